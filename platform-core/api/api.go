@@ -2,6 +2,7 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	data_trans "github.com/WeBankPartners/wecube-platform/platform-core/api/v1/data-trans"
 	"io"
@@ -17,23 +18,27 @@ import (
 	"github.com/WeBankPartners/wecube-platform/platform-core/api/v1/process"
 	"github.com/WeBankPartners/wecube-platform/platform-core/api/v1/system"
 	"github.com/WeBankPartners/wecube-platform/platform-core/common/db"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/exterror"
 	"github.com/WeBankPartners/wecube-platform/platform-core/common/log"
 	"github.com/WeBankPartners/wecube-platform/platform-core/models"
+	"github.com/WeBankPartners/wecube-platform/platform-core/services/workflow"
 	"github.com/gin-gonic/gin"
 )
 
 type handlerFuncObj struct {
-	HandlerFunc  func(c *gin.Context)
-	Method       string
-	Url          string
-	LogOperation bool
-	PreHandle    func(c *gin.Context)
-	ApiCode      string
+	HandlerFunc   func(c *gin.Context)
+	Method        string
+	Url           string
+	LogOperation  bool
+	PreHandle     func(c *gin.Context)
+	ApiCode       string
+	RejectOnDrain bool // 实例退出中拒绝的启动编排和操作实例接口
 }
 
 var (
 	httpHandlerFuncList []*handlerFuncObj
 	apiCodeMap          = make(map[string]string)
+	httpServer          *http.Server
 )
 
 func init() {
@@ -42,6 +47,7 @@ func init() {
 		&handlerFuncObj{Url: "/health-check", Method: "GET", HandlerFunc: healthCheck, ApiCode: "health"},
 		// base
 		&handlerFuncObj{Url: "/appinfo/version", Method: "GET", HandlerFunc: system.AppVersion, ApiCode: "get-version"},
+		&handlerFuncObj{Url: "/cluster/members", Method: "GET", HandlerFunc: system.ListClusterMember, ApiCode: "list-cluster-member"},
 		&handlerFuncObj{Url: "/resource-files", Method: "GET", HandlerFunc: plugin.GetPluginResourceFiles, ApiCode: "get-resource-files"},
 		// system-variable
 		&handlerFuncObj{Url: "/system-variables/retrieve", Method: "POST", HandlerFunc: system.QuerySystemVariables, ApiCode: "query-system-variables"},
@@ -49,6 +55,12 @@ func init() {
 		&handlerFuncObj{Url: "/system-variables/update", Method: "POST", HandlerFunc: system.UpdateSystemVariable, ApiCode: "update-system-variables"},
 		&handlerFuncObj{Url: "/system-variables/delete", Method: "POST", HandlerFunc: system.DeleteSystemVariable, ApiCode: "delete-system-variables"},
 		&handlerFuncObj{Url: "/system-variables/constant/system-variable-scope", Method: "GET", HandlerFunc: system.GetSystemVariableScope, ApiCode: "get-system-variable-scope"},
+		// business calendar
+		&handlerFuncObj{Url: "/business-calendars", Method: "GET", HandlerFunc: system.ListBusinessCalendar, ApiCode: "list-business-calendar"},
+		&handlerFuncObj{Url: "/business-calendars", Method: "POST", HandlerFunc: system.CreateBusinessCalendar, ApiCode: "create-business-calendar"},
+		&handlerFuncObj{Url: "/business-calendars/:calendarId", Method: "PUT", HandlerFunc: system.UpdateBusinessCalendar, ApiCode: "update-business-calendar"},
+		&handlerFuncObj{Url: "/business-calendars/:calendarId", Method: "DELETE", HandlerFunc: system.DeleteBusinessCalendar, ApiCode: "delete-business-calendar"},
+		&handlerFuncObj{Url: "/business-calendars/:calendarId/calc", Method: "POST", HandlerFunc: system.CalcBusinessCalendarTime, ApiCode: "calc-business-calendar-time"},
 		// resource
 		&handlerFuncObj{Url: "/resource/constants/resource-server-status", Method: "GET", HandlerFunc: system.GetResourceServerStatus, ApiCode: "get-resource-server-status"},
 		&handlerFuncObj{Url: "/resource/constants/resource-server-types", Method: "GET", HandlerFunc: system.GetResourceServerTypes, ApiCode: "get-resource-server-types"},
@@ -140,6 +152,9 @@ func init() {
 		// process manage
 		&handlerFuncObj{Url: "/process/definitions", Method: "POST", HandlerFunc: process.AddOrUpdateProcessDefinition, ApiCode: "add-update-process-definition"},
 		&handlerFuncObj{Url: "/process/definitions/:proc-def-id", Method: "GET", HandlerFunc: process.GetProcessDefinition, ApiCode: "get-process-definition"},
+		&handlerFuncObj{Url: "/process/definitions/:proc-def-id/lint", Method: "GET", HandlerFunc: process.LintProcessDefinition, ApiCode: "lint-process-definition"},
+		&handlerFuncObj{Url: "/process/definitions/:proc-def-id/diff/:other-id", Method: "GET", HandlerFunc: process.DiffProcessDefinition, ApiCode: "diff-process-definition"},
+		&handlerFuncObj{Url: "/process/definitions/:proc-def-id/graph", Method: "GET", HandlerFunc: process.GetProcessDefinitionGraph, ApiCode: "get-process-definition-graph"},
 		&handlerFuncObj{Url: "/process/definitions/:proc-def-id/copy/:association", Method: "POST", HandlerFunc: process.CopyProcessDefinition, ApiCode: "copy-process-definition"},
 		&handlerFuncObj{Url: "/process/definitions/list", Method: "POST", HandlerFunc: process.QueryProcessDefinitionList, ApiCode: "process-definition-list"},
 		&handlerFuncObj{Url: "/process/definitions/all", Method: "GET", HandlerFunc: process.QueryAllProcessDefinitionList, ApiCode: "process-definition-all"},
@@ -148,6 +163,11 @@ func init() {
 		&handlerFuncObj{Url: "/process/definitions/permission", Method: "POST", HandlerFunc: process.BatchUpdateProcessDefinitionPermission, ApiCode: "update-process-definition-permission"},
 		&handlerFuncObj{Url: "/process/definitions/export", Method: "POST", HandlerFunc: process.ExportProcessDefinition, ApiCode: "process-definition-export"},
 		&handlerFuncObj{Url: "/process/definitions/import", Method: "POST", HandlerFunc: process.ImportProcessDefinition, ApiCode: "import-process-definition"},
+		&handlerFuncObj{Url: "/process/definitions/export/bpmn", Method: "POST", HandlerFunc: process.ExportProcessDefinitionBpmn, ApiCode: "process-definition-export-bpmn"},
+		&handlerFuncObj{Url: "/process/definitions/import/bpmn", Method: "POST", HandlerFunc: process.ImportProcessDefinitionBpmn, ApiCode: "import-process-definition-bpmn"},
+		&handlerFuncObj{Url: "/process/definitions/export/yaml", Method: "POST", HandlerFunc: process.ExportProcessDefinitionYaml, ApiCode: "process-definition-export-yaml"},
+		&handlerFuncObj{Url: "/process/definitions/yaml/plan", Method: "POST", HandlerFunc: process.PlanProcessDefinitionYaml, ApiCode: "plan-process-definition-yaml"},
+		&handlerFuncObj{Url: "/process/definitions/yaml/apply", Method: "POST", HandlerFunc: process.ApplyProcessDefinitionYaml, ApiCode: "apply-process-definition-yaml"},
 		&handlerFuncObj{Url: "/process/definitions/deploy/:proc-def-id", Method: "POST", HandlerFunc: process.DeployProcessDefinition, ApiCode: "deploy-process-definition"},
 		&handlerFuncObj{Url: "/process/definitions/:proc-def-id/tasknodes/briefs", Method: "GET", HandlerFunc: process.GetProcDefRootTaskNode, ApiCode: "get-process-definition-root-nodes"},
 		&handlerFuncObj{Url: "/process/definitions/tasknodes", Method: "POST", HandlerFunc: process.AddOrUpdateProcDefTaskNodes, ApiCode: "add-update-process-definition-nodes"},
@@ -167,6 +187,8 @@ func init() {
 		// process runtime
 		&handlerFuncObj{Url: "/process/definitions", Method: "GET", HandlerFunc: process.ProcDefList, ApiCode: "list-process-def"},
 
+		&handlerFuncObj{Url: "/process/definitions/:proc-def-id/breakpoints", Method: "GET", HandlerFunc: process.GetProcDefBreakpoints, ApiCode: "process-def-breakpoints"},
+		&handlerFuncObj{Url: "/process/definitions/:proc-def-id/breakpoints", Method: "POST", HandlerFunc: process.SetProcDefBreakpoints, ApiCode: "process-def-breakpoints-set"},
 		&handlerFuncObj{Url: "/process/definitions/:proc-def-id/outline", Method: "GET", HandlerFunc: process.ProcDefOutline, ApiCode: "process-def-outline"},
 		&handlerFuncObj{Url: "/process/definitions/:proc-def-id/root-entities", Method: "GET", HandlerFunc: process.ProcDefRootEntities, ApiCode: "process-def-root-entity"},
 		&handlerFuncObj{Url: "/process/definitions/:proc-def-id/preview/entities/:entityDataId", Method: "GET", HandlerFunc: process.ProcDefPreview, ApiCode: "process-def-preview"},
@@ -177,22 +199,53 @@ func init() {
 		&handlerFuncObj{Url: "/process/instances/tasknodes/session/:sessionId/tasknode-bindings", Method: "GET", HandlerFunc: process.ProcInsTaskNodeBindings, ApiCode: "process-ins-binding"},
 		&handlerFuncObj{Url: "/process/instances/tasknodes/:taskNodeId/session/:sessionId/tasknode-bindings", Method: "GET", HandlerFunc: process.ProcInsTaskNodeBindings, ApiCode: "process-ins-node-binding"},
 		&handlerFuncObj{Url: "/process/instances/tasknodes/:taskNodeId/session/:sessionId/tasknode-bindings", Method: "POST", HandlerFunc: process.UpdateProcNodeBindingData, ApiCode: "update-process-ins-node-binding"},
-		&handlerFuncObj{Url: "/process/instances", Method: "POST", HandlerFunc: process.ProcInsStart, ApiCode: "process-ins-start"},
-		&handlerFuncObj{Url: "/public/process/instances", Method: "POST", HandlerFunc: process.PublicProcInsStart, ApiCode: "public-process-ins-start"},
+		&handlerFuncObj{Url: "/process/instances", Method: "POST", HandlerFunc: process.ProcInsStart, ApiCode: "process-ins-start", RejectOnDrain: true},
+		&handlerFuncObj{Url: "/public/process/instances", Method: "POST", HandlerFunc: process.PublicProcInsStart, ApiCode: "public-process-ins-start", RejectOnDrain: true},
 		&handlerFuncObj{Url: "/process/instances", Method: "GET", HandlerFunc: process.ProcInsList, ApiCode: "process-ins-list"},
 		&handlerFuncObj{Url: "/process/instances/:procInsId", Method: "GET", HandlerFunc: process.ProcInsDetail, ApiCode: "process-ins-detail"},
 		&handlerFuncObj{Url: "/process/instances/:procInsId/tasknodes/:procInsNodeId/context", Method: "GET", HandlerFunc: process.GetProcInsNodeContext, ApiCode: "process-ins-node-context"},
+		&handlerFuncObj{Url: "/process/instances/:procInsId/tasknodes/:procInsNodeId/retries", Method: "GET", HandlerFunc: process.GetProcInsNodeRetries, ApiCode: "process-ins-node-retries"},
+		&handlerFuncObj{Url: "/process/instances/:procInsId/simulation", Method: "GET", HandlerFunc: process.GetProcInsSimulation, ApiCode: "process-ins-simulation"},
+		&handlerFuncObj{Url: "/process/timers", Method: "GET", HandlerFunc: process.ListProcRunTimer, ApiCode: "process-timer-list"},
+		&handlerFuncObj{Url: "/process/timers/:timerId/fast-forward", Method: "POST", HandlerFunc: process.FastForwardProcRunTimer, ApiCode: "process-timer-fast-forward", RejectOnDrain: true},
+		&handlerFuncObj{Url: "/process/timers/:timerId/cancel", Method: "POST", HandlerFunc: process.CancelProcRunTimer, ApiCode: "process-timer-cancel", RejectOnDrain: true},
+		&handlerFuncObj{Url: "/process/queue", Method: "GET", HandlerFunc: process.ListProcInsQueue, ApiCode: "process-queue-list"},
+		&handlerFuncObj{Url: "/process/instances/:procInsId/queue/cancel", Method: "POST", HandlerFunc: process.CancelProcInsQueue, ApiCode: "process-queue-cancel", RejectOnDrain: true},
+		&handlerFuncObj{Url: "/process/entity-locks", Method: "GET", HandlerFunc: process.ListProcEntityLock, ApiCode: "process-entity-lock-list"},
+		&handlerFuncObj{Url: "/process/entity-locks/:lockId/release", Method: "POST", HandlerFunc: process.ForceReleaseProcEntityLock, ApiCode: "process-entity-lock-release", RejectOnDrain: true},
+		&handlerFuncObj{Url: "/process/instances/:procInsId/migration/preview", Method: "POST", HandlerFunc: process.PreviewProcInsMigration, ApiCode: "process-ins-migration-preview"},
+		&handlerFuncObj{Url: "/process/instances/:procInsId/migration", Method: "POST", HandlerFunc: process.MigrateProcIns, ApiCode: "process-ins-migration", RejectOnDrain: true},
+		&handlerFuncObj{Url: "/process/instances/:procInsId/migrations", Method: "GET", HandlerFunc: process.ListProcInsMigration, ApiCode: "process-ins-migration-list"},
+		&handlerFuncObj{Url: "/process/instances/:procInsId/clone", Method: "POST", HandlerFunc: process.CloneProcInstance, ApiCode: "process-ins-clone", RejectOnDrain: true},
+		&handlerFuncObj{Url: "/process/instances/:procInsId/clones", Method: "GET", HandlerFunc: process.ListProcInsClone, ApiCode: "process-ins-clone-list"},
+		&handlerFuncObj{Url: "/process/instances/:procInsId/timeline", Method: "GET", HandlerFunc: process.GetProcInsTimeline, ApiCode: "process-ins-timeline"},
+		&handlerFuncObj{Url: "/process/instances/:procInsId/timeline/export", Method: "GET", HandlerFunc: process.ExportProcInsTimeline, ApiCode: "process-ins-timeline-export"},
+		&handlerFuncObj{Url: "/process/instances/:procInsId/graph", Method: "GET", HandlerFunc: process.GetProcInsGraph, ApiCode: "process-ins-graph"},
+		&handlerFuncObj{Url: "/process/instances/:procInsId/breakpoints", Method: "GET", HandlerFunc: process.GetProcInsBreakpoints, ApiCode: "process-ins-breakpoints"},
+		&handlerFuncObj{Url: "/process/instances/:procInsId/breakpoints", Method: "POST", HandlerFunc: process.SetProcInsBreakpoints, ApiCode: "process-ins-breakpoints-set"},
+		&handlerFuncObj{Url: "/process/instances/:procInsId/breakpoints/hits", Method: "GET", HandlerFunc: process.ListProcRunBreakpoint, ApiCode: "process-ins-breakpoint-hits"},
+		&handlerFuncObj{Url: "/process/instances/:procInsId/breakpoints/hits/:breakpointId", Method: "GET", HandlerFunc: process.GetProcRunBreakpoint, ApiCode: "process-ins-breakpoint-hit-detail"},
+		&handlerFuncObj{Url: "/process/instances/:procInsId/breakpoints/hits/:breakpointId/resume", Method: "POST", HandlerFunc: process.ResumeProcRunBreakpoint, ApiCode: "process-ins-breakpoint-resume", RejectOnDrain: true},
+		&handlerFuncObj{Url: "/process/instances/:procInsId/data-cache", Method: "POST", HandlerFunc: process.UpdateProcDataCache, ApiCode: "process-ins-data-cache-update"},
+		&handlerFuncObj{Url: "/process/instances/:procInsId/approvals", Method: "GET", HandlerFunc: process.ListProcRunApproval, ApiCode: "process-ins-approvals"},
+		&handlerFuncObj{Url: "/process/instances/:procInsId/tasknodes/:procInsNodeId/approvals/vote", Method: "POST", HandlerFunc: process.VoteProcRunApproval, ApiCode: "process-ins-approval-vote", RejectOnDrain: true},
+		&handlerFuncObj{Url: "/process/instances/:procInsId/tasknodes/:procInsNodeId/approvals/delegate", Method: "POST", HandlerFunc: process.DelegateProcRunApproval, ApiCode: "process-ins-approval-delegate"},
+		&handlerFuncObj{Url: "/process/approvals/pending", Method: "GET", HandlerFunc: process.ListUserPendingApproval, ApiCode: "process-approvals-pending"},
 		&handlerFuncObj{Url: "/process/instances/:procInsId/tasknodes/:procInsNodeId/tasknode-bindings", Method: "POST", HandlerFunc: process.UpdateProcInsTaskNodeBindings, ApiCode: "process-ins-node-update-binding"},
 		&handlerFuncObj{Url: "/process/instances/:procInsId/tasknodes/:procInsNodeId/tasknode-bindings", Method: "GET", HandlerFunc: process.GetProcInsTaskNodeBindings, ApiCode: "get-process-ins-node-binding"},
 		&handlerFuncObj{Url: "/process/instances/:procInsId/tasknode-bindings", Method: "GET", HandlerFunc: process.GetInstanceTaskNodeBindings, ApiCode: "get-process-ins-binding"},
 		&handlerFuncObj{Url: "/process/instances/:procInsId/preview/entities", Method: "GET", HandlerFunc: process.GetProcInsPreview, ApiCode: "get-ins-preview"},
-		&handlerFuncObj{Url: "/public/process/instances/:procInsId/terminations", Method: "POST", HandlerFunc: process.ProcTermination, ApiCode: "process-ins-terminations"},
-		&handlerFuncObj{Url: "/public/process/instances/batch-terminations", Method: "POST", HandlerFunc: process.BatchProcTermination, ApiCode: "batch-ins-terminations"},
-		&handlerFuncObj{Url: "/process/instances/proceed", Method: "POST", HandlerFunc: process.ProcInsOperation, ApiCode: "proc-ins-operation"},
+		&handlerFuncObj{Url: "/public/process/instances/:procInsId/terminations", Method: "POST", HandlerFunc: process.ProcTermination, ApiCode: "process-ins-terminations", RejectOnDrain: true},
+		&handlerFuncObj{Url: "/public/process/instances/batch-terminations", Method: "POST", HandlerFunc: process.BatchProcTermination, ApiCode: "batch-ins-terminations", RejectOnDrain: true},
+		&handlerFuncObj{Url: "/process/instances/proceed", Method: "POST", HandlerFunc: process.ProcInsOperation, ApiCode: "proc-ins-operation", RejectOnDrain: true},
+		&handlerFuncObj{Url: "/process/instances/bulk-operations/preview", Method: "POST", HandlerFunc: process.PreviewProcInsBulk, ApiCode: "proc-ins-bulk-preview"},
+		&handlerFuncObj{Url: "/process/instances/bulk-operations", Method: "POST", HandlerFunc: process.CreateProcInsBulk, ApiCode: "proc-ins-bulk-create", RejectOnDrain: true},
+		&handlerFuncObj{Url: "/process/instances/bulk-operations", Method: "GET", HandlerFunc: process.ListProcInsBulk, ApiCode: "proc-ins-bulk-list"},
+		&handlerFuncObj{Url: "/process/instances/bulk-operations/:jobId", Method: "GET", HandlerFunc: process.GetProcInsBulk, ApiCode: "proc-ins-bulk-detail"},
 		&handlerFuncObj{Url: "/packages/:pluginPackageId/entities/:entityName/query", Method: "POST", HandlerFunc: process.ProcEntityDataQuery, ApiCode: "proc-ins-operation"},
 		&handlerFuncObj{Url: "/process/instances/callback", Method: "POST", HandlerFunc: process.ProcInstanceCallback, ApiCode: "proc-ins-callback"},
 		&handlerFuncObj{Url: "/process/instancesWithPaging", Method: "POST", HandlerFunc: process.QueryProcInsPageData, ApiCode: "proc-ins-page-data"},
-		&handlerFuncObj{Url: "/operation-events", Method: "POST", HandlerFunc: process.ProcStartEvents, ApiCode: "proc-start-events"},
+		&handlerFuncObj{Url: "/operation-events", Method: "POST", HandlerFunc: process.ProcStartEvents, ApiCode: "proc-start-events", RejectOnDrain: true},
 		&handlerFuncObj{Url: "/public/process/definitions/:proc-def-id/options/:proc-node-def-id", Method: "GET", HandlerFunc: process.GetProcNodeAllowOptions, ApiCode: "get-proc-node-options"},
 		&handlerFuncObj{Url: "/process/instances/node-message/:procInsNodeId/time", Method: "GET", HandlerFunc: process.GetProcNodeEndTime, ApiCode: "get-process-ins-node-time"},
 		&handlerFuncObj{Url: "/process/instances/node-message/:procInsNodeId/choose", Method: "GET", HandlerFunc: process.GetProcNodeNextChoose, ApiCode: "get-process-ins-node-choose"},
@@ -261,7 +314,8 @@ func init() {
 	)
 }
 
-func InitHttpServer() {
+// InitHttpServer 启动http服务,阻塞直到服务关闭,监听失败时返回错误
+func InitHttpServer() (err error) {
 	middleware.InitHttpError()
 	r := gin.New()
 	// access log
@@ -279,6 +333,9 @@ func InitHttpServer() {
 		if funcObj.PreHandle != nil {
 			handleFuncList = append([]gin.HandlerFunc{funcObj.PreHandle}, funcObj.HandlerFunc)
 		}
+		if funcObj.RejectOnDrain {
+			handleFuncList = append([]gin.HandlerFunc{drainHandle}, handleFuncList...)
+		}
 		switch funcObj.Method {
 		case "GET":
 			authRouter.GET(funcObj.Url, handleFuncList...)
@@ -293,7 +350,33 @@ func InitHttpServer() {
 	r.GET(models.UrlPrefix+"/v1/route-items", system.GetRouteItems)
 	r.GET(models.UrlPrefix+"/v1/route-items/:name", system.GetRouteItems)
 	r.POST(models.UrlPrefix+"/entities/role/query", plugin.QueryRoleEntity)
-	r.Run(":" + models.Config.HttpServer.Port)
+	httpServer = &http.Server{Addr: ":" + models.Config.HttpServer.Port, Handler: r}
+	if err = httpServer.ListenAndServe(); err != nil {
+		if err == http.ErrServerClosed {
+			return nil
+		}
+		log.Logger.Error("http server listen fail", log.Error(err))
+	}
+	return
+}
+
+// ShutdownHttpServer 停止接收新连接并等待处理中的请求完成
+func ShutdownHttpServer(ctx context.Context) {
+	if httpServer == nil {
+		return
+	}
+	if err := httpServer.Shutdown(ctx); err != nil {
+		log.Logger.Error("shutdown http server fail", log.Error(err))
+	}
+}
+
+func drainHandle(c *gin.Context) {
+	if workflow.IsDraining() {
+		middleware.ReturnError(c, exterror.New().ServerDrainingError)
+		c.Abort()
+		return
+	}
+	c.Next()
 }
 
 func httpLogHandle() gin.HandlerFunc {
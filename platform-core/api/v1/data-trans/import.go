@@ -535,6 +535,9 @@ func StartExecWorkflowCron() {
 }
 
 func doExecWorkflowDaemonJob() {
+	if workflow.IsDraining() {
+		return
+	}
 	transactionId := fmt.Sprintf("import_exec_job_%d", time.Now().Unix())
 	ctx := db.NewDBCtx(transactionId)
 	procExecList, err := database.GetTransImportProcExecList(ctx)
@@ -567,7 +570,7 @@ func doExecWorkflowDaemonJob() {
 					if v.ProcInsStatus == models.JobStatusKill {
 						v.ProcInsStatus = models.JobStatusFail
 					}
-					if v.ProcInsStatus == models.WorkflowStatusStop {
+					if v.ProcInsStatus == models.WorkflowStatusStop || v.ProcInsStatus == models.JobStatusQueued {
 						v.ProcInsStatus = models.JobStatusRunning
 					}
 					if v.Status != v.ProcInsStatus {
@@ -657,7 +660,10 @@ func startExecWorkflow(ctx context.Context, procExecRow *models.TransImportProcE
 		return
 	}
 	retProcInsId = procInsId
-	// 初始化workflow并开始
+	// 初始化workflow并开始,排队中的实例由排队任务启动
+	if workflowRow.Status == models.JobStatusQueued {
+		return
+	}
 	workObj := workflow.Workflow{ProcRunWorkflow: *workflowRow}
 	workObj.Init(context.Background(), workNodes, workLinks)
 	go workObj.Start(&models.ProcOperation{CreatedBy: procExecRow.CreatedUser})
@@ -14,6 +14,8 @@ import (
 	"github.com/WeBankPartners/wecube-platform/platform-core/services/remote"
 	"github.com/WeBankPartners/wecube-platform/platform-core/services/workflow"
 	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -406,11 +408,13 @@ func ProcInsStart(c *gin.Context) {
 		middleware.ReturnError(c, err)
 		return
 	}
-	// 初始化workflow并开始
-	workObj := workflow.Workflow{ProcRunWorkflow: *workflowRow}
-	workObj.Init(context.Background(), workNodes, workLinks)
-	//workflow.GlobalWorkflowMap.Store(workObj.Id, &workObj)
-	go workObj.Start(&models.ProcOperation{CreatedBy: operator})
+	// 初始化workflow并开始,排队中的实例由排队任务启动
+	if workflowRow.Status != models.JobStatusQueued {
+		workObj := workflow.Workflow{ProcRunWorkflow: *workflowRow}
+		workObj.Init(context.Background(), workNodes, workLinks)
+		//workflow.GlobalWorkflowMap.Store(workObj.Id, &workObj)
+		go workObj.Start(&models.ProcOperation{CreatedBy: operator})
+	}
 	// 查询 detail 返回
 	detail, queryErr := database.GetProcInstance(c, procInsId)
 	if queryErr != nil {
@@ -420,6 +424,55 @@ func ProcInsStart(c *gin.Context) {
 	}
 }
 
+// CloneProcInstance 从源实例的指定节点重新运行为新实例
+func CloneProcInstance(c *gin.Context) {
+	procInsId := c.Param("procInsId")
+	var param models.ProcInsCloneParam
+	if err := c.ShouldBindJSON(&param); err != nil {
+		middleware.ReturnError(c, exterror.Catch(exterror.New().RequestParamValidateError, err))
+		return
+	}
+	if param.ProcInsNodeId == "" {
+		middleware.ReturnError(c, exterror.Catch(exterror.New().RequestParamValidateError, fmt.Errorf("procInsNodeId can not empty")))
+		return
+	}
+	if !checkProcInsDataPermission(c, procInsId) {
+		return
+	}
+	operator := middleware.GetRequestUser(c)
+	cloneRow, workflowRow, workNodes, workLinks, err := database.CloneProcInstance(c, procInsId, &param, operator)
+	if err != nil {
+		middleware.ReturnError(c, err)
+		return
+	}
+	// 初始化workflow并开始,排队中的实例由排队任务启动
+	if workflowRow.Status != models.JobStatusQueued {
+		workObj := workflow.Workflow{ProcRunWorkflow: *workflowRow}
+		workObj.Init(context.Background(), workNodes, workLinks)
+		go workObj.Start(&models.ProcOperation{CreatedBy: operator})
+	}
+	detail, queryErr := database.GetProcInstance(c, cloneRow.ProcInsId)
+	if queryErr != nil {
+		middleware.ReturnError(c, queryErr)
+	} else {
+		middleware.ReturnData(c, detail)
+	}
+}
+
+// ListProcInsClone 查实例的重新运行纪录
+func ListProcInsClone(c *gin.Context) {
+	procInsId := c.Param("procInsId")
+	if !checkProcInsDataPermission(c, procInsId) {
+		return
+	}
+	result, err := database.ListProcInsClone(c, procInsId)
+	if err != nil {
+		middleware.ReturnError(c, err)
+	} else {
+		middleware.ReturnData(c, result)
+	}
+}
+
 func ProcInsList(c *gin.Context) {
 	withCronIns := strings.ToLower(c.Query("withCronIns"))
 	withSubProc := strings.ToLower(c.Query("withSubProc"))
@@ -473,11 +526,13 @@ func PublicProcInsStart(c *gin.Context) {
 		middleware.ReturnError(c, err)
 		return
 	}
-	// 初始化workflow并开始
-	workObj := workflow.Workflow{ProcRunWorkflow: *workflowRow}
-	workObj.Init(context.Background(), workNodes, workLinks)
-	//workflow.GlobalWorkflowMap.Store(workObj.Id, &workObj)
-	go workObj.Start(&models.ProcOperation{CreatedBy: operator})
+	// 初始化workflow并开始,排队中的实例由排队任务启动
+	if workflowRow.Status != models.JobStatusQueued {
+		workObj := workflow.Workflow{ProcRunWorkflow: *workflowRow}
+		workObj.Init(context.Background(), workNodes, workLinks)
+		//workflow.GlobalWorkflowMap.Store(workObj.Id, &workObj)
+		go workObj.Start(&models.ProcOperation{CreatedBy: operator})
+	}
 	// 查询 detail 返回
 	detail, queryErr := database.GetProcInstance(c, procInsId)
 	if queryErr != nil {
@@ -536,8 +591,8 @@ func ProcInsOperation(c *gin.Context) {
 			return
 		}
 		go workflow.HandleProOperation(&operationObj)
-		if nodeObj.NodeType == models.JobSubProcType {
-			killSubProc(c, param.ProcInstId, param.NodeInstId, middleware.GetRequestUser(c))
+		if nodeObj.NodeType == models.JobSubProcType || nodeObj.NodeType == models.JobLoopType {
+			workflow.KillSubProc(c, param.ProcInstId, param.NodeInstId, middleware.GetRequestUser(c))
 		}
 	} else if param.Act == "choose" {
 		if procInsObj.Status != models.JobStatusRunning {
@@ -584,6 +639,21 @@ func ProcInsOperation(c *gin.Context) {
 		}
 		go workflow.HandleProOperation(&operationObj)
 		time.Sleep(2500 * time.Millisecond)
+	} else if param.Act == "rollback" {
+		if procInsObj.Status != models.JobStatusRunning && procInsObj.Status != models.JobStatusFail && procInsObj.Status != models.JobStatusKill {
+			middleware.ReturnError(c, exterror.New().ProcStatusOperationError)
+			return
+		}
+		operationObj := models.ProcRunOperation{WorkflowId: workflowId, Operation: "rollback", Status: "wait", Message: param.Message, CreatedBy: middleware.GetRequestUser(c)}
+		operationObj.Id, err = database.AddWorkflowOperation(c, &operationObj)
+		if err != nil {
+			middleware.ReturnError(c, err)
+			return
+		}
+		go workflow.HandleProOperation(&operationObj)
+		if procInsObj.Status == models.JobStatusRunning {
+			workflow.KillSubProc(c, procInsObj.Id, "", middleware.GetRequestUser(c))
+		}
 	} else if param.Act == "retry" {
 		if procInsObj.Status != models.JobStatusRunning {
 			middleware.ReturnError(c, exterror.New().ProcStatusOperationError)
@@ -593,8 +663,8 @@ func ProcInsOperation(c *gin.Context) {
 		if nodeObj.Status == models.JobStatusRisky {
 			operation = "confirm"
 		} else {
-			if nodeObj.NodeType == models.JobSubProcType {
-				killSubProc(c, procInsObj.Id, nodeObj.ProcInsId, middleware.GetRequestUser(c))
+			if nodeObj.NodeType == models.JobSubProcType || nodeObj.NodeType == models.JobLoopType {
+				workflow.KillSubProc(c, procInsObj.Id, nodeObj.ProcInsId, middleware.GetRequestUser(c))
 			}
 		}
 		operationObj := models.ProcRunOperation{WorkflowId: workflowId, NodeId: nodeId, Operation: operation, Status: "wait", CreatedBy: middleware.GetRequestUser(c)}
@@ -759,6 +829,15 @@ func ProcTermination(c *gin.Context) {
 		//middleware.ReturnError(c, fmt.Errorf("procIns:%s[%s] status is %s ,can not termination", procInsObj.ProcDefName, procInsObj.Id, procInsObj.Status))
 		return
 	}
+	// 排队中的实例还没启动,直接取消排队
+	if procInsObj.Status == models.JobStatusQueued {
+		if err := database.CancelProcInsQueue(c, procInsId, middleware.GetRequestUser(c)); err != nil {
+			middleware.ReturnError(c, err)
+		} else {
+			middleware.ReturnSuccess(c)
+		}
+		return
+	}
 	workflowId, _, err := database.GetProcWorkByInsId(c, procInsId, "")
 	if err != nil {
 		middleware.ReturnError(c, err)
@@ -771,7 +850,7 @@ func ProcTermination(c *gin.Context) {
 		return
 	}
 	go workflow.HandleProOperation(&operationObj)
-	killSubProc(c, procInsId, "", middleware.GetRequestUser(c))
+	workflow.KillSubProc(c, procInsId, "", middleware.GetRequestUser(c))
 	time.Sleep(2500 * time.Millisecond)
 	middleware.ReturnSuccess(c)
 }
@@ -802,8 +881,16 @@ func BatchProcTermination(c *gin.Context) {
 			//middleware.ReturnError(c, fmt.Errorf("procIns:%s[%s] status is %s ,can not termination", procInsObj.ProcDefName, procInsObj.Id, procInsObj.Status))
 			return
 		}
+		procInsParam.Status = procInsObj.Status
 	}
 	for _, procInsParam := range procInsList {
+		if procInsParam.Status == models.JobStatusQueued {
+			if err := database.CancelProcInsQueue(c, procInsParam.Id, middleware.GetRequestUser(c)); err != nil {
+				middleware.ReturnError(c, err)
+				return
+			}
+			continue
+		}
 		workflowId, _, err := database.GetProcWorkByInsId(c, procInsParam.Id, "")
 		if err != nil {
 			middleware.ReturnError(c, err)
@@ -816,33 +903,73 @@ func BatchProcTermination(c *gin.Context) {
 			return
 		}
 		go workflow.HandleProOperation(&operationObj)
-		killSubProc(c, procInsParam.Id, "", middleware.GetRequestUser(c))
+		workflow.KillSubProc(c, procInsParam.Id, "", middleware.GetRequestUser(c))
 	}
 	time.Sleep(2500 * time.Millisecond)
 	middleware.ReturnSuccess(c)
 }
 
-func killSubProc(ctx context.Context, mainProcInsId, procNodeId, operator string) {
-	var err error
-	var subWorkflowIdList []string
-	subWorkflowIdList, err = database.GetRunningProcInsSubWorkflow(ctx, mainProcInsId, procNodeId)
+// PreviewProcInsBulk 查批量操作会作用到的实例(节点),不执行
+func PreviewProcInsBulk(c *gin.Context) {
+	var param models.ProcInsBulkParam
+	if err := c.ShouldBindJSON(&param); err != nil {
+		middleware.ReturnError(c, exterror.Catch(exterror.New().RequestParamValidateError, err))
+		return
+	}
+	if err := param.Validate(); err != nil {
+		middleware.ReturnError(c, exterror.New().ProcInsBulkError.WithParam(err.Error()))
+		return
+	}
+	result, err := database.ListProcInsBulkTarget(c, &param, middleware.GetRequestRoles(c))
 	if err != nil {
-		log.Logger.Error("Try to kill sub proc fail with query sub workflow list", log.String("mainProcIns", mainProcInsId), log.Error(err))
+		middleware.ReturnError(c, err)
+	} else {
+		middleware.ReturnData(c, result)
+	}
+}
+
+// CreateProcInsBulk 按筛选条件对一批实例执行重试、跳过高危节点、审批、暂停或继续,异步执行,返回任务用于查询进度
+func CreateProcInsBulk(c *gin.Context) {
+	var param models.ProcInsBulkParam
+	if err := c.ShouldBindJSON(&param); err != nil {
+		middleware.ReturnError(c, exterror.Catch(exterror.New().RequestParamValidateError, err))
 		return
 	}
-	if len(subWorkflowIdList) == 0 {
+	if err := param.Validate(); err != nil {
+		middleware.ReturnError(c, exterror.New().ProcInsBulkError.WithParam(err.Error()))
 		return
 	}
-	for _, subWorkflowId := range subWorkflowIdList {
-		subOperationObj := models.ProcRunOperation{WorkflowId: subWorkflowId, Operation: "kill", Status: "wait", CreatedBy: operator}
-		subOperationObj.Id, err = database.AddWorkflowOperation(ctx, &subOperationObj)
-		if err != nil {
-			log.Logger.Error("Try to kill sub proc fail", log.String("mainProcIns", mainProcInsId), log.String("subWorkflowId", subWorkflowId), log.Error(err))
-		} else {
-			go workflow.HandleProOperation(&subOperationObj)
-		}
+	targets, err := database.ListProcInsBulkTarget(c, &param, middleware.GetRequestRoles(c))
+	if err != nil {
+		middleware.ReturnError(c, err)
+		return
+	}
+	job, err := database.CreateProcInsBulkJob(c, &param, targets, middleware.GetRequestUser(c), middleware.GetRequestRoles(c))
+	if err != nil {
+		middleware.ReturnError(c, err)
+		return
+	}
+	go workflow.RunProcInsBulkJob(job)
+	middleware.ReturnData(c, job)
+}
+
+func ListProcInsBulk(c *gin.Context) {
+	result, err := database.ListProcInsBulkJob(c, c.Query("createdBy"))
+	if err != nil {
+		middleware.ReturnError(c, err)
+	} else {
+		middleware.ReturnData(c, result)
+	}
+}
+
+// GetProcInsBulk 查批量任务进度和每个实例的结果
+func GetProcInsBulk(c *gin.Context) {
+	result, err := database.GetProcInsBulkDetail(c, c.Param("jobId"), c.Query("status"))
+	if err != nil {
+		middleware.ReturnError(c, err)
+	} else {
+		middleware.ReturnData(c, result)
 	}
-	return
 }
 
 func ProcStartEvents(c *gin.Context) {
@@ -851,6 +978,20 @@ func ProcStartEvents(c *gin.Context) {
 		middleware.ReturnError(c, exterror.Catch(exterror.New().RequestParamValidateError, err))
 		return
 	}
+	// 带关联键的事件用于恢复等待信号节点
+	if param.CorrelationKey != "" {
+		if param.EventType == "" {
+			middleware.ReturnError(c, exterror.Catch(exterror.New().RequestParamValidateError, fmt.Errorf("eventType can not empty")))
+			return
+		}
+		result, deliverErr := workflow.DeliverSignalEvent(c, &param)
+		if deliverErr != nil {
+			middleware.ReturnError(c, deliverErr)
+		} else {
+			middleware.ReturnData(c, result)
+		}
+		return
+	}
 	procDef, err := database.GetLatestProcDefByKey(c, param.OperationKey)
 	if err != nil {
 		middleware.ReturnError(c, err)
@@ -886,6 +1027,198 @@ func GetProcNodeEndTime(c *gin.Context) {
 	}
 }
 
+func GetProcInsNodeRetries(c *gin.Context) {
+	procInsNodeId := c.Param("procInsNodeId")
+	result, err := database.GetProcInsNodeRetryList(c, procInsNodeId)
+	if err != nil {
+		middleware.ReturnError(c, err)
+	} else {
+		middleware.ReturnData(c, result)
+	}
+}
+
+// GetProcInsSimulation 查模拟运行的节点路径和本应发出的请求
+func GetProcInsSimulation(c *gin.Context) {
+	procInsId := c.Param("procInsId")
+	result, err := database.GetProcInsSimulationResult(c, procInsId)
+	if err != nil {
+		middleware.ReturnError(c, err)
+	} else {
+		middleware.ReturnData(c, result)
+	}
+}
+
+// ListProcRunTimer 查定时器列表
+func ListProcRunTimer(c *gin.Context) {
+	result, err := database.ListProcRunTimer(c, c.Query("procInsId"), c.Query("status"))
+	if err != nil {
+		middleware.ReturnError(c, err)
+	} else {
+		middleware.ReturnData(c, result)
+	}
+}
+
+// FastForwardProcRunTimer 快进定时器,立即触发
+func FastForwardProcRunTimer(c *gin.Context) {
+	result, err := database.UpdateProcRunTimer(c, c.Param("timerId"), "fast-forward", middleware.GetRequestUser(c))
+	if err != nil {
+		middleware.ReturnError(c, err)
+	} else {
+		middleware.ReturnData(c, result)
+	}
+}
+
+// CancelProcRunTimer 取消定时器,等待该定时器的时间节点置为失败,可重试或跳过
+func CancelProcRunTimer(c *gin.Context) {
+	operator := middleware.GetRequestUser(c)
+	result, err := database.UpdateProcRunTimer(c, c.Param("timerId"), "cancel", operator)
+	if err != nil {
+		middleware.ReturnError(c, err)
+		return
+	}
+	workflow.NotifyTimer(c, result.WorkflowId, result.ProcRunNodeId, operator)
+	middleware.ReturnData(c, result)
+}
+
+// ListProcInsQueue 查排队中的实例列表
+func ListProcInsQueue(c *gin.Context) {
+	result, err := database.ListProcInsQueue(c, c.Query("procDefKey"))
+	if err != nil {
+		middleware.ReturnError(c, err)
+	} else {
+		middleware.ReturnData(c, result)
+	}
+}
+
+// ListProcEntityLock 查数据锁列表
+func ListProcEntityLock(c *gin.Context) {
+	result, err := database.ListProcEntityLock(c, c.Query("entityTypeId"), c.Query("entityDataId"), c.Query("procInsId"), c.Query("procDefKey"))
+	if err != nil {
+		middleware.ReturnError(c, err)
+	} else {
+		middleware.ReturnData(c, result)
+	}
+}
+
+// ForceReleaseProcEntityLock 强制释放数据锁
+func ForceReleaseProcEntityLock(c *gin.Context) {
+	lockId, parseErr := strconv.ParseInt(c.Param("lockId"), 10, 64)
+	if parseErr != nil {
+		middleware.ReturnError(c, exterror.Catch(exterror.New().RequestParamValidateError, parseErr))
+		return
+	}
+	if err := database.ForceReleaseProcEntityLock(c, lockId, middleware.GetRequestUser(c)); err != nil {
+		middleware.ReturnError(c, err)
+	} else {
+		middleware.ReturnSuccess(c)
+	}
+}
+
+// CancelProcInsQueue 取消排队中的实例
+func CancelProcInsQueue(c *gin.Context) {
+	procInsId := c.Param("procInsId")
+	permissionLegal, checkPermissionErr := database.CheckProcInsUserPermission(c, middleware.GetRequestRoles(c), procInsId)
+	if checkPermissionErr != nil {
+		middleware.ReturnError(c, checkPermissionErr)
+		return
+	}
+	if !permissionLegal {
+		middleware.ReturnError(c, exterror.New().DataPermissionDeny)
+		return
+	}
+	if err := database.CancelProcInsQueue(c, procInsId, middleware.GetRequestUser(c)); err != nil {
+		middleware.ReturnError(c, err)
+	} else {
+		middleware.ReturnSuccess(c)
+	}
+}
+
+// PreviewProcInsMigration 试运行实例迁移,返回节点映射报告
+func PreviewProcInsMigration(c *gin.Context) {
+	procInsId := c.Param("procInsId")
+	var param models.ProcInsMigrationParam
+	if err := c.ShouldBindJSON(&param); err != nil {
+		middleware.ReturnError(c, exterror.Catch(exterror.New().RequestParamValidateError, err))
+		return
+	}
+	if param.TargetProcDefId == "" {
+		middleware.ReturnError(c, exterror.Catch(exterror.New().RequestParamValidateError, fmt.Errorf("targetProcDefId can not empty")))
+		return
+	}
+	report, err := database.PreviewProcInsMigration(c, procInsId, &param)
+	if err != nil {
+		middleware.ReturnError(c, err)
+	} else {
+		middleware.ReturnData(c, report)
+	}
+}
+
+// MigrateProcIns 把运行中的实例迁移到同一编排的新版本,由工作流退出内存后执行
+func MigrateProcIns(c *gin.Context) {
+	procInsId := c.Param("procInsId")
+	var param models.ProcInsMigrationParam
+	if err := c.ShouldBindJSON(&param); err != nil {
+		middleware.ReturnError(c, exterror.Catch(exterror.New().RequestParamValidateError, err))
+		return
+	}
+	if param.TargetProcDefId == "" {
+		middleware.ReturnError(c, exterror.Catch(exterror.New().RequestParamValidateError, fmt.Errorf("targetProcDefId can not empty")))
+		return
+	}
+	permissionLegal, checkPermissionErr := database.CheckProcInsUserPermission(c, middleware.GetRequestRoles(c), procInsId)
+	if checkPermissionErr != nil {
+		middleware.ReturnError(c, checkPermissionErr)
+		return
+	}
+	if !permissionLegal {
+		middleware.ReturnError(c, exterror.New().DataPermissionDeny)
+		return
+	}
+	report, err := database.PreviewProcInsMigration(c, procInsId, &param)
+	if err != nil {
+		middleware.ReturnError(c, err)
+		return
+	}
+	if !report.Legal {
+		middleware.ReturnError(c, exterror.New().ProcInsMigrationError.WithParam(strings.Join(report.Errors, ";")))
+		return
+	}
+	operator := middleware.GetRequestUser(c)
+	migrationRow, err := database.CreateProcInsMigration(c, procInsId, &param, report, operator)
+	if err != nil {
+		middleware.ReturnError(c, err)
+		return
+	}
+	operationObj := models.ProcRunOperation{WorkflowId: migrationRow.WorkflowId, Operation: "migrate", Status: "wait", CreatedBy: operator, Message: migrationRow.Id}
+	operationObj.Id, err = database.AddWorkflowOperation(c, &operationObj)
+	if err != nil {
+		middleware.ReturnError(c, err)
+		return
+	}
+	go workflow.HandleProOperation(&operationObj)
+	// 等待工作流处理迁移,超时返回等待中的纪录,可通过迁移纪录查结果
+	for i := 0; i < 10; i++ {
+		time.Sleep(1 * time.Second)
+		if latestRow, getErr := database.GetProcInsMigration(c, migrationRow.Id); getErr == nil {
+			migrationRow = latestRow
+			if migrationRow.Status != models.ProcInsMigrationStatusWait {
+				break
+			}
+		}
+	}
+	middleware.ReturnData(c, migrationRow)
+}
+
+// ListProcInsMigration 查实例迁移纪录
+func ListProcInsMigration(c *gin.Context) {
+	result, err := database.ListProcInsMigration(c, c.Param("procInsId"))
+	if err != nil {
+		middleware.ReturnError(c, err)
+	} else {
+		middleware.ReturnData(c, result)
+	}
+}
+
 func GetProcNodeNextChoose(c *gin.Context) {
 	procInsNodeId := c.Param("procInsNodeId")
 	result, err := database.GetProcNodeNextChoose(c, procInsNodeId)
@@ -931,3 +1264,328 @@ func SubProcDefList(c *gin.Context) {
 	}
 	middleware.ReturnData(c, result)
 }
+
+// GetProcInsTimeline 分页查实例时间线,按发生顺序排列
+func GetProcInsTimeline(c *gin.Context) {
+	procInsId := c.Param("procInsId")
+	if !checkProcInsDataPermission(c, procInsId) {
+		return
+	}
+	pageInfo := models.PageInfo{StartIndex: 0, PageSize: 100}
+	if startIndex := c.Query("startIndex"); startIndex != "" {
+		pageInfo.StartIndex, _ = strconv.Atoi(startIndex)
+	}
+	if pageSize := c.Query("pageSize"); pageSize != "" {
+		pageInfo.PageSize, _ = strconv.Atoi(pageSize)
+	}
+	if pageInfo.StartIndex < 0 || pageInfo.PageSize <= 0 {
+		middleware.ReturnError(c, exterror.Catch(exterror.New().RequestParamValidateError, fmt.Errorf("startIndex or pageSize illegal")))
+		return
+	}
+	// 完整时间线走导出接口,分页查询限制每页行数
+	if pageInfo.PageSize > models.TimelinePageMaxSize {
+		pageInfo.PageSize = models.TimelinePageMaxSize
+	}
+	result, err := database.QueryProcInsTimeline(c, procInsId, c.Query("eventType"), c.Query("procInsNodeId"), &pageInfo)
+	if err != nil {
+		middleware.ReturnError(c, err)
+	} else {
+		middleware.ReturnPageData(c, *result.PageInfo, result.Contents)
+	}
+}
+
+// ExportProcInsTimeline 按json lines导出实例完整时间线,一行一个事件
+func ExportProcInsTimeline(c *gin.Context) {
+	procInsId := c.Param("procInsId")
+	if !checkProcInsDataPermission(c, procInsId) {
+		return
+	}
+	// 拿到第一页后才写响应头,之前出错还能按正常的错误格式返回
+	headerWritten := false
+	writeHeader := func() {
+		c.Writer.Header().Add("Content-Disposition", fmt.Sprintf("attachment; filename=timeline-%s-%s.jsonl", procInsId, time.Now().Format("20060102150405")))
+		c.Writer.Header().Set("Content-Type", "application/x-ndjson")
+		c.Writer.WriteHeader(http.StatusOK)
+		headerWritten = true
+	}
+	err := database.ExportProcInsTimeline(c, procInsId, func(rows []*models.ProcInsTimeline) error {
+		if !headerWritten {
+			writeHeader()
+		}
+		for _, row := range rows {
+			b, _ := json.Marshal(row)
+			if _, writeErr := c.Writer.Write(append(b, '\n')); writeErr != nil {
+				return writeErr
+			}
+		}
+		c.Writer.Flush()
+		return nil
+	})
+	if err != nil {
+		if !headerWritten {
+			middleware.ReturnError(c, err)
+		} else {
+			log.Logger.Error("export proc ins timeline interrupted", log.String("procInsId", procInsId), log.Error(err))
+		}
+		return
+	}
+	if !headerWritten {
+		writeHeader()
+	}
+}
+
+// GetProcInsGraph 实例图渲染成svg、dot或mermaid,节点按运行状态着色
+func GetProcInsGraph(c *gin.Context) {
+	procInsId := c.Param("procInsId")
+	if !checkProcInsDataPermission(c, procInsId) {
+		return
+	}
+	procIns, err := database.GetSimpleProcInsRow(c, procInsId)
+	if err != nil {
+		middleware.ReturnError(c, err)
+		return
+	}
+	graph, err := getProcDefGraph(c, procIns.ProcDefId, fmt.Sprintf("%s %s %s", procIns.ProcDefName, procIns.EntityDataName, procIns.Status))
+	if err != nil {
+		middleware.ReturnError(c, err)
+		return
+	}
+	statusMap, err := database.GetProcInsNodeRunStatus(c, procInsId)
+	if err != nil {
+		middleware.ReturnError(c, err)
+		return
+	}
+	graph.SetNodeStatus(statusMap)
+	returnProcGraph(c, graph)
+}
+
+// GetProcDefBreakpoints 查编排定义上的断点
+func GetProcDefBreakpoints(c *gin.Context) {
+	result, err := database.ListProcBreakpoint(c, c.Param("proc-def-id"), "")
+	if err != nil {
+		middleware.ReturnError(c, err)
+	} else {
+		middleware.ReturnData(c, result)
+	}
+}
+
+// SetProcDefBreakpoints 设置编排定义上的断点,覆盖原有断点,传空列表表示清空
+func SetProcDefBreakpoints(c *gin.Context) {
+	var param models.ProcBreakpointParam
+	if err := c.ShouldBindJSON(&param); err != nil {
+		middleware.ReturnError(c, exterror.Catch(exterror.New().RequestParamValidateError, err))
+		return
+	}
+	procDef, err := database.GetProcessDefinition(c, c.Param("proc-def-id"))
+	if err != nil {
+		middleware.ReturnError(c, err)
+		return
+	}
+	if err = CheckPermission(procDef, middleware.GetRequestUser(c)); err != nil {
+		middleware.ReturnError(c, err)
+		return
+	}
+	if err = database.SetProcDefBreakpoints(c, procDef.Id, param.NodeIds, middleware.GetRequestUser(c)); err != nil {
+		middleware.ReturnError(c, err)
+	} else {
+		middleware.ReturnSuccess(c)
+	}
+}
+
+// GetProcInsBreakpoints 查实例生效的断点,包含所属编排定义上的断点
+func GetProcInsBreakpoints(c *gin.Context) {
+	procInsId := c.Param("procInsId")
+	if !checkProcInsDataPermission(c, procInsId) {
+		return
+	}
+	procIns, err := database.GetSimpleProcInsRow(c, procInsId)
+	if err != nil {
+		middleware.ReturnError(c, err)
+		return
+	}
+	result, err := database.ListProcBreakpoint(c, procIns.ProcDefId, procInsId)
+	if err != nil {
+		middleware.ReturnError(c, err)
+	} else {
+		middleware.ReturnData(c, result)
+	}
+}
+
+// SetProcInsBreakpoints 设置实例上的断点,覆盖实例原有断点,*表示单步执行
+func SetProcInsBreakpoints(c *gin.Context) {
+	procInsId := c.Param("procInsId")
+	var param models.ProcBreakpointParam
+	if err := c.ShouldBindJSON(&param); err != nil {
+		middleware.ReturnError(c, exterror.Catch(exterror.New().RequestParamValidateError, err))
+		return
+	}
+	if !checkProcInsDataPermission(c, procInsId) {
+		return
+	}
+	if err := database.SetProcInsBreakpoints(c, procInsId, param.NodeIds, middleware.GetRequestUser(c)); err != nil {
+		middleware.ReturnError(c, err)
+	} else {
+		middleware.ReturnSuccess(c)
+	}
+}
+
+// ListProcRunBreakpoint 查实例命中断点的纪录,可按状态过滤
+func ListProcRunBreakpoint(c *gin.Context) {
+	procInsId := c.Param("procInsId")
+	if !checkProcInsDataPermission(c, procInsId) {
+		return
+	}
+	result, err := database.ListProcRunBreakpoint(c, procInsId, c.Query("status"))
+	if err != nil {
+		middleware.ReturnError(c, err)
+	} else {
+		middleware.ReturnData(c, result)
+	}
+}
+
+// GetProcRunBreakpoint 断点详情,包含解析后的节点入参和实例数据缓存
+func GetProcRunBreakpoint(c *gin.Context) {
+	procInsId := c.Param("procInsId")
+	if !checkProcInsDataPermission(c, procInsId) {
+		return
+	}
+	hitRow, err := getProcInsRunBreakpoint(c, procInsId, c.Param("breakpointId"))
+	if err != nil {
+		middleware.ReturnError(c, err)
+		return
+	}
+	result := models.ProcRunBreakpointDetail{Breakpoint: hitRow, Inputs: []map[string]interface{}{}}
+	if hitRow.Status == models.BreakpointHitStatusWait {
+		// 入参解析依赖插件和数据查询,失败时只返回原因,不影响查看数据缓存和放行
+		if result.Inputs, err = execution.PreviewWorkflowNodeInput(c, hitRow.ProcRunNodeId); err != nil {
+			result.InputError = err.Error()
+		}
+	}
+	if result.DataCache, err = database.GetProcCacheData(c, procInsId); err != nil {
+		middleware.ReturnError(c, err)
+		return
+	}
+	middleware.ReturnData(c, result)
+}
+
+// ResumeProcRunBreakpoint 单步或继续暂停在断点的节点,可以同时修改节点入参
+func ResumeProcRunBreakpoint(c *gin.Context) {
+	procInsId := c.Param("procInsId")
+	var param models.ProcRunBreakpointResumeParam
+	if err := c.ShouldBindJSON(&param); err != nil {
+		middleware.ReturnError(c, exterror.Catch(exterror.New().RequestParamValidateError, err))
+		return
+	}
+	if !checkProcInsDataPermission(c, procInsId) {
+		return
+	}
+	if _, err := getProcInsRunBreakpoint(c, procInsId, c.Param("breakpointId")); err != nil {
+		middleware.ReturnError(c, err)
+		return
+	}
+	operator := middleware.GetRequestUser(c)
+	result, err := database.ResumeProcRunBreakpoint(c, c.Param("breakpointId"), &param, operator)
+	if err != nil {
+		middleware.ReturnError(c, err)
+		return
+	}
+	workflow.NotifyBreakpoint(c, result.WorkflowId, result.ProcRunNodeId, operator)
+	middleware.ReturnData(c, result)
+}
+
+// UpdateProcDataCache 实例暂停在断点时修改数据缓存的值
+func UpdateProcDataCache(c *gin.Context) {
+	procInsId := c.Param("procInsId")
+	var param models.ProcDataCacheUpdateParam
+	if err := c.ShouldBindJSON(&param); err != nil {
+		middleware.ReturnError(c, exterror.Catch(exterror.New().RequestParamValidateError, err))
+		return
+	}
+	if !checkProcInsDataPermission(c, procInsId) {
+		return
+	}
+	if err := database.UpdateProcDataCache(c, procInsId, &param); err != nil {
+		middleware.ReturnError(c, err)
+	} else {
+		middleware.ReturnSuccess(c)
+	}
+}
+
+// ListProcRunApproval 实例的审批票,可按节点和状态过滤
+func ListProcRunApproval(c *gin.Context) {
+	procInsId := c.Param("procInsId")
+	if !checkProcInsDataPermission(c, procInsId) {
+		return
+	}
+	result, err := database.ListProcRunApproval(c, procInsId, c.Query("procInsNodeId"), c.Query("status"))
+	if err != nil {
+		middleware.ReturnError(c, err)
+	} else {
+		middleware.ReturnData(c, result)
+	}
+}
+
+// ListUserPendingApproval 当前用户待投票的审批票
+func ListUserPendingApproval(c *gin.Context) {
+	result, err := database.ListUserPendingApproval(c, middleware.GetRequestUser(c), middleware.GetRequestRoles(c))
+	if err != nil {
+		middleware.ReturnError(c, err)
+	} else {
+		middleware.ReturnData(c, result)
+	}
+}
+
+// VoteProcRunApproval 审批人对人工节点投票,是否有票可投由审批票决定,不校验实例数据权限
+func VoteProcRunApproval(c *gin.Context) {
+	var param models.ProcRunApprovalVoteParam
+	if err := c.ShouldBindJSON(&param); err != nil {
+		middleware.ReturnError(c, exterror.Catch(exterror.New().RequestParamValidateError, err))
+		return
+	}
+	operator := middleware.GetRequestUser(c)
+	result, err := database.VoteProcRunApproval(c, c.Param("procInsId"), c.Param("procInsNodeId"), operator, middleware.GetRequestRoles(c), &param)
+	if err != nil {
+		middleware.ReturnError(c, err)
+		return
+	}
+	workflow.NotifyApproval(c, result.WorkflowId, result.ProcRunNodeId, operator)
+	middleware.ReturnData(c, result)
+}
+
+// DelegateProcRunApproval 审批人把自己的票转交给其它用户
+func DelegateProcRunApproval(c *gin.Context) {
+	var param models.ProcRunApprovalDelegateParam
+	if err := c.ShouldBindJSON(&param); err != nil {
+		middleware.ReturnError(c, exterror.Catch(exterror.New().RequestParamValidateError, err))
+		return
+	}
+	result, err := database.DelegateProcRunApproval(c, c.Param("procInsId"), c.Param("procInsNodeId"), middleware.GetRequestUser(c), middleware.GetRequestRoles(c), &param)
+	if err != nil {
+		middleware.ReturnError(c, err)
+	} else {
+		middleware.ReturnData(c, result)
+	}
+}
+
+func getProcInsRunBreakpoint(c *gin.Context, procInsId, breakpointId string) (result *models.ProcRunBreakpoint, err error) {
+	if result, err = database.GetProcRunBreakpoint(c, breakpointId); err != nil {
+		return
+	}
+	if result.ProcInsId != procInsId {
+		err = exterror.Catch(exterror.New().RequestParamValidateError, fmt.Errorf("breakpoint %s not belong to process instance %s", breakpointId, procInsId))
+	}
+	return
+}
+
+func checkProcInsDataPermission(c *gin.Context, procInsId string) bool {
+	permissionLegal, checkPermissionErr := database.CheckProcInsUserPermission(c, middleware.GetRequestRoles(c), procInsId)
+	if checkPermissionErr != nil {
+		middleware.ReturnError(c, checkPermissionErr)
+		return false
+	}
+	if !permissionLegal {
+		middleware.ReturnError(c, exterror.New().DataPermissionDeny)
+		return false
+	}
+	return true
+}
@@ -3,6 +3,7 @@ package process
 import (
 	"context"
 	"encoding/json"
+	"encoding/xml"
 	"fmt"
 	"io"
 	"net/http"
@@ -21,6 +22,7 @@ import (
 	"github.com/WeBankPartners/wecube-platform/platform-core/common/log"
 	"github.com/WeBankPartners/wecube-platform/platform-core/models"
 	"github.com/WeBankPartners/wecube-platform/platform-core/services/database"
+	"github.com/WeBankPartners/wecube-platform/platform-core/services/workflow"
 	"github.com/gin-gonic/gin"
 )
 
@@ -62,6 +64,14 @@ func AddOrUpdateProcessDefinition(c *gin.Context) {
 		middleware.ReturnError(c, exterror.Catch(exterror.New().RequestParamValidateError, fmt.Errorf("name & version not empty")))
 		return
 	}
+	if err = param.Variables.Validate(); err != nil {
+		middleware.ReturnError(c, exterror.New().ProcDefVariableError.WithParam(err.Error()))
+		return
+	}
+	if err = param.ConcurrencyPolicy.Validate(); err != nil {
+		middleware.ReturnError(c, exterror.Catch(exterror.New().RequestParamValidateError, err))
+		return
+	}
 	// 1.权限参数校验
 	if len(param.PermissionToRole.MGMT) != 1 {
 		middleware.ReturnError(c, exterror.Catch(exterror.New().RequestParamValidateError, fmt.Errorf("request param err,permissionToRole MGMT only one length")))
@@ -109,16 +119,18 @@ func AddOrUpdateProcessDefinition(c *gin.Context) {
 			return
 		}
 		entity = &models.ProcDef{
-			Id:            param.Id,
-			Name:          param.Name,
-			RootEntity:    param.RootEntity,
-			Tags:          param.Tags,
-			ForPlugin:     strings.Join(param.AuthPlugins, ","),
-			Scene:         param.Scene,
-			ConflictCheck: param.ConflictCheck,
-			UpdatedBy:     middleware.GetRequestUser(c),
-			UpdatedTime:   time.Now(),
-			SubProc:       param.SubProc,
+			Id:                param.Id,
+			Name:              param.Name,
+			RootEntity:        param.RootEntity,
+			Tags:              param.Tags,
+			ForPlugin:         strings.Join(param.AuthPlugins, ","),
+			Scene:             param.Scene,
+			ConflictCheck:     param.ConflictCheck,
+			UpdatedBy:         middleware.GetRequestUser(c),
+			UpdatedTime:       time.Now(),
+			SubProc:           param.SubProc,
+			Variables:         param.Variables.String(),
+			ConcurrencyPolicy: param.ConcurrencyPolicy.String(),
 		}
 		nodeList, err = database.GetProcDefNodeById(c, param.Id)
 		if err != nil {
@@ -175,6 +187,87 @@ func GetProcessDefinition(c *gin.Context) {
 	middleware.ReturnData(c, procDefDto)
 }
 
+// LintProcessDefinition 静态检查编排,返回所有错误和警告,不影响编排的状态和节点顺序
+func LintProcessDefinition(c *gin.Context) {
+	procDef, err := database.GetProcessDefinition(c, c.Param("proc-def-id"))
+	if err != nil {
+		middleware.ReturnError(c, err)
+		return
+	}
+	if procDef == nil {
+		middleware.ReturnError(c, fmt.Errorf("proc-def-id is invalid"))
+		return
+	}
+	result, err := workflow.LintProcDef(c, procDef)
+	if err != nil {
+		middleware.ReturnError(c, err)
+		return
+	}
+	// 发布检查的错误按请求语言转换
+	for _, item := range result.Items {
+		if item.Err != nil {
+			item.Code, _, item.Message = exterror.GetErrorResult(c.GetHeader("Accept-Language"), item.Err, -1)
+		}
+	}
+	middleware.ReturnData(c, result)
+}
+
+// DiffProcessDefinition 对比两个编排版本,以proc-def-id为基准列出other-id的节点、线和权限变化
+func DiffProcessDefinition(c *gin.Context) {
+	sourceDto, err := database.GetProcDefDetailByProcDefId(c, c.Param("proc-def-id"))
+	if err != nil {
+		middleware.ReturnError(c, err)
+		return
+	}
+	targetDto, err := database.GetProcDefDetailByProcDefId(c, c.Param("other-id"))
+	if err != nil {
+		middleware.ReturnError(c, err)
+		return
+	}
+	middleware.ReturnData(c, models.DiffProcessDefinition(sourceDto, targetDto))
+}
+
+// GetProcessDefinitionGraph 编排图渲染成svg、dot或mermaid,format默认svg
+func GetProcessDefinitionGraph(c *gin.Context) {
+	procDef, err := database.GetProcessDefinition(c, c.Param("proc-def-id"))
+	if err != nil {
+		middleware.ReturnError(c, err)
+		return
+	}
+	if procDef == nil {
+		middleware.ReturnError(c, fmt.Errorf("proc-def-id is invalid"))
+		return
+	}
+	graph, err := getProcDefGraph(c, procDef.Id, fmt.Sprintf("%s %s", procDef.Name, procDef.Version))
+	if err != nil {
+		middleware.ReturnError(c, err)
+		return
+	}
+	returnProcGraph(c, graph)
+}
+
+func getProcDefGraph(ctx context.Context, procDefId, title string) (graph *models.ProcGraph, err error) {
+	nodeList, err := database.GetProcDefNodeModelByProcDefId(ctx, procDefId)
+	if err != nil {
+		return
+	}
+	linkList, err := database.GetProcDefNodeLinkListByProcDefId(ctx, procDefId)
+	if err != nil {
+		return
+	}
+	graph = models.BuildProcGraph(title, nodeList, linkList)
+	return
+}
+
+func returnProcGraph(c *gin.Context, graph *models.ProcGraph) {
+	content, contentType, err := graph.Render(strings.ToLower(c.Query("format")))
+	if err != nil {
+		middleware.ReturnError(c, exterror.Catch(exterror.New().RequestParamValidateError, err))
+		return
+	}
+	c.Data(http.StatusOK, contentType, []byte(content))
+}
+
 // CopyProcessDefinition 复制编排
 func CopyProcessDefinition(c *gin.Context) {
 	var pList []*models.ProcDef
@@ -427,26 +520,54 @@ func BatchUpdateProcessDefinitionPermission(c *gin.Context) {
 
 // ExportProcessDefinition 编排批量导出
 func ExportProcessDefinition(c *gin.Context) {
+	resultList, fileName, err := getExportProcDefList(c)
+	if err != nil {
+		middleware.ReturnError(c, err)
+		return
+	}
+	b, jsonErr := json.Marshal(resultList)
+	if jsonErr != nil {
+		middleware.ReturnError(c, fmt.Errorf("export requestTemplate config fail, json marshal object error:%s ", jsonErr.Error()))
+		return
+	}
+	c.Writer.Header().Add("Content-Disposition", fmt.Sprintf("attachment; filename=%s.json", fileName))
+	c.Data(http.StatusOK, "application/octet-stream", b)
+}
+
+// ExportProcessDefinitionBpmn 批量导出编排为BPMN2.0文档
+func ExportProcessDefinitionBpmn(c *gin.Context) {
+	resultList, fileName, err := getExportProcDefList(c)
+	if err != nil {
+		middleware.ReturnError(c, err)
+		return
+	}
+	b, xmlErr := xml.MarshalIndent(models.BuildBpmnDefinitions(resultList), "", "  ")
+	if xmlErr != nil {
+		middleware.ReturnError(c, fmt.Errorf("export bpmn fail, xml marshal object error:%s ", xmlErr.Error()))
+		return
+	}
+	c.Writer.Header().Add("Content-Disposition", fmt.Sprintf("attachment; filename=%s.bpmn", fileName))
+	c.Data(http.StatusOK, "application/octet-stream", append([]byte(xml.Header), b...))
+}
+
+// getExportProcDefList 按请求的编排id查要导出的已发布编排详情
+func getExportProcDefList(c *gin.Context) (resultList []*models.ProcessDefinitionDto, fileName string, err error) {
 	var param models.ProcDefIds
-	var resultList []*models.ProcessDefinitionDto
 	var procDefList []*models.ProcDef
-	var err error
-	var fileName string
 	if err = c.ShouldBindJSON(&param); err != nil {
-		middleware.ReturnError(c, exterror.Catch(exterror.New().RequestParamValidateError, err))
+		err = exterror.Catch(exterror.New().RequestParamValidateError, err)
 		return
 	}
 	if len(param.ProcDefIds) == 0 {
-		middleware.ReturnError(c, exterror.Catch(exterror.New().RequestParamValidateError, fmt.Errorf("procDefIds is empty")))
+		err = exterror.Catch(exterror.New().RequestParamValidateError, fmt.Errorf("procDefIds is empty"))
 		return
 	}
 	procDefList, err = database.GetDeployedProcessDefinitionByIds(c, param.ProcDefIds)
 	if err != nil {
-		middleware.ReturnError(c, err)
 		return
 	}
 	if len(procDefList) == 0 {
-		middleware.ReturnError(c, fmt.Errorf("procDefIds need correct and deployed"))
+		err = fmt.Errorf("procDefIds need correct and deployed")
 		return
 	}
 	for index, procDef := range procDefList {
@@ -459,7 +580,7 @@ func ExportProcessDefinition(c *gin.Context) {
 		}
 		procDefDto, err2 := database.GetProcDefDetailByProcDefId(c, procDef.Id)
 		if err2 != nil {
-			middleware.ReturnError(c, err2)
+			err = err2
 			return
 		}
 		resultList = append(resultList, procDefDto)
@@ -468,13 +589,7 @@ func ExportProcessDefinition(c *gin.Context) {
 		fileName = fmt.Sprintf("%s et al.%d", fileName, len(procDefList))
 	}
 	fileName = fileName + "-" + time.Now().Format("20060102150405")
-	b, jsonErr := json.Marshal(resultList)
-	if jsonErr != nil {
-		middleware.ReturnError(c, fmt.Errorf("export requestTemplate config fail, json marshal object error:%s ", jsonErr.Error()))
-		return
-	}
-	c.Writer.Header().Add("Content-Disposition", fmt.Sprintf("attachment; filename=%s.json", fileName))
-	c.Data(http.StatusOK, "application/octet-stream", b)
+	return
 }
 
 // ImportProcessDefinition 批量导入编排
@@ -520,6 +635,49 @@ func ImportProcessDefinition(c *gin.Context) {
 	middleware.ReturnData(c, importResult)
 }
 
+// ImportProcessDefinitionBpmn 导入BPMN2.0文档,文档里的每个process导入为一个编排
+func ImportProcessDefinitionBpmn(c *gin.Context) {
+	file, err := c.FormFile("file")
+	if err != nil {
+		middleware.ReturnError(c, fmt.Errorf("Http read upload file fail:"+err.Error()))
+		return
+	}
+	f, err := file.Open()
+	if err != nil {
+		middleware.ReturnError(c, fmt.Errorf("File open error:"+err.Error()))
+		return
+	}
+	b, err := io.ReadAll(f)
+	defer f.Close()
+	if err != nil {
+		middleware.ReturnError(c, fmt.Errorf("Read content fail error:"+err.Error()))
+		return
+	}
+	var definitions models.BpmnDefinitions
+	if err = xml.Unmarshal(b, &definitions); err != nil {
+		middleware.ReturnError(c, fmt.Errorf("Xml unmarshal fail error:"+err.Error()))
+		return
+	}
+	paramList, err := models.ParseBpmnDefinitions(&definitions)
+	if err != nil {
+		middleware.ReturnError(c, exterror.Catch(exterror.New().RequestParamValidateError, err))
+		return
+	}
+	param := models.ProcDefImportDto{
+		Ctx:       c,
+		InputList: paramList,
+		Operator:  middleware.GetRequestUser(c),
+		UserToken: c.GetHeader(models.AuthorizationHeader),
+		Language:  c.GetHeader(middleware.AcceptLanguageHeader),
+	}
+	importResult, err := ProcDefImport(param)
+	if err != nil {
+		middleware.ReturnError(c, err)
+		return
+	}
+	middleware.ReturnData(c, importResult)
+}
+
 // DeployProcessDefinition 编排定义发布
 func DeployProcessDefinition(c *gin.Context) {
 	var procDef *models.ProcDef
@@ -1463,6 +1621,9 @@ func checkDeployedProcDef(ctx context.Context, procDef *models.ProcDef) error {
 	if repeatName := checkProcDefNodeNameRepeat(list); repeatName != "" {
 		return exterror.New().ProcDefNodeNameRepeatError.WithParam(repeatName)
 	}
+	if err = workflow.ValidateProcDefVariables(procDef); err != nil {
+		return err
+	}
 	linkList, err = database.GetProcDefNodeLinkListByProcDefId(ctx, procDef.Id)
 	if err != nil {
 		return exterror.Catch(exterror.New().DatabaseQueryError, err)
@@ -1490,73 +1651,14 @@ func checkDeployedProcDef(ctx context.Context, procDef *models.ProcDef) error {
 			startNodeNameList = append(startNodeNameList, node.Name)
 		case models.ProcDefNodeTypeEnd:
 			endNodeNameList = append(endNodeNameList, node.Name)
-		case models.ProcDefNodeTypeAbnormal:
-		case models.ProcDefNodeTypeFork:
-			// 分流必须单进多出
-			if !(inCount == 1 && outCount > 1) {
-				return exterror.New().ProcDefNode20000004Error.WithParam(node.Name)
-			}
 		case models.ProcDefNodeTypeMerge:
-			// 汇聚必须多进单出
 			withMerge = true
-			if !(inCount > 1 && outCount == 1) {
-				return exterror.New().ProcDefNode20000005Error.WithParam(node.Name)
-			}
 		case models.ProcDefNodeDecisionMerge:
-			// 判断汇聚必须多进单出
 			withDecisionMerge = true
-			if !(inCount > 1 && outCount == 1) {
-				return exterror.New().ProcDefNode20000005Error.WithParam(node.Name)
-			}
-		case models.ProcDefNodeTypeDecision:
-			//  判断节点出的线,必须有名字并且同一个判断节点的所有线的名字不能相同
-			var tempLinkNameMap = make(map[string]bool)
-			nodeLinkList, err2 := database.GetProcDefNodeLinkByProcDefIdAndSource(ctx, procDef.Id, node.Id)
-			if err2 != nil {
-				return exterror.Catch(exterror.New().DatabaseQueryError, err2)
-			}
-			if len(nodeLinkList) > 0 {
-				for _, link := range nodeLinkList {
-					if strings.TrimSpace(link.Name) == "" || tempLinkNameMap[link.Name] {
-						return exterror.New().ProcDefNode20000006Error.WithParam(node.Name)
-					}
-					tempLinkNameMap[link.Name] = true
-				}
-			}
-		case models.ProcDefNodeTypeData:
-			// 判断定位规则有没有带operation
-			if _, err = database.GetProcDataNodeExpression(node.RoutineExpression); err != nil {
-				return exterror.New().ProcDefDataNodeError.WithParam(node.Name)
-			}
-		case models.ProcDefNodeSubProcess:
-			if procDef.SubProc {
-				return exterror.New().ProcDefSubProcCheckError
-			}
-			if node.SubProcDefId == "" {
-				return exterror.New().ProcDefNodeSubProcEmptyError.WithParam(node.Name)
-			}
-		default:
-			// 任务三种节点,插件服务不能为空
-			if node.NodeType == string(models.ProcDefNodeTypeHuman) || node.NodeType == string(models.ProcDefNodeTypeAutomatic) {
-				if strings.TrimSpace(node.ServiceName) == "" {
-					return exterror.New().ProcDefNodeServiceNameEmptyError.WithParam(node.Name)
-				}
-			}
-			if node.NodeType == string(models.ProcDefNodeTypeHuman) && procDef.SubProc {
-				return exterror.New().ProcDefSubProcCheckError
-			}
-			// 时间节点,日期不能为空
-			if node.NodeType == string(models.ProcDefNodeTypeDate) && node.TimeConfig != "" {
-				timeConfigDto := &models.TimeConfigDto{}
-				json.Unmarshal([]byte(node.TimeConfig), timeConfigDto)
-				if strings.TrimSpace(timeConfigDto.Date) == "" {
-					return exterror.New().ProcDefNodeDateEmptyError.WithParam(node.Name)
-				}
-			}
-			// 任务3种节点、时间2种节点仅支持单进单出.
-			if inCount != 1 || outCount != 1 {
-				return exterror.New().ProcDefNode20000010Error.WithParam(node.Name)
-			}
+		}
+		// 节点自身的合法性由对应的节点执行器检查
+		if err = workflow.ValidateProcDefNode(ctx, procDef, node, inCount, outCount); err != nil {
+			return err
 		}
 	}
 	// 开始，结束节点都不超过1个
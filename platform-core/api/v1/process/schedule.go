@@ -43,6 +43,12 @@ func CreateProcSchedule(c *gin.Context) {
 		return
 	}
 	param.CronExpr = cronExpr
+	if param.Calendar != "" {
+		if _, getCalendarErr := database.GetBusinessCalendarRule(c, param.Calendar); getCalendarErr != nil {
+			middleware.ReturnError(c, getCalendarErr)
+			return
+		}
+	}
 	newRow, err := database.CreateProcSchedule(c, &param)
 	if err != nil {
 		middleware.ReturnError(c, err)
@@ -233,6 +239,18 @@ func handleProcScheduleJob(unixTimestamp int64, param interface{}) {
 		procScheduleConfigMap.Delete(psConfig.Id)
 		return
 	}
+	// 按一致性hash不归自己负责时先等负责的实例执行,超时还没执行(如负责的实例已挂掉但还没过期)再接手,重复执行由抢占任务纪录去重
+	fireTime := time.Unix(unixTimestamp, 0)
+	if !workflow.IsClusterOwner(psConfig.Id) {
+		time.Sleep(time.Until(fireTime.Add(models.ClusterOwnerFallbackTimeout*time.Second + time.Second)))
+	}
+	if workflow.IsDraining() || !workflow.IsClusterOwnerOrOverdue(psConfig.Id, fireTime) {
+		log.Logger.Debug("skip handleProcScheduleJob,not owner", log.String("psConfigId", psConfig.Id))
+		return
+	}
+	if !isScheduleCalendarWorkTime(ctx, &psConfig, fireTime) {
+		return
+	}
 	log.Logger.Info("start handleProcScheduleJob", log.String("psConfigId", psConfig.Id), log.String("jobId", jobId))
 	// 抢占任务
 	if duplicateRow, err := database.NewProcScheduleJob(ctx, &psConfig, jobId); err != nil {
@@ -273,14 +291,33 @@ func handleProcScheduleJob(unixTimestamp int64, param interface{}) {
 		log.Logger.Error("handleProcScheduleJob fail with create proc instance data", log.String("psConfigId", psConfig.Id), log.String("sessionId", previewData.ProcessSessionId), log.Error(createInsErr))
 		return
 	}
-	// 初始化workflow并开始
-	workObj := workflow.Workflow{ProcRunWorkflow: *workflowRow}
-	workObj.Init(context.Background(), workNodes, workLinks)
-	//workflow.GlobalWorkflowMap.Store(workObj.Id, &workObj)
-	go workObj.Start(&models.ProcOperation{CreatedBy: operator})
+	// 初始化workflow并开始,排队中的实例由排队任务启动
+	if workflowRow.Status != models.JobStatusQueued {
+		workObj := workflow.Workflow{ProcRunWorkflow: *workflowRow}
+		workObj.Init(context.Background(), workNodes, workLinks)
+		//workflow.GlobalWorkflowMap.Store(workObj.Id, &workObj)
+		go workObj.Start(&models.ProcOperation{CreatedBy: operator})
+	}
 	if updateJobInsIdErr := database.UpdateProcScheduleJob(ctx, jobId, "done", "", procInsId); updateJobInsIdErr != nil {
 		log.Logger.Error("handleProcScheduleJob done but update job proc instance id fail", log.String("jobId", jobId), log.String("procInsId", procInsId), log.Error(updateJobInsIdErr))
 	} else {
 		log.Logger.Info("done handleProcScheduleJob", log.String("psConfigId", psConfig.Id), log.String("jobId", jobId), log.String("procInsId", procInsId))
 	}
 }
+
+// isScheduleCalendarWorkTime 定时任务引用了业务日历时只在工作日的工作时间执行,日历查不到时不执行
+func isScheduleCalendarWorkTime(ctx context.Context, psConfig *models.ProcScheduleConfig, fireTime time.Time) bool {
+	if psConfig.Calendar == "" {
+		return true
+	}
+	calendar, err := database.GetBusinessCalendarRule(ctx, psConfig.Calendar)
+	if err != nil {
+		log.Logger.Error("skip handleProcScheduleJob,get business calendar fail", log.String("psConfigId", psConfig.Id), log.String("calendar", psConfig.Calendar), log.Error(err))
+		return false
+	}
+	if !calendar.IsWorkTime(fireTime) {
+		log.Logger.Info("skip handleProcScheduleJob,not business calendar work time", log.String("psConfigId", psConfig.Id), log.String("calendar", psConfig.Calendar))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,407 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"github.com/WeBankPartners/go-common-lib/guid"
+	"github.com/WeBankPartners/wecube-platform/platform-core/api/middleware"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/exterror"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/log"
+	"github.com/WeBankPartners/wecube-platform/platform-core/models"
+	"github.com/WeBankPartners/wecube-platform/platform-core/services/database"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// PlanProcessDefinitionYaml 对比YAML与环境中已发布的编排,列出每个编排要新建、更新还是无变化
+func PlanProcessDefinitionYaml(c *gin.Context) {
+	content, err := readProcDefYamlContent(c)
+	if err != nil {
+		middleware.ReturnError(c, err)
+		return
+	}
+	planList, err := planProcDefYaml(c, content)
+	if err != nil {
+		middleware.ReturnError(c, err)
+		return
+	}
+	middleware.ReturnData(c, planList)
+}
+
+// ApplyProcessDefinitionYaml 按YAML新建编排草稿,deploy=true时直接发布,无变化的编排跳过
+// 先新建所有草稿,有一个失败时删除本次新建的草稿并停止;草稿都建好后再按顺序发布,发布失败时停止,已发布的不回滚,后面的编排保留草稿
+func ApplyProcessDefinitionYaml(c *gin.Context) {
+	content, err := readProcDefYamlContent(c)
+	if err != nil {
+		middleware.ReturnError(c, err)
+		return
+	}
+	planList, err := planProcDefYaml(c, content)
+	if err != nil {
+		middleware.ReturnError(c, err)
+		return
+	}
+	// 有任何一个编排不能同步时全部不执行
+	for _, planItem := range planList {
+		if planItem.Error != "" {
+			middleware.ReturnError(c, exterror.Catch(exterror.New().RequestParamValidateError, fmt.Errorf("process definition %s can not apply: %s", planItem.Name, planItem.Error)))
+			return
+		}
+	}
+	deploy := strings.ToLower(c.Query("deploy")) == "true"
+	// planList已按子编排引用排序,新建的子编排先apply,父编排再取它的版本
+	createdVersionMap := make(map[string]string)
+	var result, createdList []*models.ProcDefYamlApplyItem
+	var failed bool
+	for _, planItem := range planList {
+		applyItem := &models.ProcDefYamlApplyItem{ProcDefYamlPlanItem: planItem}
+		result = append(result, applyItem)
+		if planItem.Action == models.ProcDefYamlActionNoop {
+			applyItem.Status = models.ProcDefYamlStatusSkipped
+		} else if failed {
+			applyItem.Status = models.ProcDefYamlStatusCanceled
+		} else if applyErr := createProcDefYamlDraft(c, applyItem, createdVersionMap); applyErr != nil {
+			setProcDefYamlApplyError(c, applyItem, applyErr)
+			failed = true
+		} else {
+			createdList = append(createdList, applyItem)
+		}
+	}
+	if failed {
+		for _, applyItem := range createdList {
+			if deleteErr := database.DeleteProcDefChain(c, applyItem.ProcDefId); deleteErr != nil {
+				log.Logger.Error("delete process definition yaml draft fail", log.String("name", applyItem.Name), log.String("procDefId", applyItem.ProcDefId), log.Error(deleteErr))
+				continue
+			}
+			applyItem.ProcDefId, applyItem.Version, applyItem.Status = "", "", models.ProcDefYamlStatusCanceled
+		}
+		middleware.ReturnData(c, result)
+		return
+	}
+	if deploy {
+		for _, applyItem := range createdList {
+			if deployErr := deployProcDefYamlItem(c, applyItem); deployErr != nil {
+				setProcDefYamlApplyError(c, applyItem, deployErr)
+				break
+			}
+		}
+	}
+	middleware.ReturnData(c, result)
+}
+
+func setProcDefYamlApplyError(c *gin.Context, applyItem *models.ProcDefYamlApplyItem, applyErr error) {
+	log.Logger.Error("apply process definition yaml fail", log.String("name", applyItem.Name), log.Error(applyErr))
+	_, _, applyItem.ErrMsg = exterror.GetErrorResult(c.GetHeader(middleware.AcceptLanguageHeader), applyErr, -1)
+	if applyItem.Status == "" {
+		applyItem.Status = models.ProcDefYamlStatusFailed
+	}
+}
+
+// ExportProcessDefinitionYaml 导出编排为YAML,多个编排用---分隔
+func ExportProcessDefinitionYaml(c *gin.Context) {
+	resultList, fileName, err := getExportProcDefList(c)
+	if err != nil {
+		middleware.ReturnError(c, err)
+		return
+	}
+	var yamlList []*models.ProcDefYaml
+	for _, procDefDto := range resultList {
+		yamlList = append(yamlList, models.BuildProcDefYaml(procDefDto))
+	}
+	b, err := models.MarshalProcDefYaml(yamlList)
+	if err != nil {
+		middleware.ReturnError(c, fmt.Errorf("export yaml fail, yaml marshal object error:%s ", err.Error()))
+		return
+	}
+	c.Writer.Header().Add("Content-Disposition", fmt.Sprintf("attachment; filename=%s.yaml", fileName))
+	c.Data(http.StatusOK, "application/octet-stream", b)
+}
+
+// readProcDefYamlContent 支持上传文件和直接提交YAML内容,方便流水线调用
+func readProcDefYamlContent(c *gin.Context) (content []byte, err error) {
+	if c.ContentType() == "multipart/form-data" {
+		if _, content, err = middleware.ReadFormFile(c, "file"); err != nil {
+			err = exterror.Catch(exterror.New().RequestParamValidateError, err)
+		}
+		return
+	}
+	if content, err = c.GetRawData(); err != nil {
+		err = exterror.Catch(exterror.New().RequestReadBodyError, err)
+		return
+	}
+	if len(strings.TrimSpace(string(content))) == 0 {
+		err = exterror.Catch(exterror.New().RequestParamValidateError, fmt.Errorf("yaml content is empty"))
+	}
+	return
+}
+
+func planProcDefYaml(ctx context.Context, content []byte) (result []*models.ProcDefYamlPlanItem, err error) {
+	yamlList, err := models.ParseProcDefYaml(content)
+	if err != nil {
+		err = exterror.Catch(exterror.New().RequestParamValidateError, err)
+		return
+	}
+	for _, procDefYaml := range yamlList {
+		planItem := &models.ProcDefYamlPlanItem{Name: procDefYaml.Name, Key: procDefYaml.Key}
+		result = append(result, planItem)
+		var convertErr error
+		if planItem.ProcDef, convertErr = procDefYaml.ToProcessDefinitionDto(); convertErr != nil {
+			planItem.Error = convertErr.Error()
+		}
+	}
+	result = sortProcDefYamlPlan(result)
+	// 同一份YAML里的编排可以互相引用为子编排,按排好的顺序对比,子编排的action先确定
+	bundleActionMap := make(map[string]string)
+	for _, planItem := range result {
+		bundleActionMap[planItem.Name] = ""
+	}
+	for _, planItem := range result {
+		if planItem.Error != "" {
+			continue
+		}
+		if err = planProcDefYamlItem(ctx, planItem, bundleActionMap); err != nil {
+			return
+		}
+		if planItem.Error == "" {
+			bundleActionMap[planItem.Name] = planItem.Action
+		}
+	}
+	return
+}
+
+// sortProcDefYamlPlan 按apply顺序排列,没写版本引用的同一份YAML里的子编排排在父编排前面,循环引用时报错
+func sortProcDefYamlPlan(planList []*models.ProcDefYamlPlanItem) (result []*models.ProcDefYamlPlanItem) {
+	nameIndexMap := make(map[string]int)
+	for i, planItem := range planList {
+		nameIndexMap[planItem.Name] = i
+	}
+	// 0未访问,1访问中,2已排好
+	visitState := make([]int, len(planList))
+	var path []int
+	var visit func(index int)
+	visit = func(index int) {
+		if visitState[index] == 2 {
+			return
+		}
+		if visitState[index] == 1 {
+			var cycleNames []string
+			for i := len(path) - 1; i >= 0; i-- {
+				cycleNames = append([]string{planList[path[i]].Name}, cycleNames...)
+				if path[i] == index {
+					break
+				}
+			}
+			cycleNames = append(cycleNames, planList[index].Name)
+			for _, name := range cycleNames {
+				if planItem := planList[nameIndexMap[name]]; planItem.Error == "" {
+					planItem.Error = fmt.Sprintf("sub process circular reference: %s", strings.Join(cycleNames, " -> "))
+				}
+			}
+			return
+		}
+		visitState[index] = 1
+		path = append(path, index)
+		if procDefDto := planList[index].ProcDef; procDefDto != nil {
+			for _, node := range procDefDto.ProcDefNodeExtend.Nodes {
+				attrs := node.ProcDefNodeCustomAttrs
+				if attrs.SubProcDefName == "" || attrs.SubProcDefVersion != "" {
+					continue
+				}
+				if subIndex, ok := nameIndexMap[attrs.SubProcDefName]; ok {
+					visit(subIndex)
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		visitState[index] = 2
+		result = append(result, planList[index])
+	}
+	for i := range planList {
+		visit(i)
+	}
+	return
+}
+
+// planProcDefYamlItem 按key或名称找到环境中的编排,与最新发布版本对比,差异即为YAML与环境的偏移
+func planProcDefYamlItem(ctx context.Context, planItem *models.ProcDefYamlPlanItem, bundleActionMap map[string]string) (err error) {
+	procDef := planItem.ProcDef.ProcDef
+	if len(planItem.ProcDef.PermissionToRole.MGMT) != 1 {
+		planItem.Error = "permissions mgmt must have only one role"
+		return
+	}
+	if validateErr := procDef.Variables.Validate(); validateErr != nil {
+		planItem.Error = validateErr.Error()
+		return
+	}
+	if validateErr := procDef.ConcurrencyPolicy.Validate(); validateErr != nil {
+		planItem.Error = validateErr.Error()
+		return
+	}
+	repeatNameList, err := database.GetProcessDefinitionByCondition(ctx, models.ProcDefCondition{Name: procDef.Name})
+	if err != nil {
+		return
+	}
+	if procDef.Key == "" && len(repeatNameList) > 0 {
+		procDef.Key = repeatNameList[0].Key
+	}
+	for _, repeatProcDef := range repeatNameList {
+		if repeatProcDef.Key != procDef.Key {
+			planItem.Error = fmt.Sprintf("name %s already used by process definition key %s", procDef.Name, repeatProcDef.Key)
+			return
+		}
+	}
+	planItem.Key = procDef.Key
+	var existList []*models.ProcDef
+	if procDef.Key != "" {
+		if existList, err = database.GetProcessDefinitionByCondition(ctx, models.ProcDefCondition{Key: procDef.Key}); err != nil {
+			return
+		}
+	}
+	var deployedProcDef *models.ProcDef
+	sort.Sort(models.ProcDefSort(existList))
+	for _, existProcDef := range existList {
+		if existProcDef.Status == string(models.Draft) {
+			planItem.DraftId = existProcDef.Id
+		} else if existProcDef.Status == string(models.Deployed) {
+			deployedProcDef = existProcDef
+		}
+	}
+	if planItem.Error, err = resolveProcDefYamlSubProc(ctx, planItem.ProcDef, bundleActionMap); err != nil || planItem.Error != "" {
+		return
+	}
+	switch {
+	case len(existList) == 0:
+		planItem.Action = models.ProcDefYamlActionCreate
+	case deployedProcDef == nil:
+		planItem.Action = models.ProcDefYamlActionUpdate
+	default:
+		planItem.DeployedId, planItem.DeployedVersion = deployedProcDef.Id, deployedProcDef.Version
+		deployedDto, getErr := database.GetProcDefDetailByProcDefId(ctx, deployedProcDef.Id)
+		if getErr != nil {
+			err = getErr
+			return
+		}
+		planItem.Drift = models.DiffProcessDefinition(deployedDto, planItem.ProcDef)
+		planItem.Action = models.ProcDefYamlActionUpdate
+		if planItem.Drift.IsEmpty() {
+			planItem.Action = models.ProcDefYamlActionNoop
+		}
+	}
+	if planItem.Action != models.ProcDefYamlActionNoop && planItem.DraftId != "" {
+		planItem.Error = fmt.Sprintf("already a draft %s with the same key, please delete that draft first", planItem.DraftId)
+	}
+	return
+}
+
+// resolveProcDefYamlSubProc 子编排没写版本时取最新发布版本,引用同一份YAML里要新建版本的编排时apply时再确定版本
+func resolveProcDefYamlSubProc(ctx context.Context, procDefDto *models.ProcessDefinitionDto, bundleActionMap map[string]string) (message string, err error) {
+	for _, node := range procDefDto.ProcDefNodeExtend.Nodes {
+		attrs := node.ProcDefNodeCustomAttrs
+		if attrs.SubProcDefName == "" {
+			continue
+		}
+		bundleAction, inBundle := bundleActionMap[attrs.SubProcDefName]
+		if attrs.SubProcDefVersion == "" && inBundle && bundleAction != models.ProcDefYamlActionNoop {
+			continue
+		}
+		var subProcList []*models.ProcDef
+		if subProcList, err = database.GetProcessDefinitionByCondition(ctx, models.ProcDefCondition{Name: attrs.SubProcDefName, Version: attrs.SubProcDefVersion}); err != nil {
+			return
+		}
+		if attrs.SubProcDefVersion == "" {
+			sort.Sort(models.ProcDefSort(subProcList))
+			for _, subProc := range subProcList {
+				if subProc.Status == string(models.Deployed) {
+					attrs.SubProcDefVersion = subProc.Version
+				}
+			}
+		}
+		if (len(subProcList) == 0 || attrs.SubProcDefVersion == "") && (!inBundle || bundleAction == models.ProcDefYamlActionNoop) {
+			message = fmt.Sprintf("node %s sub process %s %s not found", attrs.Id, attrs.SubProcDefName, attrs.SubProcDefVersion)
+			return
+		}
+	}
+	return
+}
+
+// createProcDefYamlDraft 按YAML新建编排草稿,子编排没写版本时用本次新建的版本
+func createProcDefYamlDraft(c *gin.Context, applyItem *models.ProcDefYamlApplyItem, createdVersionMap map[string]string) (err error) {
+	procDefDto := applyItem.ProcDef
+	procDef := procDefDto.ProcDef
+	operator := middleware.GetRequestUser(c)
+	if applyItem.Action == models.ProcDefYamlActionUpdate {
+		if err = checkProcDefYamlMgmtRole(c, procDef.Key, middleware.GetRequestRoles(c)); err != nil {
+			return
+		}
+	}
+	for _, node := range procDefDto.ProcDefNodeExtend.Nodes {
+		attrs := node.ProcDefNodeCustomAttrs
+		if attrs.SubProcDefName != "" && attrs.SubProcDefVersion == "" {
+			if attrs.SubProcDefVersion = createdVersionMap[attrs.SubProcDefName]; attrs.SubProcDefVersion == "" {
+				err = fmt.Errorf("node %s sub process %s not created", attrs.Id, attrs.SubProcDefName)
+				return
+			}
+		}
+	}
+	procDef.Id = "pdef_" + guid.CreateGuid()
+	if procDef.Key == "" {
+		procDef.Key = "pdef_key_" + guid.CreateGuid()
+	}
+	if applyItem.Action == models.ProcDefYamlActionCreate {
+		procDef.Version = "v1"
+	} else {
+		procDef.Version = calcProcDefVersion(c, procDef.Key)
+	}
+	for _, edge := range procDefDto.ProcDefNodeExtend.Edges {
+		edge.ProcDefId = procDef.Id
+	}
+	// 权限按YAML中的角色设置
+	importParam := models.ProcDefImportDto{Ctx: c, Operator: operator, UserToken: c.GetHeader(models.AuthorizationHeader),
+		Language: c.GetHeader(middleware.AcceptLanguageHeader), IsTransImport: true}
+	if err = database.CopyProcessDefinitionByDto(importParam, procDefDto); err != nil {
+		return
+	}
+	applyItem.Key, applyItem.ProcDefId, applyItem.Version, applyItem.Status = procDef.Key, procDef.Id, procDef.Version, string(models.Draft)
+	createdVersionMap[procDef.Name] = procDef.Version
+	return
+}
+
+// deployProcDefYamlItem 发布新建的草稿
+func deployProcDefYamlItem(c *gin.Context, applyItem *models.ProcDefYamlApplyItem) (err error) {
+	procDefModel, err := database.GetProcessDefinition(c, applyItem.ProcDefId)
+	if err != nil {
+		return
+	}
+	if strings.TrimSpace(procDefModel.RootEntity) == "" {
+		err = exterror.Catch(exterror.New().ProcDefRootEntityEmptyError, nil)
+		return
+	}
+	if err = ExecDeployedProcDef(c, procDefModel, middleware.GetRequestUser(c)); err != nil {
+		return
+	}
+	applyItem.Status = string(models.Deployed)
+	return
+}
+
+// checkProcDefYamlMgmtRole 更新已有编排时,当前用户要有最新版本的属主角色
+func checkProcDefYamlMgmtRole(ctx context.Context, key string, userRoles []string) (err error) {
+	existList, err := database.GetProcessDefinitionByCondition(ctx, models.ProcDefCondition{Key: key})
+	if err != nil || len(existList) == 0 {
+		return
+	}
+	sort.Sort(models.ProcDefSort(existList))
+	permissionList, err := database.GetProcDefPermissionByCondition(ctx, models.ProcDefPermission{ProcDefId: existList[len(existList)-1].Id, Permission: string(models.MGMT)})
+	if err != nil {
+		return
+	}
+	for _, permission := range permissionList {
+		for _, role := range userRoles {
+			if permission.RoleName == role {
+				return
+			}
+		}
+	}
+	return exterror.New().DataPermissionDeny
+}
@@ -0,0 +1,108 @@
+package system
+
+import (
+	"fmt"
+	"github.com/WeBankPartners/wecube-platform/platform-core/api/middleware"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/exterror"
+	"github.com/WeBankPartners/wecube-platform/platform-core/models"
+	"github.com/WeBankPartners/wecube-platform/platform-core/services/database"
+	"github.com/gin-gonic/gin"
+	"time"
+)
+
+// ListBusinessCalendar 查业务日历列表
+func ListBusinessCalendar(c *gin.Context) {
+	result, err := database.ListBusinessCalendar(c)
+	if err != nil {
+		middleware.ReturnError(c, err)
+	} else {
+		middleware.ReturnData(c, result)
+	}
+}
+
+// CreateBusinessCalendar 新增业务日历,与系统变量同样需要系统参数管理权限
+func CreateBusinessCalendar(c *gin.Context) {
+	var param models.BusinessCalendar
+	if err := c.ShouldBindJSON(&param); err != nil {
+		middleware.ReturnError(c, exterror.Catch(exterror.New().RequestParamValidateError, err))
+		return
+	}
+	if !validateSystemVariablePermission(middleware.GetRequestRoles(c)) {
+		middleware.ReturnError(c, exterror.New().DataPermissionDeny)
+		return
+	}
+	if err := database.CreateBusinessCalendar(c, &param, middleware.GetRequestUser(c)); err != nil {
+		middleware.ReturnError(c, err)
+	} else {
+		middleware.ReturnData(c, param)
+	}
+}
+
+// UpdateBusinessCalendar 修改业务日历
+func UpdateBusinessCalendar(c *gin.Context) {
+	var param models.BusinessCalendar
+	if err := c.ShouldBindJSON(&param); err != nil {
+		middleware.ReturnError(c, exterror.Catch(exterror.New().RequestParamValidateError, err))
+		return
+	}
+	if !validateSystemVariablePermission(middleware.GetRequestRoles(c)) {
+		middleware.ReturnError(c, exterror.New().DataPermissionDeny)
+		return
+	}
+	param.Id = c.Param("calendarId")
+	if err := database.UpdateBusinessCalendar(c, &param, middleware.GetRequestUser(c)); err != nil {
+		middleware.ReturnError(c, err)
+	} else {
+		middleware.ReturnData(c, param)
+	}
+}
+
+// DeleteBusinessCalendar 删除业务日历
+func DeleteBusinessCalendar(c *gin.Context) {
+	if !validateSystemVariablePermission(middleware.GetRequestRoles(c)) {
+		middleware.ReturnError(c, exterror.New().DataPermissionDeny)
+		return
+	}
+	if err := database.DeleteBusinessCalendar(c, c.Param("calendarId")); err != nil {
+		middleware.ReturnError(c, err)
+	} else {
+		middleware.ReturnSuccess(c)
+	}
+}
+
+// CalcBusinessCalendarTime 按日历试算时间节点或日期节点的触发时间,返回日历时区的时间
+func CalcBusinessCalendarTime(c *gin.Context) {
+	var param models.BusinessCalendarCalcParam
+	if err := c.ShouldBindJSON(&param); err != nil {
+		middleware.ReturnError(c, exterror.Catch(exterror.New().RequestParamValidateError, err))
+		return
+	}
+	calendarRow, err := database.GetBusinessCalendar(c, c.Param("calendarId"))
+	if err != nil {
+		middleware.ReturnError(c, err)
+		return
+	}
+	calendar, err := models.ParseBusinessCalendar(calendarRow)
+	if err != nil {
+		middleware.ReturnError(c, exterror.New().BusinessCalendarConfigError.WithParam(err.Error()))
+		return
+	}
+	fromTime := time.Now()
+	if param.From != "" {
+		if fromTime, err = time.ParseInLocation(models.DateTimeFormat, param.From, calendar.Location); err != nil {
+			middleware.ReturnError(c, exterror.Catch(exterror.New().RequestParamValidateError, fmt.Errorf("from:%s illegal", param.From)))
+			return
+		}
+	}
+	var fireTime time.Time
+	if param.Type == "date" {
+		fireTime, err = calendar.ParseDate(&param.TimeNodeParam)
+	} else {
+		fireTime, err = calendar.CalcTimeNodeFireTime(&param.TimeNodeParam, fromTime)
+	}
+	if err != nil {
+		middleware.ReturnError(c, exterror.Catch(exterror.New().RequestParamValidateError, err))
+		return
+	}
+	middleware.ReturnData(c, fireTime.In(calendar.Location).Format(models.DateTimeFormat))
+}
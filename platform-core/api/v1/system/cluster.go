@@ -0,0 +1,17 @@
+package system
+
+import (
+	"github.com/WeBankPartners/wecube-platform/platform-core/api/middleware"
+	"github.com/WeBankPartners/wecube-platform/platform-core/services/database"
+	"github.com/gin-gonic/gin"
+)
+
+// ListClusterMember 查core集群成员及各实例负载
+func ListClusterMember(c *gin.Context) {
+	result, err := database.ListClusterMember(c)
+	if err != nil {
+		middleware.ReturnError(c, err)
+	} else {
+		middleware.ReturnData(c, result)
+	}
+}
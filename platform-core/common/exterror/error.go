@@ -46,39 +46,61 @@ type ErrorTemplate struct {
 	DatabaseQueryEmptyError CustomError `json:"database_query_empty_error"`
 	DatabaseExecuteError    CustomError `json:"database_execute_error"`
 	// sever handle error
-	ServerHandleError                 CustomError `json:"server_handle_error"`
-	PluginDependencyIllegal           CustomError `json:"plugin_dependency_illegal"`
-	ProcDefNodeNameEmptyError         CustomError `json:"proc_def_node_name_empty_error"`
-	ProcDefNodeNameRepeatError        CustomError `json:"proc_def_node_name_repeat_error"`
-	ProcDefNodeServiceNameEmptyError  CustomError `json:"proc_def_node_service_name_empty_error"`
-	ProcDefNodeDeleteError            CustomError `json:"proc_def__node_delete_error"`
-	ProcDefNodeDateEmptyError         CustomError `json:"proc_def_node_date_empty_error"`
-	ProcDefNode20000004Error          CustomError `json:"proc_def_node_20000004_error"`
-	ProcDefNode20000005Error          CustomError `json:"proc_def_node_20000005_error"`
-	ProcDefNode20000006Error          CustomError `json:"proc_def_node_20000006_error"`
-	ProcDefNode20000007Error          CustomError `json:"proc_def_node_20000007_error"`
-	ProcDefNode20000008Error          CustomError `json:"proc_def_node_20000008_error"`
-	ProcDefNode20000009Error          CustomError `json:"proc_def_node_20000009_error"`
-	ProcDefNode20000010Error          CustomError `json:"proc_def_node_20000010_error"`
-	ProcDefNode20000015Error          CustomError `json:"proc_def_import_low_version_error"`
-	ProcDefNode20000016Error          CustomError `json:"proc_def_import_draft_conflict_error"`
-	ProcDefNode20000017Error          CustomError `json:"proc_def_import_server_error"`
-	ProcDefLoopCheckError             CustomError `json:"proc_def_loop_check_error"`
-	ProcDefNameRepeatError            CustomError `json:"proc_def_name_repeat_error"`
-	ProcDefRootEntityEmptyError       CustomError `json:"proc_def_root_entity_empty_error"`
-	ProcDefDecisionMergeError         CustomError `json:"proc_def_decision_merge_error"`
-	ProcDefDataNodeError              CustomError `json:"proc_def_data_node_error"`
-	ProcDefSubProcCheckError          CustomError `json:"proc_def_sub_proc_check_error"`
-	ProcDefNodeSubProcEmptyError      CustomError `json:"proc_def_node_sub_proc_empty_error"`
-	ProcDefMergeError                 CustomError `json:"proc_def_merge_error"`
-	ProcStatusOperationError          CustomError `json:"proc_status_operation_error"`
-	ScheduleOperationError            CustomError `json:"schedule_operation_error"`
-	DeleteUserError                   CustomError `json:"delete_user_error"`
-	BatchExecPluginAuthError          CustomError `json:"batch_exec_plugin_auth_error"`
-	BatchExecPluginApiError           CustomError `json:"batch_exec_plugin_api_error"`
-	BatchExecTmplDuplicateNameError   CustomError `json:"batch_exec_tmpl_duplicate_name_error"`
-	BatchExecTmplHasBeenModifiedError CustomError `json:"batch_exec_tmpl_has_been_modified_error"`
-	BatchExecDuplicateNameError       CustomError `json:"batch_exec_duplicate_name_error"`
+	ServerHandleError                  CustomError `json:"server_handle_error"`
+	PluginDependencyIllegal            CustomError `json:"plugin_dependency_illegal"`
+	ProcDefNodeNameEmptyError          CustomError `json:"proc_def_node_name_empty_error"`
+	ProcDefNodeNameRepeatError         CustomError `json:"proc_def_node_name_repeat_error"`
+	ProcDefNodeServiceNameEmptyError   CustomError `json:"proc_def_node_service_name_empty_error"`
+	ProcDefNodeDeleteError             CustomError `json:"proc_def__node_delete_error"`
+	ProcDefNodeDateEmptyError          CustomError `json:"proc_def_node_date_empty_error"`
+	ProcDefNode20000004Error           CustomError `json:"proc_def_node_20000004_error"`
+	ProcDefNode20000005Error           CustomError `json:"proc_def_node_20000005_error"`
+	ProcDefNode20000006Error           CustomError `json:"proc_def_node_20000006_error"`
+	ProcDefNode20000007Error           CustomError `json:"proc_def_node_20000007_error"`
+	ProcDefNode20000008Error           CustomError `json:"proc_def_node_20000008_error"`
+	ProcDefNode20000009Error           CustomError `json:"proc_def_node_20000009_error"`
+	ProcDefNode20000010Error           CustomError `json:"proc_def_node_20000010_error"`
+	ProcDefNode20000015Error           CustomError `json:"proc_def_import_low_version_error"`
+	ProcDefNode20000016Error           CustomError `json:"proc_def_import_draft_conflict_error"`
+	ProcDefNode20000017Error           CustomError `json:"proc_def_import_server_error"`
+	ProcDefLoopCheckError              CustomError `json:"proc_def_loop_check_error"`
+	ProcDefNameRepeatError             CustomError `json:"proc_def_name_repeat_error"`
+	ProcDefRootEntityEmptyError        CustomError `json:"proc_def_root_entity_empty_error"`
+	ProcDefDecisionMergeError          CustomError `json:"proc_def_decision_merge_error"`
+	ProcDefDataNodeError               CustomError `json:"proc_def_data_node_error"`
+	ProcDefSubProcCheckError           CustomError `json:"proc_def_sub_proc_check_error"`
+	ProcDefNodeSubProcEmptyError       CustomError `json:"proc_def_node_sub_proc_empty_error"`
+	ProcDefMergeError                  CustomError `json:"proc_def_merge_error"`
+	ProcDefNodeRetryPolicyError        CustomError `json:"proc_def_node_retry_policy_error"`
+	ProcDefNodeDecisionExpressionError CustomError `json:"proc_def_node_decision_expression_error"`
+	ProcDefNodeLoopPolicyError         CustomError `json:"proc_def_node_loop_policy_error"`
+	ProcDefNodeCompensateServiceError  CustomError `json:"proc_def_node_compensate_service_error"`
+	ProcStatusOperationError           CustomError `json:"proc_status_operation_error"`
+	ProcRunTimerStatusError            CustomError `json:"proc_run_timer_status_error"`
+	ProcDefVariableError               CustomError `json:"proc_def_variable_error"`
+	ProcDefNodeOutputMappingError      CustomError `json:"proc_def_node_output_mapping_error"`
+	ProcDefNodeSignalError             CustomError `json:"proc_def_node_signal_error"`
+	ProcInsQueueStatusError            CustomError `json:"proc_ins_queue_status_error"`
+	ProcInsMigrationError              CustomError `json:"proc_ins_migration_error"`
+	ServerDrainingError                CustomError `json:"server_draining_error"`
+	ProcRunBreakpointStatusError       CustomError `json:"proc_run_breakpoint_status_error"`
+	ProcBreakpointNodeError            CustomError `json:"proc_breakpoint_node_error"`
+	ProcDefNodeApprovalPolicyError     CustomError `json:"proc_def_node_approval_policy_error"`
+	ProcRunApprovalError               CustomError `json:"proc_run_approval_error"`
+	ProcDefNodeCalendarError           CustomError `json:"proc_def_node_calendar_error"`
+	BusinessCalendarConfigError        CustomError `json:"business_calendar_config_error"`
+	BusinessCalendarReferenceError     CustomError `json:"business_calendar_reference_error"`
+	ProcEntityLockConflictError        CustomError `json:"proc_entity_lock_conflict_error"`
+	ProcEntityLockNotFoundError        CustomError `json:"proc_entity_lock_not_found_error"`
+	ProcInsCloneError                  CustomError `json:"proc_ins_clone_error"`
+	ProcInsBulkError                   CustomError `json:"proc_ins_bulk_error"`
+	ScheduleOperationError             CustomError `json:"schedule_operation_error"`
+	DeleteUserError                    CustomError `json:"delete_user_error"`
+	BatchExecPluginAuthError           CustomError `json:"batch_exec_plugin_auth_error"`
+	BatchExecPluginApiError            CustomError `json:"batch_exec_plugin_api_error"`
+	BatchExecTmplDuplicateNameError    CustomError `json:"batch_exec_tmpl_duplicate_name_error"`
+	BatchExecTmplHasBeenModifiedError  CustomError `json:"batch_exec_tmpl_has_been_modified_error"`
+	BatchExecDuplicateNameError        CustomError `json:"batch_exec_duplicate_name_error"`
 	// 同时处理报错
 	DealWithAtTheSameTimeError CustomError `json:"deal_with_at_the_same_time_error"`
 	DataPermissionDeny         CustomError `json:"data_permission_deny"`
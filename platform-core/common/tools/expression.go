@@ -0,0 +1,471 @@
+package tools
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// BoolExpression 判断节点分支上的布尔表达式
+// 支持 == != > < >= <= && || ! 和括号,字面量支持字符串(单双引号)、数字、true/false/null,变量用 a.b.c 的路径从上下文里取值
+// 当路径取到的是数组时,比较运算只要数组中有一个元素满足即为真
+type BoolExpression struct {
+	raw       string
+	root      exprNode
+	variables []string
+}
+
+type exprNode interface {
+	eval(vars map[string]interface{}) (interface{}, error)
+}
+
+type exprLiteral struct {
+	value interface{}
+}
+
+type exprVariable struct {
+	path []string
+}
+
+type exprNot struct {
+	child exprNode
+}
+
+type exprLogic struct {
+	op          string
+	left, right exprNode
+}
+
+type exprCompare struct {
+	op          string
+	left, right exprNode
+}
+
+type exprToken struct {
+	kind  string // op|str|num|ident|lparen|rparen
+	value string
+	pos   int
+}
+
+// ParseBoolExpression 解析表达式,语法错误时返回带位置的错误信息
+func ParseBoolExpression(expression string) (result *BoolExpression, err error) {
+	tokens, err := tokenizeExpression(expression)
+	if err != nil {
+		return
+	}
+	if len(tokens) == 0 {
+		err = fmt.Errorf("expression is empty")
+		return
+	}
+	p := &exprParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return
+	}
+	if p.index < len(tokens) {
+		err = fmt.Errorf("unexpected token %s at position %d", tokens[p.index].value, tokens[p.index].pos)
+		return
+	}
+	result = &BoolExpression{raw: expression, root: root, variables: p.variables}
+	return
+}
+
+func (e *BoolExpression) String() string {
+	return e.raw
+}
+
+// Variables 表达式中引用的所有变量路径
+func (e *BoolExpression) Variables() []string {
+	return e.variables
+}
+
+// Eval 用上下文计算表达式的结果
+func (e *BoolExpression) Eval(vars map[string]interface{}) (bool, error) {
+	value, err := e.root.eval(vars)
+	if err != nil {
+		return false, err
+	}
+	return exprTruthy(value), nil
+}
+
+func tokenizeExpression(expression string) (tokens []exprToken, err error) {
+	runes := []rune(expression)
+	for i := 0; i < len(runes); {
+		c := runes[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			tokens = append(tokens, exprToken{kind: "lparen", value: "(", pos: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, exprToken{kind: "rparen", value: ")", pos: i})
+			i++
+		case c == '\'' || c == '"':
+			start := i
+			i++
+			var sb strings.Builder
+			closed := false
+			for i < len(runes) {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					sb.WriteRune(runes[i+1])
+					i += 2
+					continue
+				}
+				if runes[i] == c {
+					closed = true
+					i++
+					break
+				}
+				sb.WriteRune(runes[i])
+				i++
+			}
+			if !closed {
+				return nil, fmt.Errorf("unterminated string at position %d", start)
+			}
+			tokens = append(tokens, exprToken{kind: "str", value: sb.String(), pos: start})
+		case strings.ContainsRune("=!<>&|", c):
+			start := i
+			op := string(c)
+			if i+1 < len(runes) {
+				two := string(runes[i : i+2])
+				if two == "==" || two == "!=" || two == ">=" || two == "<=" || two == "&&" || two == "||" {
+					op = two
+				}
+			}
+			if op == "=" || op == "&" || op == "|" {
+				return nil, fmt.Errorf("illegal operator %s at position %d", op, start)
+			}
+			tokens = append(tokens, exprToken{kind: "op", value: op, pos: start})
+			i += len([]rune(op))
+		case unicode.IsDigit(c) || (c == '-' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			start := i
+			i++
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			numText := string(runes[start:i])
+			if _, parseErr := strconv.ParseFloat(numText, 64); parseErr != nil {
+				return nil, fmt.Errorf("illegal number %s at position %d", numText, start)
+			}
+			tokens = append(tokens, exprToken{kind: "num", value: numText, pos: start})
+		case unicode.IsLetter(c) || c == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_' || runes[i] == '.' || runes[i] == '-') {
+				i++
+			}
+			tokens = append(tokens, exprToken{kind: "ident", value: string(runes[start:i]), pos: start})
+		default:
+			return nil, fmt.Errorf("illegal character %s at position %d", string(c), i)
+		}
+	}
+	return
+}
+
+type exprParser struct {
+	tokens    []exprToken
+	index     int
+	variables []string
+}
+
+func (p *exprParser) peek() *exprToken {
+	if p.index < len(p.tokens) {
+		return &p.tokens[p.index]
+	}
+	return nil
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); t != nil && t.kind == "op" && t.value == "||"; t = p.peek() {
+		p.index++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &exprLogic{op: "||", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); t != nil && t.kind == "op" && t.value == "&&"; t = p.peek() {
+		p.index++
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &exprLogic{op: "&&", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseNot() (exprNode, error) {
+	if t := p.peek(); t != nil && t.kind == "op" && t.value == "!" {
+		p.index++
+		child, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &exprNot{child: child}, nil
+	}
+	return p.parseCompare()
+}
+
+func (p *exprParser) parseCompare() (exprNode, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	if t == nil || t.kind != "op" {
+		return left, nil
+	}
+	switch t.value {
+	case "==", "!=", ">", "<", ">=", "<=":
+		p.index++
+		right, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		return &exprCompare{op: t.value, left: left, right: right}, nil
+	}
+	return left, nil
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	t := p.peek()
+	if t == nil {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	p.index++
+	switch t.kind {
+	case "lparen":
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closeToken := p.peek(); closeToken == nil || closeToken.kind != "rparen" {
+			return nil, fmt.Errorf("missing ) for ( at position %d", t.pos)
+		}
+		p.index++
+		return node, nil
+	case "str":
+		return &exprLiteral{value: t.value}, nil
+	case "num":
+		num, _ := strconv.ParseFloat(t.value, 64)
+		return &exprLiteral{value: num}, nil
+	case "ident":
+		switch t.value {
+		case "true":
+			return &exprLiteral{value: true}, nil
+		case "false":
+			return &exprLiteral{value: false}, nil
+		case "null":
+			return &exprLiteral{value: nil}, nil
+		}
+		path := strings.Split(t.value, ".")
+		for _, v := range path {
+			if v == "" {
+				return nil, fmt.Errorf("illegal variable %s at position %d", t.value, t.pos)
+			}
+		}
+		p.variables = append(p.variables, t.value)
+		return &exprVariable{path: path}, nil
+	}
+	return nil, fmt.Errorf("unexpected token %s at position %d", t.value, t.pos)
+}
+
+func (n *exprLiteral) eval(vars map[string]interface{}) (interface{}, error) {
+	return n.value, nil
+}
+
+func (n *exprVariable) eval(vars map[string]interface{}) (interface{}, error) {
+	var current interface{} = vars
+	for _, key := range n.path {
+		current = lookupExprValue(current, key)
+		if current == nil {
+			return nil, nil
+		}
+	}
+	return current, nil
+}
+
+func lookupExprValue(current interface{}, key string) interface{} {
+	switch v := current.(type) {
+	case map[string]interface{}:
+		return v[key]
+	case []map[string]interface{}:
+		var result []interface{}
+		for _, item := range v {
+			if tmpValue := item[key]; tmpValue != nil {
+				result = append(result, tmpValue)
+			}
+		}
+		return exprListOrNil(result)
+	case []interface{}:
+		var result []interface{}
+		for _, item := range v {
+			if tmpValue := lookupExprValue(item, key); tmpValue != nil {
+				result = append(result, tmpValue)
+			}
+		}
+		return exprListOrNil(result)
+	}
+	return nil
+}
+
+func exprListOrNil(list []interface{}) interface{} {
+	if len(list) == 0 {
+		return nil
+	}
+	return list
+}
+
+func (n *exprNot) eval(vars map[string]interface{}) (interface{}, error) {
+	value, err := n.child.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	return !exprTruthy(value), nil
+}
+
+func (n *exprLogic) eval(vars map[string]interface{}) (interface{}, error) {
+	left, err := n.left.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	leftBool := exprTruthy(left)
+	if n.op == "&&" && !leftBool {
+		return false, nil
+	}
+	if n.op == "||" && leftBool {
+		return true, nil
+	}
+	right, err := n.right.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	return exprTruthy(right), nil
+}
+
+func (n *exprCompare) eval(vars map[string]interface{}) (interface{}, error) {
+	left, err := n.left.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	leftList, leftIsList := left.([]interface{})
+	if !leftIsList {
+		leftList = []interface{}{left}
+	}
+	rightList, rightIsList := right.([]interface{})
+	if !rightIsList {
+		rightList = []interface{}{right}
+	}
+	for _, l := range leftList {
+		for _, r := range rightList {
+			if compareExprValue(n.op, l, r) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func compareExprValue(op string, left, right interface{}) bool {
+	if left == nil || right == nil {
+		switch op {
+		case "==":
+			return left == nil && right == nil
+		case "!=":
+			return !(left == nil && right == nil)
+		}
+		return false
+	}
+	leftNum, leftIsNum := exprNumber(left)
+	rightNum, rightIsNum := exprNumber(right)
+	if leftIsNum && rightIsNum {
+		switch op {
+		case "==":
+			return leftNum == rightNum
+		case "!=":
+			return leftNum != rightNum
+		case ">":
+			return leftNum > rightNum
+		case "<":
+			return leftNum < rightNum
+		case ">=":
+			return leftNum >= rightNum
+		case "<=":
+			return leftNum <= rightNum
+		}
+	}
+	leftStr, rightStr := fmt.Sprint(left), fmt.Sprint(right)
+	switch op {
+	case "==":
+		return leftStr == rightStr
+	case "!=":
+		return leftStr != rightStr
+	case ">":
+		return leftStr > rightStr
+	case "<":
+		return leftStr < rightStr
+	case ">=":
+		return leftStr >= rightStr
+	case "<=":
+		return leftStr <= rightStr
+	}
+	return false
+}
+
+func exprNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case string:
+		if num, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+			return num, true
+		}
+	}
+	return 0, false
+}
+
+func exprTruthy(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		return v != "" && strings.ToLower(v) != "false"
+	case []interface{}:
+		for _, item := range v {
+			if exprTruthy(item) {
+				return true
+			}
+		}
+		return false
+	}
+	if num, ok := exprNumber(value); ok {
+		return num != 0
+	}
+	return true
+}
@@ -0,0 +1,102 @@
+package tools
+
+import "testing"
+
+func TestBoolExpressionEval(t *testing.T) {
+	vars := map[string]interface{}{
+		"vars": map[string]interface{}{
+			"count":  3,
+			"amount": 12.5,
+			"env":    "prd",
+			"flag":   "false",
+			"text":   "10",
+			"tags":   []interface{}{"a", "b"},
+		},
+		"nodes": map[string]interface{}{
+			"check": []map[string]interface{}{{"result": "ok"}, {"result": "fail"}},
+		},
+	}
+	cases := []struct {
+		name       string
+		expression string
+		expect     bool
+	}{
+		{"and binds tighter than or", "true || false && false", true},
+		{"parentheses override precedence", "(true || false) && false", false},
+		{"not applies to compare", "!vars.count == 3", false},
+		{"double not", "!!vars.env", true},
+		{"number equal int", "vars.count == 3", true},
+		{"number compare float", "vars.amount > 12", true},
+		{"number compare with numeric string", "vars.text > 9", true},
+		{"numeric string literal", "'10' == 10", true},
+		{"string compare", "vars.env == 'prd'", true},
+		{"double quoted string", `vars.env != "dev"`, true},
+		{"string order", "'abc' < 'abd'", true},
+		{"escaped quote", `'it\'s' == "it's"`, true},
+		{"negative number", "vars.count > -1", true},
+		{"string false is falsy", "vars.flag", false},
+		{"missing variable is null", "vars.missing == null", true},
+		{"missing variable not equal", "vars.missing != null", false},
+		{"null compare order is false", "vars.missing < 1", false},
+		{"list any match", "vars.tags == 'b'", true},
+		{"list no match", "vars.tags == 'c'", false},
+		{"list of map path", "nodes.check.result == 'fail'", true},
+		{"short circuit skips right side", "false && vars.missing.deep > 1", false},
+	}
+	for _, c := range cases {
+		expr, err := ParseBoolExpression(c.expression)
+		if err != nil {
+			t.Fatalf("%s: parse %q fail,%s", c.name, c.expression, err.Error())
+		}
+		result, err := expr.Eval(vars)
+		if err != nil {
+			t.Fatalf("%s: eval %q fail,%s", c.name, c.expression, err.Error())
+		}
+		if result != c.expect {
+			t.Errorf("%s: %q expect %v but got %v", c.name, c.expression, c.expect, result)
+		}
+	}
+}
+
+func TestBoolExpressionParseError(t *testing.T) {
+	cases := []struct {
+		name       string
+		expression string
+	}{
+		{"empty", ""},
+		{"blank", "   "},
+		{"single equal", "vars.a = 1"},
+		{"single and", "vars.a & vars.b"},
+		{"single or", "vars.a | vars.b"},
+		{"missing close paren", "(vars.a == 1"},
+		{"extra close paren", "vars.a == 1)"},
+		{"unterminated string", "vars.a == 'x"},
+		{"missing right operand", "vars.a =="},
+		{"illegal number", "1.2.3 > 1"},
+		{"trailing token", "vars.a == 1 vars.b"},
+		{"empty path segment", "vars..a == 1"},
+		{"illegal character", "vars.a == #"},
+	}
+	for _, c := range cases {
+		if _, err := ParseBoolExpression(c.expression); err == nil {
+			t.Errorf("%s: %q expect parse error", c.name, c.expression)
+		}
+	}
+}
+
+func TestBoolExpressionVariables(t *testing.T) {
+	expr, err := ParseBoolExpression("vars.a == 1 && (root.b != 'x' || !context.c)")
+	if err != nil {
+		t.Fatalf("parse fail,%s", err.Error())
+	}
+	variables := expr.Variables()
+	expect := []string{"vars.a", "root.b", "context.c"}
+	if len(variables) != len(expect) {
+		t.Fatalf("expect variables %v but got %v", expect, variables)
+	}
+	for i := range expect {
+		if variables[i] != expect[i] {
+			t.Errorf("expect variables %v but got %v", expect, variables)
+		}
+	}
+}
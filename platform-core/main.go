@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"github.com/WeBankPartners/wecube-platform/platform-core/api"
@@ -13,6 +14,10 @@ import (
 	"github.com/WeBankPartners/wecube-platform/platform-core/services/cron"
 	"github.com/WeBankPartners/wecube-platform/platform-core/services/remote"
 	"github.com/WeBankPartners/wecube-platform/platform-core/services/workflow"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 func main() {
@@ -35,5 +40,28 @@ func main() {
 	process.InitProcScheduleTimer()
 	go data_trans.StartExecWorkflowCron()
 	//start http
-	api.InitHttpServer()
+	httpErrChan := make(chan error, 1)
+	go func() {
+		httpErrChan <- api.InitHttpServer()
+	}()
+	// 收到退出信号后先停止受理并释放工作流,再关闭http服务,http服务监听失败时直接退出
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT)
+	var sig os.Signal
+	select {
+	case sig = <-sigChan:
+	case httpErr := <-httpErrChan:
+		log.Logger.Error("http server exit unexpectedly", log.Error(httpErr))
+		os.Exit(1)
+	}
+	shutdownTimeout := models.Config.HttpServer.ShutdownTimeout
+	if shutdownTimeout <= 0 {
+		shutdownTimeout = models.DefaultShutdownTimeout
+	}
+	log.Logger.Info("receive quit signal,start graceful shutdown", log.String("signal", sig.String()), log.Int("timeout", shutdownTimeout))
+	workflow.Drain(time.Duration(shutdownTimeout) * time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	api.ShutdownHttpServer(ctx)
+	log.Logger.Info("graceful shutdown done")
 }
@@ -0,0 +1,365 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	TimeNodeTypeWindow = "window" // 时间节点等到日历的下一个维护窗口
+	TimeNodeAdjustNext = "next"   // 日期节点的日期落在非工作时间时顺延到下一个工作时间
+
+	CalendarDateFormat     = "2006-01-02"
+	calendarSearchMaxDays  = 366 * 2
+	calendarAllWeekDay     = "*"
+	calendarMinutesOfDay   = 24 * 60
+	calendarWindowSplitter = ";"
+)
+
+// BusinessCalendar 业务日历,时间节点和定时任务按名称引用,计算工作日、工作时间和维护窗口
+type BusinessCalendar struct {
+	Id                 string    `json:"id" xorm:"id"`                                  // 唯一标识
+	Name               string    `json:"name" xorm:"name"`                              // 日历名称,唯一,创建后不能修改
+	Description        string    `json:"description" xorm:"description"`                // 描述
+	TimeZone           string    `json:"timeZone" xorm:"time_zone"`                     // 时区,如Asia/Shanghai,为空时用服务器时区
+	WorkDays           string    `json:"workDays" xorm:"work_days"`                     // 工作日,逗号分隔的星期几,0表示周日,如1,2,3,4,5
+	WorkHours          string    `json:"workHours" xorm:"work_hours"`                   // 工作时间段,逗号分隔,如09:00-12:00,13:30-18:00,为空表示全天
+	Holidays           string    `json:"holidays" xorm:"holidays"`                      // 节假日,逗号分隔的日期,如2026-10-01,2026-10-02
+	ExtraWorkDates     string    `json:"extraWorkDates" xorm:"extra_work_dates"`        // 调休上班日,逗号分隔的日期,优先于节假日和工作日
+	MaintenanceWindows string    `json:"maintenanceWindows" xorm:"maintenance_windows"` // 维护窗口,分号分隔,如6 22:00-24:00;* 02:00-04:00,结束早于开始表示跨天,节假日不开窗口
+	CreatedBy          string    `json:"createdBy" xorm:"created_by"`                   // 创建人
+	CreatedTime        time.Time `json:"createdTime" xorm:"created_time"`               // 创建时间
+	UpdatedBy          string    `json:"updatedBy" xorm:"updated_by"`                   // 更新人
+	UpdatedTime        time.Time `json:"updatedTime" xorm:"updated_time"`               // 更新时间
+}
+
+// BusinessCalendarCalcParam 按日历试算时间节点的触发时间
+type BusinessCalendarCalcParam struct {
+	TimeNodeParam
+	From string `json:"from"` // 开始时间,为空表示当前时间,格式2006-01-02 15:04:05
+}
+
+// BusinessCalendarRule 解析后的业务日历,用于计算时间
+type BusinessCalendarRule struct {
+	Name           string
+	Location       *time.Location
+	workDays       map[time.Weekday]bool
+	workHours      []*calendarMinuteRange
+	holidays       map[string]bool
+	extraWorkDates map[string]bool
+	windows        []*calendarWindow
+}
+
+// calendarMinuteRange 一天内的时间段,按从0点开始的分钟数
+type calendarMinuteRange struct {
+	start int
+	end   int
+}
+
+// calendarWindow 维护窗口,weekDay为-1表示每天,end小于等于start表示跨天
+type calendarWindow struct {
+	weekDay int
+	calendarMinuteRange
+}
+
+// ParseBusinessCalendar 校验并解析业务日历配置
+func ParseBusinessCalendar(row *BusinessCalendar) (rule *BusinessCalendarRule, err error) {
+	rule = &BusinessCalendarRule{Name: row.Name, Location: time.Local, workDays: make(map[time.Weekday]bool), holidays: make(map[string]bool), extraWorkDates: make(map[string]bool)}
+	if row.TimeZone != "" {
+		if rule.Location, err = time.LoadLocation(row.TimeZone); err != nil {
+			err = fmt.Errorf("timeZone:%s illegal", row.TimeZone)
+			return
+		}
+	}
+	for _, v := range splitCalendarList(row.WorkDays, ",") {
+		weekDay, parseErr := strconv.Atoi(v)
+		if parseErr != nil || weekDay < 0 || weekDay > 6 {
+			err = fmt.Errorf("workDays:%s illegal", v)
+			return
+		}
+		rule.workDays[time.Weekday(weekDay)] = true
+	}
+	// 没有工作日时工作时间无法累计,不允许保存
+	if len(rule.workDays) == 0 {
+		err = fmt.Errorf("workDays can not be empty")
+		return
+	}
+	for _, v := range splitCalendarList(row.WorkHours, ",") {
+		minuteRange, parseErr := parseCalendarMinuteRange(v)
+		if parseErr != nil || minuteRange.end <= minuteRange.start {
+			err = fmt.Errorf("workHours:%s illegal", v)
+			return
+		}
+		rule.workHours = append(rule.workHours, minuteRange)
+	}
+	sort.Slice(rule.workHours, func(i, j int) bool {
+		return rule.workHours[i].start < rule.workHours[j].start
+	})
+	for i := 1; i < len(rule.workHours); i++ {
+		if rule.workHours[i].start < rule.workHours[i-1].end {
+			err = fmt.Errorf("workHours:%s overlap", row.WorkHours)
+			return
+		}
+	}
+	for _, dateMap := range []struct {
+		input  string
+		target map[string]bool
+	}{{row.Holidays, rule.holidays}, {row.ExtraWorkDates, rule.extraWorkDates}} {
+		for _, v := range splitCalendarList(dateMap.input, ",") {
+			if _, parseErr := time.Parse(CalendarDateFormat, v); parseErr != nil {
+				err = fmt.Errorf("date:%s illegal", v)
+				return
+			}
+			dateMap.target[v] = true
+		}
+	}
+	for _, v := range splitCalendarList(row.MaintenanceWindows, calendarWindowSplitter) {
+		window, parseErr := parseCalendarWindow(v)
+		if parseErr != nil {
+			err = fmt.Errorf("maintenanceWindows:%s illegal", v)
+			return
+		}
+		rule.windows = append(rule.windows, window)
+	}
+	sort.Slice(rule.windows, func(i, j int) bool {
+		return rule.windows[i].start < rule.windows[j].start
+	})
+	return
+}
+
+func splitCalendarList(input, splitter string) (result []string) {
+	for _, v := range strings.Split(input, splitter) {
+		if v = strings.TrimSpace(v); v != "" {
+			result = append(result, v)
+		}
+	}
+	return
+}
+
+// parseCalendarMinuteRange 解析09:00-18:00格式的时间段,结束时间支持24:00
+func parseCalendarMinuteRange(input string) (result *calendarMinuteRange, err error) {
+	timeList := strings.Split(input, "-")
+	if len(timeList) != 2 {
+		err = fmt.Errorf("time range:%s illegal", input)
+		return
+	}
+	result = &calendarMinuteRange{}
+	if result.start, err = parseCalendarMinute(timeList[0]); err != nil {
+		return
+	}
+	result.end, err = parseCalendarMinute(timeList[1])
+	return
+}
+
+func parseCalendarMinute(input string) (minute int, err error) {
+	hourMinute := strings.Split(strings.TrimSpace(input), ":")
+	if len(hourMinute) != 2 {
+		err = fmt.Errorf("time:%s illegal", input)
+		return
+	}
+	hour, hourErr := strconv.Atoi(hourMinute[0])
+	minuteValue, minuteErr := strconv.Atoi(hourMinute[1])
+	if hourErr != nil || minuteErr != nil || hour < 0 || minuteValue < 0 || minuteValue > 59 || hour*60+minuteValue > calendarMinutesOfDay {
+		err = fmt.Errorf("time:%s illegal", input)
+		return
+	}
+	minute = hour*60 + minuteValue
+	return
+}
+
+// parseCalendarWindow 解析"6 22:00-24:00"格式的维护窗口,星期为*表示每天
+func parseCalendarWindow(input string) (result *calendarWindow, err error) {
+	fields := strings.Fields(input)
+	if len(fields) != 2 {
+		err = fmt.Errorf("window:%s illegal", input)
+		return
+	}
+	result = &calendarWindow{weekDay: -1}
+	if fields[0] != calendarAllWeekDay {
+		if result.weekDay, err = strconv.Atoi(fields[0]); err != nil || result.weekDay < 0 || result.weekDay > 6 {
+			err = fmt.Errorf("window weekday:%s illegal", fields[0])
+			return
+		}
+	}
+	minuteRange, parseErr := parseCalendarMinuteRange(fields[1])
+	if parseErr != nil {
+		err = parseErr
+		return
+	}
+	result.calendarMinuteRange = *minuteRange
+	return
+}
+
+func (r *BusinessCalendarRule) dayStart(t time.Time) time.Time {
+	t = t.In(r.Location)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, r.Location)
+}
+
+func (r *BusinessCalendarRule) dayMinute(day time.Time, minute int) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), 0, minute, 0, 0, r.Location)
+}
+
+// IsWorkDay 是否工作日,调休上班日优先,其次节假日,最后按星期判断
+func (r *BusinessCalendarRule) IsWorkDay(t time.Time) bool {
+	t = t.In(r.Location)
+	date := t.Format(CalendarDateFormat)
+	if r.extraWorkDates[date] {
+		return true
+	}
+	if r.holidays[date] {
+		return false
+	}
+	return r.workDays[t.Weekday()]
+}
+
+// IsHoliday 是否节假日,调休上班日不算节假日
+func (r *BusinessCalendarRule) IsHoliday(t time.Time) bool {
+	date := t.In(r.Location).Format(CalendarDateFormat)
+	return r.holidays[date] && !r.extraWorkDates[date]
+}
+
+// IsWorkTime 是否在工作日的工作时间段内
+func (r *BusinessCalendarRule) IsWorkTime(t time.Time) bool {
+	return r.NextWorkTime(t).Equal(t)
+}
+
+// dayWorkRanges 一天的工作时间段,非工作日返回空,没有配置工作时间段时为全天
+func (r *BusinessCalendarRule) dayWorkRanges(day time.Time) (result [][2]time.Time) {
+	if !r.IsWorkDay(day) {
+		return
+	}
+	if len(r.workHours) == 0 {
+		return [][2]time.Time{{day, day.AddDate(0, 0, 1)}}
+	}
+	for _, v := range r.workHours {
+		result = append(result, [2]time.Time{r.dayMinute(day, v.start), r.dayMinute(day, v.end)})
+	}
+	return
+}
+
+// NextWorkTime 不早于t的第一个工作时间,t在工作时间内时返回t
+func (r *BusinessCalendarRule) NextWorkTime(t time.Time) time.Time {
+	day := r.dayStart(t)
+	for i := 0; i < calendarSearchMaxDays; i++ {
+		for _, workRange := range r.dayWorkRanges(day) {
+			if t.Before(workRange[1]) {
+				if t.Before(workRange[0]) {
+					return workRange[0]
+				}
+				return t
+			}
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+	return t
+}
+
+// AddWorkDuration 从t开始只计算工作时间,累计duration后的时间
+func (r *BusinessCalendarRule) AddWorkDuration(t time.Time, duration time.Duration) time.Time {
+	if duration <= 0 {
+		return r.NextWorkTime(t)
+	}
+	day := r.dayStart(t)
+	for i := 0; i < calendarSearchMaxDays; i++ {
+		for _, workRange := range r.dayWorkRanges(day) {
+			if !t.Before(workRange[1]) {
+				continue
+			}
+			if t.Before(workRange[0]) {
+				t = workRange[0]
+			}
+			available := workRange[1].Sub(t)
+			if duration <= available {
+				return t.Add(duration)
+			}
+			duration -= available
+			t = workRange[1]
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+	return t.Add(duration)
+}
+
+// AddWorkDays 往后数days个工作日,保持时分秒不变,落在非工作时间时顺延到下一个工作时间
+func (r *BusinessCalendarRule) AddWorkDays(t time.Time, days int) time.Time {
+	t = t.In(r.Location)
+	for i := 0; days > 0 && i < calendarSearchMaxDays; i++ {
+		t = t.AddDate(0, 0, 1)
+		if r.IsWorkDay(t) {
+			days--
+		}
+	}
+	return r.NextWorkTime(t)
+}
+
+// NextMaintenanceWindow 不早于t的第一个维护窗口开始时间,t在窗口内时返回t,没有窗口时返回false
+func (r *BusinessCalendarRule) NextMaintenanceWindow(t time.Time) (result time.Time, ok bool) {
+	if len(r.windows) == 0 {
+		return
+	}
+	// 从前一天开始找,前一天开始的跨天窗口可能还没结束
+	day := r.dayStart(t).AddDate(0, 0, -1)
+	for i := 0; i < calendarSearchMaxDays; i++ {
+		if !r.IsHoliday(day) {
+			for _, window := range r.windows {
+				if window.weekDay >= 0 && time.Weekday(window.weekDay) != day.Weekday() {
+					continue
+				}
+				windowStart, windowEnd := r.dayMinute(day, window.start), r.dayMinute(day, window.end)
+				if window.end <= window.start {
+					windowEnd = windowEnd.AddDate(0, 0, 1)
+				}
+				if t.Before(windowEnd) {
+					if t.Before(windowStart) {
+						return windowStart, true
+					}
+					return t, true
+				}
+			}
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+	return
+}
+
+// CalcTimeNodeFireTime 按日历计算时间节点的触发时间,day按工作日计算,hour/min/sec只计算工作时间
+func (r *BusinessCalendarRule) CalcTimeNodeFireTime(param *TimeNodeParam, from time.Time) (fireTime time.Time, err error) {
+	if param.Type == TimeNodeTypeWindow {
+		var ok bool
+		if fireTime, ok = r.NextMaintenanceWindow(from); !ok {
+			err = fmt.Errorf("calendar %s has no maintenance window", r.Name)
+		}
+		return
+	}
+	if param.Duration < 0 {
+		err = fmt.Errorf("duration:%d illegal", param.Duration)
+		return
+	}
+	switch param.Unit {
+	case "sec":
+		fireTime = r.AddWorkDuration(from, time.Duration(param.Duration)*time.Second)
+	case "min":
+		fireTime = r.AddWorkDuration(from, time.Duration(param.Duration)*time.Minute)
+	case "hour":
+		fireTime = r.AddWorkDuration(from, time.Duration(param.Duration)*time.Hour)
+	case "day":
+		fireTime = r.AddWorkDays(from, param.Duration)
+	default:
+		err = fmt.Errorf("unit:%s illegal", param.Unit)
+	}
+	return
+}
+
+// ParseDate 按日历时区解析日期节点的日期,配置了顺延时落在非工作时间的顺延到下一个工作时间
+func (r *BusinessCalendarRule) ParseDate(param *TimeNodeParam) (result time.Time, err error) {
+	if result, err = time.ParseInLocation(DateTimeFormat, param.Date, r.Location); err != nil {
+		return
+	}
+	if param.Adjust == TimeNodeAdjustNext {
+		result = r.NextWorkTime(result)
+	}
+	return
+}
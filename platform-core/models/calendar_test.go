@@ -0,0 +1,139 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestCalendarRule(t *testing.T) *BusinessCalendarRule {
+	rule, err := ParseBusinessCalendar(&BusinessCalendar{
+		Name:               "test",
+		TimeZone:           "UTC",
+		WorkDays:           "1,2,3,4,5",
+		WorkHours:          "13:30-18:00,09:00-12:00",
+		Holidays:           "2026-10-01,2026-10-02,2026-10-05",
+		ExtraWorkDates:     "2026-10-10",
+		MaintenanceWindows: "6 22:00-02:00",
+	})
+	if err != nil {
+		t.Fatalf("parse calendar fail,%s", err.Error())
+	}
+	return rule
+}
+
+func parseTestCalendarTime(t *testing.T, value string) time.Time {
+	result, err := time.ParseInLocation(DateTimeFormat, value, time.UTC)
+	if err != nil {
+		t.Fatalf("parse time %s fail,%s", value, err.Error())
+	}
+	return result
+}
+
+func TestBusinessCalendarIsWorkDay(t *testing.T) {
+	rule := newTestCalendarRule(t)
+	cases := []struct {
+		name   string
+		date   string
+		expect bool
+	}{
+		{"normal workday", "2026-10-08 10:00:00", true},
+		{"holiday on workday", "2026-10-01 10:00:00", false},
+		{"weekend", "2026-10-03 10:00:00", false},
+		{"extra work date on weekend", "2026-10-10 10:00:00", true},
+	}
+	for _, c := range cases {
+		if result := rule.IsWorkDay(parseTestCalendarTime(t, c.date)); result != c.expect {
+			t.Errorf("%s: %s expect %v but got %v", c.name, c.date, c.expect, result)
+		}
+	}
+}
+
+func TestBusinessCalendarAddWorkDuration(t *testing.T) {
+	rule := newTestCalendarRule(t)
+	cases := []struct {
+		name     string
+		from     string
+		duration time.Duration
+		expect   string
+	}{
+		{"inside work range", "2026-10-08 10:00:00", time.Hour, "2026-10-08 11:00:00"},
+		{"skip lunch break", "2026-10-08 10:00:00", 3 * time.Hour, "2026-10-08 14:30:00"},
+		{"before work start", "2026-10-08 07:00:00", time.Hour, "2026-10-08 10:00:00"},
+		{"cross end of workday", "2026-10-08 17:00:00", 2 * time.Hour, "2026-10-09 10:00:00"},
+		{"end exactly at end of workday", "2026-10-08 17:00:00", time.Hour, "2026-10-08 18:00:00"},
+		{"cross weekend to extra work date", "2026-10-09 17:30:00", time.Hour, "2026-10-10 09:30:00"},
+		{"start on weekend", "2026-10-11 08:00:00", 30 * time.Minute, "2026-10-12 09:30:00"},
+		{"cross holidays and weekend", "2026-09-30 17:00:00", 2 * time.Hour, "2026-10-06 10:00:00"},
+		{"zero duration at lunch break", "2026-10-08 12:30:00", 0, "2026-10-08 13:30:00"},
+	}
+	for _, c := range cases {
+		result := rule.AddWorkDuration(parseTestCalendarTime(t, c.from), c.duration)
+		if expect := parseTestCalendarTime(t, c.expect); !result.Equal(expect) {
+			t.Errorf("%s: %s add %s expect %s but got %s", c.name, c.from, c.duration, c.expect, result.Format(DateTimeFormat))
+		}
+	}
+}
+
+func TestBusinessCalendarAddWorkDays(t *testing.T) {
+	rule := newTestCalendarRule(t)
+	cases := []struct {
+		name   string
+		from   string
+		days   int
+		expect string
+	}{
+		{"next workday", "2026-10-08 10:00:00", 1, "2026-10-09 10:00:00"},
+		{"skip holidays and weekend", "2026-09-30 10:00:00", 1, "2026-10-06 10:00:00"},
+		{"extra work date", "2026-10-09 10:00:00", 1, "2026-10-10 10:00:00"},
+		{"adjust to work time", "2026-10-08 12:30:00", 1, "2026-10-09 13:30:00"},
+	}
+	for _, c := range cases {
+		result := rule.AddWorkDays(parseTestCalendarTime(t, c.from), c.days)
+		if expect := parseTestCalendarTime(t, c.expect); !result.Equal(expect) {
+			t.Errorf("%s: %s add %d days expect %s but got %s", c.name, c.from, c.days, c.expect, result.Format(DateTimeFormat))
+		}
+	}
+}
+
+func TestBusinessCalendarNextMaintenanceWindow(t *testing.T) {
+	rule := newTestCalendarRule(t)
+	cases := []struct {
+		name   string
+		from   string
+		expect string
+	}{
+		{"before window", "2026-10-10 10:00:00", "2026-10-10 22:00:00"},
+		{"inside cross day window", "2026-10-11 01:00:00", "2026-10-11 01:00:00"},
+		{"after window", "2026-10-11 03:00:00", "2026-10-17 22:00:00"},
+	}
+	for _, c := range cases {
+		result, ok := rule.NextMaintenanceWindow(parseTestCalendarTime(t, c.from))
+		if !ok {
+			t.Errorf("%s: %s expect window but got none", c.name, c.from)
+			continue
+		}
+		if expect := parseTestCalendarTime(t, c.expect); !result.Equal(expect) {
+			t.Errorf("%s: %s expect %s but got %s", c.name, c.from, c.expect, result.Format(DateTimeFormat))
+		}
+	}
+}
+
+func TestParseBusinessCalendarError(t *testing.T) {
+	cases := []struct {
+		name string
+		row  BusinessCalendar
+	}{
+		{"empty work days", BusinessCalendar{WorkDays: " , "}},
+		{"illegal work day", BusinessCalendar{WorkDays: "1,7"}},
+		{"illegal time zone", BusinessCalendar{WorkDays: "1", TimeZone: "Mars/Base"}},
+		{"work hours end before start", BusinessCalendar{WorkDays: "1", WorkHours: "18:00-09:00"}},
+		{"work hours overlap", BusinessCalendar{WorkDays: "1", WorkHours: "09:00-12:00,11:00-13:00"}},
+		{"illegal holiday", BusinessCalendar{WorkDays: "1", Holidays: "2026-13-01"}},
+		{"illegal window", BusinessCalendar{WorkDays: "1", MaintenanceWindows: "8 22:00-24:00"}},
+	}
+	for _, c := range cases {
+		if _, err := ParseBusinessCalendar(&c.row); err == nil {
+			t.Errorf("%s: expect parse error", c.name)
+		}
+	}
+}
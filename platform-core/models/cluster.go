@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+const (
+	ClusterMemberStatusActive  = "active"  // 正常参与分配
+	ClusterMemberStatusLeaving = "leaving" // 正在退出,不再分配新的工作
+
+	ClusterMemberAliveTimeout   = 30  // 超过该秒数没有心跳的实例视为离开
+	ClusterOwnerFallbackTimeout = 120 // 工作超过该秒数没人处理时任何实例都可以接手
+	ClusterVirtualNodeNum       = 64  // 一致性hash每个实例的虚拟节点数
+	ClusterRebalanceBatchSize   = 20  // 每轮最多迁出的工作流数
+)
+
+// CoreClusterMember core集群成员,各实例定时心跳上报负载
+type CoreClusterMember struct {
+	Host          string    `json:"host" xorm:"host"`                     // 实例地址
+	Status        string    `json:"status" xorm:"status"`                 // 状态->active | leaving
+	WorkflowNum   int       `json:"workflowNum" xorm:"workflow_num"`      // 内存中运行的工作流数
+	BusyNodeNum   int       `json:"busyNodeNum" xorm:"busy_node_num"`     // 正在调插件的节点数
+	StartTime     time.Time `json:"startTime" xorm:"start_time"`          // 启动时间
+	LastAliveTime time.Time `json:"lastAliveTime" xorm:"last_alive_time"` // 最近心跳时间
+}
+
+// ClusterMemberLoad 集群成员及负载
+type ClusterMemberLoad struct {
+	CoreClusterMember
+	Alive          bool `json:"alive"`          // 是否存活
+	OwnedWorkflows int  `json:"ownedWorkflows"` // 数据库中归属该实例的运行中工作流数
+}
@@ -14,6 +14,7 @@ type HttpServerConfig struct {
 	Cross             bool   `json:"cross"`
 	ErrorTemplateDir  string `json:"error_template_dir"`
 	ErrorDetailReturn bool   `json:"error_detail_return"`
+	ShutdownTimeout   int    `json:"shutdown_timeout"` // 优雅退出时等待运行中节点完成的秒数
 }
 
 type LogConfig struct {
@@ -58,6 +58,7 @@ const (
 	BatchExecErrorCodePending           = "2"
 	BatchExecErrorCodeDangerousBlock    = "3"
 	DefaultKeepBatchExecDays            = 365
+	DefaultShutdownTimeout              = 60
 	BatchExecEncryptPrefix              = "encrypt "
 
 	// permission type
@@ -91,6 +92,9 @@ const (
 	ProcEventStatusPending = "pending"
 	ProcEventStatusDone    = "done"
 	ProcEventStatusFail    = "fail"
+	// 恢复等待信号节点的事件
+	ProcEventStatusMatched   = "matched"
+	ProcEventStatusUnmatched = "unmatched"
 
 	SensitiveDisplay = "******"
 )
@@ -0,0 +1,118 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	ApprovalModeAny    = "any"    // 任意一人同意即通过
+	ApprovalModeAll    = "all"    // 所有人同意才通过
+	ApprovalModeQuorum = "quorum" // 同意人数达到quorum即通过
+
+	ApproverTypeRole = "role" // 角色内任意用户可以投票
+	ApproverTypeUser = "user" // 指定用户投票
+
+	ApprovalStatusWait     = "wait"     // 等待投票
+	ApprovalStatusApprove  = "approve"  // 同意
+	ApprovalStatusReject   = "reject"   // 拒绝
+	ApprovalStatusCanceled = "canceled" // 节点已有结果或重试,未投的票作废
+
+	ApprovalResultPass   = "pass"
+	ApprovalResultReject = "reject"
+)
+
+// ProcNodeApprovalPolicy 人工节点多人审批策略,配置后节点结果由审批票决定
+type ProcNodeApprovalPolicy struct {
+	Mode             string              `json:"mode"`             // 审批方式->any | all | quorum
+	Quorum           int                 `json:"quorum"`           // quorum时通过需要的同意票数
+	Approvers        []*ProcNodeApprover `json:"approvers"`        // 审批人,每个审批人一票
+	PassOption       string              `json:"passOption"`       // 通过时节点的输出,用于后面的判断节点
+	RejectOption     string              `json:"rejectOption"`     // 拒绝时节点的输出,为空时拒绝则节点失败
+	ReminderInterval int                 `json:"reminderInterval"` // 提醒间隔小时数,0表示不提醒
+	EscalationHours  int                 `json:"escalationHours"`  // 超过该小时数未投的票升级给escalationRole,0表示不升级
+	EscalationRole   string              `json:"escalationRole"`   // 升级角色
+}
+
+// ProcNodeApprover 审批人
+type ProcNodeApprover struct {
+	Type string `json:"type"` // 类型->role | user
+	Name string `json:"name"` // 角色名或用户名
+}
+
+func (p *ProcNodeApprovalPolicy) String() string {
+	if p == nil || len(p.Approvers) == 0 {
+		return ""
+	}
+	b, _ := json.Marshal(p)
+	return string(b)
+}
+
+// ParseProcNodeApprovalPolicy 解析节点定义中的审批策略,没有配置或配置非法时返回nil
+func ParseProcNodeApprovalPolicy(input string) *ProcNodeApprovalPolicy {
+	if input == "" {
+		return nil
+	}
+	policy := ProcNodeApprovalPolicy{}
+	if err := json.Unmarshal([]byte(input), &policy); err != nil || len(policy.Approvers) == 0 {
+		return nil
+	}
+	return &policy
+}
+
+// RequiredNum 通过需要的同意票数
+func (p *ProcNodeApprovalPolicy) RequiredNum() int {
+	switch p.Mode {
+	case ApprovalModeAll:
+		return len(p.Approvers)
+	case ApprovalModeQuorum:
+		return p.Quorum
+	}
+	return 1
+}
+
+// Decide 按已投的票判断审批结果,还不能确定时返回空
+func (p *ProcNodeApprovalPolicy) Decide(approveNum, rejectNum int) string {
+	requiredNum := p.RequiredNum()
+	if approveNum >= requiredNum {
+		return ApprovalResultPass
+	}
+	if rejectNum > len(p.Approvers)-requiredNum {
+		return ApprovalResultReject
+	}
+	return ""
+}
+
+// ProcRunApproval 人工节点审批票,每个审批人一条
+type ProcRunApproval struct {
+	Id            string    `json:"id" xorm:"id"`                          // 唯一标识
+	WorkflowId    string    `json:"workflowId" xorm:"workflow_id"`         // 工作流id
+	ProcInsId     string    `json:"procInsId" xorm:"proc_ins_id"`          // 编排实例id
+	ProcInsNodeId string    `json:"procInsNodeId" xorm:"proc_ins_node_id"` // 编排实例节点id
+	ProcRunNodeId string    `json:"procRunNodeId" xorm:"proc_run_node_id"` // 工作流节点id
+	NodeName      string    `json:"nodeName" xorm:"node_name"`             // 节点名称
+	Round         int       `json:"round" xorm:"round"`                    // 审批轮次,节点重试时开始新一轮
+	ApproverType  string    `json:"approverType" xorm:"approver_type"`     // 审批人类型->role | user
+	Approver      string    `json:"approver" xorm:"approver"`              // 角色名或用户名
+	DelegateTo    string    `json:"delegateTo" xorm:"delegate_to"`         // 转交给的用户,转交后只有该用户可以投票
+	EscalatedFrom string    `json:"escalatedFrom" xorm:"escalated_from"`   // 升级前的审批人
+	Status        string    `json:"status" xorm:"status"`                  // 状态->wait | approve | reject | canceled
+	Comment       string    `json:"comment" xorm:"comment"`                // 审批意见
+	VotedBy       string    `json:"votedBy" xorm:"voted_by"`               // 投票人
+	RemindedTime  time.Time `json:"remindedTime" xorm:"reminded_time"`     // 最近提醒时间
+	CreatedTime   time.Time `json:"createdTime" xorm:"created_time"`       // 创建时间
+	UpdatedTime   time.Time `json:"updatedTime" xorm:"updated_time"`       // 更新时间
+}
+
+// ProcRunApprovalVoteParam 审批投票
+type ProcRunApprovalVoteParam struct {
+	Decision string `json:"decision"` // approve | reject
+	Comment  string `json:"comment"`  // 审批意见
+}
+
+// ProcRunApprovalDelegateParam 转交审批票
+type ProcRunApprovalDelegateParam struct {
+	ApprovalId string `json:"approvalId"` // 审批票id
+	DelegateTo string `json:"delegateTo"` // 转交给的用户
+	Comment    string `json:"comment"`    // 说明
+}
@@ -0,0 +1,661 @@
+package models
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"github.com/WeBankPartners/go-common-lib/guid"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	BpmnModelNamespace  = "http://www.omg.org/spec/BPMN/20100524/MODEL"
+	BpmnWecubeNamespace = "http://www.webank.com/schema/wecube/bpmn"
+	BpmnExporter        = "WeCube"
+
+	BpmnGatewayConverging = "Converging"
+	BpmnGatewayDiverging  = "Diverging"
+)
+
+var bpmnDurationRegexp = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// BpmnDefinitions BPMN2.0文档,一个文档可以包含多个编排,WeCube特有的配置放在extensionElements里
+type BpmnDefinitions struct {
+	XMLName         xml.Name       `xml:"definitions"`
+	Xmlns           string         `xml:"xmlns,attr"`
+	Id              string         `xml:"id,attr"`
+	TargetNamespace string         `xml:"targetNamespace,attr"`
+	Exporter        string         `xml:"exporter,attr,omitempty"`
+	Processes       []*BpmnProcess `xml:"process"`
+	Diagrams        []*BpmnDiagram `xml:"http://www.omg.org/spec/BPMN/20100524/DI BPMNDiagram"`
+}
+
+type BpmnProcess struct {
+	Id                      string                 `xml:"id,attr"`
+	Name                    string                 `xml:"name,attr,omitempty"`
+	IsExecutable            bool                   `xml:"isExecutable,attr"`
+	Documentation           string                 `xml:"documentation,omitempty"`
+	ExtensionElements       *BpmnExtensionElements `xml:"extensionElements"`
+	StartEvents             []*BpmnFlowNode        `xml:"startEvent"`
+	EndEvents               []*BpmnFlowNode        `xml:"endEvent"`
+	IntermediateCatchEvents []*BpmnFlowNode        `xml:"intermediateCatchEvent"`
+	Tasks                   []*BpmnFlowNode        `xml:"task"`
+	ServiceTasks            []*BpmnFlowNode        `xml:"serviceTask"`
+	SendTasks               []*BpmnFlowNode        `xml:"sendTask"`
+	BusinessRuleTasks       []*BpmnFlowNode        `xml:"businessRuleTask"`
+	ScriptTasks             []*BpmnFlowNode        `xml:"scriptTask"`
+	UserTasks               []*BpmnFlowNode        `xml:"userTask"`
+	ManualTasks             []*BpmnFlowNode        `xml:"manualTask"`
+	CallActivities          []*BpmnFlowNode        `xml:"callActivity"`
+	ExclusiveGateways       []*BpmnFlowNode        `xml:"exclusiveGateway"`
+	ParallelGateways        []*BpmnFlowNode        `xml:"parallelGateway"`
+	SequenceFlows           []*BpmnSequenceFlow    `xml:"sequenceFlow"`
+}
+
+type BpmnFlowNode struct {
+	Id                    string                    `xml:"id,attr"`
+	Name                  string                    `xml:"name,attr,omitempty"`
+	CalledElement         string                    `xml:"calledElement,attr,omitempty"`    // callActivity调用的子编排
+	GatewayDirection      string                    `xml:"gatewayDirection,attr,omitempty"` // 网关方向->Converging | Diverging
+	Default               string                    `xml:"default,attr,omitempty"`          // 排他网关的默认分支
+	Documentation         string                    `xml:"documentation,omitempty"`
+	ExtensionElements     *BpmnExtensionElements    `xml:"extensionElements"`
+	Incoming              []string                  `xml:"incoming"`
+	Outgoing              []string                  `xml:"outgoing"`
+	StandardLoop          *BpmnEventDefinition      `xml:"standardLoopCharacteristics"`
+	MultiInstanceLoop     *BpmnEventDefinition      `xml:"multiInstanceLoopCharacteristics"`
+	TimerEventDefinition  *BpmnTimerEventDefinition `xml:"timerEventDefinition"`
+	SignalEventDefinition *BpmnEventDefinition      `xml:"signalEventDefinition"`
+	ErrorEventDefinition  *BpmnEventDefinition      `xml:"errorEventDefinition"`
+}
+
+type BpmnEventDefinition struct {
+	Id string `xml:"id,attr,omitempty"`
+}
+
+type BpmnTimerEventDefinition struct {
+	Id           string          `xml:"id,attr,omitempty"`
+	TimeDate     *BpmnExpression `xml:"timeDate"`
+	TimeDuration *BpmnExpression `xml:"timeDuration"`
+}
+
+type BpmnExpression struct {
+	Body string `xml:",chardata"`
+}
+
+type BpmnSequenceFlow struct {
+	Id                  string                 `xml:"id,attr"`
+	Name                string                 `xml:"name,attr,omitempty"`
+	SourceRef           string                 `xml:"sourceRef,attr"`
+	TargetRef           string                 `xml:"targetRef,attr"`
+	ExtensionElements   *BpmnExtensionElements `xml:"extensionElements"`
+	ConditionExpression *BpmnExpression        `xml:"conditionExpression"`
+}
+
+type BpmnExtensionElements struct {
+	ProcDef *BpmnWecubeProcDef `xml:"http://www.webank.com/schema/wecube/bpmn procDef"`
+	Node    *BpmnWecubeNode    `xml:"http://www.webank.com/schema/wecube/bpmn node"`
+	Link    *BpmnWecubeLink    `xml:"http://www.webank.com/schema/wecube/bpmn link"`
+}
+
+// BpmnWecubeProcDef 编排属性和权限
+type BpmnWecubeProcDef struct {
+	Id                string   `xml:"id,attr,omitempty"`
+	Key               string   `xml:"key,attr,omitempty"`
+	Version           string   `xml:"version,attr,omitempty"`
+	RootEntity        string   `xml:"rootEntity,attr,omitempty"`
+	Status            string   `xml:"status,attr,omitempty"`
+	Tags              string   `xml:"tags,attr,omitempty"`
+	Scene             string   `xml:"scene,attr,omitempty"`
+	ConflictCheck     bool     `xml:"conflictCheck,attr,omitempty"`
+	SubProc           bool     `xml:"subProc,attr,omitempty"`
+	AuthPlugins       []string `xml:"authPlugin"`
+	MgmtRoles         []string `xml:"mgmtRole"`
+	UseRoles          []string `xml:"useRole"`
+	Variables         string   `xml:"variables,omitempty"`         // 编排变量json
+	ConcurrencyPolicy string   `xml:"concurrencyPolicy,omitempty"` // 并发控制json
+}
+
+// BpmnWecubeNode 编排节点配置,BPMN元素不能表达的配置都放在这里
+type BpmnWecubeNode struct {
+	NodeId            string             `xml:"nodeId,attr"`
+	NodeType          string             `xml:"nodeType,attr"`
+	Status            string             `xml:"status,attr,omitempty"`
+	ServiceName       string             `xml:"serviceName,attr,omitempty"`
+	RoutineExpression string             `xml:"routineExpression,attr,omitempty"`
+	Timeout           int                `xml:"timeout,attr,omitempty"`
+	RiskCheck         bool               `xml:"riskCheck,attr,omitempty"`
+	DynamicBind       int                `xml:"dynamicBind,attr,omitempty"`
+	BindNodeId        string             `xml:"bindNodeId,attr,omitempty"`
+	AllowContinue     bool               `xml:"allowContinue,attr,omitempty"`
+	ContextParamNodes string             `xml:"contextParamNodes,attr,omitempty"`
+	OrderedNo         int                `xml:"orderedNo,attr,omitempty"`
+	SubProcDefId      string             `xml:"subProcDefId,attr,omitempty"`
+	SubProcDefName    string             `xml:"subProcDefName,attr,omitempty"`
+	SubProcDefVersion string             `xml:"subProcDefVersion,attr,omitempty"`
+	CompensateService string             `xml:"compensateService,attr,omitempty"`
+	Params            []*BpmnWecubeParam `xml:"param"`
+	TimeConfig        string             `xml:"timeConfig,omitempty"`     // 时间、日期、信号节点配置json
+	RetryPolicy       string             `xml:"retryPolicy,omitempty"`    // 重试策略json
+	LoopPolicy        string             `xml:"loopPolicy,omitempty"`     // 循环策略json
+	OutputMappings    string             `xml:"outputMappings,omitempty"` // 出参映射json
+	ApprovalPolicy    string             `xml:"approvalPolicy,omitempty"` // 审批策略json
+	SelfAttrs         string             `xml:"selfAttrs,omitempty"`      // 前端样式json
+}
+
+type BpmnWecubeParam struct {
+	Id          string `xml:"id,attr,omitempty"`
+	Name        string `xml:"name,attr"`
+	BindType    string `xml:"bindType,attr,omitempty"`
+	Value       string `xml:"value,attr,omitempty"`
+	CtxBindNode string `xml:"ctxBindNode,attr,omitempty"`
+	CtxBindType string `xml:"ctxBindType,attr,omitempty"`
+	CtxBindName string `xml:"ctxBindName,attr,omitempty"`
+	Required    string `xml:"required,attr,omitempty"`
+}
+
+type BpmnWecubeLink struct {
+	LinkId    string `xml:"linkId,attr"`
+	IsDefault bool   `xml:"isDefault,attr,omitempty"`
+	SelfAttrs string `xml:"selfAttrs,omitempty"` // 前端样式json
+}
+
+// BpmnDiagram 图形信息,坐标取自前端样式,让标准BPMN建模工具可以直接显示
+type BpmnDiagram struct {
+	Id    string     `xml:"id,attr"`
+	Plane *BpmnPlane `xml:"BPMNPlane"`
+}
+
+type BpmnPlane struct {
+	Id          string       `xml:"id,attr"`
+	BpmnElement string       `xml:"bpmnElement,attr"`
+	Shapes      []*BpmnShape `xml:"BPMNShape"`
+	Edges       []*BpmnEdge  `xml:"BPMNEdge"`
+}
+
+type BpmnShape struct {
+	Id          string      `xml:"id,attr"`
+	BpmnElement string      `xml:"bpmnElement,attr"`
+	Bounds      *BpmnBounds `xml:"http://www.omg.org/spec/DD/20100524/DC Bounds"`
+}
+
+type BpmnBounds struct {
+	X      float64 `xml:"x,attr"`
+	Y      float64 `xml:"y,attr"`
+	Width  float64 `xml:"width,attr"`
+	Height float64 `xml:"height,attr"`
+}
+
+type BpmnEdge struct {
+	Id          string       `xml:"id,attr"`
+	BpmnElement string       `xml:"bpmnElement,attr"`
+	Waypoints   []*BpmnPoint `xml:"http://www.omg.org/spec/DD/20100524/DI waypoint"`
+}
+
+type BpmnPoint struct {
+	X float64 `xml:"x,attr"`
+	Y float64 `xml:"y,attr"`
+}
+
+// bpmnFlowNodeRef BPMN元素和元素名称,元素名称用来推断节点类型
+type bpmnFlowNodeRef struct {
+	Element string
+	Node    *BpmnFlowNode
+}
+
+func (p *BpmnProcess) flowNodes() (result []*bpmnFlowNodeRef) {
+	groups := []struct {
+		element string
+		nodes   []*BpmnFlowNode
+	}{{"startEvent", p.StartEvents}, {"endEvent", p.EndEvents}, {"intermediateCatchEvent", p.IntermediateCatchEvents},
+		{"task", p.Tasks}, {"serviceTask", p.ServiceTasks}, {"sendTask", p.SendTasks}, {"businessRuleTask", p.BusinessRuleTasks},
+		{"scriptTask", p.ScriptTasks}, {"userTask", p.UserTasks}, {"manualTask", p.ManualTasks}, {"callActivity", p.CallActivities},
+		{"exclusiveGateway", p.ExclusiveGateways}, {"parallelGateway", p.ParallelGateways}}
+	for _, group := range groups {
+		for _, node := range group.nodes {
+			result = append(result, &bpmnFlowNodeRef{Element: group.element, Node: node})
+		}
+	}
+	return
+}
+
+func (p *BpmnProcess) addFlowNode(element string, node *BpmnFlowNode) {
+	switch element {
+	case "startEvent":
+		p.StartEvents = append(p.StartEvents, node)
+	case "endEvent":
+		p.EndEvents = append(p.EndEvents, node)
+	case "intermediateCatchEvent":
+		p.IntermediateCatchEvents = append(p.IntermediateCatchEvents, node)
+	case "serviceTask":
+		p.ServiceTasks = append(p.ServiceTasks, node)
+	case "scriptTask":
+		p.ScriptTasks = append(p.ScriptTasks, node)
+	case "userTask":
+		p.UserTasks = append(p.UserTasks, node)
+	case "callActivity":
+		p.CallActivities = append(p.CallActivities, node)
+	case "exclusiveGateway":
+		p.ExclusiveGateways = append(p.ExclusiveGateways, node)
+	case "parallelGateway":
+		p.ParallelGateways = append(p.ParallelGateways, node)
+	default:
+		p.Tasks = append(p.Tasks, node)
+	}
+}
+
+// bpmnNodeElement 节点类型对应的BPMN元素和图形大小
+func bpmnNodeElement(nodeType string) (element string, width, height float64) {
+	switch nodeType {
+	case JobStartType:
+		return "startEvent", 36, 36
+	case JobEndType, JobBreakType:
+		return "endEvent", 36, 36
+	case JobTimeType, JobDateType, JobSignalType:
+		return "intermediateCatchEvent", 36, 36
+	case JobAutoType:
+		return "serviceTask", 100, 80
+	case JobDataType:
+		return "scriptTask", 100, 80
+	case JobHumanType:
+		return "userTask", 100, 80
+	case JobSubProcType, JobLoopType:
+		return "callActivity", 100, 80
+	case JobDecisionType, JobDecisionMergeType:
+		return "exclusiveGateway", 50, 50
+	case JobForkType, JobMergeType:
+		return "parallelGateway", 50, 50
+	}
+	return "task", 100, 80
+}
+
+// BuildBpmnDefinitions 编排转成BPMN文档,同一个文档里元素id重复时加上编排序号
+func BuildBpmnDefinitions(procDefList []*ProcessDefinitionDto) *BpmnDefinitions {
+	result := &BpmnDefinitions{Xmlns: BpmnModelNamespace, Id: "Definitions_" + guid.CreateGuid(), TargetNamespace: BpmnWecubeNamespace, Exporter: BpmnExporter}
+	usedIdMap := make(map[string]bool)
+	uniqueId := func(id string, index int) string {
+		if id == "" {
+			id = fmt.Sprintf("Element_%d", len(usedIdMap)+1)
+		}
+		for usedIdMap[id] {
+			id = fmt.Sprintf("%s_%d", id, index+1)
+		}
+		usedIdMap[id] = true
+		return id
+	}
+	for index, procDefDto := range procDefList {
+		if procDefDto == nil || procDefDto.ProcDef == nil {
+			continue
+		}
+		procDef := procDefDto.ProcDef
+		process := &BpmnProcess{Id: uniqueId(procDef.Id, index), Name: procDef.Name, IsExecutable: true,
+			ExtensionElements: &BpmnExtensionElements{ProcDef: &BpmnWecubeProcDef{Id: procDef.Id, Key: procDef.Key, Version: procDef.Version, RootEntity: procDef.RootEntity,
+				Status: procDef.Status, Tags: procDef.Tags, Scene: procDef.Scene, ConflictCheck: procDef.ConflictCheck, SubProc: procDef.SubProc, AuthPlugins: procDef.AuthPlugins,
+				MgmtRoles: procDefDto.PermissionToRole.MGMT, UseRoles: procDefDto.PermissionToRole.USE, Variables: procDef.Variables.String(), ConcurrencyPolicy: procDef.ConcurrencyPolicy.String()}}}
+		plane := &BpmnPlane{Id: process.Id + "_plane", BpmnElement: process.Id}
+		var nodes []*ProcDefNodeResultDto
+		var edges []*ProcDefNodeLinkDto
+		if procDefDto.ProcDefNodeExtend != nil {
+			nodes, edges = procDefDto.ProcDefNodeExtend.Nodes, procDefDto.ProcDefNodeExtend.Edges
+		}
+		elementIdMap := make(map[string]string)
+		flowNodeMap := make(map[string]*BpmnFlowNode)
+		centerMap := make(map[string]*BpmnPoint)
+		for _, node := range nodes {
+			if node == nil || node.ProcDefNodeCustomAttrs == nil {
+				continue
+			}
+			attrs := node.ProcDefNodeCustomAttrs
+			element, width, height := bpmnNodeElement(attrs.NodeType)
+			flowNode := &BpmnFlowNode{Id: uniqueId(attrs.Id, index), Name: attrs.Name, Documentation: attrs.Description,
+				ExtensionElements: &BpmnExtensionElements{Node: buildBpmnWecubeNode(attrs, node.NodeAttrs)}}
+			switch attrs.NodeType {
+			case JobBreakType:
+				flowNode.ErrorEventDefinition = &BpmnEventDefinition{}
+			case JobSignalType:
+				flowNode.SignalEventDefinition = &BpmnEventDefinition{}
+			case JobTimeType, JobDateType:
+				flowNode.TimerEventDefinition = buildBpmnTimerEventDefinition(attrs.NodeType, flowNode.ExtensionElements.Node.TimeConfig)
+			case JobSubProcType:
+				flowNode.CalledElement = attrs.SubProcDefId
+			case JobLoopType:
+				flowNode.CalledElement = attrs.SubProcDefId
+				flowNode.StandardLoop = &BpmnEventDefinition{}
+			case JobForkType, JobDecisionType:
+				flowNode.GatewayDirection = BpmnGatewayDiverging
+			case JobMergeType, JobDecisionMergeType:
+				flowNode.GatewayDirection = BpmnGatewayConverging
+			}
+			process.addFlowNode(element, flowNode)
+			elementIdMap[attrs.Id] = flowNode.Id
+			flowNodeMap[attrs.Id] = flowNode
+			if x, y, ok := getBpmnSelfAttrsPosition(flowNode.ExtensionElements.Node.SelfAttrs); ok {
+				centerMap[attrs.Id] = &BpmnPoint{X: x, Y: y}
+				plane.Shapes = append(plane.Shapes, &BpmnShape{Id: flowNode.Id + "_di", BpmnElement: flowNode.Id, Bounds: &BpmnBounds{X: x - width/2, Y: y - height/2, Width: width, Height: height}})
+			}
+		}
+		for _, edge := range edges {
+			if edge == nil || edge.ProcDefNodeLinkCustomAttrs == nil {
+				continue
+			}
+			attrs := edge.ProcDefNodeLinkCustomAttrs
+			source, target := flowNodeMap[attrs.Source], flowNodeMap[attrs.Target]
+			if source == nil || target == nil {
+				continue
+			}
+			flow := &BpmnSequenceFlow{Id: uniqueId(attrs.Id, index), Name: attrs.Name, SourceRef: source.Id, TargetRef: target.Id,
+				ExtensionElements: &BpmnExtensionElements{Link: &BpmnWecubeLink{LinkId: attrs.Id, IsDefault: attrs.IsDefault, SelfAttrs: getBpmnSelfAttrsString(edge.SelfAttrs)}}}
+			if attrs.Expression != "" {
+				flow.ConditionExpression = &BpmnExpression{Body: attrs.Expression}
+			}
+			if attrs.IsDefault && source.GatewayDirection == BpmnGatewayDiverging {
+				source.Default = flow.Id
+			}
+			source.Outgoing = append(source.Outgoing, flow.Id)
+			target.Incoming = append(target.Incoming, flow.Id)
+			process.SequenceFlows = append(process.SequenceFlows, flow)
+			if centerMap[attrs.Source] != nil && centerMap[attrs.Target] != nil {
+				plane.Edges = append(plane.Edges, &BpmnEdge{Id: flow.Id + "_di", BpmnElement: flow.Id, Waypoints: []*BpmnPoint{centerMap[attrs.Source], centerMap[attrs.Target]}})
+			}
+		}
+		result.Processes = append(result.Processes, process)
+		result.Diagrams = append(result.Diagrams, &BpmnDiagram{Id: process.Id + "_diagram", Plane: plane})
+	}
+	return result
+}
+
+func buildBpmnWecubeNode(attrs *ProcDefNodeCustomAttrsDto, nodeAttrs interface{}) *BpmnWecubeNode {
+	wecubeNode := &BpmnWecubeNode{NodeId: attrs.Id, NodeType: attrs.NodeType, Status: attrs.Status, ServiceName: attrs.ServiceName, RoutineExpression: attrs.RoutineExpression,
+		Timeout: attrs.Timeout, RiskCheck: attrs.RiskCheck, DynamicBind: attrs.DynamicBind, BindNodeId: attrs.BindNodeId, AllowContinue: attrs.AllowContinue,
+		ContextParamNodes: strings.Join(attrs.ContextParamNodes, ","), OrderedNo: attrs.OrderedNo, SubProcDefId: attrs.SubProcDefId, SubProcDefName: attrs.SubProcDefName,
+		SubProcDefVersion: attrs.SubProcDefVersion, CompensateService: attrs.CompensateService, TimeConfig: getBpmnSelfAttrsString(attrs.TimeConfig),
+		RetryPolicy: attrs.RetryPolicy.String(), LoopPolicy: attrs.LoopPolicy.String(), OutputMappings: attrs.OutputMappings.String(),
+		ApprovalPolicy: attrs.ApprovalPolicy.String(), SelfAttrs: getBpmnSelfAttrsString(nodeAttrs)}
+	for _, param := range attrs.ParamInfos {
+		wecubeNode.Params = append(wecubeNode.Params, &BpmnWecubeParam{Id: param.ParamId, Name: param.Name, BindType: param.BindType, Value: param.Value,
+			CtxBindNode: param.CtxBindNode, CtxBindType: param.CtxBindType, CtxBindName: param.CtxBindName, Required: param.Required})
+	}
+	return wecubeNode
+}
+
+// buildBpmnTimerEventDefinition 时间节点转成ISO8601时长,日期节点转成日期
+func buildBpmnTimerEventDefinition(nodeType, timeConfig string) *BpmnTimerEventDefinition {
+	result := &BpmnTimerEventDefinition{}
+	configMap := make(map[string]interface{})
+	json.Unmarshal([]byte(timeConfig), &configMap)
+	if nodeType == JobDateType {
+		if date := fmt.Sprint(configMap["date"]); configMap["date"] != nil && date != "" {
+			result.TimeDate = &BpmnExpression{Body: date}
+		}
+		return result
+	}
+	if configMap["duration"] == nil {
+		return result
+	}
+	duration := fmt.Sprint(configMap["duration"])
+	switch fmt.Sprint(configMap["unit"]) {
+	case "sec":
+		result.TimeDuration = &BpmnExpression{Body: "PT" + duration + "S"}
+	case "min":
+		result.TimeDuration = &BpmnExpression{Body: "PT" + duration + "M"}
+	case "hour":
+		result.TimeDuration = &BpmnExpression{Body: "PT" + duration + "H"}
+	case "day":
+		result.TimeDuration = &BpmnExpression{Body: "P" + duration + "D"}
+	}
+	return result
+}
+
+// getBpmnSelfAttrsString 前端样式和时间配置在数据库里是json字符串,导入时是对象
+func getBpmnSelfAttrsString(input interface{}) string {
+	switch value := input.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	default:
+		b, _ := json.Marshal(value)
+		return string(b)
+	}
+}
+
+func getBpmnSelfAttrsPosition(selfAttrs string) (x, y float64, ok bool) {
+	position := struct {
+		X *float64 `json:"x"`
+		Y *float64 `json:"y"`
+	}{}
+	if err := json.Unmarshal([]byte(selfAttrs), &position); err != nil || position.X == nil || position.Y == nil {
+		return
+	}
+	return *position.X, *position.Y, true
+}
+
+// ParseBpmnDefinitions BPMN文档转成编排,有WeCube扩展配置时按扩展配置还原,没有时按BPMN元素推断节点类型
+func ParseBpmnDefinitions(definitions *BpmnDefinitions) (result []*ProcessDefinitionDto, err error) {
+	shapeMap := make(map[string]*BpmnBounds)
+	for _, diagram := range definitions.Diagrams {
+		if diagram.Plane == nil {
+			continue
+		}
+		for _, shape := range diagram.Plane.Shapes {
+			if shape.Bounds != nil {
+				shapeMap[shape.BpmnElement] = shape.Bounds
+			}
+		}
+	}
+	for _, process := range definitions.Processes {
+		procDefDto, parseErr := parseBpmnProcess(process, shapeMap)
+		if parseErr != nil {
+			err = fmt.Errorf("process %s %s", process.Id, parseErr.Error())
+			return
+		}
+		result = append(result, procDefDto)
+	}
+	if len(result) == 0 {
+		err = fmt.Errorf("can not find any process in bpmn document")
+	}
+	return
+}
+
+func parseBpmnProcess(process *BpmnProcess, shapeMap map[string]*BpmnBounds) (result *ProcessDefinitionDto, err error) {
+	procDef := &ProcDefDto{Name: process.Name, Status: string(Draft), AuthPlugins: []string{}}
+	result = &ProcessDefinitionDto{ProcDef: procDef, ProcDefNodeExtend: &ProcDefNodeExtendDto{Nodes: []*ProcDefNodeResultDto{}, Edges: []*ProcDefNodeLinkDto{}}}
+	if process.ExtensionElements != nil && process.ExtensionElements.ProcDef != nil {
+		ext := process.ExtensionElements.ProcDef
+		procDef.Id, procDef.Key, procDef.Version, procDef.RootEntity, procDef.Tags, procDef.Scene = ext.Id, ext.Key, ext.Version, ext.RootEntity, ext.Tags, ext.Scene
+		procDef.ConflictCheck, procDef.SubProc = ext.ConflictCheck, ext.SubProc
+		if ext.Status != "" {
+			procDef.Status = ext.Status
+		}
+		if len(ext.AuthPlugins) > 0 {
+			procDef.AuthPlugins = ext.AuthPlugins
+		}
+		procDef.Variables = ParseProcDefVariables(ext.Variables)
+		procDef.ConcurrencyPolicy = ParseProcDefConcurrencyPolicy(ext.ConcurrencyPolicy)
+		result.PermissionToRole = PermissionToRole{MGMT: ext.MgmtRoles, USE: ext.UseRoles}
+	}
+	if procDef.Name == "" {
+		procDef.Name = process.Id
+	}
+	if procDef.Key == "" {
+		procDef.Key = "pdef_key_" + guid.CreateGuid()
+	}
+	// 没有扩展配置时按连线数量判断网关是分流还是汇聚
+	inCountMap, outCountMap := make(map[string]int), make(map[string]int)
+	for _, flow := range process.SequenceFlows {
+		outCountMap[flow.SourceRef]++
+		inCountMap[flow.TargetRef]++
+	}
+	nodeIdMap := make(map[string]string)
+	defaultFlowMap := make(map[string]bool)
+	for index, ref := range process.flowNodes() {
+		flowNode := ref.Node
+		attrs := &ProcDefNodeCustomAttrsDto{Id: flowNode.Id, Name: flowNode.Name, Description: flowNode.Documentation, ProcDefId: procDef.Id, Timeout: 30,
+			ParamInfos: []*ProcDefNodeParam{}, ContextParamNodes: []string{}, OrderedNo: index + 1, TimeConfig: ""}
+		var selfAttrs string
+		if flowNode.ExtensionElements != nil && flowNode.ExtensionElements.Node != nil {
+			ext := flowNode.ExtensionElements.Node
+			if ext.NodeId != "" {
+				attrs.Id = ext.NodeId
+			}
+			attrs.NodeType, attrs.Status, attrs.ServiceName, attrs.RoutineExpression = ext.NodeType, ext.Status, ext.ServiceName, ext.RoutineExpression
+			attrs.Timeout, attrs.RiskCheck, attrs.DynamicBind, attrs.BindNodeId, attrs.AllowContinue = ext.Timeout, ext.RiskCheck, ext.DynamicBind, ext.BindNodeId, ext.AllowContinue
+			attrs.SubProcDefId, attrs.SubProcDefName, attrs.SubProcDefVersion, attrs.CompensateService = ext.SubProcDefId, ext.SubProcDefName, ext.SubProcDefVersion, ext.CompensateService
+			attrs.TimeConfig, attrs.RetryPolicy, attrs.LoopPolicy = ext.TimeConfig, ParseProcNodeRetryPolicy(ext.RetryPolicy), ParseProcNodeLoopPolicy(ext.LoopPolicy)
+			attrs.OutputMappings, attrs.ApprovalPolicy = ParseProcNodeOutputMappings(ext.OutputMappings), ParseProcNodeApprovalPolicy(ext.ApprovalPolicy)
+			if ext.OrderedNo > 0 {
+				attrs.OrderedNo = ext.OrderedNo
+			}
+			if ext.ContextParamNodes != "" {
+				attrs.ContextParamNodes = strings.Split(ext.ContextParamNodes, ",")
+			}
+			for _, param := range ext.Params {
+				attrs.ParamInfos = append(attrs.ParamInfos, &ProcDefNodeParam{ProcDefNodeId: attrs.Id, ParamId: param.Id, Name: param.Name, BindType: param.BindType, Value: param.Value,
+					CtxBindNode: param.CtxBindNode, CtxBindType: param.CtxBindType, CtxBindName: param.CtxBindName, Required: param.Required})
+			}
+			selfAttrs = ext.SelfAttrs
+		} else if err = inferBpmnNode(ref, attrs, inCountMap[flowNode.Id], outCountMap[flowNode.Id]); err != nil {
+			return
+		}
+		if attrs.Name == "" {
+			attrs.Name = flowNode.Id
+		}
+		if selfAttrs == "" {
+			selfAttrs = buildBpmnNodeSelfAttrs(attrs, shapeMap[flowNode.Id])
+		}
+		if flowNode.Default != "" {
+			defaultFlowMap[flowNode.Default] = true
+		}
+		nodeIdMap[flowNode.Id] = attrs.Id
+		result.ProcDefNodeExtend.Nodes = append(result.ProcDefNodeExtend.Nodes, &ProcDefNodeResultDto{ProcDefNodeCustomAttrs: attrs, NodeAttrs: selfAttrs})
+	}
+	for _, flow := range process.SequenceFlows {
+		source, sourceOk := nodeIdMap[flow.SourceRef]
+		target, targetOk := nodeIdMap[flow.TargetRef]
+		if !sourceOk || !targetOk {
+			err = fmt.Errorf("sequence flow %s source or target is not supported element", flow.Id)
+			return
+		}
+		attrs := &ProcDefNodeLinkCustomAttrs{Id: flow.Id, Name: flow.Name, Source: source, Target: target, IsDefault: defaultFlowMap[flow.Id]}
+		if flow.ConditionExpression != nil {
+			attrs.Expression = strings.TrimSpace(flow.ConditionExpression.Body)
+		}
+		var selfAttrs string
+		if flow.ExtensionElements != nil && flow.ExtensionElements.Link != nil {
+			ext := flow.ExtensionElements.Link
+			if ext.LinkId != "" {
+				attrs.Id = ext.LinkId
+			}
+			attrs.IsDefault = attrs.IsDefault || ext.IsDefault
+			selfAttrs = ext.SelfAttrs
+		}
+		if selfAttrs == "" {
+			b, _ := json.Marshal(map[string]string{"id": attrs.Id, "source": source, "target": target, "label": attrs.Name})
+			selfAttrs = string(b)
+		}
+		result.ProcDefNodeExtend.Edges = append(result.ProcDefNodeExtend.Edges, &ProcDefNodeLinkDto{ProcDefId: procDef.Id, ProcDefNodeLinkCustomAttrs: attrs, SelfAttrs: selfAttrs})
+	}
+	return
+}
+
+// inferBpmnNode 标准BPMN建模工具画的流程没有扩展配置,按元素推断节点类型
+func inferBpmnNode(ref *bpmnFlowNodeRef, attrs *ProcDefNodeCustomAttrsDto, inCount, outCount int) error {
+	flowNode := ref.Node
+	converging := flowNode.GatewayDirection == BpmnGatewayConverging || (flowNode.GatewayDirection != BpmnGatewayDiverging && inCount > 1 && outCount <= 1)
+	switch ref.Element {
+	case "startEvent":
+		attrs.NodeType = JobStartType
+	case "endEvent":
+		attrs.NodeType = JobEndType
+		if flowNode.ErrorEventDefinition != nil {
+			attrs.NodeType = JobBreakType
+		}
+	case "intermediateCatchEvent":
+		if flowNode.SignalEventDefinition != nil {
+			attrs.NodeType = JobSignalType
+		} else if timer := flowNode.TimerEventDefinition; timer != nil && timer.TimeDate != nil {
+			attrs.NodeType = JobDateType
+			b, _ := json.Marshal(map[string]string{"date": strings.TrimSpace(timer.TimeDate.Body)})
+			attrs.TimeConfig = string(b)
+		} else if timer != nil && timer.TimeDuration != nil {
+			duration, unit, err := parseBpmnDuration(strings.TrimSpace(timer.TimeDuration.Body))
+			if err != nil {
+				return err
+			}
+			attrs.NodeType = JobTimeType
+			b, _ := json.Marshal(map[string]interface{}{"duration": duration, "unit": unit})
+			attrs.TimeConfig = string(b)
+		} else {
+			return fmt.Errorf("intermediateCatchEvent %s only support timer and signal", flowNode.Id)
+		}
+	case "task", "serviceTask", "sendTask", "businessRuleTask":
+		attrs.NodeType = JobAutoType
+	case "scriptTask":
+		attrs.NodeType = JobDataType
+	case "userTask", "manualTask":
+		attrs.NodeType = JobHumanType
+	case "callActivity":
+		attrs.NodeType = JobSubProcType
+		if flowNode.StandardLoop != nil || flowNode.MultiInstanceLoop != nil {
+			attrs.NodeType = JobLoopType
+		}
+		attrs.SubProcDefId = flowNode.CalledElement
+	case "exclusiveGateway":
+		attrs.NodeType = JobDecisionType
+		if converging {
+			attrs.NodeType = JobDecisionMergeType
+		}
+	case "parallelGateway":
+		attrs.NodeType = JobForkType
+		if converging {
+			attrs.NodeType = JobMergeType
+		}
+	default:
+		return fmt.Errorf("element %s not supported", ref.Element)
+	}
+	return nil
+}
+
+// parseBpmnDuration ISO8601时长转成时间节点配置,只有一个单位时保留单位,否则换算成秒
+func parseBpmnDuration(input string) (duration int, unit string, err error) {
+	matches := bpmnDurationRegexp.FindStringSubmatch(input)
+	if matches == nil || input == "P" || input == "PT" {
+		err = fmt.Errorf("timer duration %s illegal", input)
+		return
+	}
+	units := []string{"day", "hour", "min", "sec"}
+	seconds := []int{86400, 3600, 60, 1}
+	var total, unitCount int
+	for i, value := range matches[1:] {
+		if value == "" {
+			continue
+		}
+		number, _ := strconv.Atoi(value)
+		duration, unit = number, units[i]
+		total += number * seconds[i]
+		unitCount++
+	}
+	if unitCount > 1 {
+		duration, unit = total, "sec"
+	}
+	return
+}
+
+// buildBpmnNodeSelfAttrs 没有前端样式时按BPMN图形位置生成
+func buildBpmnNodeSelfAttrs(attrs *ProcDefNodeCustomAttrsDto, bounds *BpmnBounds) string {
+	shape := "rect-node"
+	switch attrs.NodeType {
+	case JobStartType, JobEndType, JobBreakType, JobTimeType, JobDateType, JobSignalType:
+		shape = "circle-node"
+	case JobDecisionType, JobDecisionMergeType, JobForkType, JobMergeType:
+		shape = "diamond-node"
+	}
+	selfAttrs := map[string]interface{}{"id": attrs.Id, "label": attrs.Name, "type": shape}
+	if bounds != nil {
+		selfAttrs["x"], selfAttrs["y"] = bounds.X+bounds.Width/2, bounds.Y+bounds.Height/2
+	}
+	b, _ := json.Marshal(selfAttrs)
+	return string(b)
+}
@@ -0,0 +1,109 @@
+package models
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"testing"
+)
+
+func newTestBpmnNode(id, name, nodeType string, orderedNo int, x float64) *ProcDefNodeResultDto {
+	return &ProcDefNodeResultDto{
+		ProcDefNodeCustomAttrs: &ProcDefNodeCustomAttrsDto{Id: id, Name: name, NodeType: nodeType, Description: name + " desc", Timeout: 30, OrderedNo: orderedNo,
+			ParamInfos: []*ProcDefNodeParam{}, ContextParamNodes: []string{}},
+		NodeAttrs: map[string]interface{}{"id": id, "label": name, "x": x, "y": 100},
+	}
+}
+
+func newTestBpmnEdge(source, target, name string) *ProcDefNodeLinkDto {
+	attrs := &ProcDefNodeLinkCustomAttrs{Id: source + "_" + target, Name: name, Source: source, Target: target}
+	return &ProcDefNodeLinkDto{ProcDefNodeLinkCustomAttrs: attrs, SelfAttrs: map[string]interface{}{"id": attrs.Id, "source": source, "target": target, "label": name}}
+}
+
+// newTestBpmnProcDef 覆盖所有节点类型和节点策略的编排
+func newTestBpmnProcDef() *ProcessDefinitionDto {
+	start := newTestBpmnNode("start", "start", JobStartType, 1, 0)
+	fork := newTestBpmnNode("fork", "fork", JobForkType, 2, 100)
+	auto := newTestBpmnNode("auto", "auto", JobAutoType, 3, 200)
+	auto.ProcDefNodeCustomAttrs.ServiceName = "wecmdb/ci-data/query"
+	auto.ProcDefNodeCustomAttrs.RoutineExpression = "wecmdb:app_system"
+	auto.ProcDefNodeCustomAttrs.RiskCheck = true
+	auto.ProcDefNodeCustomAttrs.AllowContinue = true
+	auto.ProcDefNodeCustomAttrs.CompensateService = "wecmdb/ci-data/rollback"
+	auto.ProcDefNodeCustomAttrs.RetryPolicy = &ProcNodeRetryPolicy{MaxAttempts: 3, Backoff: RetryBackoffExponential, Interval: 10, MaxInterval: 60, RetryOn: []string{NodeErrorNetwork}}
+	auto.ProcDefNodeCustomAttrs.OutputMappings = ProcNodeOutputMappingList{{Param: "guid", Variable: "appGuid"}}
+	auto.ProcDefNodeCustomAttrs.ParamInfos = []*ProcDefNodeParam{{ParamId: "p1", Name: "name", BindType: "constant", Value: "demo", Required: "Y"}}
+	data := newTestBpmnNode("data", "data", JobDataType, 4, 200)
+	data.ProcDefNodeCustomAttrs.DynamicBind = 1
+	data.ProcDefNodeCustomAttrs.BindNodeId = "auto"
+	data.ProcDefNodeCustomAttrs.ContextParamNodes = []string{"auto"}
+	data.ProcDefNodeCustomAttrs.ParamInfos = []*ProcDefNodeParam{{ParamId: "p2", Name: "guid", BindType: "context", CtxBindNode: "auto", CtxBindType: "output", CtxBindName: "guid", Required: "N"}}
+	merge := newTestBpmnNode("merge", "merge", JobMergeType, 5, 300)
+	human := newTestBpmnNode("human", "human", JobHumanType, 6, 400)
+	human.ProcDefNodeCustomAttrs.ApprovalPolicy = &ProcNodeApprovalPolicy{Mode: ApprovalModeQuorum, Quorum: 2, PassOption: "pass", RejectOption: "reject", ReminderInterval: 2, EscalationHours: 24,
+		EscalationRole: "SUPER_ADMIN", Approvers: []*ProcNodeApprover{{Type: ApproverTypeRole, Name: "APP_ADMIN"}, {Type: ApproverTypeUser, Name: "admin"}}}
+	decision := newTestBpmnNode("decision", "decision", JobDecisionType, 7, 500)
+	timer := newTestBpmnNode("timer", "timer", JobTimeType, 8, 600)
+	timer.ProcDefNodeCustomAttrs.TimeConfig = `{"duration":10,"unit":"min"}`
+	date := newTestBpmnNode("date", "date", JobDateType, 9, 600)
+	date.ProcDefNodeCustomAttrs.TimeConfig = `{"date":"2026-10-20 10:00:00"}`
+	decisionMerge := newTestBpmnNode("decisionMerge", "decisionMerge", JobDecisionMergeType, 10, 700)
+	signal := newTestBpmnNode("signal", "signal", JobSignalType, 11, 800)
+	signal.ProcDefNodeCustomAttrs.TimeConfig = `{"signal":"deployDone","timeout":3600}`
+	subProc := newTestBpmnNode("subProc", "subProc", JobSubProcType, 12, 900)
+	subProc.ProcDefNodeCustomAttrs.SubProcDefId = "pdef_sub"
+	subProc.ProcDefNodeCustomAttrs.SubProcDefName = "sub"
+	subProc.ProcDefNodeCustomAttrs.SubProcDefVersion = "v2"
+	loop := newTestBpmnNode("loop", "loop", JobLoopType, 13, 1000)
+	loop.ProcDefNodeCustomAttrs.SubProcDefId = "pdef_sub"
+	loop.ProcDefNodeCustomAttrs.SubProcDefName = "sub"
+	loop.ProcDefNodeCustomAttrs.SubProcDefVersion = "v2"
+	loop.ProcDefNodeCustomAttrs.LoopPolicy = &ProcNodeLoopPolicy{Mode: LoopModeUntil, MaxParallel: 2, MaxIterations: 5, FailurePolicy: LoopFailThreshold, FailureThreshold: 20, Until: "vars.done == true"}
+	end := newTestBpmnNode("end", "end", JobEndType, 14, 1100)
+	abnormal := newTestBpmnNode("abnormal", "abnormal", JobBreakType, 15, 600)
+	decisionEdge := newTestBpmnEdge("decision", "timer", "fast")
+	decisionEdge.ProcDefNodeLinkCustomAttrs.Expression = "nodes.human.output == 'pass'"
+	defaultEdge := newTestBpmnEdge("decision", "date", "slow")
+	defaultEdge.ProcDefNodeLinkCustomAttrs.IsDefault = true
+	return &ProcessDefinitionDto{
+		ProcDef: &ProcDefDto{Id: "pdef_test", Key: "pdef_key_test", Name: "bpmn test", Version: "v1", RootEntity: "wecmdb:app_system", Status: string(Draft), Tags: "test",
+			AuthPlugins: []string{"wecmdb"}, Scene: "deploy", ConflictCheck: true,
+			Variables:         ProcDefVariableList{{Name: "appGuid", DataType: ProcVariableTypeString, Description: "app guid"}, {Name: "done", DataType: ProcVariableTypeBool, DefaultValue: false}},
+			ConcurrencyPolicy: &ProcDefConcurrencyPolicy{MaxRunning: 5, MaxRunningPerEntity: 1, QueueMode: "fifo"}},
+		PermissionToRole: PermissionToRole{MGMT: []string{"SUPER_ADMIN"}, USE: []string{"APP_ADMIN"}},
+		ProcDefNodeExtend: &ProcDefNodeExtendDto{
+			Nodes: []*ProcDefNodeResultDto{start, fork, auto, data, merge, human, decision, timer, date, decisionMerge, signal, subProc, loop, end, abnormal},
+			Edges: []*ProcDefNodeLinkDto{newTestBpmnEdge("start", "fork", ""), newTestBpmnEdge("fork", "auto", ""), newTestBpmnEdge("fork", "data", ""),
+				newTestBpmnEdge("auto", "merge", ""), newTestBpmnEdge("data", "merge", ""), newTestBpmnEdge("merge", "human", ""), newTestBpmnEdge("human", "decision", ""),
+				decisionEdge, defaultEdge, newTestBpmnEdge("timer", "decisionMerge", ""), newTestBpmnEdge("date", "decisionMerge", ""),
+				newTestBpmnEdge("decisionMerge", "signal", ""), newTestBpmnEdge("signal", "subProc", ""), newTestBpmnEdge("signal", "abnormal", SignalTimeoutBranch),
+				newTestBpmnEdge("subProc", "loop", ""), newTestBpmnEdge("loop", "end", "")},
+		},
+	}
+}
+
+func TestBpmnRoundTrip(t *testing.T) {
+	source := newTestBpmnProcDef()
+	b, err := xml.MarshalIndent(BuildBpmnDefinitions([]*ProcessDefinitionDto{source}), "", "  ")
+	if err != nil {
+		t.Fatalf("marshal bpmn fail,%s", err.Error())
+	}
+	var definitions BpmnDefinitions
+	if err = xml.Unmarshal(b, &definitions); err != nil {
+		t.Fatalf("unmarshal bpmn fail,%s", err.Error())
+	}
+	targetList, err := ParseBpmnDefinitions(&definitions)
+	if err != nil {
+		t.Fatalf("parse bpmn fail,%s", err.Error())
+	}
+	if len(targetList) != 1 {
+		t.Fatalf("parse bpmn expect 1 process,got %d", len(targetList))
+	}
+	diff := DiffProcessDefinition(source, targetList[0])
+	if !diff.IsEmpty() {
+		diffBytes, _ := json.Marshal(diff)
+		t.Fatalf("bpmn round trip changed the process,%s", string(diffBytes))
+	}
+	if len(diff.Source.Id) == 0 || diff.Source.Id != diff.Target.Id || diff.Source.Version != diff.Target.Version {
+		t.Errorf("bpmn round trip changed procDef id or version,%+v %+v", diff.Source, diff.Target)
+	}
+}
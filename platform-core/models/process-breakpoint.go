@@ -0,0 +1,74 @@
+package models
+
+import "time"
+
+const (
+	JobStatusPaused = "Paused" // 命中断点暂停,等待单步或继续
+
+	ProcBreakpointScopeDefinition = "definition" // 编排定义上的断点,该定义的所有实例生效
+	ProcBreakpointScopeInstance   = "instance"   // 单个实例上的断点
+	ProcBreakpointAllNode         = "*"          // 实例单步执行,每个任务节点前都暂停
+
+	BreakpointHitStatusWait     = "wait"     // 暂停中
+	BreakpointHitStatusStep     = "step"     // 单步,执行该节点后在下一个节点前继续暂停
+	BreakpointHitStatusContinue = "continue" // 继续,关闭单步直到下一个断点
+
+	BreakpointInputAllEntity = "*" // 入参修改对节点所有数据行生效
+)
+
+// ProcBreakpoint 断点配置,nodeId为编排定义节点的nodeId
+type ProcBreakpoint struct {
+	Id          string    `json:"id" xorm:"id"`                    // 唯一标识
+	Scope       string    `json:"scope" xorm:"scope"`              // 范围->definition | instance
+	ProcDefId   string    `json:"procDefId" xorm:"proc_def_id"`    // 编排定义id
+	ProcInsId   string    `json:"procInsId" xorm:"proc_ins_id"`    // 编排实例id
+	NodeId      string    `json:"nodeId" xorm:"node_id"`           // 编排定义节点nodeId,*表示单步
+	CreatedBy   string    `json:"createdBy" xorm:"created_by"`     // 创建人
+	CreatedTime time.Time `json:"createdTime" xorm:"created_time"` // 创建时间
+}
+
+// ProcBreakpointParam 设置断点,覆盖该范围原有的断点
+type ProcBreakpointParam struct {
+	NodeIds []string `json:"nodeIds"` // 编排定义节点nodeId列表,实例上可以用*开启单步
+}
+
+// ProcRunBreakpoint 工作流节点命中断点的纪录
+type ProcRunBreakpoint struct {
+	Id            string    `json:"id" xorm:"id"`                          // 唯一标识
+	WorkflowId    string    `json:"workflowId" xorm:"workflow_id"`         // 工作流id
+	ProcInsId     string    `json:"procInsId" xorm:"proc_ins_id"`          // 编排实例id
+	ProcInsNodeId string    `json:"procInsNodeId" xorm:"proc_ins_node_id"` // 编排实例节点id
+	ProcRunNodeId string    `json:"procRunNodeId" xorm:"proc_run_node_id"` // 工作流节点id
+	NodeName      string    `json:"nodeName" xorm:"node_name"`             // 节点名称
+	JobType       string    `json:"jobType" xorm:"job_type"`               // 节点类型
+	Status        string    `json:"status" xorm:"status"`                  // 状态->wait | step | continue
+	InputOverride string    `json:"inputOverride" xorm:"input_override"`   // 修改后的入参json
+	CreatedTime   time.Time `json:"createdTime" xorm:"created_time"`       // 命中时间
+	UpdatedBy     string    `json:"updatedBy" xorm:"updated_by"`           // 处理人
+	UpdatedTime   time.Time `json:"updatedTime" xorm:"updated_time"`       // 处理时间
+}
+
+// ProcRunBreakpointResumeParam 断点单步或继续,可以同时修改节点入参
+type ProcRunBreakpointResumeParam struct {
+	Action        string                            `json:"action"`        // step | continue
+	InputOverride map[string]map[string]interface{} `json:"inputOverride"` // 数据行id(callbackParameter)->参数名->值,*表示所有数据行
+}
+
+// ProcRunBreakpointDetail 断点详情,包含解析后的节点入参和实例数据缓存
+type ProcRunBreakpointDetail struct {
+	Breakpoint *ProcRunBreakpoint       `json:"breakpoint"`
+	Inputs     []map[string]interface{} `json:"inputs"`     // 解析后的插件入参,已应用修改
+	InputError string                   `json:"inputError"` // 入参解析失败的原因
+	DataCache  []*ProcDataCache         `json:"dataCache"`  // 实例数据缓存
+}
+
+// ProcDataCacheUpdateParam 修改实例数据缓存的值
+type ProcDataCacheUpdateParam struct {
+	Id        string `json:"id"`
+	DataValue string `json:"dataValue"`
+}
+
+// IsBreakpointJobType 支持断点的节点类型,只在调用插件或创建任务前暂停
+func IsBreakpointJobType(jobType string) bool {
+	return jobType == JobAutoType || jobType == JobDataType || jobType == JobHumanType
+}
@@ -0,0 +1,123 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	ProcInsBulkActionRetry       = "retry"       // 重试实例中失败的节点
+	ProcInsBulkActionIgnoreRisky = "ignoreRisky" // 跳过命中高危检测的节点
+	ProcInsBulkActionApprove     = "approve"     // 对等待审批的人工节点投同意票
+	ProcInsBulkActionStop        = "stop"        // 暂停运行中的实例
+	ProcInsBulkActionContinue    = "continue"    // 继续已暂停的实例
+
+	ProcInsBulkStatusRunning = "running" // 执行中
+	ProcInsBulkStatusDone    = "done"    // 执行完成
+
+	ProcInsBulkResultWait    = "wait"    // 等待执行
+	ProcInsBulkResultSuccess = "success" // 操作已下发
+	ProcInsBulkResultFail    = "fail"    // 操作失败
+	ProcInsBulkResultSkipped = "skipped" // 状态已变化,不需要操作
+
+	ProcInsBulkMaxNum       = 500 // 单次批量操作的最大目标数
+	ProcInsBulkStallSeconds = 120 // 执行中的任务超过该时间没有进度视为中断,由集群中的节点恢复执行
+)
+
+// ProcInsBulkFilter 批量操作的实例筛选条件,节点名称和报错信息用于筛选节点,实例级操作时筛选有该节点报错的实例
+type ProcInsBulkFilter struct {
+	ProcDefId     string   `json:"procDefId"`     // 编排定义id
+	ProcDefKey    string   `json:"procDefKey"`    // 编排定义key,包含所有版本
+	Status        string   `json:"status"`        // 实例状态,为空时按操作取可以操作的状态
+	StartTime     string   `json:"startTime"`     // 实例创建时间起,格式2006-01-02 15:04:05
+	EndTime       string   `json:"endTime"`       // 实例创建时间止
+	NodeName      string   `json:"nodeName"`      // 失败节点名称
+	ErrorPattern  string   `json:"errorPattern"`  // 节点报错信息包含的内容
+	ProcInsIdList []string `json:"procInsIdList"` // 指定实例id,和其它条件同时生效
+}
+
+// ProcInsBulkParam 批量操作参数
+type ProcInsBulkParam struct {
+	Action  string             `json:"action"`  // 操作->retry | ignoreRisky | approve | stop | continue
+	Message string             `json:"message"` // 审批意见
+	Filter  *ProcInsBulkFilter `json:"filter"`
+}
+
+func (p *ProcInsBulkParam) Validate() error {
+	switch p.Action {
+	case ProcInsBulkActionRetry, ProcInsBulkActionIgnoreRisky, ProcInsBulkActionApprove, ProcInsBulkActionStop, ProcInsBulkActionContinue:
+	default:
+		return fmt.Errorf("action:%s illegal", p.Action)
+	}
+	if p.Filter == nil {
+		p.Filter = &ProcInsBulkFilter{}
+	}
+	if p.Filter.ProcDefId == "" && p.Filter.ProcDefKey == "" && len(p.Filter.ProcInsIdList) == 0 {
+		return fmt.Errorf("filter procDefId,procDefKey or procInsIdList can not all empty")
+	}
+	for _, timeValue := range []string{p.Filter.StartTime, p.Filter.EndTime} {
+		if timeValue == "" {
+			continue
+		}
+		if _, err := time.ParseInLocation(DateTimeFormat, timeValue, time.Local); err != nil {
+			return fmt.Errorf("time:%s format illegal,should be %s", timeValue, DateTimeFormat)
+		}
+	}
+	if p.Filter.Status != "" && p.Filter.Status != p.GetProcInsStatus() {
+		return fmt.Errorf("instance with status %s can not %s", p.Filter.Status, p.Action)
+	}
+	p.Filter.ErrorPattern = strings.TrimSpace(p.Filter.ErrorPattern)
+	return nil
+}
+
+// GetProcInsStatus 可以执行该操作的实例状态
+func (p *ProcInsBulkParam) GetProcInsStatus() string {
+	if p.Action == ProcInsBulkActionContinue {
+		return WorkflowStatusStop
+	}
+	return JobStatusRunning
+}
+
+// IsNodeAction 该操作是否针对实例中的节点
+func (p *ProcInsBulkParam) IsNodeAction() bool {
+	return p.Action == ProcInsBulkActionRetry || p.Action == ProcInsBulkActionIgnoreRisky || p.Action == ProcInsBulkActionApprove
+}
+
+// ProcInsBulkJob 批量操作任务,记录筛选条件和执行进度
+type ProcInsBulkJob struct {
+	Id          string    `json:"id" xorm:"id"`                    // 唯一标识
+	Action      string    `json:"action" xorm:"action"`            // 操作
+	Filter      string    `json:"filter" xorm:"filter"`            // 筛选条件json
+	Message     string    `json:"message" xorm:"message"`          // 审批意见
+	Status      string    `json:"status" xorm:"status"`            // 状态->running | done
+	TotalNum    int       `json:"totalNum" xorm:"total_num"`       // 目标总数
+	SuccessNum  int       `json:"successNum" xorm:"success_num"`   // 成功数
+	FailNum     int       `json:"failNum" xorm:"fail_num"`         // 失败数
+	SkipNum     int       `json:"skipNum" xorm:"skip_num"`         // 跳过数
+	Roles       string    `json:"-" xorm:"roles"`                  // 创建人角色,逗号分隔,中断后恢复执行时用于审批投票
+	CreatedBy   string    `json:"createdBy" xorm:"created_by"`     // 创建人
+	CreatedTime time.Time `json:"createdTime" xorm:"created_time"` // 创建时间
+	UpdatedTime time.Time `json:"updatedTime" xorm:"updated_time"` // 更新时间
+}
+
+// ProcInsBulkResult 批量操作中单个实例(节点)的执行结果
+type ProcInsBulkResult struct {
+	Id             int64     `json:"id" xorm:"id"`                           // 自增id
+	JobId          string    `json:"jobId" xorm:"job_id"`                    // 批量任务id
+	ProcInsId      string    `json:"procInsId" xorm:"proc_ins_id"`           // 编排实例id
+	ProcDefName    string    `json:"procDefName" xorm:"proc_def_name"`       // 编排名称
+	EntityDataName string    `json:"entityDataName" xorm:"entity_data_name"` // 根数据名称
+	ProcInsNodeId  string    `json:"procInsNodeId" xorm:"proc_ins_node_id"`  // 编排实例节点id,实例级操作为空
+	NodeName       string    `json:"nodeName" xorm:"node_name"`              // 节点名称
+	NodeType       string    `json:"nodeType" xorm:"node_type"`              // 节点类型
+	Status         string    `json:"status" xorm:"status"`                   // 状态->wait | success | fail | skipped
+	Message        string    `json:"message" xorm:"message"`                 // 失败或跳过的原因
+	UpdatedTime    time.Time `json:"updatedTime" xorm:"updated_time"`        // 更新时间
+}
+
+// ProcInsBulkDetail 批量任务及每个实例的结果
+type ProcInsBulkDetail struct {
+	*ProcInsBulkJob
+	Results []*ProcInsBulkResult `json:"results"`
+}
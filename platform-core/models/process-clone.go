@@ -0,0 +1,61 @@
+package models
+
+import "time"
+
+// ProcInsCloneParam 从源实例的指定节点重新运行为新实例
+type ProcInsCloneParam struct {
+	ProcInsNodeId string `json:"procInsNodeId"` // 源实例中开始运行的节点id
+}
+
+// ProcInsClone 实例重新运行纪录,关联新实例和源实例
+type ProcInsClone struct {
+	Id                 string    `json:"id" xorm:"id"`                                     // 唯一标识
+	ProcInsId          string    `json:"procInsId" xorm:"proc_ins_id"`                     // 新实例id
+	SourceProcInsId    string    `json:"sourceProcInsId" xorm:"source_proc_ins_id"`        // 源实例id
+	StartProcDefNodeId string    `json:"startProcDefNodeId" xorm:"start_proc_def_node_id"` // 开始运行的节点定义id
+	StartNodeName      string    `json:"startNodeName" xorm:"start_node_name"`             // 开始运行的节点名称
+	ReusedNodes        string    `json:"reusedNodes" xorm:"reused_nodes"`                  // 复用源实例执行结果的节点名称,逗号分隔
+	SkippedNodes       string    `json:"skippedNodes" xorm:"skipped_nodes"`                // 源实例中没有成功、直接跳过的节点名称,逗号分隔
+	CreatedBy          string    `json:"createdBy" xorm:"created_by"`                      // 创建人
+	CreatedTime        time.Time `json:"createdTime" xorm:"created_time"`                  // 创建时间
+}
+
+// IsProcInsCloneReplayNode 开始节点之前的这些任务类节点不再执行,复用源实例的结果或跳过,其它节点(开始、分流、聚合、判断等)正常流转
+func IsProcInsCloneReplayNode(nodeType string) bool {
+	switch nodeType {
+	case JobAutoType, JobDataType, JobHumanType, JobSubProcType, JobLoopType, JobTimeType, JobDateType, JobSignalType:
+		return true
+	}
+	return false
+}
+
+// GetProcDefNodeDescendants 沿连线正向查找该节点能到达的所有下游节点
+func GetProcDefNodeDescendants(links []*ProcDefNodeLink, nodeId string) map[string]bool {
+	reverseLinks := make([]*ProcDefNodeLink, 0, len(links))
+	for _, link := range links {
+		reverseLinks = append(reverseLinks, &ProcDefNodeLink{Source: link.Target, Target: link.Source})
+	}
+	return GetProcDefNodeAncestors(reverseLinks, nodeId)
+}
+
+// GetProcDefNodeAncestors 沿连线反向查找能到达该节点的所有上游节点
+func GetProcDefNodeAncestors(links []*ProcDefNodeLink, nodeId string) map[string]bool {
+	sourceMap := make(map[string][]string)
+	for _, link := range links {
+		sourceMap[link.Target] = append(sourceMap[link.Target], link.Source)
+	}
+	result := make(map[string]bool)
+	queue := []string{nodeId}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, source := range sourceMap[current] {
+			if source == nodeId || result[source] {
+				continue
+			}
+			result[source] = true
+			queue = append(queue, source)
+		}
+	}
+	return result
+}
@@ -41,25 +41,29 @@ const (
 	ProcDefNodeTypeTimeInterval ProcDefNodeType = "timeInterval"  //时间间隔
 	ProcDefNodeSubProcess       ProcDefNodeType = "subProc"       // 子编排
 	ProcDefNodeDecisionMerge    ProcDefNodeType = "decisionMerge" // 判断汇聚
+	ProcDefNodeLoop             ProcDefNodeType = "loop"          // 循环
+	ProcDefNodeSignal           ProcDefNodeType = "signal"        // 等待信号
 )
 
 type ProcDef struct {
-	Id            string    `json:"id" xorm:"id"`                        // 唯一标识
-	Key           string    `json:"key" xorm:"key"`                      // 编排key
-	Name          string    `json:"name" xorm:"name"`                    // 编排名称
-	Version       string    `json:"version" xorm:"version"`              // 版本
-	RootEntity    string    `json:"rootEntity" xorm:"root_entity"`       // 根节点
-	Status        string    `json:"status" xorm:"status"`                // 状态
-	Tags          string    `json:"tags" xorm:"tags"`                    // 标签
-	ForPlugin     string    `json:"forPlugin" xorm:"for_plugin"`         // 授权插件
-	Scene         string    `json:"scene" xorm:"scene"`                  // 使用场景
-	ConflictCheck bool      `json:"conflictCheck" xorm:"conflict_check"` // 冲突检测
-	CreatedBy     string    `json:"createdBy" xorm:"created_by"`         // 创建人
-	CreatedTime   time.Time `json:"createdTime" xorm:"created_time"`     // 创建时间
-	UpdatedBy     string    `json:"updatedBy" xorm:"updated_by"`         // 更新人
-	UpdatedTime   time.Time `json:"updatedTime" xorm:"updated_time"`     // 更新时间
-	ManageRole    string    `json:"manageRole" xorm:"-"`                 // 属主
-	SubProc       bool      `json:"subProc" xorm:"sub_proc"`             // 是否子编排
+	Id                string    `json:"id" xorm:"id"`                                // 唯一标识
+	Key               string    `json:"key" xorm:"key"`                              // 编排key
+	Name              string    `json:"name" xorm:"name"`                            // 编排名称
+	Version           string    `json:"version" xorm:"version"`                      // 版本
+	RootEntity        string    `json:"rootEntity" xorm:"root_entity"`               // 根节点
+	Status            string    `json:"status" xorm:"status"`                        // 状态
+	Tags              string    `json:"tags" xorm:"tags"`                            // 标签
+	ForPlugin         string    `json:"forPlugin" xorm:"for_plugin"`                 // 授权插件
+	Scene             string    `json:"scene" xorm:"scene"`                          // 使用场景
+	ConflictCheck     bool      `json:"conflictCheck" xorm:"conflict_check"`         // 冲突检测
+	CreatedBy         string    `json:"createdBy" xorm:"created_by"`                 // 创建人
+	CreatedTime       time.Time `json:"createdTime" xorm:"created_time"`             // 创建时间
+	UpdatedBy         string    `json:"updatedBy" xorm:"updated_by"`                 // 更新人
+	UpdatedTime       time.Time `json:"updatedTime" xorm:"updated_time"`             // 更新时间
+	ManageRole        string    `json:"manageRole" xorm:"-"`                         // 属主
+	SubProc           bool      `json:"subProc" xorm:"sub_proc"`                     // 是否子编排
+	Variables         string    `json:"variables" xorm:"variables"`                  // 编排变量定义
+	ConcurrencyPolicy string    `json:"concurrencyPolicy" xorm:"concurrency_policy"` // 并发控制
 }
 
 type ProcDefNode struct {
@@ -82,6 +86,11 @@ type ProcDefNode struct {
 	UiStyle           string    `json:"uiStyle" xorm:"ui_style"`                      // 前端样式
 	AllowContinue     bool      `json:"allowContinue" xorm:"allow_continue"`          // 允许跳过
 	SubProcDefId      string    `json:"subProcDefId" xorm:"sub_proc_def_id"`          // 子编排定义id
+	RetryPolicy       string    `json:"retryPolicy" xorm:"retry_policy"`              // 自动重试策略
+	LoopPolicy        string    `json:"loopPolicy" xorm:"loop_policy"`                // 循环节点策略
+	CompensateService string    `json:"compensateService" xorm:"compensate_service"`  // 补偿插件服务
+	OutputMappings    string    `json:"outputMappings" xorm:"output_mappings"`        // 出参写入编排变量的映射
+	ApprovalPolicy    string    `json:"approvalPolicy" xorm:"approval_policy"`        // 人工节点多人审批策略
 	CreatedBy         string    `json:"createdBy" xorm:"created_by"`                  // 创建人
 	CreatedTime       time.Time `json:"createdTime" xorm:"created_time"`              // 创建时间
 	UpdatedBy         string    `json:"updatedBy" xorm:"updated_by"`                  // 更新人
@@ -93,8 +102,8 @@ type ProcDefNodeParam struct {
 	ProcDefNodeId string `json:"nodeId" xorm:"proc_def_node_id"`     // 编排节点id
 	ParamId       string `json:"id" xorm:"param_id"`                 // 编排节点参数id
 	Name          string `json:"paramName" xorm:"name"`              // 参数名
-	BindType      string `json:"bindType" xorm:"bind_type"`          // 参数类型->context(上下文) | constant(静态值)
-	Value         string `json:"bindValue" xorm:"value"`             // 参数值
+	BindType      string `json:"bindType" xorm:"bind_type"`          // 参数类型->context(上下文) | constant(静态值) | variable(编排变量)
+	Value         string `json:"bindValue" xorm:"value"`             // 参数值,variable时为变量名
 	CtxBindNode   string `json:"bindNodeId" xorm:"ctx_bind_node"`    // 上下文节点
 	CtxBindType   string `json:"bindParamType" xorm:"ctx_bind_type"` // 上下文出入参->input(入参) | output(出参)
 	CtxBindName   string `json:"bindParamName" xorm:"ctx_bind_name"` // 上下文参数名
@@ -102,13 +111,15 @@ type ProcDefNodeParam struct {
 }
 
 type ProcDefNodeLink struct {
-	Id        string `json:"id" xorm:"id"`                 // 唯一标识(source__target)
-	ProcDefId string `json:"procDefId" xorm:"proc_def_id"` // 编排id
-	LinkId    string `json:"LinkId" xorm:"link_id"`        // 前端线id
-	Source    string `json:"source" xorm:"source"`         // 源节点
-	Target    string `json:"target" xorm:"target"`         // 目标节点
-	Name      string `json:"name" xorm:"name"`             // 连接名称
-	UiStyle   string `json:"uiStyle" xorm:"ui_style"`      // 前端样式
+	Id         string `json:"id" xorm:"id"`                 // 唯一标识(source__target)
+	ProcDefId  string `json:"procDefId" xorm:"proc_def_id"` // 编排id
+	LinkId     string `json:"LinkId" xorm:"link_id"`        // 前端线id
+	Source     string `json:"source" xorm:"source"`         // 源节点
+	Target     string `json:"target" xorm:"target"`         // 目标节点
+	Name       string `json:"name" xorm:"name"`             // 连接名称
+	UiStyle    string `json:"uiStyle" xorm:"ui_style"`      // 前端样式
+	Expression string `json:"expression" xorm:"expression"` // 判断分支表达式
+	IsDefault  bool   `json:"isDefault" xorm:"is_default"`  // 是否判断默认分支
 }
 
 type ProcDefPermission struct {
@@ -135,17 +146,19 @@ type SyncUseRoleParam struct {
 
 // ProcessDefinitionParam 添加编排参数
 type ProcessDefinitionParam struct {
-	Id               string           `json:"id"`               // 唯一标识
-	Key              string           `json:"Key"`              // key
-	Name             string           `json:"name"`             // 编排名称
-	Version          string           `json:"version"`          // 编排版本
-	Scene            string           `json:"scene"`            // 使用场景
-	AuthPlugins      []string         `json:"authPlugins"`      // 授权插件列表
-	Tags             string           `json:"tags"`             // 标签
-	ConflictCheck    bool             `json:"conflictCheck"`    // 冲突检测
-	RootEntity       string           `json:"rootEntity"`       // 根节点
-	PermissionToRole PermissionToRole `json:"permissionToRole"` // 角色
-	SubProc          bool             `json:"subProc"`          // 是否子编排
+	Id                string                    `json:"id"`                // 唯一标识
+	Key               string                    `json:"Key"`               // key
+	Name              string                    `json:"name"`              // 编排名称
+	Version           string                    `json:"version"`           // 编排版本
+	Scene             string                    `json:"scene"`             // 使用场景
+	AuthPlugins       []string                  `json:"authPlugins"`       // 授权插件列表
+	Tags              string                    `json:"tags"`              // 标签
+	ConflictCheck     bool                      `json:"conflictCheck"`     // 冲突检测
+	RootEntity        string                    `json:"rootEntity"`        // 根节点
+	PermissionToRole  PermissionToRole          `json:"permissionToRole"`  // 角色
+	SubProc           bool                      `json:"subProc"`           // 是否子编排
+	Variables         ProcDefVariableList       `json:"variables"`         // 编排变量定义
+	ConcurrencyPolicy *ProcDefConcurrencyPolicy `json:"concurrencyPolicy"` // 并发控制
 }
 
 type CheckProcDefNameParam struct {
@@ -221,56 +234,66 @@ type ProcDefNodeExtendDto struct {
 }
 
 type ProcDefNodeCustomAttrs struct {
-	Id                string              `json:"id"`                // 节点Id
-	Name              string              `json:"name"`              // 节点名称
-	Status            string              `json:"status"`            // 状态
-	NodeType          string              `json:"nodeType"`          // 节点类型
-	ProcDefId         string              `json:"procDefId"`         // 编排定义id
-	Timeout           int                 `json:"timeout"`           // 超时时间
-	Description       string              `json:"description"`       // 描述
-	DynamicBind       int                 `json:"dynamicBind"`       // 动态绑定 -> 0(启动时绑定)|1->(绑定节点)|2->(运行时)
-	BindNodeId        string              `json:"bindNodeId"`        // 动态绑定节点
-	RoutineExpression string              `json:"routineExpression"` // 定位规则
-	ServiceId         string              `json:"serviceId"`         // 插件服务ID
-	ServiceName       string              `json:"serviceName"`       // 插件服务名
-	RiskCheck         bool                `json:"riskCheck"`         // 是否高危检测
-	ParamInfos        []*ProcDefNodeParam `json:"paramInfos"`        // 节点参数
-	ContextParamNodes []string            `json:"contextParamNodes"` // 上下文参数节点
-	TimeConfig        interface{}         `json:"timeConfig"`        // 节点配置
-	OrderedNo         int                 `json:"orderedNo"`         // 节点顺序
-	CreatedBy         string              `json:"createdBy" `        // 创建人
-	CreatedTime       string              `json:"createdTime" `      // 创建时间
-	UpdatedBy         string              `json:"updatedBy" `        // 更新人
-	UpdatedTime       string              `json:"updatedTime" `      // 更新时间
-	AllowContinue     bool                `json:"allowContinue"`     // 允许跳过
-	SubProcDefId      string              `json:"subProcDefId"`      // 子编排定义id
+	Id                string                    `json:"id"`                // 节点Id
+	Name              string                    `json:"name"`              // 节点名称
+	Status            string                    `json:"status"`            // 状态
+	NodeType          string                    `json:"nodeType"`          // 节点类型
+	ProcDefId         string                    `json:"procDefId"`         // 编排定义id
+	Timeout           int                       `json:"timeout"`           // 超时时间
+	Description       string                    `json:"description"`       // 描述
+	DynamicBind       int                       `json:"dynamicBind"`       // 动态绑定 -> 0(启动时绑定)|1->(绑定节点)|2->(运行时)
+	BindNodeId        string                    `json:"bindNodeId"`        // 动态绑定节点
+	RoutineExpression string                    `json:"routineExpression"` // 定位规则
+	ServiceId         string                    `json:"serviceId"`         // 插件服务ID
+	ServiceName       string                    `json:"serviceName"`       // 插件服务名
+	RiskCheck         bool                      `json:"riskCheck"`         // 是否高危检测
+	ParamInfos        []*ProcDefNodeParam       `json:"paramInfos"`        // 节点参数
+	ContextParamNodes []string                  `json:"contextParamNodes"` // 上下文参数节点
+	TimeConfig        interface{}               `json:"timeConfig"`        // 节点配置
+	OrderedNo         int                       `json:"orderedNo"`         // 节点顺序
+	CreatedBy         string                    `json:"createdBy" `        // 创建人
+	CreatedTime       string                    `json:"createdTime" `      // 创建时间
+	UpdatedBy         string                    `json:"updatedBy" `        // 更新人
+	UpdatedTime       string                    `json:"updatedTime" `      // 更新时间
+	AllowContinue     bool                      `json:"allowContinue"`     // 允许跳过
+	SubProcDefId      string                    `json:"subProcDefId"`      // 子编排定义id
+	RetryPolicy       *ProcNodeRetryPolicy      `json:"retryPolicy"`       // 自动重试策略
+	LoopPolicy        *ProcNodeLoopPolicy       `json:"loopPolicy"`        // 循环节点策略
+	CompensateService string                    `json:"compensateService"` // 补偿插件服务
+	OutputMappings    ProcNodeOutputMappingList `json:"outputMappings"`    // 出参写入编排变量的映射
+	ApprovalPolicy    *ProcNodeApprovalPolicy   `json:"approvalPolicy"`    // 人工节点多人审批策略
 }
 
 type ProcDefNodeCustomAttrsDto struct {
-	Id                string              `json:"id"`                // 节点Id
-	Name              string              `json:"name"`              // 节点名称
-	Status            string              `json:"status"`            // 状态
-	NodeType          string              `json:"nodeType"`          // 节点类型
-	ProcDefId         string              `json:"procDefId"`         // 编排定义id
-	Timeout           int                 `json:"timeout"`           // 超时时间
-	Description       string              `json:"description"`       // 描述
-	DynamicBind       int                 `json:"dynamicBind"`       // 动态绑定 -> 0(启动时绑定)|1->(绑定节点)|2->(运行时)
-	BindNodeId        string              `json:"bindNodeId"`        // 动态绑定节点
-	RoutineExpression string              `json:"routineExpression"` // 定位规则
-	ServiceName       string              `json:"serviceName"`       // 插件服务名
-	RiskCheck         bool                `json:"riskCheck"`         // 是否高危检测
-	ParamInfos        []*ProcDefNodeParam `json:"paramInfos"`        // 节点参数
-	ContextParamNodes []string            `json:"contextParamNodes"` // 上下文参数节点
-	TimeConfig        interface{}         `json:"timeConfig"`        // 节点配置
-	OrderedNo         int                 `json:"orderedNo"`         // 节点顺序
-	CreatedBy         string              `json:"createdBy" `        // 创建人
-	CreatedTime       string              `json:"createdTime" `      // 创建时间
-	UpdatedBy         string              `json:"updatedBy" `        // 更新人
-	UpdatedTime       string              `json:"updatedTime" `      // 更新时间
-	AllowContinue     bool                `json:"allowContinue"`     // 允许跳过
-	SubProcDefId      string              `json:"subProcDefId"`      // 子编排定义id
-	SubProcDefName    string              `json:"subProcDefName"`    // 子编排定义名称
-	SubProcDefVersion string              `json:"subProcDefVersion"` // 子编排定义版本
+	Id                string                    `json:"id"`                // 节点Id
+	Name              string                    `json:"name"`              // 节点名称
+	Status            string                    `json:"status"`            // 状态
+	NodeType          string                    `json:"nodeType"`          // 节点类型
+	ProcDefId         string                    `json:"procDefId"`         // 编排定义id
+	Timeout           int                       `json:"timeout"`           // 超时时间
+	Description       string                    `json:"description"`       // 描述
+	DynamicBind       int                       `json:"dynamicBind"`       // 动态绑定 -> 0(启动时绑定)|1->(绑定节点)|2->(运行时)
+	BindNodeId        string                    `json:"bindNodeId"`        // 动态绑定节点
+	RoutineExpression string                    `json:"routineExpression"` // 定位规则
+	ServiceName       string                    `json:"serviceName"`       // 插件服务名
+	RiskCheck         bool                      `json:"riskCheck"`         // 是否高危检测
+	ParamInfos        []*ProcDefNodeParam       `json:"paramInfos"`        // 节点参数
+	ContextParamNodes []string                  `json:"contextParamNodes"` // 上下文参数节点
+	TimeConfig        interface{}               `json:"timeConfig"`        // 节点配置
+	OrderedNo         int                       `json:"orderedNo"`         // 节点顺序
+	CreatedBy         string                    `json:"createdBy" `        // 创建人
+	CreatedTime       string                    `json:"createdTime" `      // 创建时间
+	UpdatedBy         string                    `json:"updatedBy" `        // 更新人
+	UpdatedTime       string                    `json:"updatedTime" `      // 更新时间
+	AllowContinue     bool                      `json:"allowContinue"`     // 允许跳过
+	SubProcDefId      string                    `json:"subProcDefId"`      // 子编排定义id
+	SubProcDefName    string                    `json:"subProcDefName"`    // 子编排定义名称
+	SubProcDefVersion string                    `json:"subProcDefVersion"` // 子编排定义版本
+	RetryPolicy       *ProcNodeRetryPolicy      `json:"retryPolicy"`       // 自动重试策略
+	LoopPolicy        *ProcNodeLoopPolicy       `json:"loopPolicy"`        // 循环节点策略
+	CompensateService string                    `json:"compensateService"` // 补偿插件服务
+	OutputMappings    ProcNodeOutputMappingList `json:"outputMappings"`    // 出参写入编排变量的映射
+	ApprovalPolicy    *ProcNodeApprovalPolicy   `json:"approvalPolicy"`    // 人工节点多人审批策略
 }
 
 type InterfaceParameterDto struct {
@@ -313,35 +336,39 @@ type ImportResultItemDto struct {
 }
 
 type ProcDefNodeLinkCustomAttrs struct {
-	Id     string `json:"id"`     // Id
-	Name   string `json:"name"`   // 线名称
-	Source string `json:"source"` // 源
-	Target string `json:"target"` // 目标
+	Id         string `json:"id"`         // Id
+	Name       string `json:"name"`       // 线名称
+	Source     string `json:"source"`     // 源
+	Target     string `json:"target"`     // 目标
+	Expression string `json:"expression"` // 判断分支表达式
+	IsDefault  bool   `json:"isDefault"`  // 是否判断默认分支
 }
 
 type ProcDefDto struct {
-	Id               string   `json:"id"`               // 唯一标识
-	Key              string   `json:"key"`              // 编排key
-	Name             string   `json:"name"`             // 编排名称
-	Version          string   `json:"version"`          // 版本
-	RootEntity       string   `json:"rootEntity"`       // 根节点
-	Status           string   `json:"status"`           // 状态
-	Tags             string   `json:"tags"`             // 标签
-	AuthPlugins      []string `json:"authPlugins"`      // 授权插件
-	Scene            string   `json:"scene"`            // 使用场景
-	ConflictCheck    bool     `json:"conflictCheck"`    // 冲突检测
-	CreatedBy        string   `json:"createdBy"`        // 创建人
-	CreatedTime      string   `json:"createdTime"`      // 创建时间
-	UpdatedBy        string   `json:"updatedBy"`        // 更新人
-	UpdatedTime      string   `json:"updatedTime"`      // 更新时间
-	EnableCreated    bool     `json:"enableCreated"`    // 能否创建新版本
-	EnableModifyName bool     `json:"enableModifyName"` // 能否修改名称
-	UseRoles         []string `json:"userRoles"`        // 使用角色
-	UseRolesDisplay  []string `json:"userRolesDisplay"` // 使用角色-显示名
-	MgmtRoles        []string `json:"mgmtRoles"`        // 管理角色
-	MgmtRolesDisplay []string `json:"mgmtRolesDisplay"` // 管理角色-显示名
-	SubProc          bool     `json:"subProc"`          // 是否子编排
-	Collected        bool     `json:"collected"`        // 是否收藏
+	Id                string                    `json:"id"`                // 唯一标识
+	Key               string                    `json:"key"`               // 编排key
+	Name              string                    `json:"name"`              // 编排名称
+	Version           string                    `json:"version"`           // 版本
+	RootEntity        string                    `json:"rootEntity"`        // 根节点
+	Status            string                    `json:"status"`            // 状态
+	Tags              string                    `json:"tags"`              // 标签
+	AuthPlugins       []string                  `json:"authPlugins"`       // 授权插件
+	Scene             string                    `json:"scene"`             // 使用场景
+	ConflictCheck     bool                      `json:"conflictCheck"`     // 冲突检测
+	CreatedBy         string                    `json:"createdBy"`         // 创建人
+	CreatedTime       string                    `json:"createdTime"`       // 创建时间
+	UpdatedBy         string                    `json:"updatedBy"`         // 更新人
+	UpdatedTime       string                    `json:"updatedTime"`       // 更新时间
+	EnableCreated     bool                      `json:"enableCreated"`     // 能否创建新版本
+	EnableModifyName  bool                      `json:"enableModifyName"`  // 能否修改名称
+	UseRoles          []string                  `json:"userRoles"`         // 使用角色
+	UseRolesDisplay   []string                  `json:"userRolesDisplay"`  // 使用角色-显示名
+	MgmtRoles         []string                  `json:"mgmtRoles"`         // 管理角色
+	MgmtRolesDisplay  []string                  `json:"mgmtRolesDisplay"`  // 管理角色-显示名
+	SubProc           bool                      `json:"subProc"`           // 是否子编排
+	Collected         bool                      `json:"collected"`         // 是否收藏
+	Variables         ProcDefVariableList       `json:"variables"`         // 编排变量定义
+	ConcurrencyPolicy *ProcDefConcurrencyPolicy `json:"concurrencyPolicy"` // 并发控制
 }
 
 type ProcDefParentListItem struct {
@@ -356,6 +383,8 @@ type TimeConfigDto struct {
 	Date     string `json:"date"`
 	Duration string `json:"duration"`
 	Unit     string `json:"unit"`
+	Type     string `json:"type"`
+	Calendar string `json:"calendar"`
 }
 
 type ProcDefQueryDto struct {
@@ -510,21 +539,23 @@ func ConvertProcDef2Dto(procDef *ProcDef) *ProcDefDto {
 		authPlugins = strings.Split(procDef.ForPlugin, ",")
 	}
 	dto := &ProcDefDto{
-		Id:            procDef.Id,
-		Key:           procDef.Key,
-		Name:          procDef.Name,
-		Version:       procDef.Version,
-		RootEntity:    procDef.RootEntity,
-		Status:        procDef.Status,
-		Tags:          procDef.Tags,
-		AuthPlugins:   authPlugins,
-		Scene:         procDef.Scene,
-		ConflictCheck: procDef.ConflictCheck,
-		CreatedBy:     procDef.CreatedBy,
-		CreatedTime:   procDef.CreatedTime.Format(DateTimeFormat),
-		UpdatedBy:     procDef.UpdatedBy,
-		UpdatedTime:   procDef.UpdatedTime.Format(DateTimeFormat),
-		SubProc:       procDef.SubProc,
+		Id:                procDef.Id,
+		Key:               procDef.Key,
+		Name:              procDef.Name,
+		Version:           procDef.Version,
+		RootEntity:        procDef.RootEntity,
+		Status:            procDef.Status,
+		Tags:              procDef.Tags,
+		AuthPlugins:       authPlugins,
+		Scene:             procDef.Scene,
+		ConflictCheck:     procDef.ConflictCheck,
+		CreatedBy:         procDef.CreatedBy,
+		CreatedTime:       procDef.CreatedTime.Format(DateTimeFormat),
+		UpdatedBy:         procDef.UpdatedBy,
+		UpdatedTime:       procDef.UpdatedTime.Format(DateTimeFormat),
+		SubProc:           procDef.SubProc,
+		Variables:         ParseProcDefVariables(procDef.Variables),
+		ConcurrencyPolicy: ParseProcDefConcurrencyPolicy(procDef.ConcurrencyPolicy),
 	}
 	return dto
 }
@@ -542,21 +573,23 @@ func ConvertProcDefDto2Model(dto *ProcDefDto) *ProcDef {
 		authPlugins = strings.Join(dto.AuthPlugins, ",")
 	}
 	return &ProcDef{
-		Id:            dto.Id,
-		Key:           dto.Key,
-		Name:          dto.Name,
-		Version:       dto.Version,
-		RootEntity:    dto.RootEntity,
-		Status:        dto.Status,
-		Tags:          dto.Tags,
-		ForPlugin:     authPlugins,
-		Scene:         dto.Scene,
-		ConflictCheck: dto.ConflictCheck,
-		CreatedBy:     dto.CreatedBy,
-		CreatedTime:   createTime,
-		UpdatedBy:     dto.UpdatedBy,
-		UpdatedTime:   updateTime,
-		SubProc:       dto.SubProc,
+		Id:                dto.Id,
+		Key:               dto.Key,
+		Name:              dto.Name,
+		Version:           dto.Version,
+		RootEntity:        dto.RootEntity,
+		Status:            dto.Status,
+		Tags:              dto.Tags,
+		ForPlugin:         authPlugins,
+		Scene:             dto.Scene,
+		ConflictCheck:     dto.ConflictCheck,
+		CreatedBy:         dto.CreatedBy,
+		CreatedTime:       createTime,
+		UpdatedBy:         dto.UpdatedBy,
+		UpdatedTime:       updateTime,
+		SubProc:           dto.SubProc,
+		Variables:         dto.Variables.String(),
+		ConcurrencyPolicy: dto.ConcurrencyPolicy.String(),
 	}
 }
 
@@ -605,6 +638,11 @@ func ConvertProcDefNodeResultDto2Model(dto *ProcDefNodeResultDto) (node *ProcDef
 			UpdatedTime:       updateTime,
 			AllowContinue:     attr.AllowContinue,
 			SubProcDefId:      attr.SubProcDefId,
+			RetryPolicy:       attr.RetryPolicy.String(),
+			LoopPolicy:        attr.LoopPolicy.String(),
+			CompensateService: attr.CompensateService,
+			OutputMappings:    attr.OutputMappings.String(),
+			ApprovalPolicy:    attr.ApprovalPolicy.String(),
 		}
 		if dto.ProcDefNodeCustomAttrs != nil {
 			list = dto.ProcDefNodeCustomAttrs.ParamInfos
@@ -651,6 +689,11 @@ func ConvertProcDefNode2Dto(procDefNode *ProcDefNode, list []*ProcDefNodeParam)
 			UpdatedTime:       procDefNode.UpdatedTime.Format(DateTimeFormat),
 			AllowContinue:     procDefNode.AllowContinue,
 			SubProcDefId:      procDefNode.SubProcDefId,
+			RetryPolicy:       ParseProcNodeRetryPolicy(procDefNode.RetryPolicy),
+			LoopPolicy:        ParseProcNodeLoopPolicy(procDefNode.LoopPolicy),
+			CompensateService: procDefNode.CompensateService,
+			OutputMappings:    ParseProcNodeOutputMappings(procDefNode.OutputMappings),
+			ApprovalPolicy:    ParseProcNodeApprovalPolicy(procDefNode.ApprovalPolicy),
 		},
 		NodeAttrs: procDefNode.UiStyle,
 	}
@@ -661,12 +704,14 @@ func ConvertParam2ProcDefNodeLink(param *ProcDefNodeLinkDto) *ProcDefNodeLink {
 	byteArr, _ := json.Marshal(param.SelfAttrs)
 	nodeLinkAttr := param.ProcDefNodeLinkCustomAttrs
 	return &ProcDefNodeLink{
-		ProcDefId: param.ProcDefId,
-		LinkId:    nodeLinkAttr.Id,
-		Source:    nodeLinkAttr.Source,
-		Target:    nodeLinkAttr.Target,
-		Name:      nodeLinkAttr.Name,
-		UiStyle:   string(byteArr),
+		ProcDefId:  param.ProcDefId,
+		LinkId:     nodeLinkAttr.Id,
+		Source:     nodeLinkAttr.Source,
+		Target:     nodeLinkAttr.Target,
+		Name:       nodeLinkAttr.Name,
+		UiStyle:    string(byteArr),
+		Expression: nodeLinkAttr.Expression,
+		IsDefault:  nodeLinkAttr.IsDefault,
 	}
 }
 
@@ -677,12 +722,14 @@ func CovertNodeLinkDto2Model(param *ProcDefNodeLinkDto) *ProcDefNodeLink {
 	}
 	nodeLinkAttr := param.ProcDefNodeLinkCustomAttrs
 	return &ProcDefNodeLink{
-		ProcDefId: param.ProcDefId,
-		LinkId:    nodeLinkAttr.Id,
-		Source:    nodeLinkAttr.Source,
-		Target:    nodeLinkAttr.Target,
-		Name:      nodeLinkAttr.Name,
-		UiStyle:   uiStyle,
+		ProcDefId:  param.ProcDefId,
+		LinkId:     nodeLinkAttr.Id,
+		Source:     nodeLinkAttr.Source,
+		Target:     nodeLinkAttr.Target,
+		Name:       nodeLinkAttr.Name,
+		UiStyle:    uiStyle,
+		Expression: nodeLinkAttr.Expression,
+		IsDefault:  nodeLinkAttr.IsDefault,
 	}
 }
 
@@ -698,10 +745,12 @@ func ConvertProcDefNodeLink2Dto(nodeLink *ProcDefNodeLink, nodeList []*ProcDefNo
 	dto := &ProcDefNodeLinkDto{
 		ProcDefId: nodeLink.ProcDefId,
 		ProcDefNodeLinkCustomAttrs: &ProcDefNodeLinkCustomAttrs{
-			Id:     nodeLink.LinkId,
-			Name:   nodeLink.Name,
-			Source: source,
-			Target: target,
+			Id:         nodeLink.LinkId,
+			Name:       nodeLink.Name,
+			Source:     source,
+			Target:     target,
+			Expression: nodeLink.Expression,
+			IsDefault:  nodeLink.IsDefault,
 		},
 		SelfAttrs: nodeLink.UiStyle,
 	}
@@ -743,26 +792,28 @@ func BuildProcDefDto(procDef *ProcDef, userRoles, manageRoles, userRolesDisplay,
 		collected = true
 	}
 	return &ProcDefDto{
-		Id:               procDef.Id,
-		Key:              procDef.Key,
-		Name:             procDef.Name,
-		Version:          procDef.Version,
-		RootEntity:       procDef.RootEntity,
-		Status:           procDef.Status,
-		Tags:             procDef.Tags,
-		AuthPlugins:      authPlugins,
-		Scene:            procDef.Scene,
-		ConflictCheck:    procDef.ConflictCheck,
-		CreatedBy:        procDef.CreatedBy,
-		CreatedTime:      procDef.CreatedTime.Format(DateTimeFormat),
-		UpdatedBy:        procDef.UpdatedBy,
-		UpdatedTime:      procDef.UpdatedTime.Format(DateTimeFormat),
-		EnableCreated:    enableCreated,
-		UseRoles:         userRoles,
-		UseRolesDisplay:  userRolesDisplay,
-		MgmtRoles:        manageRoles,
-		MgmtRolesDisplay: manageRolesDisplay,
-		Collected:        collected,
+		Id:                procDef.Id,
+		Key:               procDef.Key,
+		Name:              procDef.Name,
+		Version:           procDef.Version,
+		RootEntity:        procDef.RootEntity,
+		Status:            procDef.Status,
+		Tags:              procDef.Tags,
+		AuthPlugins:       authPlugins,
+		Scene:             procDef.Scene,
+		ConflictCheck:     procDef.ConflictCheck,
+		CreatedBy:         procDef.CreatedBy,
+		CreatedTime:       procDef.CreatedTime.Format(DateTimeFormat),
+		UpdatedBy:         procDef.UpdatedBy,
+		UpdatedTime:       procDef.UpdatedTime.Format(DateTimeFormat),
+		EnableCreated:     enableCreated,
+		UseRoles:          userRoles,
+		UseRolesDisplay:   userRolesDisplay,
+		MgmtRoles:         manageRoles,
+		MgmtRolesDisplay:  manageRolesDisplay,
+		Collected:         collected,
+		Variables:         ParseProcDefVariables(procDef.Variables),
+		ConcurrencyPolicy: ParseProcDefConcurrencyPolicy(procDef.ConcurrencyPolicy),
 	}
 }
 
@@ -798,6 +849,11 @@ func ConvertParam2ProcDefNode(user string, param ProcDefNodeRequestParam) *ProcD
 		UpdatedTime:       now,
 		AllowContinue:     procDefNodeAttr.AllowContinue,
 		SubProcDefId:      procDefNodeAttr.SubProcDefId,
+		RetryPolicy:       procDefNodeAttr.RetryPolicy.String(),
+		LoopPolicy:        procDefNodeAttr.LoopPolicy.String(),
+		CompensateService: procDefNodeAttr.CompensateService,
+		OutputMappings:    procDefNodeAttr.OutputMappings.String(),
+		ApprovalPolicy:    procDefNodeAttr.ApprovalPolicy.String(),
 	}
 	return node
 }
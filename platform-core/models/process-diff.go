@@ -0,0 +1,284 @@
+package models
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+const (
+	DiffActionAdded   = "added"   // 新版本新增
+	DiffActionRemoved = "removed" // 新版本删除
+	DiffActionChanged = "changed" // 两个版本都有但内容不同
+)
+
+// ProcDefDiffResult 两个编排版本的差异,source为基准版本,target为对比版本
+type ProcDefDiffResult struct {
+	Source      *ProcDefParentListItem   `json:"source"`      // 基准编排
+	Target      *ProcDefParentListItem   `json:"target"`      // 对比编排
+	ProcDef     []*ProcDefDiffField      `json:"procDef"`     // 编排属性变化
+	Nodes       []*ProcDefNodeDiff       `json:"nodes"`       // 节点变化
+	Links       []*ProcDefLinkDiff       `json:"links"`       // 线变化
+	Permissions []*ProcDefPermissionDiff `json:"permissions"` // 权限变化
+}
+
+// ProcDefDiffField 单个属性的变化
+type ProcDefDiffField struct {
+	Field    string      `json:"field"`    // 属性名,节点参数为param.参数名
+	OldValue interface{} `json:"oldValue"` // 基准版本的值
+	NewValue interface{} `json:"newValue"` // 对比版本的值
+}
+
+// ProcDefNodeDiff 节点变化,节点按前端nodeId对应
+type ProcDefNodeDiff struct {
+	Action   string              `json:"action"`   // 变化类型->added | removed | changed
+	NodeId   string              `json:"nodeId"`   // 前端节点id
+	NodeName string              `json:"nodeName"` // 节点名称
+	NodeType string              `json:"nodeType"` // 节点类型
+	Changes  []*ProcDefDiffField `json:"changes"`  // 属性变化,changed时有值
+}
+
+// ProcDefLinkDiff 线变化,线按起止节点对应
+type ProcDefLinkDiff struct {
+	Action  string              `json:"action"`  // 变化类型->added | removed | changed
+	LinkId  string              `json:"linkId"`  // 前端线id
+	Name    string              `json:"name"`    // 线名称
+	Source  string              `json:"source"`  // 源节点id
+	Target  string              `json:"target"`  // 目标节点id
+	Changes []*ProcDefDiffField `json:"changes"` // 属性变化,changed时有值
+}
+
+// ProcDefPermissionDiff 权限变化
+type ProcDefPermissionDiff struct {
+	Action     string `json:"action"`     // 变化类型->added | removed
+	Permission string `json:"permission"` // 权限->MGMT | USE
+	Role       string `json:"role"`       // 角色
+}
+
+// DiffProcessDefinition 对比两个编排详情,以source为基准列出target的新增、删除和修改
+func DiffProcessDefinition(source, target *ProcessDefinitionDto) *ProcDefDiffResult {
+	result := &ProcDefDiffResult{Source: buildDiffProcDefItem(source.ProcDef), Target: buildDiffProcDefItem(target.ProcDef),
+		ProcDef: []*ProcDefDiffField{}, Nodes: []*ProcDefNodeDiff{}, Links: []*ProcDefLinkDiff{}, Permissions: []*ProcDefPermissionDiff{}}
+	result.ProcDef = diffProcDefAttrs(source.ProcDef, target.ProcDef)
+	sourceNodes, sourceEdges := getDiffNodeEdges(source)
+	targetNodes, targetEdges := getDiffNodeEdges(target)
+	sourceNodeMap := make(map[string]*ProcDefNodeCustomAttrsDto)
+	for _, node := range sourceNodes {
+		sourceNodeMap[node.Id] = node
+	}
+	targetNodeMap := make(map[string]*ProcDefNodeCustomAttrsDto)
+	for _, node := range targetNodes {
+		targetNodeMap[node.Id] = node
+		if sourceNode, ok := sourceNodeMap[node.Id]; !ok {
+			result.Nodes = append(result.Nodes, &ProcDefNodeDiff{Action: DiffActionAdded, NodeId: node.Id, NodeName: node.Name, NodeType: node.NodeType})
+		} else if changes := diffProcDefNode(sourceNode, node); len(changes) > 0 {
+			result.Nodes = append(result.Nodes, &ProcDefNodeDiff{Action: DiffActionChanged, NodeId: node.Id, NodeName: node.Name, NodeType: node.NodeType, Changes: changes})
+		}
+	}
+	for _, node := range sourceNodes {
+		if _, ok := targetNodeMap[node.Id]; !ok {
+			result.Nodes = append(result.Nodes, &ProcDefNodeDiff{Action: DiffActionRemoved, NodeId: node.Id, NodeName: node.Name, NodeType: node.NodeType})
+		}
+	}
+	sourceEdgeMap := make(map[string]*ProcDefNodeLinkCustomAttrs)
+	for _, edge := range sourceEdges {
+		sourceEdgeMap[edge.Source+"__"+edge.Target] = edge
+	}
+	targetEdgeMap := make(map[string]*ProcDefNodeLinkCustomAttrs)
+	for _, edge := range targetEdges {
+		key := edge.Source + "__" + edge.Target
+		targetEdgeMap[key] = edge
+		if sourceEdge, ok := sourceEdgeMap[key]; !ok {
+			result.Links = append(result.Links, &ProcDefLinkDiff{Action: DiffActionAdded, LinkId: edge.Id, Name: edge.Name, Source: edge.Source, Target: edge.Target})
+		} else {
+			var changes []*ProcDefDiffField
+			changes = appendDiffField(changes, "name", sourceEdge.Name, edge.Name)
+			changes = appendDiffField(changes, "expression", sourceEdge.Expression, edge.Expression)
+			changes = appendDiffField(changes, "isDefault", sourceEdge.IsDefault, edge.IsDefault)
+			if len(changes) > 0 {
+				result.Links = append(result.Links, &ProcDefLinkDiff{Action: DiffActionChanged, LinkId: edge.Id, Name: edge.Name, Source: edge.Source, Target: edge.Target, Changes: changes})
+			}
+		}
+	}
+	for _, edge := range sourceEdges {
+		if _, ok := targetEdgeMap[edge.Source+"__"+edge.Target]; !ok {
+			result.Links = append(result.Links, &ProcDefLinkDiff{Action: DiffActionRemoved, LinkId: edge.Id, Name: edge.Name, Source: edge.Source, Target: edge.Target})
+		}
+	}
+	result.Permissions = append(result.Permissions, diffPermissionRoles(string(MGMT), source.PermissionToRole.MGMT, target.PermissionToRole.MGMT)...)
+	result.Permissions = append(result.Permissions, diffPermissionRoles(string(USE), source.PermissionToRole.USE, target.PermissionToRole.USE)...)
+	return result
+}
+
+// IsEmpty 两个编排没有任何差异
+func (r *ProcDefDiffResult) IsEmpty() bool {
+	return len(r.ProcDef) == 0 && len(r.Nodes) == 0 && len(r.Links) == 0 && len(r.Permissions) == 0
+}
+
+func buildDiffProcDefItem(procDef *ProcDefDto) *ProcDefParentListItem {
+	return &ProcDefParentListItem{Id: procDef.Id, Key: procDef.Key, Name: procDef.Name, Version: procDef.Version, Status: procDef.Status}
+}
+
+func diffProcDefAttrs(source, target *ProcDefDto) (changes []*ProcDefDiffField) {
+	changes = []*ProcDefDiffField{}
+	changes = appendDiffField(changes, "key", source.Key, target.Key)
+	changes = appendDiffField(changes, "name", source.Name, target.Name)
+	changes = appendDiffField(changes, "rootEntity", source.RootEntity, target.RootEntity)
+	changes = appendDiffField(changes, "tags", source.Tags, target.Tags)
+	changes = appendDiffField(changes, "authPlugins", source.AuthPlugins, target.AuthPlugins)
+	changes = appendDiffField(changes, "scene", source.Scene, target.Scene)
+	changes = appendDiffField(changes, "conflictCheck", source.ConflictCheck, target.ConflictCheck)
+	changes = appendDiffField(changes, "subProc", source.SubProc, target.SubProc)
+	changes = appendDiffField(changes, "variables", source.Variables, target.Variables)
+	changes = appendDiffField(changes, "concurrencyPolicy", source.ConcurrencyPolicy, target.ConcurrencyPolicy)
+	return
+}
+
+func getDiffNodeEdges(procDef *ProcessDefinitionDto) (nodes []*ProcDefNodeCustomAttrsDto, edges []*ProcDefNodeLinkCustomAttrs) {
+	if procDef.ProcDefNodeExtend == nil {
+		return
+	}
+	for _, node := range procDef.ProcDefNodeExtend.Nodes {
+		if node != nil && node.ProcDefNodeCustomAttrs != nil {
+			nodes = append(nodes, node.ProcDefNodeCustomAttrs)
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].OrderedNo < nodes[j].OrderedNo
+	})
+	for _, edge := range procDef.ProcDefNodeExtend.Edges {
+		if edge != nil && edge.ProcDefNodeLinkCustomAttrs != nil {
+			edges = append(edges, edge.ProcDefNodeLinkCustomAttrs)
+		}
+	}
+	return
+}
+
+// diffProcDefNode 对比节点配置,不比较id、状态、顺序和创建更新信息
+func diffProcDefNode(source, target *ProcDefNodeCustomAttrsDto) (changes []*ProcDefDiffField) {
+	changes = appendDiffField(changes, "name", source.Name, target.Name)
+	changes = appendDiffField(changes, "nodeType", source.NodeType, target.NodeType)
+	changes = appendDiffField(changes, "description", source.Description, target.Description)
+	changes = appendDiffField(changes, "serviceName", source.ServiceName, target.ServiceName)
+	changes = appendDiffField(changes, "routineExpression", source.RoutineExpression, target.RoutineExpression)
+	changes = appendDiffField(changes, "timeout", source.Timeout, target.Timeout)
+	changes = appendDiffField(changes, "riskCheck", source.RiskCheck, target.RiskCheck)
+	changes = appendDiffField(changes, "dynamicBind", source.DynamicBind, target.DynamicBind)
+	changes = appendDiffField(changes, "bindNodeId", source.BindNodeId, target.BindNodeId)
+	changes = appendDiffField(changes, "allowContinue", source.AllowContinue, target.AllowContinue)
+	changes = appendDiffField(changes, "contextParamNodes", source.ContextParamNodes, target.ContextParamNodes)
+	changes = appendDiffField(changes, "timeConfig", diffTimeConfig(source.TimeConfig), diffTimeConfig(target.TimeConfig))
+	changes = appendDiffField(changes, "subProcDef", diffSubProcDefName(source), diffSubProcDefName(target))
+	changes = appendDiffField(changes, "retryPolicy", source.RetryPolicy, target.RetryPolicy)
+	changes = appendDiffField(changes, "loopPolicy", source.LoopPolicy, target.LoopPolicy)
+	changes = appendDiffField(changes, "compensateService", source.CompensateService, target.CompensateService)
+	changes = appendDiffField(changes, "outputMappings", source.OutputMappings, target.OutputMappings)
+	changes = appendDiffField(changes, "approvalPolicy", source.ApprovalPolicy, target.ApprovalPolicy)
+	// 节点参数按参数名对应,参数id和所属节点id每个版本不同不参与比较
+	sourceParamMap := make(map[string]ProcDefNodeParam)
+	for _, param := range source.ParamInfos {
+		sourceParamMap[param.Name] = diffNodeParam(param)
+	}
+	targetParamMap := make(map[string]bool)
+	for _, param := range target.ParamInfos {
+		targetParamMap[param.Name] = true
+		if sourceParam, ok := sourceParamMap[param.Name]; ok {
+			changes = appendDiffField(changes, "param."+param.Name, sourceParam, diffNodeParam(param))
+		} else {
+			changes = append(changes, &ProcDefDiffField{Field: "param." + param.Name, NewValue: diffNodeParam(param)})
+		}
+	}
+	for _, param := range source.ParamInfos {
+		if !targetParamMap[param.Name] {
+			changes = append(changes, &ProcDefDiffField{Field: "param." + param.Name, OldValue: diffNodeParam(param)})
+		}
+	}
+	return
+}
+
+func diffNodeParam(param *ProcDefNodeParam) ProcDefNodeParam {
+	return ProcDefNodeParam{Name: param.Name, BindType: param.BindType, Value: param.Value, CtxBindNode: param.CtxBindNode, CtxBindType: param.CtxBindType, CtxBindName: param.CtxBindName, Required: param.Required}
+}
+
+// diffTimeConfig 时间配置是json字符串,解析后比较,避免字段顺序不同和空字段被当成变化
+func diffTimeConfig(timeConfig interface{}) interface{} {
+	stringValue, ok := timeConfig.(string)
+	if !ok {
+		return timeConfig
+	}
+	var result interface{}
+	if err := json.Unmarshal([]byte(stringValue), &result); err != nil {
+		return timeConfig
+	}
+	return compactJsonValue(result)
+}
+
+// diffSubProcDefName 子编排用名称和版本展示,子编排被删除时用id
+func diffSubProcDefName(node *ProcDefNodeCustomAttrsDto) string {
+	if node.SubProcDefName == "" {
+		return node.SubProcDefId
+	}
+	return node.SubProcDefName + " " + node.SubProcDefVersion
+}
+
+func diffPermissionRoles(permission string, sourceRoles, targetRoles []string) (result []*ProcDefPermissionDiff) {
+	sourceRoleMap := make(map[string]bool)
+	for _, role := range sourceRoles {
+		sourceRoleMap[role] = true
+	}
+	targetRoleMap := make(map[string]bool)
+	for _, role := range targetRoles {
+		targetRoleMap[role] = true
+		if !sourceRoleMap[role] {
+			result = append(result, &ProcDefPermissionDiff{Action: DiffActionAdded, Permission: permission, Role: role})
+		}
+	}
+	for _, role := range sourceRoles {
+		if !targetRoleMap[role] {
+			result = append(result, &ProcDefPermissionDiff{Action: DiffActionRemoved, Permission: permission, Role: role})
+		}
+	}
+	return
+}
+
+// appendDiffField 按json序列化结果比较,空值和空列表视为相同
+func appendDiffField(changes []*ProcDefDiffField, field string, oldValue, newValue interface{}) []*ProcDefDiffField {
+	if diffJsonValue(oldValue) == diffJsonValue(newValue) {
+		return changes
+	}
+	return append(changes, &ProcDefDiffField{Field: field, OldValue: oldValue, NewValue: newValue})
+}
+
+func diffJsonValue(value interface{}) string {
+	b, _ := json.Marshal(value)
+	switch jsonValue := string(b); jsonValue {
+	case "null", "[]", "{}", "\"\"":
+		return ""
+	default:
+		return jsonValue
+	}
+}
+
+// compactJsonValue 去掉对象里的空字符串和null字段,空对象和空列表返回nil
+func compactJsonValue(value interface{}) interface{} {
+	switch typeValue := value.(type) {
+	case map[string]interface{}:
+		for k, v := range typeValue {
+			if v = compactJsonValue(v); v == nil || v == "" {
+				delete(typeValue, k)
+			} else {
+				typeValue[k] = v
+			}
+		}
+		if len(typeValue) == 0 {
+			return nil
+		}
+	case []interface{}:
+		for i, v := range typeValue {
+			typeValue[i] = compactJsonValue(v)
+		}
+		if len(typeValue) == 0 {
+			return nil
+		}
+	}
+	return value
+}
@@ -183,14 +183,20 @@ type TaskNodeBindingObj struct {
 }
 
 type ProcInsStartParam struct {
-	EntityDataId      string                `json:"entityDataId"`
-	EntityDisplayName string                `json:"entityDisplayName"`
-	EntityTypeId      string                `json:"entityTypeId"`
-	ProcDefId         string                `json:"procDefId"`
-	ProcessSessionId  string                `json:"processSessionId"`
-	TaskNodeBinds     []*TaskNodeBindingObj `json:"taskNodeBinds"`
-	ParentInsNodeId   string                `json:"parentInsNodeId"`
-	ParentRunNodeId   string                `json:"parentRunNodeId"`
+	EntityDataId      string                 `json:"entityDataId"`
+	EntityDisplayName string                 `json:"entityDisplayName"`
+	EntityTypeId      string                 `json:"entityTypeId"`
+	ProcDefId         string                 `json:"procDefId"`
+	ProcessSessionId  string                 `json:"processSessionId"`
+	TaskNodeBinds     []*TaskNodeBindingObj  `json:"taskNodeBinds"`
+	ParentInsNodeId   string                 `json:"parentInsNodeId"`
+	ParentRunNodeId   string                 `json:"parentRunNodeId"`
+	Simulation        bool                   `json:"simulation"`        // 模拟运行,不真正调用插件和写数据
+	MockResponses     []*ProcSimulationMock  `json:"mockResponses"`     // 模拟运行时按插件服务名配置的返回
+	MockFromProcInsId string                 `json:"mockFromProcInsId"` // 模拟运行时用该实例录制的插件返回作为mock
+	Variables         map[string]interface{} `json:"variables"`         // 编排变量初始值,覆盖定义的默认值
+	Priority          int                    `json:"priority"`          // 启动排队时的优先级,数值越大越优先
+	Breakpoints       []string               `json:"breakpoints"`       // 实例断点,编排定义节点nodeId列表,*表示从开始单步执行
 }
 
 type ProcInsDetail struct {
@@ -215,6 +221,7 @@ type ProcInsDetail struct {
 	SubProc           bool                 `json:"subProc"`
 	DisplayStatus     string               `json:"displayStatus"`
 	Request           []*SimpleRequestDto  `json:"request"`
+	Variables         []*ProcInsVariable   `json:"variables"`
 }
 
 type ProcInsNodeDetail struct {
@@ -526,22 +533,27 @@ type ProcStartEventParam struct {
 	NotifyRequired  string `json:"notifyRequired"`
 	NotifyEndpoint  string `json:"notifyEndpoint"`
 	OperationUser   string `json:"operationUser"`
+	CorrelationKey  string `json:"correlationKey"` // 关联键,有值时用于恢复等待该事件的信号节点,不启动新编排
+	Priority        int    `json:"priority"`       // 优先级,数值越大越优先处理和出队
 }
 
 type ProcInsEvent struct {
-	Id            int       `json:"id" xorm:"id"`                        // 自增id
-	EventSeqNo    string    `json:"eventSeqNo" xorm:"event_seq_no"`      // 事件序列号
-	EventType     string    `json:"eventType" xorm:"event_type"`         // 事件类型
-	OperationData string    `json:"operationData" xorm:"operation_data"` // 根数据
-	OperationKey  string    `json:"operationKey" xorm:"operation_key"`   // 编排key
-	OperationUser string    `json:"operationUser" xorm:"operation_user"` // 发起者
-	ProcDefId     string    `json:"procDefId" xorm:"proc_def_id"`        // 编排定义id
-	ProcInsId     string    `json:"procInsId" xorm:"proc_ins_id"`        // 编排实例id
-	SourcePlugin  string    `json:"sourcePlugin" xorm:"source_plugin"`   // 来源
-	Status        string    `json:"status" xorm:"status"`                // 状态->created(初始化) | pending(处理中) | done(处理完成功运行编排) | fail(处理失败)
-	CreatedTime   time.Time `json:"createdTime" xorm:"created_time"`     // 创建时间
-	Host          string    `json:"host" xorm:"host"`                    // 处理主机
-	ErrorMessage  string    `json:"errorMessage" xorm:"error_message"`   // 错误信息
+	Id              int       `json:"id" xorm:"id"`                              // 自增id
+	EventSeqNo      string    `json:"eventSeqNo" xorm:"event_seq_no"`            // 事件序列号
+	EventType       string    `json:"eventType" xorm:"event_type"`               // 事件类型
+	OperationData   string    `json:"operationData" xorm:"operation_data"`       // 根数据
+	OperationKey    string    `json:"operationKey" xorm:"operation_key"`         // 编排key
+	OperationUser   string    `json:"operationUser" xorm:"operation_user"`       // 发起者
+	ProcDefId       string    `json:"procDefId" xorm:"proc_def_id"`              // 编排定义id
+	ProcInsId       string    `json:"procInsId" xorm:"proc_ins_id"`              // 编排实例id
+	SourcePlugin    string    `json:"sourcePlugin" xorm:"source_plugin"`         // 来源
+	Status          string    `json:"status" xorm:"status"`                      // 状态->created(初始化) | pending(处理中) | done(处理完成功运行编排) | fail(处理失败) | matched(已恢复信号节点) | unmatched(未匹配到信号节点)
+	CreatedTime     time.Time `json:"createdTime" xorm:"created_time"`           // 创建时间
+	Host            string    `json:"host" xorm:"host"`                          // 处理主机
+	ErrorMessage    string    `json:"errorMessage" xorm:"error_message"`         // 错误信息
+	CorrelationKey  string    `json:"correlationKey" xorm:"correlation_key"`     // 关联键
+	Priority        int       `json:"priority" xorm:"priority"`                  // 优先级
+	MatchProcInsIds string    `json:"matchProcInsIds" xorm:"match_proc_ins_ids"` // 信号事件匹配到的所有编排实例id,逗号分隔
 }
 
 type CoreOperationEvent struct {
@@ -572,6 +584,7 @@ type CoreOperationEvent struct {
 
 type ProcStartEventResultData struct {
 	ProcInstId        string                      `json:"procInstId"`
+	EventId           string                      `json:"eventId,omitempty"` // 信号事件id,只在投递等待信号节点的事件时返回
 	Status            string                      `json:"status"`
 	TaskNodeInstances []*ProcStartEventResultData `json:"taskNodeInstances"`
 }
@@ -0,0 +1,379 @@
+package models
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"sort"
+	"strings"
+)
+
+const (
+	ProcGraphFormatSvg     = "svg"
+	ProcGraphFormatDot     = "dot"
+	ProcGraphFormatMermaid = "mermaid"
+
+	procGraphMargin      = 40.0
+	procGraphRankGap     = 180.0 // 自动排版时每一层的间距
+	procGraphRowGap      = 100.0 // 自动排版时同一层节点的间距
+	procGraphTaskWidth   = 120.0
+	procGraphTaskHeight  = 50.0
+	procGraphEventSize   = 40.0
+	procGraphDefaultFill = "#ffffff"
+)
+
+// ProcGraphStatusColorMap 实例节点按状态着色
+var ProcGraphStatusColorMap = map[string]string{
+	JobStatusReady:     "#ffffff",
+	JobStatusRunning:   "#5dade2",
+	JobStatusSuccess:   "#58d68d",
+	JobStatusFail:      "#ec7063",
+	JobStatusTimeout:   "#f5b041",
+	JobStatusKill:      "#aab7b8",
+	WorkflowStatusStop: "#aab7b8",
+	JobStatusRisky:     "#f4d03f",
+	JobStatusPaused:    "#af7ac5",
+	JobStatusQueued:    "#d5dbdb",
+}
+
+// ProcGraph 编排或实例的节点图,用于服务端渲染
+type ProcGraph struct {
+	Title string           // 标题
+	Nodes []*ProcGraphNode // 节点
+	Links []*ProcGraphLink // 线
+}
+
+type ProcGraphNode struct {
+	Id        string  // 编排节点id
+	Name      string  // 节点名称
+	NodeType  string  // 节点类型
+	Status    string  // 实例节点状态,编排图为空
+	OrderedNo int     // 节点顺序
+	X         float64 // 中心点横坐标
+	Y         float64 // 中心点纵坐标
+	position  bool    // 是否有前端画布坐标
+}
+
+type ProcGraphLink struct {
+	Source string // 源节点id
+	Target string // 目标节点id
+	Name   string // 线名称
+}
+
+// BuildProcGraph 按编排节点和线构建节点图,节点位置取前端画布坐标
+func BuildProcGraph(title string, nodeList []*ProcDefNode, linkList []*ProcDefNodeLink) *ProcGraph {
+	graph := &ProcGraph{Title: title}
+	for _, node := range nodeList {
+		graphNode := &ProcGraphNode{Id: node.Id, Name: node.Name, NodeType: node.NodeType, OrderedNo: node.OrderedNo}
+		if graphNode.Name == "" {
+			graphNode.Name = node.NodeType
+		}
+		graphNode.X, graphNode.Y, graphNode.position = getBpmnSelfAttrsPosition(node.UiStyle)
+		graph.Nodes = append(graph.Nodes, graphNode)
+	}
+	sort.SliceStable(graph.Nodes, func(i, j int) bool {
+		return graph.Nodes[i].OrderedNo < graph.Nodes[j].OrderedNo
+	})
+	for _, link := range linkList {
+		graph.Links = append(graph.Links, &ProcGraphLink{Source: link.Source, Target: link.Target, Name: link.Name})
+	}
+	return graph
+}
+
+// SetNodeStatus 设置实例节点状态,key为编排节点id
+func (g *ProcGraph) SetNodeStatus(statusMap map[string]string) {
+	for _, node := range g.Nodes {
+		node.Status = statusMap[node.Id]
+	}
+}
+
+// Render 按格式渲染
+func (g *ProcGraph) Render(format string) (content, contentType string, err error) {
+	switch format {
+	case "", ProcGraphFormatSvg:
+		return g.RenderSvg(), "image/svg+xml; charset=utf-8", nil
+	case ProcGraphFormatDot:
+		return g.RenderDot(), "text/vnd.graphviz; charset=utf-8", nil
+	case ProcGraphFormatMermaid:
+		return g.RenderMermaid(), "text/plain; charset=utf-8", nil
+	default:
+		err = fmt.Errorf("graph format %s not support, should be svg | dot | mermaid", format)
+	}
+	return
+}
+
+func (n *ProcGraphNode) fillColor() string {
+	if color, ok := ProcGraphStatusColorMap[n.Status]; ok {
+		return color
+	}
+	return procGraphDefaultFill
+}
+
+func (n *ProcGraphNode) label() string {
+	if n.Status == "" {
+		return n.Name
+	}
+	return n.Name + "\n" + n.Status
+}
+
+// shape 节点形状->circle(事件) | diamond(网关) | rect(任务)
+func (n *ProcGraphNode) shape() string {
+	switch n.NodeType {
+	case JobStartType, JobEndType, JobBreakType, JobTimeType, JobDateType, JobSignalType:
+		return "circle"
+	case JobDecisionType, JobDecisionMergeType, JobForkType, JobMergeType:
+		return "diamond"
+	default:
+		return "rect"
+	}
+}
+
+// RenderDot 输出Graphviz DOT
+func (g *ProcGraph) RenderDot() string {
+	var buf strings.Builder
+	buf.WriteString(fmt.Sprintf("digraph %s {\n", dotQuote(g.Title)))
+	buf.WriteString("  rankdir=LR;\n")
+	buf.WriteString(fmt.Sprintf("  label=%s;\n  labelloc=t;\n", dotQuote(g.Title)))
+	buf.WriteString("  node [fontname=\"Helvetica\", fontsize=11, style=filled];\n")
+	buf.WriteString("  edge [fontname=\"Helvetica\", fontsize=10];\n")
+	for _, node := range g.Nodes {
+		shape := "box"
+		switch node.shape() {
+		case "circle":
+			shape = "circle"
+		case "diamond":
+			shape = "diamond"
+		}
+		if node.NodeType == JobEndType || node.NodeType == JobBreakType {
+			shape = "doublecircle"
+		}
+		buf.WriteString(fmt.Sprintf("  %s [label=%s, shape=%s, fillcolor=%s];\n", dotQuote(node.Id), dotQuote(node.label()), shape, dotQuote(node.fillColor())))
+	}
+	for _, link := range g.Links {
+		if link.Name != "" {
+			buf.WriteString(fmt.Sprintf("  %s -> %s [label=%s];\n", dotQuote(link.Source), dotQuote(link.Target), dotQuote(link.Name)))
+		} else {
+			buf.WriteString(fmt.Sprintf("  %s -> %s;\n", dotQuote(link.Source), dotQuote(link.Target)))
+		}
+	}
+	buf.WriteString("}\n")
+	return buf.String()
+}
+
+func dotQuote(input string) string {
+	return "\"" + strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n").Replace(input) + "\""
+}
+
+// RenderMermaid 输出Mermaid flowchart,节点id只能是字母数字,按顺序重新编号
+func (g *ProcGraph) RenderMermaid() string {
+	var buf strings.Builder
+	buf.WriteString("---\n")
+	buf.WriteString("title: " + mermaidQuote(g.Title) + "\n")
+	buf.WriteString("---\n")
+	buf.WriteString("flowchart LR\n")
+	idMap := make(map[string]string)
+	statusClassMap := make(map[string]string)
+	for index, node := range g.Nodes {
+		mermaidId := fmt.Sprintf("n%d", index+1)
+		idMap[node.Id] = mermaidId
+		label := strings.ReplaceAll(mermaidQuote(node.label()), "\n", "<br/>")
+		switch node.shape() {
+		case "circle":
+			buf.WriteString(fmt.Sprintf("  %s((%s))\n", mermaidId, label))
+		case "diamond":
+			buf.WriteString(fmt.Sprintf("  %s{%s}\n", mermaidId, label))
+		default:
+			buf.WriteString(fmt.Sprintf("  %s[%s]\n", mermaidId, label))
+		}
+		if node.Status != "" {
+			statusClassMap[node.Status] = node.fillColor()
+		}
+	}
+	for _, link := range g.Links {
+		source, target := idMap[link.Source], idMap[link.Target]
+		if source == "" || target == "" {
+			continue
+		}
+		if link.Name != "" {
+			buf.WriteString(fmt.Sprintf("  %s -->|%s| %s\n", source, mermaidQuote(link.Name), target))
+		} else {
+			buf.WriteString(fmt.Sprintf("  %s --> %s\n", source, target))
+		}
+	}
+	var statusList []string
+	for status := range statusClassMap {
+		statusList = append(statusList, status)
+	}
+	sort.Strings(statusList)
+	for _, status := range statusList {
+		buf.WriteString(fmt.Sprintf("  classDef %s fill:%s,stroke:#566573\n", status, statusClassMap[status]))
+	}
+	for _, node := range g.Nodes {
+		if node.Status != "" {
+			buf.WriteString(fmt.Sprintf("  class %s %s\n", idMap[node.Id], node.Status))
+		}
+	}
+	return buf.String()
+}
+
+func mermaidQuote(input string) string {
+	return "\"" + strings.NewReplacer("\"", "#quot;", "<", "#lt;", ">", "#gt;").Replace(input) + "\""
+}
+
+// RenderSvg 输出SVG,所有节点都有画布坐标时按画布位置,否则从开始节点按层自动排版
+func (g *ProcGraph) RenderSvg() string {
+	g.layout()
+	minX, minY, maxX, maxY := math.MaxFloat64, math.MaxFloat64, -math.MaxFloat64, -math.MaxFloat64
+	for _, node := range g.Nodes {
+		width, height := node.size()
+		minX, minY = math.Min(minX, node.X-width/2), math.Min(minY, node.Y-height/2)
+		maxX, maxY = math.Max(maxX, node.X+width/2), math.Max(maxY, node.Y+height/2+14)
+	}
+	if len(g.Nodes) == 0 {
+		minX, minY, maxX, maxY = 0, 0, 0, 0
+	}
+	// 平移到左上角留出标题位置
+	offsetX, offsetY := procGraphMargin-minX, procGraphMargin+20-minY
+	width, height := maxX-minX+procGraphMargin*2, maxY-minY+procGraphMargin*2+20
+	nodeMap := make(map[string]*ProcGraphNode)
+	for _, node := range g.Nodes {
+		nodeMap[node.Id] = node
+	}
+	var buf strings.Builder
+	buf.WriteString(fmt.Sprintf("<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%.0f\" height=\"%.0f\" viewBox=\"0 0 %.0f %.0f\" font-family=\"Helvetica,Arial,sans-serif\">\n", width, height, width, height))
+	buf.WriteString("  <defs><marker id=\"arrow\" viewBox=\"0 0 10 10\" refX=\"10\" refY=\"5\" markerWidth=\"8\" markerHeight=\"8\" orient=\"auto-start-reverse\"><path d=\"M 0 0 L 10 5 L 0 10 z\" fill=\"#566573\"/></marker></defs>\n")
+	buf.WriteString(fmt.Sprintf("  <rect width=\"100%%\" height=\"100%%\" fill=\"#ffffff\"/>\n  <text x=\"%.0f\" y=\"24\" font-size=\"14\" font-weight=\"bold\">%s</text>\n", procGraphMargin, html.EscapeString(g.Title)))
+	for _, link := range g.Links {
+		source, target := nodeMap[link.Source], nodeMap[link.Target]
+		if source == nil || target == nil {
+			continue
+		}
+		x1, y1 := source.borderPoint(target.X, target.Y)
+		x2, y2 := target.borderPoint(source.X, source.Y)
+		x1, y1, x2, y2 = x1+offsetX, y1+offsetY, x2+offsetX, y2+offsetY
+		buf.WriteString(fmt.Sprintf("  <line x1=\"%.1f\" y1=\"%.1f\" x2=\"%.1f\" y2=\"%.1f\" stroke=\"#566573\" stroke-width=\"1.2\" marker-end=\"url(#arrow)\"/>\n", x1, y1, x2, y2))
+		if link.Name != "" {
+			buf.WriteString(fmt.Sprintf("  <text x=\"%.1f\" y=\"%.1f\" font-size=\"10\" text-anchor=\"middle\" fill=\"#566573\">%s</text>\n", (x1+x2)/2, (y1+y2)/2-4, html.EscapeString(link.Name)))
+		}
+	}
+	for _, node := range g.Nodes {
+		x, y := node.X+offsetX, node.Y+offsetY
+		nodeWidth, nodeHeight := node.size()
+		buf.WriteString(fmt.Sprintf("  <g id=%q>\n    <title>%s</title>\n", html.EscapeString(node.Id), html.EscapeString(node.label())))
+		switch node.shape() {
+		case "circle":
+			strokeWidth := 1.5
+			if node.NodeType == JobEndType || node.NodeType == JobBreakType {
+				strokeWidth = 3
+			}
+			buf.WriteString(fmt.Sprintf("    <circle cx=\"%.1f\" cy=\"%.1f\" r=\"%.1f\" fill=\"%s\" stroke=\"#566573\" stroke-width=\"%.1f\"/>\n", x, y, nodeWidth/2, node.fillColor(), strokeWidth))
+		case "diamond":
+			buf.WriteString(fmt.Sprintf("    <polygon points=\"%.1f,%.1f %.1f,%.1f %.1f,%.1f %.1f,%.1f\" fill=\"%s\" stroke=\"#566573\" stroke-width=\"1.5\"/>\n",
+				x, y-nodeHeight/2, x+nodeWidth/2, y, x, y+nodeHeight/2, x-nodeWidth/2, y, node.fillColor()))
+		default:
+			buf.WriteString(fmt.Sprintf("    <rect x=\"%.1f\" y=\"%.1f\" width=\"%.1f\" height=\"%.1f\" rx=\"6\" fill=\"%s\" stroke=\"#566573\" stroke-width=\"1.5\"/>\n",
+				x-nodeWidth/2, y-nodeHeight/2, nodeWidth, nodeHeight, node.fillColor()))
+		}
+		// 任务名称写在框内,事件和网关名称写在图形下方
+		labelY := y + 4
+		if node.shape() != "rect" {
+			labelY = y + nodeHeight/2 + 14
+		}
+		buf.WriteString(fmt.Sprintf("    <text x=\"%.1f\" y=\"%.1f\" font-size=\"11\" text-anchor=\"middle\">%s</text>\n", x, labelY, html.EscapeString(node.Name)))
+		buf.WriteString("  </g>\n")
+	}
+	buf.WriteString("</svg>\n")
+	return buf.String()
+}
+
+func (n *ProcGraphNode) size() (width, height float64) {
+	if n.shape() == "rect" {
+		return procGraphTaskWidth, procGraphTaskHeight
+	}
+	return procGraphEventSize, procGraphEventSize
+}
+
+// borderPoint 从节点中心指向(x,y)的线与节点边框的交点,箭头画到边框上
+func (n *ProcGraphNode) borderPoint(x, y float64) (float64, float64) {
+	dx, dy := x-n.X, y-n.Y
+	if dx == 0 && dy == 0 {
+		return n.X, n.Y
+	}
+	width, height := n.size()
+	var scale float64
+	switch n.shape() {
+	case "circle":
+		scale = (width / 2) / math.Hypot(dx, dy)
+	case "diamond":
+		scale = 1 / (math.Abs(dx)/(width/2) + math.Abs(dy)/(height/2))
+	default:
+		scale = math.Min((width/2)/math.Abs(dx), (height/2)/math.Abs(dy))
+	}
+	return n.X + dx*scale, n.Y + dy*scale
+}
+
+// layout 有节点没有画布坐标时,按最长路径分层,同层按节点顺序从上到下排列
+func (g *ProcGraph) layout() {
+	for _, node := range g.Nodes {
+		if !node.position {
+			g.autoLayout()
+			return
+		}
+	}
+}
+
+func (g *ProcGraph) autoLayout() {
+	nodeIndexMap := make(map[string]int)
+	for index, node := range g.Nodes {
+		nodeIndexMap[node.Id] = index
+	}
+	inDegree := make([]int, len(g.Nodes))
+	children := make([][]int, len(g.Nodes))
+	for _, link := range g.Links {
+		source, sourceOk := nodeIndexMap[link.Source]
+		target, targetOk := nodeIndexMap[link.Target]
+		if !sourceOk || !targetOk || source == target {
+			continue
+		}
+		children[source] = append(children[source], target)
+		inDegree[target]++
+	}
+	rank := make([]int, len(g.Nodes))
+	visited := make([]bool, len(g.Nodes))
+	var queue []int
+	for index := range g.Nodes {
+		if inDegree[index] == 0 {
+			queue = append(queue, index)
+		}
+	}
+	maxRank := 0
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		visited[current] = true
+		for _, child := range children[current] {
+			if rank[current]+1 > rank[child] {
+				rank[child] = rank[current] + 1
+			}
+			if inDegree[child]--; inDegree[child] == 0 {
+				queue = append(queue, child)
+			}
+		}
+		if rank[current] > maxRank {
+			maxRank = rank[current]
+		}
+	}
+	// 环路上的节点放到最后一层之后
+	for index := range g.Nodes {
+		if !visited[index] {
+			maxRank++
+			rank[index] = maxRank
+		}
+	}
+	rowMap := make(map[int]int)
+	for index, node := range g.Nodes {
+		node.X = float64(rank[index]) * procGraphRankGap
+		node.Y = float64(rowMap[rank[index]]) * procGraphRowGap
+		rowMap[rank[index]]++
+	}
+}
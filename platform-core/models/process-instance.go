@@ -160,3 +160,66 @@ type ProcInsWithVersion struct {
 	Version        string    `json:"version" xorm:"version"`
 	SubProc        bool      `json:"subProc" xorm:"sub_proc"` // 是否子编排
 }
+
+const (
+	SimulationCtxKey             = "simulation"   // 模拟运行时在ctx中传递模拟信息
+	SimulationActionPlugin       = "plugin"       // 调用插件服务
+	SimulationActionHuman        = "human"        // 创建人工任务
+	SimulationActionEntityCreate = "entityCreate" // 新增数据
+	SimulationActionEntityUpdate = "entityUpdate" // 修改数据
+)
+
+type ProcInsSimulation struct {
+	ProcInsId       string                `json:"procInsId" xorm:"proc_ins_id"`              // 编排实例id
+	MockData        string                `json:"-" xorm:"mock_data"`                        // 插件服务mock返回
+	RecordProcInsId string                `json:"recordProcInsId" xorm:"record_proc_ins_id"` // 录制mock返回的编排实例id
+	CreatedBy       string                `json:"createdBy" xorm:"created_by"`               // 创建人
+	CreatedTime     time.Time             `json:"createdTime" xorm:"created_time"`           // 创建时间
+	MockResponses   []*ProcSimulationMock `json:"mockResponses" xorm:"-"`
+}
+
+// GetMock 按插件服务名取mock返回,没有配置时返回nil
+func (s *ProcInsSimulation) GetMock(serviceName string) *ProcSimulationMock {
+	for _, v := range s.MockResponses {
+		if v.ServiceName == serviceName {
+			return v
+		}
+	}
+	return nil
+}
+
+type ProcSimulationMock struct {
+	ServiceName  string                   `json:"serviceName"`  // 插件服务名
+	ResultCode   string                   `json:"resultCode"`   // 插件返回码,非0表示调用失败
+	ErrorMessage string                   `json:"errorMessage"` // 插件返回的错误信息
+	ChoseOption  string                   `json:"choseOption"`  // 人工任务选择的分支
+	Outputs      []map[string]interface{} `json:"outputs"`      // 按数据依次对应的输出,数据比输出多时重复使用最后一个
+}
+
+type ProcInsSimulationTrace struct {
+	Id            int64     `json:"id" xorm:"id"`                          // 自增id
+	ProcInsId     string    `json:"procInsId" xorm:"proc_ins_id"`          // 编排实例id
+	ProcInsNodeId string    `json:"procInsNodeId" xorm:"proc_ins_node_id"` // 编排实例节点id
+	NodeName      string    `json:"nodeName" xorm:"node_name"`             // 节点名称
+	Action        string    `json:"action" xorm:"action"`                  // 动作->plugin | human | entityCreate | entityUpdate
+	ServiceName   string    `json:"serviceName" xorm:"service_name"`       // 插件服务名或数据entity
+	Request       string    `json:"request" xorm:"request"`                // 本应发出的请求
+	Response      string    `json:"response" xorm:"response"`              // mock返回
+	ErrorMessage  string    `json:"errorMessage" xorm:"error_message"`     // 错误信息
+	CreatedTime   time.Time `json:"createdTime" xorm:"created_time"`       // 创建时间
+}
+
+type ProcInsNodeReqOutputRow struct {
+	ReqId       string `xorm:"req_id"`
+	ServiceName string `xorm:"service_name"`
+	DataIndex   int    `xorm:"data_index"`
+	Name        string `xorm:"name"`
+	DataValue   string `xorm:"data_value"`
+}
+
+type ProcInsSimulationResult struct {
+	*ProcInsSimulation
+	Status   string                    `json:"status"`   // 编排实例状态
+	Path     []*ProcRunNode            `json:"path"`     // 按执行顺序走过的节点
+	Requests []*ProcInsSimulationTrace `json:"requests"` // 本应发出的请求
+}
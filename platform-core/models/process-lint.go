@@ -0,0 +1,46 @@
+package models
+
+const (
+	LintLevelError   = "error"   // 发布会失败或运行时必然出错
+	LintLevelWarning = "warning" // 可能出错,需要人工确认
+
+	LintRuleNodeDefine           = "node_define"            // 发布时的节点检查,如进出线数量、服务名为空
+	LintRuleGraph                = "graph"                  // 编排图检查,如环路、开始结束节点数量
+	LintRuleUnreachableNode      = "unreachable_node"       // 从开始节点走不到的节点
+	LintRuleContextNotAncestor   = "context_not_ancestor"   // 上下文参数绑定的节点不是当前节点的前置节点
+	LintRuleRequiredParamUnbound = "required_param_unbound" // 插件必填参数没有绑定
+	LintRuleParamTypeMismatch    = "param_type_mismatch"    // 绑定的出参与入参数据类型不一致
+	LintRuleServiceUnavailable   = "service_unavailable"    // 插件服务不存在或已禁用
+	LintRuleRoutineExpression    = "routine_expression"     // 定位规则与数据模型不匹配
+)
+
+// ProcDefLintItem 编排定义检查结果项,带节点id方便前端高亮
+type ProcDefLintItem struct {
+	Level     string `json:"level"`     // 级别->error | warning
+	Rule      string `json:"rule"`      // 检查规则
+	Id        string `json:"id"`        // 编排节点id,编排图检查时为空
+	NodeId    string `json:"nodeId"`    // 前端节点id
+	NodeName  string `json:"nodeName"`  // 节点名称
+	ParamName string `json:"paramName"` // 参数名,参数相关检查时有值
+	Code      int    `json:"code"`      // 错误码,发布检查的错误才有
+	Message   string `json:"message"`   // 说明
+	Err       error  `json:"-"`         // 发布检查返回的错误,接口按请求语言转成message
+}
+
+// ProcDefLintResult 编排定义检查结果
+type ProcDefLintResult struct {
+	ProcDefId    string             `json:"procDefId"`    // 编排id
+	ErrorCount   int                `json:"errorCount"`   // 错误数
+	WarningCount int                `json:"warningCount"` // 警告数
+	Items        []*ProcDefLintItem `json:"items"`        // 检查结果
+}
+
+// Add 添加检查结果项并计数
+func (r *ProcDefLintResult) Add(item *ProcDefLintItem) {
+	if item.Level == LintLevelError {
+		r.ErrorCount++
+	} else {
+		r.WarningCount++
+	}
+	r.Items = append(r.Items, item)
+}
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+const (
+	ProcLockModeReject = "reject" // 数据被占用时直接拒绝启动
+	ProcLockModeQueue  = "queue"  // 进入排队,直到数据锁释放
+	ProcLockModeWait   = "wait"   // 进入排队,超过等待时间仍拿不到数据锁则超时结束
+)
+
+// ProcEntityLock 编排实例持有的数据锁,同一数据同时只能被一个实例持有,实例结束时释放
+type ProcEntityLock struct {
+	Id             int64     `json:"id" xorm:"id"`                           // 自增id
+	EntityTypeId   string    `json:"entityTypeId" xorm:"entity_type_id"`     // 数据类型->包名:模型名
+	EntityDataId   string    `json:"entityDataId" xorm:"entity_data_id"`     // 数据id
+	EntityDataName string    `json:"entityDataName" xorm:"entity_data_name"` // 数据名称
+	ProcInsId      string    `json:"procInsId" xorm:"proc_ins_id"`           // 持有锁的编排实例id
+	ProcDefId      string    `json:"procDefId" xorm:"proc_def_id"`           // 编排定义id
+	ProcDefKey     string    `json:"procDefKey" xorm:"proc_def_key"`         // 编排定义key
+	ProcDefName    string    `json:"procDefName" xorm:"proc_def_name"`       // 编排名称
+	LockMode       string    `json:"lockMode" xorm:"lock_mode"`              // 加锁方式->reject | queue | wait
+	CreatedBy      string    `json:"createdBy" xorm:"created_by"`            // 创建人
+	CreatedTime    time.Time `json:"createdTime" xorm:"created_time"`        // 加锁时间
+	ProcInsStatus  string    `json:"procInsStatus" xorm:"proc_ins_status"`   // 持有锁的实例状态
+}
+
+// Key 数据锁的唯一标识->数据类型:数据id
+func (l *ProcEntityLock) Key() string {
+	return l.EntityTypeId + ":" + l.EntityDataId
+}
+
+// IsProcInsFinishStatus 实例是否已结束,结束的实例释放持有的数据锁
+func IsProcInsFinishStatus(status string) bool {
+	return status == JobStatusSuccess || status == JobStatusFail || status == JobStatusKill || status == JobStatusTimeout
+}
@@ -0,0 +1,61 @@
+package models
+
+import "time"
+
+const (
+	ProcInsMigrationStatusWait = "wait" // 等待工作流处理
+	ProcInsMigrationStatusDone = "done" // 迁移完成
+	ProcInsMigrationStatusFail = "fail" // 迁移失败
+
+	ProcInsMigrationActionKeep = "keep" // 映射到新版本相同nodeId的节点
+	ProcInsMigrationActionMap  = "map"  // 映射到新版本指定的节点
+	ProcInsMigrationActionDrop = "drop" // 新版本没有对应节点,删除
+	ProcInsMigrationActionAdd  = "add"  // 新版本新增的节点
+)
+
+// ProcInsMigrationParam 编排实例迁移到新版本的节点映射计划
+type ProcInsMigrationParam struct {
+	TargetProcDefId string            `json:"targetProcDefId"` // 目标编排定义id,需同一编排key且已发布
+	NodeMapping     map[string]string `json:"nodeMapping"`     // 旧节点nodeId->新节点nodeId,没配置的按相同nodeId映射,配置为空表示删除该节点
+}
+
+// ProcInsMigrationNode 迁移报告中单个节点的处理方式
+type ProcInsMigrationNode struct {
+	OldNodeId   string `json:"oldNodeId"`   // 旧版本节点nodeId
+	OldNodeName string `json:"oldNodeName"` // 旧版本节点名称
+	NodeType    string `json:"nodeType"`    // 节点类型
+	Status      string `json:"status"`      // 实例节点当前状态
+	NewNodeId   string `json:"newNodeId"`   // 新版本节点nodeId
+	NewNodeName string `json:"newNodeName"` // 新版本节点名称
+	Action      string `json:"action"`      // 处理方式->keep | map | drop | add
+	Message     string `json:"message"`     // 不能迁移的原因或提示
+}
+
+// ProcInsMigrationReport 迁移试运行报告,有错误时不能迁移
+type ProcInsMigrationReport struct {
+	ProcInsId     string                  `json:"procInsId"`
+	FromProcDefId string                  `json:"fromProcDefId"`
+	FromVersion   string                  `json:"fromVersion"`
+	ToProcDefId   string                  `json:"toProcDefId"`
+	ToVersion     string                  `json:"toVersion"`
+	Legal         bool                    `json:"legal"`    // 是否可以迁移
+	Errors        []string                `json:"errors"`   // 不能迁移的原因
+	Warnings      []string                `json:"warnings"` // 可以迁移但需要注意的地方
+	Nodes         []*ProcInsMigrationNode `json:"nodes"`
+}
+
+// ProcInsMigration 编排实例迁移纪录
+type ProcInsMigration struct {
+	Id            string    `json:"id" xorm:"id"`                          // 唯一标识
+	ProcInsId     string    `json:"procInsId" xorm:"proc_ins_id"`          // 编排实例id
+	WorkflowId    string    `json:"workflowId" xorm:"workflow_id"`         // 工作流id
+	FromProcDefId string    `json:"fromProcDefId" xorm:"from_proc_def_id"` // 迁移前编排定义id
+	ToProcDefId   string    `json:"toProcDefId" xorm:"to_proc_def_id"`     // 迁移后编排定义id
+	NodeMapping   string    `json:"nodeMapping" xorm:"node_mapping"`       // 节点映射计划json
+	Report        string    `json:"report" xorm:"report"`                  // 迁移报告json
+	Status        string    `json:"status" xorm:"status"`                  // 状态->wait | done | fail
+	ErrorMessage  string    `json:"errorMessage" xorm:"error_message"`     // 错误信息
+	CreatedBy     string    `json:"createdBy" xorm:"created_by"`           // 创建人
+	CreatedTime   time.Time `json:"createdTime" xorm:"created_time"`       // 创建时间
+	UpdatedTime   time.Time `json:"updatedTime" xorm:"updated_time"`       // 更新时间
+}
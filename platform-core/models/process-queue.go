@@ -0,0 +1,100 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	JobStatusQueued = "Queued" // 排队等待启动
+
+	ProcInsQueueStatusQueued   = "queued"   // 排队中
+	ProcInsQueueStatusStarted  = "started"  // 已出队启动
+	ProcInsQueueStatusCanceled = "canceled" // 已取消
+
+	ProcQueueModeFifo     = "fifo"     // 先进先出
+	ProcQueueModePriority = "priority" // 按优先级,同优先级先进先出
+)
+
+// ProcDefConcurrencyPolicy 编排并发控制,超过上限的启动请求进入排队,0表示不限制
+type ProcDefConcurrencyPolicy struct {
+	MaxRunning          int    `json:"maxRunning"`                // 同一编排(key)最大同时运行实例数
+	MaxRunningPerEntity int    `json:"maxRunningPerEntity"`       // 同一编排同一根数据最大同时运行实例数
+	QueueMode           string `json:"queueMode"`                 // 排队方式->fifo | priority
+	LockMode            string `json:"lockMode,omitempty"`        // 开启冲突检测时数据被占用的处理方式->reject(默认) | queue | wait
+	LockWaitTimeout     int    `json:"lockWaitTimeout,omitempty"` // wait模式等待数据锁的秒数
+}
+
+func (p *ProcDefConcurrencyPolicy) String() string {
+	if p == nil || (p.MaxRunning <= 0 && p.MaxRunningPerEntity <= 0 && p.GetLockMode() == ProcLockModeReject) {
+		return ""
+	}
+	b, _ := json.Marshal(p)
+	return string(b)
+}
+
+// Enabled 是否配置了并发上限
+func (p *ProcDefConcurrencyPolicy) Enabled() bool {
+	return p != nil && (p.MaxRunning > 0 || p.MaxRunningPerEntity > 0)
+}
+
+// Validate 检查并发上限和排队方式
+func (p *ProcDefConcurrencyPolicy) Validate() error {
+	if p == nil {
+		return nil
+	}
+	if p.MaxRunning < 0 || p.MaxRunningPerEntity < 0 {
+		return fmt.Errorf("concurrency policy max running can not less than 0")
+	}
+	if p.QueueMode != "" && p.QueueMode != ProcQueueModeFifo && p.QueueMode != ProcQueueModePriority {
+		return fmt.Errorf("concurrency policy queueMode %s not support", p.QueueMode)
+	}
+	if p.LockMode != "" && p.LockMode != ProcLockModeReject && p.LockMode != ProcLockModeQueue && p.LockMode != ProcLockModeWait {
+		return fmt.Errorf("concurrency policy lockMode %s not support", p.LockMode)
+	}
+	if p.LockMode == ProcLockModeWait && p.LockWaitTimeout <= 0 {
+		return fmt.Errorf("concurrency policy lockWaitTimeout must greater than 0 with wait lockMode")
+	}
+	return nil
+}
+
+// GetLockMode 数据锁被占用时的处理方式,没有配置时直接拒绝
+func (p *ProcDefConcurrencyPolicy) GetLockMode() string {
+	if p == nil || p.LockMode == "" {
+		return ProcLockModeReject
+	}
+	return p.LockMode
+}
+
+// ParseProcDefConcurrencyPolicy 解析编排定义中的并发控制,没有配置或配置非法时返回nil
+func ParseProcDefConcurrencyPolicy(input string) *ProcDefConcurrencyPolicy {
+	if input == "" {
+		return nil
+	}
+	result := ProcDefConcurrencyPolicy{}
+	if err := json.Unmarshal([]byte(input), &result); err != nil {
+		return nil
+	}
+	if result.QueueMode == "" {
+		result.QueueMode = ProcQueueModeFifo
+	}
+	return &result
+}
+
+// ProcInsQueue 编排实例启动排队
+type ProcInsQueue struct {
+	Id           int64     `json:"id" xorm:"id"`                       // 自增id
+	ProcInsId    string    `json:"procInsId" xorm:"proc_ins_id"`       // 编排实例id
+	WorkflowId   string    `json:"workflowId" xorm:"workflow_id"`      // 工作流id
+	ProcDefId    string    `json:"procDefId" xorm:"proc_def_id"`       // 编排定义id
+	ProcDefKey   string    `json:"procDefKey" xorm:"proc_def_key"`     // 编排定义key
+	ProcDefName  string    `json:"procDefName" xorm:"proc_def_name"`   // 编排名称
+	EntityDataId string    `json:"entityDataId" xorm:"entity_data_id"` // 根数据id
+	Priority     int       `json:"priority" xorm:"priority"`           // 优先级,数值越大越优先
+	Status       string    `json:"status" xorm:"status"`               // 状态->queued | started | canceled
+	CreatedBy    string    `json:"createdBy" xorm:"created_by"`        // 创建人
+	CreatedTime  time.Time `json:"createdTime" xorm:"created_time"`    // 创建时间
+	UpdatedBy    string    `json:"updatedBy" xorm:"updated_by"`        // 更新人
+	UpdatedTime  time.Time `json:"updatedTime" xorm:"updated_time"`    // 更新时间
+}
@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+const (
+	TimelineEventWorkflow       = "workflow"        // 工作流状态变化
+	TimelineEventNode           = "node"            // 节点状态变化
+	TimelineEventOperation      = "operation"       // 用户或系统对实例的操作
+	TimelineEventTakeover       = "takeover"        // 其它实例接管工作流
+	TimelineEventRelease        = "release"         // 实例退出或迁移时释放工作流
+	TimelineEventRecover        = "recover"         // 工作流加载到内存
+	TimelineEventWakeup         = "wakeup"          // 休眠工作流被唤醒
+	TimelineEventRetry          = "retry"           // 节点自动重试
+	TimelineEventPluginRequest  = "plugin_request"  // 调用插件请求
+	TimelineEventPluginResponse = "plugin_response" // 插件返回结果
+	TimelineEventBreakpoint     = "breakpoint"      // 节点命中断点或断点放行
+	TimelineEventApproval       = "approval"        // 审批投票、转交、提醒和升级
+	TimelineEventLock           = "lock"            // 数据锁等待、超时和强制释放
+
+	TimelineMessageMaxLength = 1000
+	TimelineExportPageSize   = 1000 // 导出时每次查询的行数
+	TimelinePageMaxSize      = 1000 // 分页查询每页最多返回的行数
+)
+
+// ProcInsTimeline 编排实例时间线,只追加不修改
+type ProcInsTimeline struct {
+	Id            int64     `json:"id" xorm:"id"`                          // 自增id
+	ProcInsId     string    `json:"procInsId" xorm:"proc_ins_id"`          // 编排实例id
+	WorkflowId    string    `json:"workflowId" xorm:"workflow_id"`         // 工作流id
+	ProcInsNodeId string    `json:"procInsNodeId" xorm:"proc_ins_node_id"` // 编排实例节点id
+	ProcRunNodeId string    `json:"procRunNodeId" xorm:"proc_run_node_id"` // 工作流节点id
+	NodeName      string    `json:"nodeName" xorm:"node_name"`             // 节点名称
+	EventType     string    `json:"eventType" xorm:"event_type"`           // 事件类型->workflow | node | operation | takeover | release | recover | wakeup | retry | plugin_request | plugin_response | breakpoint | approval
+	Status        string    `json:"status" xorm:"status"`                  // 事件后的状态或操作名称
+	Message       string    `json:"message" xorm:"message"`                // 说明,操作原因或错误信息
+	RefId         string    `json:"refId" xorm:"ref_id"`                   // 关联纪录id,如操作id、插件请求id、重试纪录id
+	Host          string    `json:"host" xorm:"host"`                      // 处理主机
+	CreatedBy     string    `json:"createdBy" xorm:"created_by"`           // 操作人
+	CreatedTime   time.Time `json:"createdTime" xorm:"created_time"`       // 发生时间
+}
+
+// ProcInsTimelinePageData 实例时间线分页数据
+type ProcInsTimelinePageData struct {
+	PageInfo *PageInfo          `json:"pageInfo"`
+	Contents []*ProcInsTimeline `json:"contents"`
+}
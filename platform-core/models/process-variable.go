@@ -0,0 +1,214 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+const (
+	ProcVariableTypeString = "string"
+	ProcVariableTypeInt    = "int"
+	ProcVariableTypeBool   = "bool"
+	ProcVariableTypeObject = "object"
+	ProcVariableTypeList   = "list"
+
+	ProcVariableSourceDefault = "default" // 定义的默认值
+	ProcVariableSourceStart   = "start"   // 启动时传入
+
+	ProcDefNodeParamBindVariable = "variable"
+)
+
+var procVariableNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ProcDefVariable 编排变量定义
+type ProcDefVariable struct {
+	Name         string      `json:"name"`         // 变量名,只能包含字母数字下划线
+	DataType     string      `json:"dataType"`     // 数据类型->string | int | bool | object | list
+	DefaultValue interface{} `json:"defaultValue"` // 默认值
+	Description  string      `json:"description"`  // 描述
+}
+
+type ProcDefVariableList []*ProcDefVariable
+
+func (l ProcDefVariableList) String() string {
+	if len(l) == 0 {
+		return ""
+	}
+	b, _ := json.Marshal(l)
+	return string(b)
+}
+
+// ParseProcDefVariables 解析编排定义中的变量,没有配置或配置非法时返回空列表
+func ParseProcDefVariables(input string) ProcDefVariableList {
+	result := ProcDefVariableList{}
+	if input == "" {
+		return result
+	}
+	if err := json.Unmarshal([]byte(input), &result); err != nil {
+		return ProcDefVariableList{}
+	}
+	return result
+}
+
+func (l ProcDefVariableList) Get(name string) *ProcDefVariable {
+	for _, v := range l {
+		if v.Name == name {
+			return v
+		}
+	}
+	return nil
+}
+
+// Validate 检查变量名和类型,以及默认值是否符合类型
+func (l ProcDefVariableList) Validate() error {
+	nameMap := make(map[string]bool)
+	for _, v := range l {
+		if !procVariableNameRegexp.MatchString(v.Name) {
+			return fmt.Errorf("variable name %s illegal", v.Name)
+		}
+		if nameMap[v.Name] {
+			return fmt.Errorf("variable name %s duplicate", v.Name)
+		}
+		nameMap[v.Name] = true
+		switch v.DataType {
+		case ProcVariableTypeString, ProcVariableTypeInt, ProcVariableTypeBool, ProcVariableTypeObject, ProcVariableTypeList:
+		default:
+			return fmt.Errorf("variable %s dataType %s not support", v.Name, v.DataType)
+		}
+		if v.DefaultValue != nil {
+			if _, err := v.ConvertValue(v.DefaultValue); err != nil {
+				return fmt.Errorf("variable %s default value illegal,%s", v.Name, err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+// ConvertValue 按变量类型转换值,字符串形式的值会尝试解析
+func (v *ProcDefVariable) ConvertValue(input interface{}) (output interface{}, err error) {
+	if input == nil {
+		return
+	}
+	switch v.DataType {
+	case ProcVariableTypeString:
+		if s, ok := input.(string); ok {
+			output = s
+		} else if b, marshalErr := json.Marshal(input); marshalErr == nil {
+			output = string(b)
+		} else {
+			output = fmt.Sprintf("%v", input)
+		}
+	case ProcVariableTypeInt:
+		switch value := input.(type) {
+		case float64:
+			if value != math.Trunc(value) {
+				err = fmt.Errorf("value %v is not int", value)
+			}
+			output = int64(value)
+		case int:
+			output = int64(value)
+		case int64:
+			output = value
+		case json.Number:
+			output, err = value.Int64()
+		case string:
+			output, err = strconv.ParseInt(value, 10, 64)
+		default:
+			err = fmt.Errorf("value %v is not int", input)
+		}
+	case ProcVariableTypeBool:
+		switch value := input.(type) {
+		case bool:
+			output = value
+		case string:
+			output, err = strconv.ParseBool(value)
+		default:
+			err = fmt.Errorf("value %v is not bool", input)
+		}
+	case ProcVariableTypeObject:
+		switch value := input.(type) {
+		case map[string]interface{}:
+			output = value
+		case string:
+			objValue := make(map[string]interface{})
+			if err = json.Unmarshal([]byte(value), &objValue); err == nil {
+				output = objValue
+			}
+		default:
+			err = fmt.Errorf("value %v is not object", input)
+		}
+	case ProcVariableTypeList:
+		switch value := input.(type) {
+		case []interface{}:
+			output = value
+		case string:
+			var listValue []interface{}
+			if err = json.Unmarshal([]byte(value), &listValue); err == nil {
+				output = listValue
+			}
+		default:
+			err = fmt.Errorf("value %v is not list", input)
+		}
+	default:
+		err = fmt.Errorf("dataType %s not support", v.DataType)
+	}
+	if err != nil {
+		output = nil
+	}
+	return
+}
+
+// ProcNodeOutputMapping 节点出参写入编排变量,list类型变量收集所有数据的出参,其它类型取第一条
+type ProcNodeOutputMapping struct {
+	Param    string `json:"param"`    // 节点出参名
+	Variable string `json:"variable"` // 编排变量名
+}
+
+type ProcNodeOutputMappingList []*ProcNodeOutputMapping
+
+func (l ProcNodeOutputMappingList) String() string {
+	if len(l) == 0 {
+		return ""
+	}
+	b, _ := json.Marshal(l)
+	return string(b)
+}
+
+// ParseProcNodeOutputMappings 解析节点定义中的出参映射,没有配置或配置非法时返回nil
+func ParseProcNodeOutputMappings(input string) ProcNodeOutputMappingList {
+	if input == "" {
+		return nil
+	}
+	var result ProcNodeOutputMappingList
+	if err := json.Unmarshal([]byte(input), &result); err != nil {
+		return nil
+	}
+	return result
+}
+
+// ProcInsVariable 编排实例变量值
+type ProcInsVariable struct {
+	Id          int64       `json:"-" xorm:"id"`                     // 自增id
+	ProcInsId   string      `json:"procInsId" xorm:"proc_ins_id"`    // 编排实例id
+	Name        string      `json:"name" xorm:"name"`                // 变量名
+	DataType    string      `json:"dataType" xorm:"data_type"`       // 数据类型
+	Value       string      `json:"-" xorm:"value"`                  // 变量值json
+	SourceNode  string      `json:"sourceNode" xorm:"source_node"`   // 最后写入来源->default | start | 编排实例节点id
+	UpdatedBy   string      `json:"updatedBy" xorm:"updated_by"`     // 更新人
+	UpdatedTime time.Time   `json:"updatedTime" xorm:"updated_time"` // 更新时间
+	Data        interface{} `json:"value" xorm:"-"`                  // 变量值
+}
+
+// ParseValue 把数据库中的json值解析到Data
+func (v *ProcInsVariable) ParseValue() {
+	if v.Value == "" {
+		return
+	}
+	if err := json.Unmarshal([]byte(v.Value), &v.Data); err != nil {
+		v.Data = v.Value
+	}
+}
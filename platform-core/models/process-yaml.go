@@ -0,0 +1,390 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"sort"
+)
+
+const (
+	ProcDefYamlActionCreate = "create" // 环境中没有同key或同名编排,新建编排
+	ProcDefYamlActionUpdate = "update" // 与已发布版本有差异,新建版本
+	ProcDefYamlActionNoop   = "noop"   // 与已发布版本一致
+
+	ProcDefYamlStatusSkipped  = "skipped"  // 无变化跳过
+	ProcDefYamlStatusFailed   = "failed"   // 同步失败
+	ProcDefYamlStatusCanceled = "canceled" // 其它编排新建草稿失败,本编排没有执行或新建的草稿已删除
+)
+
+// ProcDefYaml 声明式编排定义,一个YAML文档对应一个编排,节点和线用前端节点id关联
+type ProcDefYaml struct {
+	Name              string                 `yaml:"name"`                        // 编排名称
+	Key               string                 `yaml:"key,omitempty"`               // 编排key,为空时按名称匹配环境中的编排
+	RootEntity        string                 `yaml:"rootEntity,omitempty"`        // 根节点
+	Tags              string                 `yaml:"tags,omitempty"`              // 标签
+	Scene             string                 `yaml:"scene,omitempty"`             // 使用场景
+	ConflictCheck     bool                   `yaml:"conflictCheck,omitempty"`     // 冲突检测
+	SubProc           bool                   `yaml:"subProc,omitempty"`           // 是否子编排
+	AuthPlugins       []string               `yaml:"authPlugins,omitempty"`       // 授权插件
+	Permissions       ProcDefYamlPermission  `yaml:"permissions"`                 // 权限
+	Variables         interface{}            `yaml:"variables,omitempty"`         // 编排变量定义
+	ConcurrencyPolicy interface{}            `yaml:"concurrencyPolicy,omitempty"` // 并发控制
+	Nodes             []*ProcDefNodeYaml     `yaml:"nodes"`                       // 节点
+	Links             []*ProcDefNodeLinkYaml `yaml:"links"`                       // 线
+}
+
+type ProcDefYamlPermission struct {
+	Mgmt []string `yaml:"mgmt"`          // 属主角色
+	Use  []string `yaml:"use,omitempty"` // 使用角色
+}
+
+type ProcDefNodeYaml struct {
+	Id                string                  `yaml:"id"`                          // 前端节点id
+	Name              string                  `yaml:"name"`                        // 节点名称
+	Type              string                  `yaml:"type"`                        // 节点类型
+	Description       string                  `yaml:"description,omitempty"`       // 描述
+	Service           string                  `yaml:"service,omitempty"`           // 插件服务名
+	RoutineExpression string                  `yaml:"routineExpression,omitempty"` // 定位规则
+	Timeout           *int                    `yaml:"timeout,omitempty"`           // 超时时间,为空时默认30
+	RiskCheck         bool                    `yaml:"riskCheck,omitempty"`         // 是否高危检测
+	DynamicBind       int                     `yaml:"dynamicBind,omitempty"`       // 动态绑定
+	BindNode          string                  `yaml:"bindNode,omitempty"`          // 动态绑定节点
+	AllowContinue     bool                    `yaml:"allowContinue,omitempty"`     // 允许跳过
+	ContextParamNodes []string                `yaml:"contextParamNodes,omitempty"` // 上下文参数节点
+	SubProcess        *ProcDefSubProcYaml     `yaml:"subProcess,omitempty"`        // 子编排
+	CompensateService string                  `yaml:"compensateService,omitempty"` // 补偿插件服务
+	TimeConfig        interface{}             `yaml:"timeConfig,omitempty"`        // 时间、日期、信号节点配置
+	RetryPolicy       interface{}             `yaml:"retryPolicy,omitempty"`       // 自动重试策略
+	LoopPolicy        interface{}             `yaml:"loopPolicy,omitempty"`        // 循环节点策略
+	OutputMappings    interface{}             `yaml:"outputMappings,omitempty"`    // 出参写入编排变量的映射
+	ApprovalPolicy    interface{}             `yaml:"approvalPolicy,omitempty"`    // 人工节点多人审批策略
+	Params            []*ProcDefNodeParamYaml `yaml:"params,omitempty"`            // 节点参数
+	Ui                interface{}             `yaml:"ui,omitempty"`                // 前端样式,为空时自动排版
+}
+
+// ProcDefSubProcYaml 子编排按名称和版本引用,版本为空时取最新发布版本
+type ProcDefSubProcYaml struct {
+	Name    string `yaml:"name"`              // 子编排名称
+	Version string `yaml:"version,omitempty"` // 子编排版本
+}
+
+type ProcDefNodeParamYaml struct {
+	Id            string `yaml:"id,omitempty"`            // 插件参数id
+	Name          string `yaml:"name"`                    // 参数名
+	BindType      string `yaml:"bindType"`                // 参数类型->context | constant | variable
+	Value         string `yaml:"value,omitempty"`         // 参数值
+	Node          string `yaml:"node,omitempty"`          // 上下文节点id
+	NodeParamType string `yaml:"nodeParamType,omitempty"` // 上下文出入参->input | output
+	NodeParam     string `yaml:"nodeParam,omitempty"`     // 上下文参数名
+	Required      string `yaml:"required,omitempty"`      // 是否必填->Y | N
+}
+
+type ProcDefNodeLinkYaml struct {
+	Id         string      `yaml:"id,omitempty"`         // 前端线id,为空时用source__target
+	Name       string      `yaml:"name,omitempty"`       // 线名称
+	Source     string      `yaml:"source"`               // 源节点id
+	Target     string      `yaml:"target"`               // 目标节点id
+	Expression string      `yaml:"expression,omitempty"` // 判断分支表达式
+	Default    bool        `yaml:"default,omitempty"`    // 是否判断默认分支
+	Ui         interface{} `yaml:"ui,omitempty"`         // 前端样式
+}
+
+// ProcDefYamlPlanItem YAML中单个编排与环境中已发布版本的对比
+type ProcDefYamlPlanItem struct {
+	Name            string                `json:"name"`            // 编排名称
+	Key             string                `json:"key"`             // 编排key,新建时为空
+	Action          string                `json:"action"`          // 动作->create | update | noop
+	DeployedId      string                `json:"deployedId"`      // 最新发布版本id
+	DeployedVersion string                `json:"deployedVersion"` // 最新发布版本
+	DraftId         string                `json:"draftId"`         // 已有草稿id
+	Drift           *ProcDefDiffResult    `json:"drift"`           // 已发布版本与YAML的差异
+	Error           string                `json:"error"`           // 不能同步的原因
+	ProcDef         *ProcessDefinitionDto `json:"-"`               // YAML转换后的编排
+}
+
+// ProcDefYamlApplyItem 同步结果
+type ProcDefYamlApplyItem struct {
+	*ProcDefYamlPlanItem
+	ProcDefId string `json:"procDefId"` // 新建的编排id
+	Version   string `json:"version"`   // 新建的编排版本
+	Status    string `json:"status"`    // 结果->draft | deployed | skipped | failed
+	ErrMsg    string `json:"errMsg"`    // 报错
+}
+
+// ParseProcDefYaml 解析YAML,多个编排用---分隔,不认识的字段报错防止拼写错误被忽略
+func ParseProcDefYaml(content []byte) (result []*ProcDefYaml, err error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	for index := 1; ; index++ {
+		procDefYaml := &ProcDefYaml{}
+		if decodeErr := decoder.Decode(procDefYaml); decodeErr != nil {
+			if errors.Is(decodeErr, io.EOF) {
+				break
+			}
+			err = fmt.Errorf("yaml document %d decode fail,%s ", index, decodeErr.Error())
+			return
+		}
+		if procDefYaml.Name == "" && len(procDefYaml.Nodes) == 0 {
+			continue
+		}
+		result = append(result, procDefYaml)
+	}
+	if len(result) == 0 {
+		err = fmt.Errorf("can not find any process definition in yaml")
+	}
+	return
+}
+
+// MarshalProcDefYaml 多个编排输出为一个多文档YAML
+func MarshalProcDefYaml(list []*ProcDefYaml) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	for _, procDefYaml := range list {
+		if err := encoder.Encode(procDefYaml); err != nil {
+			return nil, err
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ToProcessDefinitionDto 转成编排导入dto,时间配置和前端样式转成json字符串,与数据库中一致
+func (y *ProcDefYaml) ToProcessDefinitionDto() (result *ProcessDefinitionDto, err error) {
+	if y.Name == "" {
+		err = fmt.Errorf("name can not empty")
+		return
+	}
+	procDef := &ProcDefDto{Key: y.Key, Name: y.Name, RootEntity: y.RootEntity, Status: string(Draft), Tags: y.Tags, AuthPlugins: y.AuthPlugins,
+		Scene: y.Scene, ConflictCheck: y.ConflictCheck, SubProc: y.SubProc, Variables: ProcDefVariableList{}}
+	if procDef.AuthPlugins == nil {
+		procDef.AuthPlugins = []string{}
+	}
+	if err = decodeYamlValue(y.Variables, &procDef.Variables); err != nil {
+		err = fmt.Errorf("variables %s", err.Error())
+		return
+	}
+	if err = decodeYamlValue(y.ConcurrencyPolicy, &procDef.ConcurrencyPolicy); err != nil {
+		err = fmt.Errorf("concurrencyPolicy %s", err.Error())
+		return
+	}
+	result = &ProcessDefinitionDto{ProcDef: procDef, PermissionToRole: PermissionToRole{MGMT: y.Permissions.Mgmt, USE: y.Permissions.Use},
+		ProcDefNodeExtend: &ProcDefNodeExtendDto{Nodes: []*ProcDefNodeResultDto{}, Edges: []*ProcDefNodeLinkDto{}}}
+	nodeIdMap := make(map[string]bool)
+	for index, node := range y.Nodes {
+		if node.Id == "" || node.Type == "" {
+			err = fmt.Errorf("node %d id and type can not empty", index+1)
+			return
+		}
+		if nodeIdMap[node.Id] {
+			err = fmt.Errorf("node id %s duplicate", node.Id)
+			return
+		}
+		nodeIdMap[node.Id] = true
+		var nodeDto *ProcDefNodeResultDto
+		if nodeDto, err = node.toNodeDto(index); err != nil {
+			err = fmt.Errorf("node %s %s", node.Id, err.Error())
+			return
+		}
+		result.ProcDefNodeExtend.Nodes = append(result.ProcDefNodeExtend.Nodes, nodeDto)
+	}
+	for _, nodeDto := range result.ProcDefNodeExtend.Nodes {
+		attrs := nodeDto.ProcDefNodeCustomAttrs
+		for _, param := range attrs.ParamInfos {
+			if param.CtxBindNode != "" && !nodeIdMap[param.CtxBindNode] {
+				err = fmt.Errorf("node %s param %s bind node %s not found", attrs.Id, param.Name, param.CtxBindNode)
+				return
+			}
+		}
+		if attrs.BindNodeId != "" && !nodeIdMap[attrs.BindNodeId] {
+			err = fmt.Errorf("node %s bind node %s not found", attrs.Id, attrs.BindNodeId)
+			return
+		}
+	}
+	for _, link := range y.Links {
+		if !nodeIdMap[link.Source] || !nodeIdMap[link.Target] {
+			err = fmt.Errorf("link %s -> %s source or target node not found", link.Source, link.Target)
+			return
+		}
+		attrs := &ProcDefNodeLinkCustomAttrs{Id: link.Id, Name: link.Name, Source: link.Source, Target: link.Target, Expression: link.Expression, IsDefault: link.Default}
+		if attrs.Id == "" {
+			attrs.Id = link.Source + "__" + link.Target
+		}
+		selfAttrs := getYamlJsonString(link.Ui)
+		if selfAttrs == "" {
+			b, _ := json.Marshal(map[string]string{"id": attrs.Id, "source": attrs.Source, "target": attrs.Target, "label": attrs.Name})
+			selfAttrs = string(b)
+		}
+		result.ProcDefNodeExtend.Edges = append(result.ProcDefNodeExtend.Edges, &ProcDefNodeLinkDto{ProcDefNodeLinkCustomAttrs: attrs, SelfAttrs: selfAttrs})
+	}
+	return
+}
+
+func (n *ProcDefNodeYaml) toNodeDto(index int) (result *ProcDefNodeResultDto, err error) {
+	attrs := &ProcDefNodeCustomAttrsDto{Id: n.Id, Name: n.Name, Status: string(Draft), NodeType: n.Type, Timeout: 30, Description: n.Description,
+		DynamicBind: n.DynamicBind, BindNodeId: n.BindNode, RoutineExpression: n.RoutineExpression, ServiceName: n.Service, RiskCheck: n.RiskCheck,
+		ParamInfos: []*ProcDefNodeParam{}, ContextParamNodes: n.ContextParamNodes, TimeConfig: getYamlJsonString(n.TimeConfig), OrderedNo: index + 1,
+		AllowContinue: n.AllowContinue, CompensateService: n.CompensateService, OutputMappings: ProcNodeOutputMappingList{}}
+	if attrs.Name == "" {
+		attrs.Name = n.Id
+	}
+	if n.Timeout != nil {
+		attrs.Timeout = *n.Timeout
+	}
+	if attrs.ContextParamNodes == nil {
+		attrs.ContextParamNodes = []string{}
+	}
+	if n.SubProcess != nil {
+		attrs.SubProcDefName, attrs.SubProcDefVersion = n.SubProcess.Name, n.SubProcess.Version
+	}
+	if err = decodeYamlValue(n.RetryPolicy, &attrs.RetryPolicy); err != nil {
+		err = fmt.Errorf("retryPolicy %s", err.Error())
+		return
+	}
+	if err = decodeYamlValue(n.LoopPolicy, &attrs.LoopPolicy); err != nil {
+		err = fmt.Errorf("loopPolicy %s", err.Error())
+		return
+	}
+	if err = decodeYamlValue(n.OutputMappings, &attrs.OutputMappings); err != nil {
+		err = fmt.Errorf("outputMappings %s", err.Error())
+		return
+	}
+	if err = decodeYamlValue(n.ApprovalPolicy, &attrs.ApprovalPolicy); err != nil {
+		err = fmt.Errorf("approvalPolicy %s", err.Error())
+		return
+	}
+	for _, param := range n.Params {
+		attrs.ParamInfos = append(attrs.ParamInfos, &ProcDefNodeParam{ProcDefNodeId: n.Id, ParamId: param.Id, Name: param.Name, BindType: param.BindType,
+			Value: param.Value, CtxBindNode: param.Node, CtxBindType: param.NodeParamType, CtxBindName: param.NodeParam, Required: param.Required})
+	}
+	selfAttrs := getYamlJsonString(n.Ui)
+	if selfAttrs == "" {
+		// 没有前端样式时从左到右排列
+		selfAttrs = buildBpmnNodeSelfAttrs(attrs, &BpmnBounds{X: float64(100 + index*160), Y: 200})
+	}
+	result = &ProcDefNodeResultDto{ProcDefNodeCustomAttrs: attrs, NodeAttrs: selfAttrs}
+	return
+}
+
+// BuildProcDefYaml 编排详情转成YAML,节点按顺序、线和参数按id排序,方便在git里对比
+func BuildProcDefYaml(procDefDto *ProcessDefinitionDto) *ProcDefYaml {
+	procDef := procDefDto.ProcDef
+	result := &ProcDefYaml{Name: procDef.Name, Key: procDef.Key, RootEntity: procDef.RootEntity, Tags: procDef.Tags, Scene: procDef.Scene,
+		ConflictCheck: procDef.ConflictCheck, SubProc: procDef.SubProc, AuthPlugins: procDef.AuthPlugins,
+		Permissions: ProcDefYamlPermission{Mgmt: procDefDto.PermissionToRole.MGMT, Use: procDefDto.PermissionToRole.USE},
+		Variables:   getYamlVariables(procDef.Variables), ConcurrencyPolicy: getYamlValue(procDef.ConcurrencyPolicy),
+		Nodes: []*ProcDefNodeYaml{}, Links: []*ProcDefNodeLinkYaml{}}
+	var nodeDtoList []*ProcDefNodeResultDto
+	if procDefDto.ProcDefNodeExtend != nil {
+		for _, nodeDto := range procDefDto.ProcDefNodeExtend.Nodes {
+			if nodeDto != nil && nodeDto.ProcDefNodeCustomAttrs != nil {
+				nodeDtoList = append(nodeDtoList, nodeDto)
+			}
+		}
+	}
+	sort.SliceStable(nodeDtoList, func(i, j int) bool {
+		return nodeDtoList[i].ProcDefNodeCustomAttrs.OrderedNo < nodeDtoList[j].ProcDefNodeCustomAttrs.OrderedNo
+	})
+	for _, nodeDto := range nodeDtoList {
+		attrs := nodeDto.ProcDefNodeCustomAttrs
+		timeout := attrs.Timeout
+		node := &ProcDefNodeYaml{Id: attrs.Id, Name: attrs.Name, Type: attrs.NodeType, Description: attrs.Description, Service: attrs.ServiceName,
+			RoutineExpression: attrs.RoutineExpression, Timeout: &timeout, RiskCheck: attrs.RiskCheck, DynamicBind: attrs.DynamicBind, BindNode: attrs.BindNodeId,
+			AllowContinue: attrs.AllowContinue, ContextParamNodes: attrs.ContextParamNodes, CompensateService: attrs.CompensateService,
+			TimeConfig: getYamlValue(attrs.TimeConfig), RetryPolicy: getYamlValue(attrs.RetryPolicy), LoopPolicy: getYamlValue(attrs.LoopPolicy),
+			OutputMappings: getYamlValue(attrs.OutputMappings), ApprovalPolicy: getYamlValue(attrs.ApprovalPolicy), Ui: getYamlValue(nodeDto.NodeAttrs)}
+		if attrs.SubProcDefName != "" {
+			node.SubProcess = &ProcDefSubProcYaml{Name: attrs.SubProcDefName, Version: attrs.SubProcDefVersion}
+		}
+		params := append([]*ProcDefNodeParam{}, attrs.ParamInfos...)
+		sort.Slice(params, func(i, j int) bool {
+			return params[i].Name < params[j].Name
+		})
+		for _, param := range params {
+			node.Params = append(node.Params, &ProcDefNodeParamYaml{Id: param.ParamId, Name: param.Name, BindType: param.BindType, Value: param.Value,
+				Node: param.CtxBindNode, NodeParamType: param.CtxBindType, NodeParam: param.CtxBindName, Required: param.Required})
+		}
+		result.Nodes = append(result.Nodes, node)
+	}
+	if procDefDto.ProcDefNodeExtend != nil {
+		for _, edge := range procDefDto.ProcDefNodeExtend.Edges {
+			if edge == nil || edge.ProcDefNodeLinkCustomAttrs == nil {
+				continue
+			}
+			attrs := edge.ProcDefNodeLinkCustomAttrs
+			result.Links = append(result.Links, &ProcDefNodeLinkYaml{Id: attrs.Id, Name: attrs.Name, Source: attrs.Source, Target: attrs.Target,
+				Expression: attrs.Expression, Default: attrs.IsDefault, Ui: getYamlValue(edge.SelfAttrs)})
+		}
+	}
+	sort.Slice(result.Links, func(i, j int) bool {
+		return result.Links[i].Id < result.Links[j].Id
+	})
+	return result
+}
+
+// decodeYamlValue YAML中的策略配置按json字段名解析,与接口保持一致
+func decodeYamlValue(value interface{}, target interface{}) error {
+	if value == nil {
+		return nil
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, target)
+}
+
+// getYamlJsonString YAML中的对象转成数据库里存的json字符串
+func getYamlJsonString(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	if stringValue, ok := value.(string); ok {
+		return stringValue
+	}
+	b, _ := json.Marshal(value)
+	return string(b)
+}
+
+// getYamlValue 数据库里的json字符串和结构体转成通用对象,输出YAML时用json字段名,空值不输出
+func getYamlValue(value interface{}) interface{} {
+	var b []byte
+	if stringValue, ok := value.(string); ok {
+		b = []byte(stringValue)
+	} else {
+		b, _ = json.Marshal(value)
+	}
+	var result interface{}
+	if err := json.Unmarshal(b, &result); err != nil {
+		if stringValue, ok := value.(string); ok && stringValue != "" {
+			return stringValue
+		}
+		return nil
+	}
+	return compactJsonValue(result)
+}
+
+// getYamlVariables 变量默认值为空字符串时也要输出,不能和其它配置一样去掉空字段
+func getYamlVariables(variables ProcDefVariableList) interface{} {
+	var result []interface{}
+	for _, variable := range variables {
+		item := map[string]interface{}{"name": variable.Name, "dataType": variable.DataType}
+		if variable.DefaultValue != nil {
+			item["defaultValue"] = variable.DefaultValue
+		}
+		if variable.Description != "" {
+			item["description"] = variable.Description
+		}
+		result = append(result, item)
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
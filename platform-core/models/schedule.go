@@ -28,6 +28,7 @@ type ProcScheduleConfig struct {
 	UpdatedBy      string    `json:"updatedBy" xorm:"updated_by"`            // 更新人
 	UpdatedTime    time.Time `json:"updatedTime" xorm:"updated_time"`        // 更新时间
 	Name           string    `json:"name" xorm:"name"`                       // 任务名
+	Calendar       string    `json:"calendar" xorm:"calendar"`               // 业务日历名称,配置后只在工作日的工作时间执行
 }
 
 type ProcScheduleJob struct {
@@ -73,6 +74,7 @@ type CreateProcScheduleParam struct {
 	CronExpr       string `json:"-"`
 	Operator       string `json:"-"`
 	Name           string `json:"name" binding:"required"`
+	Calendar       string `json:"calendar"` // 业务日历名称,配置后只在工作日的工作时间执行
 }
 
 type ProcScheduleConfigObj struct {
@@ -95,6 +97,7 @@ type ProcScheduleConfigObj struct {
 	MailMode                 string `json:"mailMode" xorm:"mail_mode"` // 邮件发送模式->role(角色邮箱) | user(用户邮箱) | none(不发送)
 	Version                  string `json:"version"`
 	Name                     string `json:"name"`
+	Calendar                 string `json:"calendar"` // 业务日历名称
 }
 
 type ProcScheduleOperationParam struct {
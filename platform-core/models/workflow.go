@@ -2,6 +2,8 @@ package models
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"time"
 )
 
@@ -19,6 +21,9 @@ const (
 	JobDecisionType      = "decision"
 	JobSubProcType       = "subProc"
 	JobDecisionMergeType = "decisionMerge"
+	JobLoopType          = "loop"
+	JobCompensateType    = "compensate"
+	JobSignalType        = "signal"
 
 	JobStatusReady     = "NotStarted"
 	JobStatusRunning   = "InProgress"
@@ -28,6 +33,38 @@ const (
 	JobStatusTimeout   = "Timeouted"
 	WorkflowStatusStop = "Stop"
 	JobStatusRisky     = "Risky"
+
+	WorkflowHostReleased = "released" // 实例退出时释放的工作流,其它实例立即接管
+
+	RetryBackoffFixed       = "fixed"
+	RetryBackoffExponential = "exponential"
+	RetryDefaultMaxInterval = 3600 // 指数退避没有配置最大间隔时默认最多等待1小时
+
+	NodeErrorNetwork = "network"
+	NodeErrorPlugin  = "pluginError"
+	NodeErrorOther   = "other"
+
+	LoopModeForEach = "forEach"
+	LoopModeUntil   = "until"
+
+	LoopFailFast      = "failFast"
+	LoopFailContinue  = "continue"
+	LoopFailThreshold = "threshold"
+
+	CompensateTriggerFail     = "fail"
+	CompensateTriggerRollback = "rollback"
+
+	TimerStatusWait     = "wait"
+	TimerStatusFired    = "fired"
+	TimerStatusCanceled = "canceled"
+
+	SignalStatusWait     = "wait"
+	SignalStatusReceived = "received"
+	SignalStatusTimeout  = "timeout"
+
+	SignalCorrelationRoot     = "root"
+	SignalCorrelationVariable = "variable"
+	SignalTimeoutBranch       = "timeout" // 等待信号节点超时分支的线名称
 )
 
 type ProcRunWorkflow struct {
@@ -86,7 +123,7 @@ type ProcRunOperation struct {
 	Id          int64     `json:"id" xorm:"id"`                    // 自增id
 	WorkflowId  string    `json:"workflowId" xorm:"workflow_id"`   // 工作流id
 	NodeId      string    `json:"nodeId" xorm:"node_id"`           // 节点id
-	Operation   string    `json:"operation" xorm:"operation"`      // 操作->kill(终止工作流) | retry(重试节点) | ignore(跳过节点) | approve(人工审批) | date(定期触发) | stop(暂停) | continue(恢复)
+	Operation   string    `json:"operation" xorm:"operation"`      // 操作->kill(终止工作流) | retry(重试节点) | ignore(跳过节点) | approve(人工审批) | date(定期触发) | stop(暂停) | continue(恢复) | rollback(终止并补偿) | timer(定时器触发或取消)
 	Status      string    `json:"status" xorm:"status"`            // 状态->wait(待处理) | doing(正在处理) | done(已处理)
 	Message     string    `json:"message" xorm:"message"`          // 详细信息->审批结果,终止原因等
 	CreatedBy   string    `json:"createdBy" xorm:"created_by"`     // 创建人
@@ -111,10 +148,12 @@ type ProcNodeContext struct {
 }
 
 type TimeNodeParam struct {
-	Type     string `json:"type"` // duration/date
+	Type     string `json:"type"` // duration/date/window
 	Duration int    `json:"duration"`
-	Unit     string `json:"unit"` // sec/min/hour/day
-	Date     string `json:"date"` // 2024-01-15 00:00:00
+	Unit     string `json:"unit"`     // sec/min/hour/day,配置了日历时day按工作日,其它只计算工作时间
+	Date     string `json:"date"`     // 2024-01-15 00:00:00
+	Calendar string `json:"calendar"` // 业务日历名称,日期按日历时区解析
+	Adjust   string `json:"adjust"`   // 日期落在非工作时间时的处理->next(顺延) | 空(不调整)
 }
 
 type WorkProblemErrObj struct {
@@ -141,3 +180,254 @@ type ProcSubProcQueryRow struct {
 	ErrorMessage  string `json:"errorMessage" xorm:"error_message"`     // 错误信息
 	ProcInsId     string `json:"procInsId" xorm:"proc_ins_id"`          // 编排实例id
 }
+
+// ProcNodeRetryPolicy 自动节点和数据写入节点的自动重试策略
+type ProcNodeRetryPolicy struct {
+	MaxAttempts int      `json:"maxAttempts"` // 最大执行次数,包含首次执行
+	Backoff     string   `json:"backoff"`     // 退避方式->fixed(固定间隔) | exponential(指数退避)
+	Interval    int      `json:"interval"`    // 重试间隔秒数,指数退避时为首次重试间隔
+	MaxInterval int      `json:"maxInterval"` // 指数退避时的最大间隔秒数,0表示使用默认值3600
+	RetryOn     []string `json:"retryOn"`     // 可重试的错误类型->network(网络或网关请求失败) | pluginError(插件返回resultCode!=0,数据写入节点为写数据接口返回失败) | other(其它错误),为空时只重试network
+}
+
+func (p *ProcNodeRetryPolicy) String() string {
+	if p == nil || p.MaxAttempts <= 1 {
+		return ""
+	}
+	b, _ := json.Marshal(p)
+	return string(b)
+}
+
+// Retryable 判断该错误类型是否可以重试
+func (p *ProcNodeRetryPolicy) Retryable(errorCode string) bool {
+	if len(p.RetryOn) == 0 {
+		return errorCode == NodeErrorNetwork
+	}
+	for _, v := range p.RetryOn {
+		if v == errorCode {
+			return true
+		}
+	}
+	return false
+}
+
+// Delay 第attempt次执行失败后,到下一次执行需要等待的时间
+func (p *ProcNodeRetryPolicy) Delay(attempt int) time.Duration {
+	maxInterval := p.MaxInterval
+	if maxInterval <= 0 {
+		maxInterval = RetryDefaultMaxInterval
+	}
+	interval := p.Interval
+	if p.Backoff == RetryBackoffExponential {
+		for i := 1; i < attempt && interval < maxInterval; i++ {
+			interval = interval * 2
+		}
+	}
+	if interval > maxInterval {
+		interval = maxInterval
+	}
+	return time.Duration(interval) * time.Second
+}
+
+// ParseProcNodeRetryPolicy 解析节点定义中的重试策略,没有配置或配置非法时返回nil
+func ParseProcNodeRetryPolicy(input string) *ProcNodeRetryPolicy {
+	if input == "" {
+		return nil
+	}
+	policy := ProcNodeRetryPolicy{}
+	if err := json.Unmarshal([]byte(input), &policy); err != nil {
+		return nil
+	}
+	return &policy
+}
+
+// ProcNodeLoopPolicy 循环节点策略,循环体为节点配置的子编排,或者当前编排中循环节点之后到bodyEndNode为止的一段子图
+type ProcNodeLoopPolicy struct {
+	Mode             string `json:"mode"`             // 循环方式->forEach(按绑定数据逐条执行) | until(重复执行直到条件满足)
+	BodyEndNode      string `json:"bodyEndNode"`      // 循环子图最后一个节点的nodeId,节点没有配置子编排时必填
+	MaxParallel      int    `json:"maxParallel"`      // 最大并发数,forEach时有效,默认1
+	MaxIterations    int    `json:"maxIterations"`    // 最大迭代次数,0表示不限制(until时必填)
+	FailurePolicy    string `json:"failurePolicy"`    // 失败策略->failFast(有失败即停止) | continue(继续执行剩余) | threshold(失败比例超过阈值停止)
+	FailureThreshold int    `json:"failureThreshold"` // 失败比例阈值,百分比,failurePolicy为threshold时有效
+	Until            string `json:"until"`            // 结束条件表达式,until时有效,语法同判断分支表达式
+}
+
+func (p *ProcNodeLoopPolicy) String() string {
+	if p == nil {
+		return ""
+	}
+	b, _ := json.Marshal(p)
+	return string(b)
+}
+
+// ParseProcNodeLoopPolicy 解析节点定义中的循环策略,没有配置或配置非法时返回nil
+func ParseProcNodeLoopPolicy(input string) *ProcNodeLoopPolicy {
+	if input == "" {
+		return nil
+	}
+	policy := ProcNodeLoopPolicy{}
+	if err := json.Unmarshal([]byte(input), &policy); err != nil {
+		return nil
+	}
+	return &policy
+}
+
+// AllowFailure 按失败策略判断当前的失败数是否还允许继续执行
+func (p *ProcNodeLoopPolicy) AllowFailure(failCount, totalCount int) bool {
+	if failCount == 0 {
+		return true
+	}
+	switch p.FailurePolicy {
+	case LoopFailContinue:
+		return true
+	case LoopFailThreshold:
+		if totalCount <= 0 {
+			return false
+		}
+		return failCount*100 <= p.FailureThreshold*totalCount
+	}
+	return false
+}
+
+// GetProcDefLoopBody 取循环节点之后到bodyEndNodeId为止的子图节点,子图只能从循环节点进入、从最后一个节点出去
+func GetProcDefLoopBody(links []*ProcDefNodeLink, loopNodeId, bodyEndNodeId string) (bodyNodes map[string]bool, err error) {
+	descendants := GetProcDefNodeDescendants(links, loopNodeId)
+	if !descendants[bodyEndNodeId] {
+		err = fmt.Errorf("body end node is not after loop node")
+		return
+	}
+	bodyNodes = map[string]bool{bodyEndNodeId: true}
+	for nodeId := range GetProcDefNodeAncestors(links, bodyEndNodeId) {
+		if descendants[nodeId] {
+			bodyNodes[nodeId] = true
+		}
+	}
+	for _, link := range links {
+		if bodyNodes[link.Target] && !bodyNodes[link.Source] && link.Source != loopNodeId {
+			err = fmt.Errorf("link %s enter loop body from outside", link.LinkId)
+			return
+		}
+		if bodyNodes[link.Source] && !bodyNodes[link.Target] && link.Source != bodyEndNodeId {
+			err = fmt.Errorf("link %s leave loop body before body end node", link.LinkId)
+			return
+		}
+	}
+	return
+}
+
+// ProcNodeCallError 节点调用插件失败的错误,区分网络错误和插件返回的错误
+type ProcNodeCallError struct {
+	Code string
+	Err  error
+}
+
+func (e *ProcNodeCallError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ProcNodeCallError) Unwrap() error {
+	return e.Err
+}
+
+// ProcNodeSignalConfig 等待信号节点配置,存放在节点配置(time_config)中
+type ProcNodeSignalConfig struct {
+	EventType           string `json:"eventType"`           // 事件类型
+	CorrelationFrom     string `json:"correlationFrom"`     // 关联键来源->root(根数据id) | variable(编排变量)
+	CorrelationVariable string `json:"correlationVariable"` // 关联键取值的编排变量,correlationFrom为variable时有效
+	Duration            int    `json:"duration"`            // 超时时长,0表示一直等待
+	Unit                string `json:"unit"`                // 超时时长单位->sec | min | hour | day
+}
+
+// ParseProcNodeSignalConfig 解析等待信号节点配置,配置非法时返回nil
+func ParseProcNodeSignalConfig(input string) *ProcNodeSignalConfig {
+	if input == "" {
+		return nil
+	}
+	config := ProcNodeSignalConfig{}
+	if err := json.Unmarshal([]byte(input), &config); err != nil {
+		return nil
+	}
+	if config.CorrelationFrom == "" {
+		config.CorrelationFrom = SignalCorrelationRoot
+	}
+	return &config
+}
+
+// TimeoutDuration 超时时长,单位不合法时返回错误
+func (c *ProcNodeSignalConfig) TimeoutDuration() (duration time.Duration, err error) {
+	if c.Duration < 0 {
+		err = fmt.Errorf("duration can not be negative")
+		return
+	}
+	switch c.Unit {
+	case "sec":
+		duration = time.Duration(c.Duration) * time.Second
+	case "min":
+		duration = time.Duration(c.Duration) * time.Minute
+	case "hour":
+		duration = time.Duration(c.Duration) * time.Hour
+	case "day":
+		duration = time.Duration(c.Duration) * time.Hour * 24
+	default:
+		if c.Duration > 0 {
+			err = fmt.Errorf("unit %s illegal", c.Unit)
+		}
+	}
+	return
+}
+
+type ProcRunSignal struct {
+	Id             string    `json:"id" xorm:"id"`                          // 唯一标识
+	WorkflowId     string    `json:"workflowId" xorm:"workflow_id"`         // 工作流id
+	ProcRunNodeId  string    `json:"procRunNodeId" xorm:"proc_run_node_id"` // 任务节点id
+	ProcInsId      string    `json:"procInsId" xorm:"proc_ins_id"`          // 编排实例id
+	NodeName       string    `json:"nodeName" xorm:"node_name"`             // 节点名称
+	EventType      string    `json:"eventType" xorm:"event_type"`           // 事件类型
+	CorrelationKey string    `json:"correlationKey" xorm:"correlation_key"` // 关联键
+	TimerId        string    `json:"timerId" xorm:"timer_id"`               // 超时定时器id
+	Status         string    `json:"status" xorm:"status"`                  // 状态->wait(等待) | received(已收到) | timeout(超时)
+	EventId        int64     `json:"eventId" xorm:"event_id"`               // 匹配的事件id
+	Payload        string    `json:"payload" xorm:"payload"`                // 事件数据
+	CreatedTime    time.Time `json:"createdTime" xorm:"created_time"`       // 创建时间
+	UpdatedBy      string    `json:"updatedBy" xorm:"updated_by"`           // 更新人
+	UpdatedTime    time.Time `json:"updatedTime" xorm:"updated_time"`       // 更新时间
+}
+
+type ProcRunNodeRetry struct {
+	Id            int64     `json:"id" xorm:"id"`                          // 自增id
+	WorkflowId    string    `json:"workflowId" xorm:"workflow_id"`         // 工作流id
+	ProcRunNodeId string    `json:"procRunNodeId" xorm:"proc_run_node_id"` // 任务节点id
+	Attempt       int       `json:"attempt" xorm:"attempt"`                // 第几次执行
+	Host          string    `json:"host" xorm:"host"`                      // 执行主机
+	ErrorCode     string    `json:"errorCode" xorm:"error_code"`           // 错误类型->network | pluginError | other
+	ErrorMessage  string    `json:"errorMessage" xorm:"error_message"`     // 错误信息
+	StartTime     time.Time `json:"startTime" xorm:"start_time"`           // 执行开始时间
+	EndTime       time.Time `json:"endTime" xorm:"end_time"`               // 执行结束时间
+	NextRetryTime time.Time `json:"nextRetryTime" xorm:"next_retry_time"`  // 下一次重试时间,为空表示不再重试
+}
+
+type ProcRunNodeCompensate struct {
+	Id                int64     `json:"id" xorm:"id"`                                // 自增id
+	WorkflowId        string    `json:"workflowId" xorm:"workflow_id"`               // 工作流id
+	ProcRunNodeId     string    `json:"procRunNodeId" xorm:"proc_run_node_id"`       // 补偿任务节点id
+	OriginRunNodeId   string    `json:"originRunNodeId" xorm:"origin_run_node_id"`   // 被补偿的任务节点id
+	OriginInsNodeId   string    `json:"originInsNodeId" xorm:"origin_ins_node_id"`   // 被补偿的实例节点id
+	CompensateTrigger string    `json:"compensateTrigger" xorm:"compensate_trigger"` // 触发方式->fail(编排失败) | rollback(人工回滚)
+	CreatedBy         string    `json:"createdBy" xorm:"created_by"`                 // 创建人
+	CreatedTime       time.Time `json:"createdTime" xorm:"created_time"`             // 创建时间
+}
+
+type ProcRunTimer struct {
+	Id            string    `json:"id" xorm:"id"`                          // 唯一标识
+	WorkflowId    string    `json:"workflowId" xorm:"workflow_id"`         // 工作流id
+	ProcRunNodeId string    `json:"procRunNodeId" xorm:"proc_run_node_id"` // 任务节点id
+	ProcInsId     string    `json:"procInsId" xorm:"proc_ins_id"`          // 编排实例id
+	NodeName      string    `json:"nodeName" xorm:"node_name"`             // 节点名称
+	JobType       string    `json:"jobType" xorm:"job_type"`               // 任务类型->timeInterval | date | signal
+	FireTime      time.Time `json:"fireTime" xorm:"fire_time"`             // 触发时间
+	Status        string    `json:"status" xorm:"status"`                  // 状态->wait(等待) | fired(已触发) | canceled(已取消)
+	HandleBy      string    `json:"handleBy" xorm:"handle_by"`             // 触发的主机
+	CreatedTime   time.Time `json:"createdTime" xorm:"created_time"`       // 创建时间
+	UpdatedBy     string    `json:"updatedBy" xorm:"updated_by"`           // 更新人
+	UpdatedTime   time.Time `json:"updatedTime" xorm:"updated_time"`       // 更新时间
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"testing"
+)
+
+func newTestLoopLinks(pairs ...string) []*ProcDefNodeLink {
+	var links []*ProcDefNodeLink
+	for i := 0; i+1 < len(pairs); i += 2 {
+		links = append(links, &ProcDefNodeLink{LinkId: pairs[i] + "_" + pairs[i+1], Source: pairs[i], Target: pairs[i+1]})
+	}
+	return links
+}
+
+func TestGetProcDefLoopBody(t *testing.T) {
+	// start -> loop -> fork -> a,b -> merge -> c -> end
+	links := newTestLoopLinks("start", "loop", "loop", "fork", "fork", "a", "fork", "b", "a", "merge", "b", "merge", "merge", "c", "c", "end")
+	body, err := GetProcDefLoopBody(links, "loop", "merge")
+	if err != nil {
+		t.Fatalf("get loop body fail,%s", err.Error())
+	}
+	for _, nodeId := range []string{"fork", "a", "b", "merge"} {
+		if !body[nodeId] {
+			t.Errorf("node %s should in loop body", nodeId)
+		}
+	}
+	if len(body) != 4 {
+		t.Errorf("loop body expect 4 nodes,got %d", len(body))
+	}
+}
+
+func TestGetProcDefLoopBodyIllegal(t *testing.T) {
+	cases := []struct {
+		name  string
+		links []*ProcDefNodeLink
+		end   string
+	}{
+		{"end node before loop", newTestLoopLinks("start", "a", "a", "loop", "loop", "end"), "a"},
+		{"enter from outside", newTestLoopLinks("start", "d", "d", "loop", "loop", "a", "a", "b", "d", "b", "b", "end"), "b"},
+		{"leave before end node", newTestLoopLinks("start", "loop", "loop", "d", "d", "a", "d", "b", "a", "end", "b", "end"), "a"},
+	}
+	for _, c := range cases {
+		if _, err := GetProcDefLoopBody(c.links, "loop", c.end); err == nil {
+			t.Errorf("%s: expect error", c.name)
+		}
+	}
+}
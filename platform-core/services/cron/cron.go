@@ -218,9 +218,12 @@ func StartHandleProcEvent() {
 
 // 扫事件表定时处理
 func doHandleProcEventJob() {
+	if workflow.IsDraining() {
+		return
+	}
 	log.Logger.Debug("Start handle proc event job")
 	var procEventRows []*models.ProcInsEvent
-	err := db.MysqlEngine.SQL("select * from proc_ins_event where status=?", models.ProcEventStatusCreated).Find(&procEventRows)
+	err := db.MysqlEngine.SQL("select * from proc_ins_event where status=? order by priority desc,id", models.ProcEventStatusCreated).Find(&procEventRows)
 	if err != nil {
 		log.Logger.Error("doHandleProcEventJob fail with query proc_ins_event table", log.Error(err))
 		return
@@ -230,6 +233,9 @@ func doHandleProcEventJob() {
 		return
 	}
 	for _, row := range procEventRows {
+		if !workflow.IsClusterOwnerOrOverdue(fmt.Sprintf("proc_event_%d", row.Id), row.CreatedTime) {
+			continue
+		}
 		ctx := context.WithValue(context.Background(), models.TransactionIdHeader, fmt.Sprintf("proc_event_%d", row.Id))
 		takeoverFlag, procInsId, tmpErr := handleProcEvent(ctx, row)
 		if tmpErr != nil {
@@ -273,6 +279,7 @@ func handleProcEvent(ctx context.Context, procEvent *models.ProcInsEvent) (takeo
 		EntityDisplayName: procEvent.OperationData,
 		ProcDefId:         procEvent.ProcDefId,
 		ProcessSessionId:  previewData.ProcessSessionId,
+		Priority:          procEvent.Priority,
 	}
 	// 新增 proc_ins,proc_ins_node,proc_data_binding 纪录
 	newProcInsId, workflowRow, workNodes, workLinks, createInsErr := database.CreateProcInstance(ctx, &procStartParam, operator)
@@ -282,6 +289,10 @@ func handleProcEvent(ctx context.Context, procEvent *models.ProcInsEvent) (takeo
 		return
 	}
 	procInsId = newProcInsId
+	// 超过并发上限进入排队,由排队任务负责启动
+	if workflowRow.Status == models.JobStatusQueued {
+		return
+	}
 	// 初始化workflow并开始
 	workObj := workflow.Workflow{ProcRunWorkflow: *workflowRow}
 	workObj.Init(context.Background(), workNodes, workLinks)
@@ -315,8 +326,8 @@ func doTransOldEventToNew() {
 	var actions []*db.ExecAction
 	nowTime := time.Now()
 	for _, row := range oldEventRows {
-		tmpNewRowAction := db.ExecAction{Sql: "insert into proc_ins_event(event_seq_no,event_type,operation_data,operation_key,operation_user,proc_def_id,source_plugin,status,created_time) values (?,?,?,?,?,?,?,?,?)", Param: []interface{}{
-			row.EventSeqNo, row.EventType, row.OperData, row.OperKey, row.OperUser, row.ProcDefId, row.SrcSubSystem, models.ProcEventStatusCreated, nowTime,
+		tmpNewRowAction := db.ExecAction{Sql: "insert into proc_ins_event(event_seq_no,event_type,operation_data,operation_key,operation_user,proc_def_id,source_plugin,status,created_time,priority) values (?,?,?,?,?,?,?,?,?,?)", Param: []interface{}{
+			row.EventSeqNo, row.EventType, row.OperData, row.OperKey, row.OperUser, row.ProcDefId, row.SrcSubSystem, models.ProcEventStatusCreated, nowTime, row.Priority,
 		}}
 		tmpDelAction := db.ExecAction{Sql: "delete from core_operation_event where id=?", Param: []interface{}{row.Id}}
 		actions = append(actions, &tmpNewRowAction)
@@ -0,0 +1,125 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"github.com/WeBankPartners/go-common-lib/guid"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/db"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/exterror"
+	"github.com/WeBankPartners/wecube-platform/platform-core/models"
+	"strings"
+	"time"
+)
+
+// ListBusinessCalendar 查所有业务日历
+func ListBusinessCalendar(ctx context.Context) (result []*models.BusinessCalendar, err error) {
+	result = []*models.BusinessCalendar{}
+	if err = db.MysqlEngine.Context(ctx).SQL("select * from business_calendar order by name").Find(&result); err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+	}
+	return
+}
+
+// GetBusinessCalendar 按id查业务日历
+func GetBusinessCalendar(ctx context.Context, calendarId string) (result *models.BusinessCalendar, err error) {
+	return getBusinessCalendarRow(ctx, "id", calendarId)
+}
+
+// GetBusinessCalendarRule 按名称查业务日历并解析,用于时间节点和定时任务计算时间
+func GetBusinessCalendarRule(ctx context.Context, name string) (rule *models.BusinessCalendarRule, err error) {
+	row, getErr := getBusinessCalendarRow(ctx, "name", name)
+	if getErr != nil {
+		err = getErr
+		return
+	}
+	if rule, err = models.ParseBusinessCalendar(row); err != nil {
+		err = exterror.New().BusinessCalendarConfigError.WithParam(err.Error())
+	}
+	return
+}
+
+func getBusinessCalendarRow(ctx context.Context, column, value string) (result *models.BusinessCalendar, err error) {
+	var calendarRows []*models.BusinessCalendar
+	if err = db.MysqlEngine.Context(ctx).SQL("select * from business_calendar where "+column+"=?", value).Find(&calendarRows); err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+		return
+	}
+	if len(calendarRows) == 0 {
+		err = exterror.New().BusinessCalendarConfigError.WithParam(fmt.Sprintf("can not find calendar %s", value))
+		return
+	}
+	result = calendarRows[0]
+	return
+}
+
+// CreateBusinessCalendar 新增业务日历,名称不能重复
+func CreateBusinessCalendar(ctx context.Context, param *models.BusinessCalendar, operator string) (err error) {
+	param.Name = strings.TrimSpace(param.Name)
+	if param.Name == "" {
+		return exterror.New().BusinessCalendarConfigError.WithParam("name empty")
+	}
+	if _, err = models.ParseBusinessCalendar(param); err != nil {
+		return exterror.New().BusinessCalendarConfigError.WithParam(err.Error())
+	}
+	queryRows, queryErr := db.MysqlEngine.Context(ctx).QueryString("select id from business_calendar where name=?", param.Name)
+	if queryErr != nil {
+		return exterror.Catch(exterror.New().DatabaseQueryError, queryErr)
+	}
+	if len(queryRows) > 0 {
+		return exterror.New().BusinessCalendarConfigError.WithParam(fmt.Sprintf("name:%s duplicate", param.Name))
+	}
+	nowTime := time.Now()
+	param.Id = "bc_" + guid.CreateGuid()
+	param.CreatedBy, param.CreatedTime, param.UpdatedBy, param.UpdatedTime = operator, nowTime, operator, nowTime
+	_, err = db.MysqlEngine.Context(ctx).Exec("insert into business_calendar(id,name,description,time_zone,work_days,work_hours,holidays,extra_work_dates,maintenance_windows,created_by,created_time,updated_by,updated_time) values (?,?,?,?,?,?,?,?,?,?,?,?,?)",
+		param.Id, param.Name, param.Description, param.TimeZone, param.WorkDays, param.WorkHours, param.Holidays, param.ExtraWorkDates, param.MaintenanceWindows, param.CreatedBy, param.CreatedTime, param.UpdatedBy, param.UpdatedTime)
+	if err != nil {
+		err = exterror.Catch(exterror.New().DatabaseExecuteError, err)
+	}
+	return
+}
+
+// UpdateBusinessCalendar 修改业务日历,名称被节点和定时任务引用所以不能修改
+func UpdateBusinessCalendar(ctx context.Context, param *models.BusinessCalendar, operator string) (err error) {
+	existRow, getErr := GetBusinessCalendar(ctx, param.Id)
+	if getErr != nil {
+		return getErr
+	}
+	param.Name = existRow.Name
+	if _, err = models.ParseBusinessCalendar(param); err != nil {
+		return exterror.New().BusinessCalendarConfigError.WithParam(err.Error())
+	}
+	param.CreatedBy, param.CreatedTime, param.UpdatedBy, param.UpdatedTime = existRow.CreatedBy, existRow.CreatedTime, operator, time.Now()
+	_, err = db.MysqlEngine.Context(ctx).Exec("update business_calendar set description=?,time_zone=?,work_days=?,work_hours=?,holidays=?,extra_work_dates=?,maintenance_windows=?,updated_by=?,updated_time=? where id=?",
+		param.Description, param.TimeZone, param.WorkDays, param.WorkHours, param.Holidays, param.ExtraWorkDates, param.MaintenanceWindows, param.UpdatedBy, param.UpdatedTime, param.Id)
+	if err != nil {
+		err = exterror.Catch(exterror.New().DatabaseExecuteError, err)
+	}
+	return
+}
+
+// DeleteBusinessCalendar 删除业务日历,被编排节点或定时任务引用时不能删除
+func DeleteBusinessCalendar(ctx context.Context, calendarId string) (err error) {
+	existRow, getErr := GetBusinessCalendar(ctx, calendarId)
+	if getErr != nil {
+		return getErr
+	}
+	scheduleRows, queryErr := db.MysqlEngine.Context(ctx).QueryString("select name from proc_schedule_config where calendar=? and status<>?", existRow.Name, models.ScheduleStatusDelete)
+	if queryErr != nil {
+		return exterror.Catch(exterror.New().DatabaseQueryError, queryErr)
+	}
+	if len(scheduleRows) > 0 {
+		return exterror.New().BusinessCalendarReferenceError.WithParam(existRow.Name, "schedule "+scheduleRows[0]["name"])
+	}
+	nodeRows, queryErr := db.MysqlEngine.Context(ctx).QueryString("select t2.name as proc_def_name,t1.name from proc_def_node t1 join proc_def t2 on t2.id=t1.proc_def_id where t1.time_config like ?", "%\"calendar\":\""+existRow.Name+"\"%")
+	if queryErr != nil {
+		return exterror.Catch(exterror.New().DatabaseQueryError, queryErr)
+	}
+	if len(nodeRows) > 0 {
+		return exterror.New().BusinessCalendarReferenceError.WithParam(existRow.Name, "process "+nodeRows[0]["proc_def_name"]+" node "+nodeRows[0]["name"])
+	}
+	if _, err = db.MysqlEngine.Context(ctx).Exec("delete from business_calendar where id=?", calendarId); err != nil {
+		err = exterror.Catch(exterror.New().DatabaseExecuteError, err)
+	}
+	return
+}
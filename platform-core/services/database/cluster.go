@@ -0,0 +1,34 @@
+package database
+
+import (
+	"context"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/db"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/exterror"
+	"github.com/WeBankPartners/wecube-platform/platform-core/models"
+	"strconv"
+	"time"
+)
+
+// ListClusterMember 查集群成员,负载取成员上报的内存工作流数和数据库中归属该实例的运行中工作流数
+func ListClusterMember(ctx context.Context) (result []*models.ClusterMemberLoad, err error) {
+	result = []*models.ClusterMemberLoad{}
+	var memberRows []*models.CoreClusterMember
+	if err = db.MysqlEngine.Context(ctx).SQL("select * from core_cluster_member order by host").Find(&memberRows); err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+		return
+	}
+	ownedRows, queryErr := db.MysqlEngine.Context(ctx).QueryString("select host,count(1) as num from proc_run_workflow where status=? and `sleep`=0 group by host", models.JobStatusRunning)
+	if queryErr != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, queryErr)
+		return
+	}
+	ownedMap := make(map[string]int)
+	for _, row := range ownedRows {
+		ownedMap[row["host"]], _ = strconv.Atoi(row["num"])
+	}
+	aliveTime := time.Now().Add(-models.ClusterMemberAliveTimeout * time.Second)
+	for _, row := range memberRows {
+		result = append(result, &models.ClusterMemberLoad{CoreClusterMember: *row, Alive: row.LastAliveTime.After(aliveTime), OwnedWorkflows: ownedMap[row.Host]})
+	}
+	return
+}
@@ -0,0 +1,283 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"github.com/WeBankPartners/go-common-lib/guid"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/db"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/exterror"
+	"github.com/WeBankPartners/wecube-platform/platform-core/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GetProcInsNodeApprovalPolicy 查实例节点对应定义节点上的审批策略,没有配置时返回nil
+func GetProcInsNodeApprovalPolicy(ctx context.Context, procInsNodeId string) (policy *models.ProcNodeApprovalPolicy, err error) {
+	queryRows, queryErr := db.MysqlEngine.Context(ctx).QueryString("select t2.approval_policy from proc_ins_node t1 join proc_def_node t2 on t2.id=t1.proc_def_node_id where t1.id=?", procInsNodeId)
+	if queryErr != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, queryErr)
+		return
+	}
+	if len(queryRows) > 0 {
+		policy = models.ParseProcNodeApprovalPolicy(queryRows[0]["approval_policy"])
+	}
+	return
+}
+
+// GetProcRunApprovalRound 查工作流节点当前的审批轮次,还没有审批票时返回0
+func GetProcRunApprovalRound(ctx context.Context, procRunNodeId string) (round int, err error) {
+	queryRows, queryErr := db.MysqlEngine.Context(ctx).QueryString("select max(round) as round from proc_run_approval where proc_run_node_id=?", procRunNodeId)
+	if queryErr != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, queryErr)
+		return
+	}
+	if len(queryRows) > 0 && queryRows[0]["round"] != "" {
+		round, _ = strconv.Atoi(queryRows[0]["round"])
+	}
+	return
+}
+
+// CreateProcRunApprovals 开始新一轮审批,按审批策略给每个审批人生成一张票,上一轮未投的票作废
+func CreateProcRunApprovals(ctx context.Context, nodeRow *models.ProcRunApproval, policy *models.ProcNodeApprovalPolicy, round int) (err error) {
+	nowTime := time.Now()
+	var actions []*db.ExecAction
+	var timelineEvents []*models.ProcInsTimeline
+	actions = append(actions, &db.ExecAction{Sql: "update proc_run_approval set status=?,updated_time=? where proc_run_node_id=? and status=?", Param: []interface{}{models.ApprovalStatusCanceled, nowTime, nodeRow.ProcRunNodeId, models.ApprovalStatusWait}})
+	for _, approver := range policy.Approvers {
+		approvalId := "apv_" + guid.CreateGuid()
+		actions = append(actions, &db.ExecAction{Sql: "insert into proc_run_approval(id,workflow_id,proc_ins_id,proc_ins_node_id,proc_run_node_id,node_name,round,approver_type,approver,status,created_time,updated_time) values (?,?,?,?,?,?,?,?,?,?,?,?)", Param: []interface{}{
+			approvalId, nodeRow.WorkflowId, nodeRow.ProcInsId, nodeRow.ProcInsNodeId, nodeRow.ProcRunNodeId, nodeRow.NodeName, round, approver.Type, approver.Name, models.ApprovalStatusWait, nowTime, nowTime,
+		}})
+		timelineEvents = append(timelineEvents, &models.ProcInsTimeline{ProcInsId: nodeRow.ProcInsId, WorkflowId: nodeRow.WorkflowId, ProcInsNodeId: nodeRow.ProcInsNodeId, ProcRunNodeId: nodeRow.ProcRunNodeId, NodeName: nodeRow.NodeName, EventType: models.TimelineEventApproval, Status: models.ApprovalStatusWait, Message: approver.Type + ":" + approver.Name, RefId: approvalId, CreatedBy: "system", CreatedTime: nowTime})
+	}
+	if err = db.Transaction(actions, ctx); err != nil {
+		return
+	}
+	for _, event := range timelineEvents {
+		AddProcInsTimeline(ctx, event)
+	}
+	return
+}
+
+// CountProcRunApproval 统计一轮审批的同意票和拒绝票
+func CountProcRunApproval(ctx context.Context, procRunNodeId string, round int) (approveNum, rejectNum int, err error) {
+	var approvalRows []*models.ProcRunApproval
+	if err = db.MysqlEngine.Context(ctx).SQL("select id,status from proc_run_approval where proc_run_node_id=? and round=?", procRunNodeId, round).Find(&approvalRows); err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+		return
+	}
+	for _, row := range approvalRows {
+		if row.Status == models.ApprovalStatusApprove {
+			approveNum++
+		} else if row.Status == models.ApprovalStatusReject {
+			rejectNum++
+		}
+	}
+	return
+}
+
+// CancelProcRunApproval 审批有结果后作废这一轮未投的票
+func CancelProcRunApproval(ctx context.Context, procRunNodeId string, round int) (err error) {
+	if _, err = db.MysqlEngine.Context(ctx).Exec("update proc_run_approval set status=?,updated_time=? where proc_run_node_id=? and round=? and status=?", models.ApprovalStatusCanceled, time.Now(), procRunNodeId, round, models.ApprovalStatusWait); err != nil {
+		err = exterror.Catch(exterror.New().DatabaseExecuteError, err)
+	}
+	return
+}
+
+// ListProcRunApproval 查实例的审批票,可按节点和状态过滤
+func ListProcRunApproval(ctx context.Context, procInsId, procInsNodeId, status string) (result []*models.ProcRunApproval, err error) {
+	baseSql := "select * from proc_run_approval where proc_ins_id=?"
+	queryParam := []interface{}{procInsId}
+	if procInsNodeId != "" {
+		baseSql += " and proc_ins_node_id=?"
+		queryParam = append(queryParam, procInsNodeId)
+	}
+	if status != "" {
+		baseSql += " and status=?"
+		queryParam = append(queryParam, status)
+	}
+	if err = db.MysqlEngine.Context(ctx).SQL(baseSql+" order by round,created_time,id", queryParam...).Find(&result); err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+	}
+	return
+}
+
+// ListUserPendingApproval 查当前用户可以投票的审批票
+func ListUserPendingApproval(ctx context.Context, user string, roles []string) (result []*models.ProcRunApproval, err error) {
+	baseSql := "select * from proc_run_approval where status=? and (delegate_to=? or (ifnull(delegate_to,'')='' and ((approver_type=? and approver=?)"
+	queryParam := []interface{}{models.ApprovalStatusWait, user, models.ApproverTypeUser, user}
+	if len(roles) > 0 {
+		roleFilterSql, roleFilterParam := createListParams(roles, "")
+		baseSql += " or (approver_type=? and approver in (" + roleFilterSql + "))"
+		queryParam = append(append(queryParam, models.ApproverTypeRole), roleFilterParam...)
+	}
+	if err = db.MysqlEngine.Context(ctx).SQL(baseSql+"))) order by created_time", queryParam...).Find(&result); err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+	}
+	return
+}
+
+// ListWaitProcRunApproval 查所有等待投票的审批票,用于提醒和升级
+func ListWaitProcRunApproval(ctx context.Context) (result []*models.ProcRunApproval, err error) {
+	if err = db.MysqlEngine.Context(ctx).SQL("select * from proc_run_approval where status=? order by created_time", models.ApprovalStatusWait).Find(&result); err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+	}
+	return
+}
+
+// VoteProcRunApproval 用户对节点当前轮次投票,同一用户在一轮中只能投一票,优先使用转交给自己的票
+func VoteProcRunApproval(ctx context.Context, procInsId, procInsNodeId, user string, roles []string, param *models.ProcRunApprovalVoteParam) (result *models.ProcRunApproval, err error) {
+	if param.Decision != models.ApprovalStatusApprove && param.Decision != models.ApprovalStatusReject {
+		err = exterror.Catch(exterror.New().RequestParamValidateError, fmt.Errorf("decision:%s illegal", param.Decision))
+		return
+	}
+	roundRows, getErr := listProcInsNodeCurrentApproval(ctx, procInsId, procInsNodeId)
+	if getErr != nil {
+		err = getErr
+		return
+	}
+	for _, row := range roundRows {
+		if row.VotedBy == user {
+			err = exterror.New().ProcRunApprovalError.WithParam(fmt.Sprintf("user %s already voted in this round", user))
+			return
+		}
+	}
+	if result = matchUserApproval(roundRows, user, roles); result == nil {
+		err = exterror.New().ProcRunApprovalError.WithParam(fmt.Sprintf("user %s has no waiting approval on this node", user))
+		return
+	}
+	nowTime := time.Now()
+	execResult, execErr := db.MysqlEngine.Context(ctx).Exec("update proc_run_approval set status=?,comment=?,voted_by=?,updated_time=? where id=? and status=?", param.Decision, param.Comment, user, nowTime, result.Id, models.ApprovalStatusWait)
+	if execErr != nil {
+		// 同时持有用户票和角色票并发投票时,由唯一索引保证一轮只能投一票
+		if isApprovalVoteDuplicateErr(execErr) {
+			err = exterror.New().ProcRunApprovalError.WithParam(fmt.Sprintf("user %s already voted in this round", user))
+			return
+		}
+		err = exterror.Catch(exterror.New().DatabaseExecuteError, execErr)
+		return
+	}
+	if affectNum, _ := execResult.RowsAffected(); affectNum == 0 {
+		err = exterror.New().ProcRunApprovalError.WithParam(fmt.Sprintf("approval %s is not waiting", result.Id))
+		return
+	}
+	result.Status, result.Comment, result.VotedBy, result.UpdatedTime = param.Decision, param.Comment, user, nowTime
+	AddProcInsTimeline(ctx, &models.ProcInsTimeline{ProcInsId: result.ProcInsId, WorkflowId: result.WorkflowId, ProcInsNodeId: result.ProcInsNodeId, ProcRunNodeId: result.ProcRunNodeId, NodeName: result.NodeName, EventType: models.TimelineEventApproval, Status: param.Decision, Message: param.Comment, RefId: result.Id, CreatedBy: user, CreatedTime: nowTime})
+	return
+}
+
+// isApprovalVoteDuplicateErr 同一用户同一轮重复投票时唯一索引冲突
+func isApprovalVoteDuplicateErr(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "Duplicate entry") && strings.Contains(err.Error(), "uk_approval_vote")
+}
+
+// DelegateProcRunApproval 把自己可以投的票转交给其它用户
+func DelegateProcRunApproval(ctx context.Context, procInsId, procInsNodeId, user string, roles []string, param *models.ProcRunApprovalDelegateParam) (result *models.ProcRunApproval, err error) {
+	if param.DelegateTo == "" || param.DelegateTo == user {
+		err = exterror.Catch(exterror.New().RequestParamValidateError, fmt.Errorf("delegateTo:%s illegal", param.DelegateTo))
+		return
+	}
+	roundRows, getErr := listProcInsNodeCurrentApproval(ctx, procInsId, procInsNodeId)
+	if getErr != nil {
+		err = getErr
+		return
+	}
+	for _, row := range roundRows {
+		if row.Id == param.ApprovalId && matchUserApproval([]*models.ProcRunApproval{row}, user, roles) != nil {
+			result = row
+			break
+		}
+	}
+	if result == nil {
+		err = exterror.New().ProcRunApprovalError.WithParam(fmt.Sprintf("user %s can not delegate approval %s", user, param.ApprovalId))
+		return
+	}
+	nowTime := time.Now()
+	execResult, execErr := db.MysqlEngine.Context(ctx).Exec("update proc_run_approval set delegate_to=?,updated_time=? where id=? and status=?", param.DelegateTo, nowTime, result.Id, models.ApprovalStatusWait)
+	if execErr != nil {
+		err = exterror.Catch(exterror.New().DatabaseExecuteError, execErr)
+		return
+	}
+	if affectNum, _ := execResult.RowsAffected(); affectNum == 0 {
+		err = exterror.New().ProcRunApprovalError.WithParam(fmt.Sprintf("approval %s is not waiting", result.Id))
+		return
+	}
+	result.DelegateTo, result.UpdatedTime = param.DelegateTo, nowTime
+	AddProcInsTimeline(ctx, &models.ProcInsTimeline{ProcInsId: result.ProcInsId, WorkflowId: result.WorkflowId, ProcInsNodeId: result.ProcInsNodeId, ProcRunNodeId: result.ProcRunNodeId, NodeName: result.NodeName, EventType: models.TimelineEventApproval, Status: "delegate", Message: strings.TrimSpace("delegate to " + param.DelegateTo + " " + param.Comment), RefId: result.Id, CreatedBy: user, CreatedTime: nowTime})
+	return
+}
+
+// RemindProcRunApproval 抢占提醒时间,多个实例同时扫描时只有一个能抢占成功
+func RemindProcRunApproval(ctx context.Context, row *models.ProcRunApproval, lastRemindBefore time.Time) bool {
+	execResult, err := db.MysqlEngine.Context(ctx).Exec("update proc_run_approval set reminded_time=? where id=? and status=? and (reminded_time is null or reminded_time<?)", time.Now(), row.Id, models.ApprovalStatusWait, lastRemindBefore)
+	if err != nil {
+		return false
+	}
+	affectNum, _ := execResult.RowsAffected()
+	if affectNum > 0 {
+		AddProcInsTimeline(ctx, &models.ProcInsTimeline{ProcInsId: row.ProcInsId, WorkflowId: row.WorkflowId, ProcInsNodeId: row.ProcInsNodeId, ProcRunNodeId: row.ProcRunNodeId, NodeName: row.NodeName, EventType: models.TimelineEventApproval, Status: "remind", Message: approvalTarget(row), RefId: row.Id, CreatedBy: "system"})
+	}
+	return affectNum > 0
+}
+
+// EscalateProcRunApproval 把超时未投的票升级给升级角色,每张票只升级一次,升级时已发送通知所以同时更新提醒时间
+func EscalateProcRunApproval(ctx context.Context, row *models.ProcRunApproval, escalationRole string) bool {
+	escalatedFrom := approvalTarget(row)
+	nowTime := time.Now()
+	execResult, err := db.MysqlEngine.Context(ctx).Exec("update proc_run_approval set approver_type=?,approver=?,delegate_to=null,escalated_from=?,reminded_time=?,updated_time=? where id=? and status=? and ifnull(escalated_from,'')=''",
+		models.ApproverTypeRole, escalationRole, escalatedFrom, nowTime, nowTime, row.Id, models.ApprovalStatusWait)
+	if err != nil {
+		return false
+	}
+	affectNum, _ := execResult.RowsAffected()
+	if affectNum > 0 {
+		AddProcInsTimeline(ctx, &models.ProcInsTimeline{ProcInsId: row.ProcInsId, WorkflowId: row.WorkflowId, ProcInsNodeId: row.ProcInsNodeId, ProcRunNodeId: row.ProcRunNodeId, NodeName: row.NodeName, EventType: models.TimelineEventApproval, Status: "escalate", Message: fmt.Sprintf("%s -> %s:%s", escalatedFrom, models.ApproverTypeRole, escalationRole), RefId: row.Id, CreatedBy: "system"})
+	}
+	return affectNum > 0
+}
+
+// listProcInsNodeCurrentApproval 查实例节点当前轮次的审批票
+func listProcInsNodeCurrentApproval(ctx context.Context, procInsId, procInsNodeId string) (result []*models.ProcRunApproval, err error) {
+	err = db.MysqlEngine.Context(ctx).SQL("select * from proc_run_approval where proc_ins_id=? and proc_ins_node_id=? and round=(select max(round) from proc_run_approval where proc_ins_node_id=?)", procInsId, procInsNodeId, procInsNodeId).Find(&result)
+	if err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+	}
+	return
+}
+
+// matchUserApproval 找用户可以投的票,转交给用户的票优先,其次是指定用户的票,最后是角色的票
+func matchUserApproval(rows []*models.ProcRunApproval, user string, roles []string) *models.ProcRunApproval {
+	roleMap := make(map[string]bool)
+	for _, role := range roles {
+		roleMap[role] = true
+	}
+	var userMatch, roleMatch *models.ProcRunApproval
+	for _, row := range rows {
+		if row.Status != models.ApprovalStatusWait {
+			continue
+		}
+		if row.DelegateTo != "" {
+			if row.DelegateTo == user {
+				return row
+			}
+			continue
+		}
+		if row.ApproverType == models.ApproverTypeUser && row.Approver == user && userMatch == nil {
+			userMatch = row
+		} else if row.ApproverType == models.ApproverTypeRole && roleMap[row.Approver] && roleMatch == nil {
+			roleMatch = row
+		}
+	}
+	if userMatch != nil {
+		return userMatch
+	}
+	return roleMatch
+}
+
+func approvalTarget(row *models.ProcRunApproval) string {
+	if row.DelegateTo != "" {
+		return models.ApproverTypeUser + ":" + row.DelegateTo
+	}
+	return row.ApproverType + ":" + row.Approver
+}
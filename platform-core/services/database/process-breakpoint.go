@@ -0,0 +1,264 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/WeBankPartners/go-common-lib/guid"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/db"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/exterror"
+	"github.com/WeBankPartners/wecube-platform/platform-core/models"
+	"time"
+)
+
+// buildProcBreakpointActions 覆盖某个范围的断点配置
+func buildProcBreakpointActions(scope, procDefId, procInsId string, nodeIds []string, operator string, nowTime time.Time) (actions []*db.ExecAction) {
+	if scope == models.ProcBreakpointScopeInstance {
+		actions = append(actions, &db.ExecAction{Sql: "delete from proc_breakpoint where scope=? and proc_ins_id=?", Param: []interface{}{scope, procInsId}})
+	} else {
+		actions = append(actions, &db.ExecAction{Sql: "delete from proc_breakpoint where scope=? and proc_def_id=?", Param: []interface{}{scope, procDefId}})
+	}
+	existMap := make(map[string]bool)
+	for _, nodeId := range nodeIds {
+		if existMap[nodeId] {
+			continue
+		}
+		existMap[nodeId] = true
+		actions = append(actions, &db.ExecAction{Sql: "insert into proc_breakpoint(id,scope,proc_def_id,proc_ins_id,node_id,created_by,created_time) values (?,?,?,?,?,?,?)", Param: []interface{}{
+			"bp_" + guid.CreateGuid(), scope, procDefId, procInsId, nodeId, operator, nowTime,
+		}})
+	}
+	return
+}
+
+// checkProcBreakpointNodes 校验断点节点是编排定义中的任务节点,实例上允许用*开启单步
+func checkProcBreakpointNodes(ctx context.Context, procDefId string, nodeIds []string, allowAll bool) (err error) {
+	var procDefNodes []*models.ProcDefNode
+	if err = db.MysqlEngine.Context(ctx).SQL("select node_id,node_type from proc_def_node where proc_def_id=?", procDefId).Find(&procDefNodes); err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+		return
+	}
+	nodeTypeMap := make(map[string]string)
+	for _, row := range procDefNodes {
+		nodeTypeMap[row.NodeId] = row.NodeType
+	}
+	for _, nodeId := range nodeIds {
+		if nodeId == models.ProcBreakpointAllNode {
+			if !allowAll {
+				err = exterror.New().ProcBreakpointNodeError.WithParam(nodeId, "step mode can only be set on instance")
+				return
+			}
+			continue
+		}
+		nodeType, ok := nodeTypeMap[nodeId]
+		if !ok {
+			err = exterror.New().ProcBreakpointNodeError.WithParam(nodeId, "can not find node in procDef")
+			return
+		}
+		if !models.IsBreakpointJobType(nodeType) {
+			err = exterror.New().ProcBreakpointNodeError.WithParam(nodeId, fmt.Sprintf("node type %s not support breakpoint", nodeType))
+			return
+		}
+	}
+	return
+}
+
+// buildProcInsBreakpointActions 实例启动时带的断点
+func buildProcInsBreakpointActions(ctx context.Context, procDefId, procInsId string, nodeIds []string, operator string, nowTime time.Time) (actions []*db.ExecAction, err error) {
+	if len(nodeIds) == 0 {
+		return
+	}
+	if err = checkProcBreakpointNodes(ctx, procDefId, nodeIds, true); err != nil {
+		return
+	}
+	actions = buildProcBreakpointActions(models.ProcBreakpointScopeInstance, procDefId, procInsId, nodeIds, operator, nowTime)
+	return
+}
+
+// SetProcDefBreakpoints 设置编排定义上的断点,该定义之后执行的节点都会生效
+func SetProcDefBreakpoints(ctx context.Context, procDefId string, nodeIds []string, operator string) (err error) {
+	if err = checkProcBreakpointNodes(ctx, procDefId, nodeIds, false); err != nil {
+		return
+	}
+	actions := buildProcBreakpointActions(models.ProcBreakpointScopeDefinition, procDefId, "", nodeIds, operator, time.Now())
+	err = db.Transaction(actions, ctx)
+	return
+}
+
+// SetProcInsBreakpoints 设置实例上的断点
+func SetProcInsBreakpoints(ctx context.Context, procInsId string, nodeIds []string, operator string) (err error) {
+	procIns, getErr := GetSimpleProcInsRow(ctx, procInsId)
+	if getErr != nil {
+		err = getErr
+		return
+	}
+	if err = checkProcBreakpointNodes(ctx, procIns.ProcDefId, nodeIds, true); err != nil {
+		return
+	}
+	actions := buildProcBreakpointActions(models.ProcBreakpointScopeInstance, procIns.ProcDefId, procInsId, nodeIds, operator, time.Now())
+	err = db.Transaction(actions, ctx)
+	return
+}
+
+// ListProcBreakpoint 查断点配置,传实例id时同时返回实例所属定义上的断点
+func ListProcBreakpoint(ctx context.Context, procDefId, procInsId string) (result []*models.ProcBreakpoint, err error) {
+	baseSql := "select * from proc_breakpoint where scope=? and proc_def_id=?"
+	queryParam := []interface{}{models.ProcBreakpointScopeDefinition, procDefId}
+	if procInsId != "" {
+		baseSql = "select * from proc_breakpoint where (scope=? and proc_def_id=?) or (scope=? and proc_ins_id=?)"
+		queryParam = append(queryParam, models.ProcBreakpointScopeInstance, procInsId)
+	}
+	if err = db.MysqlEngine.Context(ctx).SQL(baseSql+" order by created_time", queryParam...).Find(&result); err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+	}
+	return
+}
+
+// MatchProcBreakpoint 实例节点开始前检查是否命中断点
+func MatchProcBreakpoint(ctx context.Context, procInsNodeId string) (match bool, err error) {
+	queryRows, queryErr := db.MysqlEngine.Context(ctx).QueryString("select count(1) as num from proc_breakpoint t1 join proc_ins_node t2 on t2.id=? join proc_def_node t3 on t3.id=t2.proc_def_node_id join proc_ins t4 on t4.id=t2.proc_ins_id "+
+		"where (t1.scope=? and t1.proc_ins_id=t4.id and t1.node_id in (t3.node_id,?)) or (t1.scope=? and t1.proc_def_id=t4.proc_def_id and t1.node_id=t3.node_id)",
+		procInsNodeId, models.ProcBreakpointScopeInstance, models.ProcBreakpointAllNode, models.ProcBreakpointScopeDefinition)
+	if queryErr != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, queryErr)
+		return
+	}
+	if len(queryRows) > 0 && queryRows[0]["num"] != "0" {
+		match = true
+	}
+	return
+}
+
+// CreateProcRunBreakpoint 纪录节点命中断点
+func CreateProcRunBreakpoint(ctx context.Context, hitRow *models.ProcRunBreakpoint) (err error) {
+	hitRow.Id = "bph_" + guid.CreateGuid()
+	hitRow.Status = models.BreakpointHitStatusWait
+	hitRow.CreatedTime = time.Now()
+	var actions []*db.ExecAction
+	actions = append(actions, &db.ExecAction{Sql: "insert into proc_run_breakpoint(id,workflow_id,proc_ins_id,proc_ins_node_id,proc_run_node_id,node_name,job_type,status,created_time) values (?,?,?,?,?,?,?,?,?)", Param: []interface{}{
+		hitRow.Id, hitRow.WorkflowId, hitRow.ProcInsId, hitRow.ProcInsNodeId, hitRow.ProcRunNodeId, hitRow.NodeName, hitRow.JobType, hitRow.Status, hitRow.CreatedTime,
+	}})
+	if err = db.Transaction(actions, ctx); err != nil {
+		return
+	}
+	AddProcInsTimeline(ctx, &models.ProcInsTimeline{ProcInsId: hitRow.ProcInsId, WorkflowId: hitRow.WorkflowId, ProcInsNodeId: hitRow.ProcInsNodeId, ProcRunNodeId: hitRow.ProcRunNodeId, NodeName: hitRow.NodeName, EventType: models.TimelineEventBreakpoint, Status: hitRow.Status, RefId: hitRow.Id, CreatedBy: "system", CreatedTime: hitRow.CreatedTime})
+	return
+}
+
+func GetProcRunBreakpoint(ctx context.Context, breakpointId string) (result *models.ProcRunBreakpoint, err error) {
+	var hitRows []*models.ProcRunBreakpoint
+	if err = db.MysqlEngine.Context(ctx).SQL("select * from proc_run_breakpoint where id=?", breakpointId).Find(&hitRows); err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+		return
+	}
+	if len(hitRows) == 0 {
+		err = exterror.Catch(exterror.New().DatabaseQueryEmptyError, fmt.Errorf("can not find breakpoint with id:%s", breakpointId))
+		return
+	}
+	result = hitRows[0]
+	return
+}
+
+// GetLastProcRunBreakpoint 查工作流节点最近一次命中的断点,没有时返回nil
+func GetLastProcRunBreakpoint(ctx context.Context, procRunNodeId string) (result *models.ProcRunBreakpoint, err error) {
+	var hitRows []*models.ProcRunBreakpoint
+	if err = db.MysqlEngine.Context(ctx).SQL("select * from proc_run_breakpoint where proc_run_node_id=? order by created_time desc limit 1", procRunNodeId).Find(&hitRows); err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+		return
+	}
+	if len(hitRows) > 0 {
+		result = hitRows[0]
+	}
+	return
+}
+
+// ListProcRunBreakpoint 查实例命中断点的纪录
+func ListProcRunBreakpoint(ctx context.Context, procInsId, status string) (result []*models.ProcRunBreakpoint, err error) {
+	baseSql := "select * from proc_run_breakpoint where proc_ins_id=?"
+	queryParam := []interface{}{procInsId}
+	if status != "" {
+		baseSql += " and status=?"
+		queryParam = append(queryParam, status)
+	}
+	if err = db.MysqlEngine.Context(ctx).SQL(baseSql+" order by created_time", queryParam...).Find(&result); err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+	}
+	return
+}
+
+// ResumeProcRunBreakpoint 单步或继续暂停中的断点,单步时打开实例的单步模式,继续时关闭
+func ResumeProcRunBreakpoint(ctx context.Context, breakpointId string, param *models.ProcRunBreakpointResumeParam, operator string) (result *models.ProcRunBreakpoint, err error) {
+	if param.Action != models.BreakpointHitStatusStep && param.Action != models.BreakpointHitStatusContinue {
+		err = exterror.Catch(exterror.New().RequestParamValidateError, fmt.Errorf("action:%s illegal", param.Action))
+		return
+	}
+	if result, err = GetProcRunBreakpoint(ctx, breakpointId); err != nil {
+		return
+	}
+	inputOverride := ""
+	if len(param.InputOverride) > 0 {
+		overrideBytes, _ := json.Marshal(param.InputOverride)
+		inputOverride = string(overrideBytes)
+	}
+	nowTime := time.Now()
+	execResult, execErr := db.MysqlEngine.Context(ctx).Exec("update proc_run_breakpoint set status=?,input_override=?,updated_by=?,updated_time=? where id=? and status=?", param.Action, inputOverride, operator, nowTime, breakpointId, models.BreakpointHitStatusWait)
+	if execErr != nil {
+		err = exterror.Catch(exterror.New().DatabaseExecuteError, execErr)
+		return
+	}
+	if affectNum, _ := execResult.RowsAffected(); affectNum == 0 {
+		err = exterror.New().ProcRunBreakpointStatusError.WithParam(breakpointId, result.Status)
+		return
+	}
+	var actions []*db.ExecAction
+	actions = append(actions, &db.ExecAction{Sql: "delete from proc_breakpoint where scope=? and proc_ins_id=? and node_id=?", Param: []interface{}{models.ProcBreakpointScopeInstance, result.ProcInsId, models.ProcBreakpointAllNode}})
+	if param.Action == models.BreakpointHitStatusStep {
+		actions = append(actions, &db.ExecAction{Sql: "insert into proc_breakpoint(id,scope,proc_def_id,proc_ins_id,node_id,created_by,created_time) select ?,?,proc_def_id,id,?,?,? from proc_ins where id=?", Param: []interface{}{
+			"bp_" + guid.CreateGuid(), models.ProcBreakpointScopeInstance, models.ProcBreakpointAllNode, operator, nowTime, result.ProcInsId,
+		}})
+	}
+	if err = db.Transaction(actions, ctx); err != nil {
+		return
+	}
+	AddProcInsTimeline(ctx, &models.ProcInsTimeline{ProcInsId: result.ProcInsId, WorkflowId: result.WorkflowId, ProcInsNodeId: result.ProcInsNodeId, ProcRunNodeId: result.ProcRunNodeId, NodeName: result.NodeName, EventType: models.TimelineEventBreakpoint, Status: param.Action, Message: inputOverride, RefId: result.Id, CreatedBy: operator, CreatedTime: nowTime})
+	result, err = GetProcRunBreakpoint(ctx, breakpointId)
+	return
+}
+
+// GetProcRunBreakpointInputOverride 查节点最近一次断点放行时修改的入参
+func GetProcRunBreakpointInputOverride(ctx context.Context, procInsNodeId string) (result map[string]map[string]interface{}, err error) {
+	var hitRows []*models.ProcRunBreakpoint
+	if err = db.MysqlEngine.Context(ctx).SQL("select id,status,input_override from proc_run_breakpoint where proc_ins_node_id=? order by created_time desc limit 1", procInsNodeId).Find(&hitRows); err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+		return
+	}
+	if len(hitRows) == 0 || hitRows[0].Status == models.BreakpointHitStatusWait || hitRows[0].InputOverride == "" {
+		return
+	}
+	if err = json.Unmarshal([]byte(hitRows[0].InputOverride), &result); err != nil {
+		err = fmt.Errorf("json unmarshal breakpoint %s input override fail,%s ", hitRows[0].Id, err.Error())
+	}
+	return
+}
+
+// UpdateProcDataCache 实例暂停在断点时修改数据缓存的值
+func UpdateProcDataCache(ctx context.Context, procInsId string, param *models.ProcDataCacheUpdateParam) (err error) {
+	waitRows, getErr := ListProcRunBreakpoint(ctx, procInsId, models.BreakpointHitStatusWait)
+	if getErr != nil {
+		err = getErr
+		return
+	}
+	if len(waitRows) == 0 {
+		err = exterror.Catch(exterror.New().RequestParamValidateError, fmt.Errorf("data cache can only be updated when process instance paused at breakpoint"))
+		return
+	}
+	execResult, execErr := db.MysqlEngine.Context(ctx).Exec("update proc_data_cache set data_value=?,updated_time=? where id=? and proc_ins_id=?", param.DataValue, time.Now(), param.Id, procInsId)
+	if execErr != nil {
+		err = exterror.Catch(exterror.New().DatabaseExecuteError, execErr)
+		return
+	}
+	if affectNum, _ := execResult.RowsAffected(); affectNum == 0 {
+		err = exterror.Catch(exterror.New().DatabaseQueryEmptyError, fmt.Errorf("can not find data cache with id:%s", param.Id))
+	}
+	return
+}
@@ -0,0 +1,226 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/WeBankPartners/go-common-lib/guid"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/db"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/exterror"
+	"github.com/WeBankPartners/wecube-platform/platform-core/models"
+	"strings"
+	"time"
+)
+
+var likeEscapeReplacer = strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_")
+
+// ListProcInsBulkTarget 按筛选条件查批量操作的目标实例(节点),除审批外只取用户有使用权限的编排实例
+func ListProcInsBulkTarget(ctx context.Context, param *models.ProcInsBulkParam, roles []string) (result []*models.ProcInsBulkResult, err error) {
+	result = []*models.ProcInsBulkResult{}
+	filter := param.Filter
+	var filterSql string
+	var queryParam []interface{}
+	filterSql += " and t1.status=? and t1.id not in (select proc_ins_id from proc_ins_simulation)"
+	queryParam = append(queryParam, param.GetProcInsStatus())
+	if filter.ProcDefId != "" {
+		filterSql += " and t1.proc_def_id=?"
+		queryParam = append(queryParam, filter.ProcDefId)
+	}
+	if filter.ProcDefKey != "" {
+		filterSql += " and t1.proc_def_key=?"
+		queryParam = append(queryParam, filter.ProcDefKey)
+	}
+	if len(filter.ProcInsIdList) > 0 {
+		insFilterSql, insFilterParam := db.CreateListParams(filter.ProcInsIdList, "")
+		filterSql += " and t1.id in (" + insFilterSql + ")"
+		queryParam = append(queryParam, insFilterParam...)
+	}
+	if filter.StartTime != "" {
+		filterSql += " and t1.created_time>=?"
+		queryParam = append(queryParam, filter.StartTime)
+	}
+	if filter.EndTime != "" {
+		filterSql += " and t1.created_time<=?"
+		queryParam = append(queryParam, filter.EndTime)
+	}
+	if param.Action != models.ProcInsBulkActionApprove {
+		if len(roles) == 0 {
+			return
+		}
+		roleFilterSql, roleFilterParam := db.CreateListParams(roles, "")
+		filterSql += " and t1.proc_def_id in (select proc_def_id from proc_def_permission where permission='USE' and role_id in (" + roleFilterSql + "))"
+		queryParam = append(queryParam, roleFilterParam...)
+	}
+	var nodeFilterSql string
+	var nodeQueryParam []interface{}
+	switch param.Action {
+	case models.ProcInsBulkActionRetry:
+		nodeFilterSql += " and t2.status in (?,?)"
+		nodeQueryParam = append(nodeQueryParam, models.JobStatusFail, models.JobStatusTimeout)
+	case models.ProcInsBulkActionIgnoreRisky:
+		nodeFilterSql += " and t2.status=?"
+		nodeQueryParam = append(nodeQueryParam, models.JobStatusRisky)
+	case models.ProcInsBulkActionApprove:
+		nodeFilterSql += " and t2.id in (select proc_ins_node_id from proc_run_approval where status=?)"
+		nodeQueryParam = append(nodeQueryParam, models.ApprovalStatusWait)
+	}
+	if filter.NodeName != "" {
+		nodeFilterSql += " and t2.name=?"
+		nodeQueryParam = append(nodeQueryParam, filter.NodeName)
+	}
+	if filter.ErrorPattern != "" {
+		nodeFilterSql += " and t2.error_msg like ?"
+		nodeQueryParam = append(nodeQueryParam, "%"+likeEscapeReplacer.Replace(filter.ErrorPattern)+"%")
+	}
+	var baseSql string
+	if param.IsNodeAction() {
+		baseSql = "select t1.id as proc_ins_id,t1.proc_def_name,t1.entity_data_name,t2.id as proc_ins_node_id,t2.name as node_name,t2.node_type from proc_ins t1 join proc_ins_node t2 on t1.id=t2.proc_ins_id where 1=1" +
+			filterSql + nodeFilterSql + " order by t1.created_time,t2.ordered_no"
+		queryParam = append(queryParam, nodeQueryParam...)
+	} else {
+		baseSql = "select t1.id as proc_ins_id,t1.proc_def_name,t1.entity_data_name from proc_ins t1 where 1=1" + filterSql
+		// 实例级操作按节点名称和报错信息筛选有该节点报错的实例
+		if nodeFilterSql != "" {
+			baseSql += " and exists (select 1 from proc_ins_node t2 where t2.proc_ins_id=t1.id" + nodeFilterSql + ")"
+			queryParam = append(queryParam, nodeQueryParam...)
+		}
+		baseSql += " order by t1.created_time"
+	}
+	baseSql += fmt.Sprintf(" limit %d", models.ProcInsBulkMaxNum+1)
+	if err = db.MysqlEngine.Context(ctx).SQL(baseSql, queryParam...).Find(&result); err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+		return
+	}
+	if len(result) > models.ProcInsBulkMaxNum {
+		err = exterror.New().ProcInsBulkError.WithParam(fmt.Sprintf("matched targets more than %d,please narrow the filter", models.ProcInsBulkMaxNum))
+	}
+	return
+}
+
+// CreateProcInsBulkJob 创建批量任务和每个目标的待执行纪录
+func CreateProcInsBulkJob(ctx context.Context, param *models.ProcInsBulkParam, targets []*models.ProcInsBulkResult, operator string, roles []string) (job *models.ProcInsBulkJob, err error) {
+	if len(targets) == 0 {
+		err = exterror.New().ProcInsBulkError.WithParam("no instance matched the filter")
+		return
+	}
+	filterBytes, _ := json.Marshal(param.Filter)
+	nowTime := time.Now()
+	job = &models.ProcInsBulkJob{Id: "pbulk_" + guid.CreateGuid(), Action: param.Action, Filter: string(filterBytes), Message: param.Message, Status: models.ProcInsBulkStatusRunning,
+		TotalNum: len(targets), Roles: strings.Join(roles, ","), CreatedBy: operator, CreatedTime: nowTime, UpdatedTime: nowTime}
+	var actions []*db.ExecAction
+	actions = append(actions, &db.ExecAction{Sql: "insert into proc_ins_bulk_job(id,action,filter,message,status,total_num,success_num,fail_num,skip_num,roles,created_by,created_time,updated_time) values (?,?,?,?,?,?,0,0,0,?,?,?,?)", Param: []interface{}{
+		job.Id, job.Action, job.Filter, job.Message, job.Status, job.TotalNum, job.Roles, job.CreatedBy, job.CreatedTime, job.UpdatedTime,
+	}})
+	for _, row := range targets {
+		actions = append(actions, &db.ExecAction{Sql: "insert into proc_ins_bulk_result(job_id,proc_ins_id,proc_def_name,entity_data_name,proc_ins_node_id,node_name,node_type,status,updated_time) values (?,?,?,?,?,?,?,?,?)", Param: []interface{}{
+			job.Id, row.ProcInsId, row.ProcDefName, row.EntityDataName, row.ProcInsNodeId, row.NodeName, row.NodeType, models.ProcInsBulkResultWait, nowTime,
+		}})
+	}
+	if err = db.Transaction(actions, ctx); err != nil {
+		err = exterror.Catch(exterror.New().DatabaseExecuteError, err)
+	}
+	return
+}
+
+func GetProcInsBulkJob(ctx context.Context, jobId string) (result *models.ProcInsBulkJob, err error) {
+	var jobRows []*models.ProcInsBulkJob
+	if err = db.MysqlEngine.Context(ctx).SQL("select * from proc_ins_bulk_job where id=?", jobId).Find(&jobRows); err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+		return
+	}
+	if len(jobRows) == 0 {
+		err = exterror.Catch(exterror.New().DatabaseQueryEmptyError, fmt.Errorf("can not find bulk job:%s", jobId))
+		return
+	}
+	result = jobRows[0]
+	return
+}
+
+// GetProcInsBulkDetail 查批量任务进度和每个目标的结果,status不为空时只返回该状态的结果
+func GetProcInsBulkDetail(ctx context.Context, jobId, status string) (result *models.ProcInsBulkDetail, err error) {
+	jobRow, getErr := GetProcInsBulkJob(ctx, jobId)
+	if getErr != nil {
+		err = getErr
+		return
+	}
+	result = &models.ProcInsBulkDetail{ProcInsBulkJob: jobRow, Results: []*models.ProcInsBulkResult{}}
+	baseSql := "select * from proc_ins_bulk_result where job_id=?"
+	queryParam := []interface{}{jobId}
+	if status != "" {
+		baseSql += " and status=?"
+		queryParam = append(queryParam, status)
+	}
+	if err = db.MysqlEngine.Context(ctx).SQL(baseSql+" order by id", queryParam...).Find(&result.Results); err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+	}
+	return
+}
+
+// ListProcInsBulkJob 查最近的批量任务
+func ListProcInsBulkJob(ctx context.Context, createdBy string) (result []*models.ProcInsBulkJob, err error) {
+	result = []*models.ProcInsBulkJob{}
+	baseSql := "select * from proc_ins_bulk_job where 1=1"
+	var queryParam []interface{}
+	if createdBy != "" {
+		baseSql += " and created_by=?"
+		queryParam = append(queryParam, createdBy)
+	}
+	if err = db.MysqlEngine.Context(ctx).SQL(baseSql+" order by created_time desc limit 100", queryParam...).Find(&result); err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+	}
+	return
+}
+
+func ListWaitProcInsBulkResult(ctx context.Context, jobId string) (result []*models.ProcInsBulkResult, err error) {
+	if err = db.MysqlEngine.Context(ctx).SQL("select * from proc_ins_bulk_result where job_id=? and status=? order by id", jobId, models.ProcInsBulkResultWait).Find(&result); err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+	}
+	return
+}
+
+// UpdateProcInsBulkResult 记录单个目标的结果并累加任务进度
+func UpdateProcInsBulkResult(ctx context.Context, row *models.ProcInsBulkResult) (err error) {
+	var counterColumn string
+	switch row.Status {
+	case models.ProcInsBulkResultSuccess:
+		counterColumn = "success_num"
+	case models.ProcInsBulkResultFail:
+		counterColumn = "fail_num"
+	default:
+		counterColumn = "skip_num"
+	}
+	nowTime := time.Now()
+	var actions []*db.ExecAction
+	actions = append(actions, &db.ExecAction{Sql: "update proc_ins_bulk_result set status=?,message=?,updated_time=? where id=? and status=?", Param: []interface{}{row.Status, row.Message, nowTime, row.Id, models.ProcInsBulkResultWait}, CheckAffectRow: true})
+	actions = append(actions, &db.ExecAction{Sql: "update proc_ins_bulk_job set " + counterColumn + "=" + counterColumn + "+1,updated_time=? where id=?", Param: []interface{}{nowTime, row.JobId}})
+	if err = db.Transaction(actions, ctx); err != nil {
+		err = exterror.Catch(exterror.New().DatabaseExecuteError, err)
+	}
+	return
+}
+
+func FinishProcInsBulkJob(ctx context.Context, jobId string) (err error) {
+	if _, err = db.MysqlEngine.Context(ctx).Exec("update proc_ins_bulk_job set status=?,updated_time=? where id=?", models.ProcInsBulkStatusDone, time.Now(), jobId); err != nil {
+		err = exterror.Catch(exterror.New().DatabaseExecuteError, err)
+	}
+	return
+}
+
+// ListStalledProcInsBulkJob 查执行中但长时间没有进度的任务,一般是执行的节点重启了
+func ListStalledProcInsBulkJob(ctx context.Context) (result []*models.ProcInsBulkJob, err error) {
+	if err = db.MysqlEngine.Context(ctx).SQL("select * from proc_ins_bulk_job where status=? and updated_time<?", models.ProcInsBulkStatusRunning,
+		time.Now().Add(-1*models.ProcInsBulkStallSeconds*time.Second)).Find(&result); err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+	}
+	return
+}
+
+// ClaimStalledProcInsBulkJob 抢占中断的任务,只有一个节点能抢到
+func ClaimStalledProcInsBulkJob(ctx context.Context, job *models.ProcInsBulkJob) bool {
+	execResult, err := db.MysqlEngine.Context(ctx).Exec("update proc_ins_bulk_job set updated_time=? where id=? and status=? and updated_time=?", time.Now(), job.Id, models.ProcInsBulkStatusRunning, job.UpdatedTime)
+	if err != nil {
+		return false
+	}
+	affectNum, _ := execResult.RowsAffected()
+	return affectNum > 0
+}
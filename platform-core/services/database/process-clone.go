@@ -0,0 +1,380 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"github.com/WeBankPartners/go-common-lib/guid"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/db"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/exterror"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/log"
+	"github.com/WeBankPartners/wecube-platform/platform-core/models"
+	"strings"
+	"time"
+)
+
+// CloneProcInstance 从源实例的指定节点重新运行为新实例
+// 复制根数据、数据绑定和数据缓存,开始节点之前的任务节点复用源实例的执行结果(源实例中未成功的直接跳过),从开始节点继续执行
+// 不在开始节点上游也不在其下游的节点(如并行分支里其它分支的节点)在源实例中成功的同样复用,未成功的重新执行
+func CloneProcInstance(ctx context.Context, sourceProcInsId string, param *models.ProcInsCloneParam, operator string) (cloneRow *models.ProcInsClone, workflowRow *models.ProcRunWorkflow, workNodes []*models.ProcRunNode, workLinks []*models.ProcRunLink, err error) {
+	sourceIns, getInsErr := GetSimpleProcInsRow(ctx, sourceProcInsId)
+	if getInsErr != nil {
+		err = getInsErr
+		return
+	}
+	if err = checkProcInsCloneSource(ctx, sourceIns); err != nil {
+		return
+	}
+	if err = CheckProcDefStatus(ctx, sourceIns.ProcDefId); err != nil {
+		return
+	}
+	procDefObj, getProcDefErr := GetSimpleProcDefRow(ctx, sourceIns.ProcDefId)
+	if getProcDefErr != nil {
+		err = getProcDefErr
+		return
+	}
+	var sourceInsNodes []*models.ProcInsNode
+	err = db.MysqlEngine.Context(ctx).SQL("select id,proc_ins_id,proc_def_node_id,name,node_type,status from proc_ins_node where proc_ins_id=?", sourceProcInsId).Find(&sourceInsNodes)
+	if err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+		return
+	}
+	var sourceRunNodes []*models.ProcRunNode
+	err = db.MysqlEngine.Context(ctx).SQL("select * from proc_run_node where proc_ins_node_id in (select id from proc_ins_node where proc_ins_id=?)", sourceProcInsId).Find(&sourceRunNodes)
+	if err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+		return
+	}
+	var startInsNode *models.ProcInsNode
+	sourceInsNodeMap := make(map[string]*models.ProcInsNode)
+	for _, row := range sourceInsNodes {
+		sourceInsNodeMap[row.ProcDefNodeId] = row
+		if row.Id == param.ProcInsNodeId {
+			startInsNode = row
+		}
+	}
+	if startInsNode == nil {
+		err = exterror.New().ProcInsCloneError.WithParam(fmt.Sprintf("can not find node %s in process instance %s", param.ProcInsNodeId, sourceProcInsId))
+		return
+	}
+	if startInsNode.NodeType == models.JobStartType {
+		err = exterror.New().ProcInsCloneError.WithParam("can not re-run from start node,please start a new instance")
+		return
+	}
+	sourceRunNodeMap := make(map[string]*models.ProcRunNode)
+	for _, row := range sourceRunNodes {
+		sourceRunNodeMap[row.ProcInsNodeId] = row
+	}
+	var procDefNodes []*models.ProcDefNode
+	err = db.MysqlEngine.Context(ctx).SQL("select id,node_id,proc_def_id,name,description,status,node_type,service_name,dynamic_bind,bind_node_id,risk_check,routine_expression,context_param_nodes,timeout,ordered_no,time_config from proc_def_node where proc_def_id=? order by ordered_no", procDefObj.Id).Find(&procDefNodes)
+	if err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+		return
+	}
+	var procDefLinks []*models.ProcDefNodeLink
+	err = db.MysqlEngine.Context(ctx).SQL("select id,link_id,proc_def_id,source,target,name from proc_def_node_link where proc_def_id=?", procDefObj.Id).Find(&procDefLinks)
+	if err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+		return
+	}
+	var sourceBindings []*models.ProcDataBinding
+	err = db.MysqlEngine.Context(ctx).SQL("select * from proc_data_binding where proc_ins_id=?", sourceProcInsId).Find(&sourceBindings)
+	if err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+		return
+	}
+	var sourceCaches []*models.ProcDataCache
+	err = db.MysqlEngine.Context(ctx).SQL("select * from proc_data_cache where proc_ins_id=?", sourceProcInsId).Find(&sourceCaches)
+	if err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+		return
+	}
+	var sourceVariables []*models.ProcInsVariable
+	err = db.MysqlEngine.Context(ctx).SQL("select * from proc_ins_variable where proc_ins_id=?", sourceProcInsId).Find(&sourceVariables)
+	if err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+		return
+	}
+	procInsId := "pins_" + guid.CreateGuid()
+	nowTime := time.Now()
+	var actions []*db.ExecAction
+	actions = append(actions, &db.ExecAction{Sql: "insert into proc_ins(id,proc_def_id,proc_def_key,proc_def_name,status,entity_data_id,entity_type_id,entity_data_name,proc_session_id,created_by,created_time,updated_by,updated_time,request_info) values (?,?,?,?,?,?,?,?,?,?,?,?,?,?)", Param: []interface{}{
+		procInsId, procDefObj.Id, procDefObj.Key, procDefObj.Name, models.JobStatusReady, sourceIns.EntityDataId, sourceIns.EntityTypeId, sourceIns.EntityDataName, sourceIns.ProcSessionId, operator, nowTime, operator, nowTime, sourceIns.RequestInfo,
+	}})
+	workflowRow = &models.ProcRunWorkflow{Id: "wf_" + guid.CreateGuid(), ProcInsId: procInsId, Name: procDefObj.Name, Status: models.JobStatusReady, CreatedTime: nowTime}
+	// 并发控制和数据冲突检测与正常启动一致
+	queued, queueUnlock, checkQueueErr := checkProcInsNeedQueue(ctx, procDefObj, sourceIns.EntityDataId)
+	if checkQueueErr != nil {
+		err = checkQueueErr
+		return
+	}
+	defer queueUnlock()
+	if queued {
+		workflowRow.Status = models.JobStatusQueued
+		actions = append(actions, buildProcInsQueueActions(procDefObj, &models.ProcInsStartParam{}, procInsId, workflowRow.Id, sourceIns.EntityDataId, operator, nowTime)...)
+	}
+	var lockRows []*models.ProcEntityLock
+	if procDefObj.ConflictCheck {
+		var previewRows []*models.ProcDataPreview
+		for _, row := range sourceBindings {
+			previewRows = append(previewRows, &models.ProcDataPreview{EntityTypeId: row.EntityTypeId, EntityDataId: row.EntityDataId, EntityDataName: row.EntityDataName, IsBound: row.BindFlag})
+		}
+		var lockActions []*db.ExecAction
+		var buildLockErr error
+		lockRows, _, lockActions, buildLockErr = buildProcInsEntityLockActions(ctx, procDefObj, &models.ProcInsStartParam{}, previewRows, procInsId, sourceIns.EntityDataId, workflowRow, operator, nowTime)
+		if buildLockErr != nil {
+			err = buildLockErr
+			return
+		}
+		actions = append(actions, lockActions...)
+	}
+	actions = append(actions, &db.ExecAction{Sql: "insert into proc_run_workflow(id,proc_ins_id,name,status,created_time) values (?,?,?,?,?)", Param: []interface{}{
+		workflowRow.Id, workflowRow.ProcInsId, workflowRow.Name, workflowRow.Status, workflowRow.CreatedTime,
+	}})
+	ancestorMap := models.GetProcDefNodeAncestors(procDefLinks, startInsNode.ProcDefNodeId)
+	descendantMap := models.GetProcDefNodeDescendants(procDefLinks, startInsNode.ProcDefNodeId)
+	cloneRow = &models.ProcInsClone{Id: "pins_clone_" + guid.CreateGuid(), ProcInsId: procInsId, SourceProcInsId: sourceProcInsId, StartProcDefNodeId: startInsNode.ProcDefNodeId, StartNodeName: startInsNode.Name, CreatedBy: operator, CreatedTime: nowTime}
+	var reusedNodes, skippedNodes []string
+	var reusedSourceInsNodeIds []string
+	insNodeIdMap := make(map[string]string)
+	workNodeIdMap := make(map[string]string)
+	for _, node := range procDefNodes {
+		if node.NodeType != "automatic" && node.NodeType != "data" {
+			node.Timeout = 0
+		}
+		tmpProcInsNodeId := "pins_node_" + guid.CreateGuid()
+		workNodeObj := models.ProcRunNode{Id: "wn_" + guid.CreateGuid(), WorkflowId: workflowRow.Id, ProcInsNodeId: tmpProcInsNodeId, Name: node.Name, JobType: node.NodeType, Status: models.JobStatusReady, Timeout: node.Timeout, CreatedTime: nowTime}
+		if node.NodeType == models.JobTimeType || node.NodeType == models.JobDateType || node.NodeType == models.JobSignalType {
+			workNodeObj.Input = node.TimeConfig
+		}
+		var sourceRunNode *models.ProcRunNode
+		// 与开始节点并行的分支,汇聚到开始节点下游时不需要重新执行
+		parallelFlag := !ancestorMap[node.Id] && !descendantMap[node.Id] && node.Id != startInsNode.ProcDefNodeId
+		if sourceInsNode, ok := sourceInsNodeMap[node.Id]; ok {
+			insNodeIdMap[sourceInsNode.Id] = tmpProcInsNodeId
+			sourceRunNode = sourceRunNodeMap[sourceInsNode.Id]
+			if (ancestorMap[node.Id] || parallelFlag) && models.IsProcInsCloneReplayNode(node.NodeType) && sourceRunNode != nil && sourceRunNode.Status == models.JobStatusSuccess {
+				reusedSourceInsNodeIds = append(reusedSourceInsNodeIds, sourceInsNode.Id)
+			}
+		}
+		if parallelFlag && sourceRunNode != nil {
+			if models.IsProcInsCloneReplayNode(node.NodeType) && sourceRunNode.Status == models.JobStatusSuccess {
+				workNodeObj.Status = models.JobStatusSuccess
+				workNodeObj.StartTime, workNodeObj.EndTime = nowTime, nowTime
+				workNodeObj.Input, workNodeObj.Output = sourceRunNode.Input, sourceRunNode.Output
+				reusedNodes = append(reusedNodes, node.Name)
+			} else if node.NodeType == models.JobDecisionType {
+				// 并行分支里的判断节点沿用源实例的选择
+				workNodeObj.Input = sourceRunNode.Input
+			}
+		} else if ancestorMap[node.Id] {
+			if models.IsProcInsCloneReplayNode(node.NodeType) {
+				workNodeObj.Status = models.JobStatusSuccess
+				workNodeObj.StartTime, workNodeObj.EndTime = nowTime, nowTime
+				if sourceRunNode != nil && sourceRunNode.Status == models.JobStatusSuccess {
+					workNodeObj.Input, workNodeObj.Output = sourceRunNode.Input, sourceRunNode.Output
+					reusedNodes = append(reusedNodes, node.Name)
+				} else {
+					skippedNodes = append(skippedNodes, node.Name)
+				}
+			} else if node.NodeType == models.JobDecisionType {
+				// 判断节点重新流转,选择通往开始节点的分支,有多个分支能到达时沿用源实例的选择
+				workNodeObj.Input = getProcInsCloneDecisionBranch(procDefLinks, node.Id, startInsNode.ProcDefNodeId, ancestorMap)
+				if workNodeObj.Input == "" && sourceRunNode != nil {
+					workNodeObj.Input = sourceRunNode.Input
+				}
+			}
+		}
+		actions = append(actions, &db.ExecAction{Sql: "insert into proc_ins_node(id,proc_ins_id,proc_def_node_id,name,node_type,status,ordered_no,created_by,created_time) values (?,?,?,?,?,?,?,?,?)", Param: []interface{}{
+			tmpProcInsNodeId, procInsId, node.Id, node.Name, node.NodeType, workNodeObj.Status, node.OrderedNo, operator, nowTime,
+		}})
+		if workNodeObj.Status == models.JobStatusSuccess {
+			actions = append(actions, &db.ExecAction{Sql: "insert into proc_run_node(id,workflow_id,proc_ins_node_id,name,job_type,status,timeout,input,output,start_time,end_time,created_time) values (?,?,?,?,?,?,?,?,?,?,?,?)", Param: []interface{}{
+				workNodeObj.Id, workNodeObj.WorkflowId, workNodeObj.ProcInsNodeId, workNodeObj.Name, workNodeObj.JobType, workNodeObj.Status, workNodeObj.Timeout, workNodeObj.Input, workNodeObj.Output, workNodeObj.StartTime, workNodeObj.EndTime, workNodeObj.CreatedTime,
+			}})
+		} else {
+			actions = append(actions, &db.ExecAction{Sql: "insert into proc_run_node(id,workflow_id,proc_ins_node_id,name,job_type,status,timeout,input,created_time) values (?,?,?,?,?,?,?,?,?)", Param: []interface{}{
+				workNodeObj.Id, workNodeObj.WorkflowId, workNodeObj.ProcInsNodeId, workNodeObj.Name, workNodeObj.JobType, workNodeObj.Status, workNodeObj.Timeout, workNodeObj.Input, workNodeObj.CreatedTime,
+			}})
+		}
+		workNodeIdMap[node.Id] = workNodeObj.Id
+		workNodes = append(workNodes, &workNodeObj)
+	}
+	cloneRow.ReusedNodes = strings.Join(reusedNodes, ",")
+	cloneRow.SkippedNodes = strings.Join(skippedNodes, ",")
+	actions = append(actions, &db.ExecAction{Sql: "insert into proc_ins_clone(id,proc_ins_id,source_proc_ins_id,start_proc_def_node_id,start_node_name,reused_nodes,skipped_nodes,created_by,created_time) values (?,?,?,?,?,?,?,?,?)", Param: []interface{}{
+		cloneRow.Id, cloneRow.ProcInsId, cloneRow.SourceProcInsId, cloneRow.StartProcDefNodeId, cloneRow.StartNodeName, cloneRow.ReusedNodes, cloneRow.SkippedNodes, cloneRow.CreatedBy, cloneRow.CreatedTime,
+	}})
+	reqActions, buildReqErr := buildProcInsCloneReqActions(ctx, reusedSourceInsNodeIds, insNodeIdMap)
+	if buildReqErr != nil {
+		err = buildReqErr
+		return
+	}
+	actions = append(actions, reqActions...)
+	reusedInsNodeMap := make(map[string]bool)
+	for _, v := range reusedSourceInsNodeIds {
+		reusedInsNodeMap[v] = true
+	}
+	for _, row := range sourceBindings {
+		newInsNodeId := insNodeIdMap[row.ProcInsNodeId]
+		if row.ProcInsNodeId != "" && newInsNodeId == "" {
+			continue
+		}
+		// 复用结果的子编排节点仍指向源实例创建的子编排实例
+		subProcInsId := ""
+		if reusedInsNodeMap[row.ProcInsNodeId] {
+			subProcInsId = row.SubProcInsId
+		}
+		actions = append(actions, &db.ExecAction{Sql: "insert into proc_data_binding(id,proc_def_id,proc_ins_id,proc_def_node_id,proc_ins_node_id,entity_id,entity_data_id,entity_data_name,entity_type_id,bind_flag,bind_type,full_data_id,sub_session_id,sub_proc_ins_id,created_by,created_time) values (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)", Param: []interface{}{
+			"p_bind_" + guid.CreateGuid(), procDefObj.Id, procInsId, row.ProcDefNodeId, newInsNodeId, row.EntityId, row.EntityDataId, row.EntityDataName, row.EntityTypeId, row.BindFlag, row.BindType, row.FullDataId, row.SubSessionId, subProcInsId, operator, nowTime,
+		}})
+	}
+	for _, row := range sourceCaches {
+		actions = append(actions, &db.ExecAction{Sql: "insert into proc_data_cache(id,proc_ins_id,entity_id,entity_data_id,entity_data_name,entity_type_id,full_data_id,data_value,prev_ids,succ_ids,created_time) values (?,?,?,?,?,?,?,?,?,?,?)", Param: []interface{}{
+			"p_cache_" + guid.CreateGuid(), procInsId, row.EntityId, row.EntityDataId, row.EntityDataName, row.EntityTypeId, row.FullDataId, row.DataValue, row.PrevIds, row.SuccIds, nowTime,
+		}})
+	}
+	variableActions, buildVariableErr := buildProcInsCloneVariableActions(procDefObj, sourceVariables, procInsId, insNodeIdMap, reusedInsNodeMap, operator, nowTime)
+	if buildVariableErr != nil {
+		err = buildVariableErr
+		return
+	}
+	actions = append(actions, variableActions...)
+	for _, link := range procDefLinks {
+		workLinkObj := models.ProcRunLink{Id: "wl_" + guid.CreateGuid(), WorkflowId: workflowRow.Id, ProcDefLinkId: link.Id, Name: link.Name, Source: workNodeIdMap[link.Source], Target: workNodeIdMap[link.Target]}
+		actions = append(actions, &db.ExecAction{Sql: "insert into proc_run_link(id,workflow_id,proc_def_link_id,name,source,target) values (?,?,?,?,?,?)", Param: []interface{}{
+			workLinkObj.Id, workLinkObj.WorkflowId, workLinkObj.ProcDefLinkId, workLinkObj.Name, workLinkObj.Source, workLinkObj.Target,
+		}})
+		workLinks = append(workLinks, &workLinkObj)
+	}
+	if err = db.Transaction(actions, ctx); err != nil {
+		log.Logger.Error("CloneProcInstance fail", log.Error(err))
+		if isProcEntityLockDuplicateErr(err) {
+			if conflictLock, _, _ := getProcEntityLockConflict(ctx, lockRows, ""); conflictLock != nil {
+				err = exterror.Catch(exterror.New().ProcEntityLockConflictError.WithParam(conflictLock.Key(), conflictLock.ProcInsId), err)
+				return
+			}
+		}
+		err = exterror.Catch(exterror.New().DatabaseExecuteError, err)
+		return
+	}
+	AddProcInsTimeline(ctx, &models.ProcInsTimeline{ProcInsId: procInsId, WorkflowId: workflowRow.Id, EventType: models.TimelineEventOperation, Status: "clone",
+		Message: fmt.Sprintf("re-run from process instance %s node %s", sourceProcInsId, startInsNode.Name), RefId: cloneRow.Id, CreatedBy: operator, CreatedTime: nowTime})
+	return
+}
+
+// getProcInsCloneDecisionBranch 判断节点只有一个分支能到达开始节点时返回该分支名称
+func getProcInsCloneDecisionBranch(procDefLinks []*models.ProcDefNodeLink, decisionNodeId, startNodeId string, ancestorMap map[string]bool) (branch string) {
+	matchNum := 0
+	for _, link := range procDefLinks {
+		if link.Source != decisionNodeId {
+			continue
+		}
+		if link.Target == startNodeId || ancestorMap[link.Target] {
+			branch = link.Name
+			matchNum++
+		}
+	}
+	if matchNum != 1 {
+		branch = ""
+	}
+	return
+}
+
+// checkProcInsCloneSource 只有已结束(成功、失败、终止、超时)的实例可以重新运行,子编排实例和模拟运行实例不能重新运行
+// 运行中、暂停或停止的实例要先终止,避免和新实例同时修改数据
+func checkProcInsCloneSource(ctx context.Context, sourceIns *models.ProcIns) (err error) {
+	if sourceIns.ParentInsNodeId != "" {
+		err = exterror.New().ProcInsCloneError.WithParam("sub process instance can not re-run alone")
+		return
+	}
+	switch sourceIns.Status {
+	case models.JobStatusSuccess, models.JobStatusFail, models.JobStatusKill, models.JobStatusTimeout:
+	default:
+		err = exterror.New().ProcInsCloneError.WithParam(fmt.Sprintf("process instance status %s is not finished, kill it before re-run", sourceIns.Status))
+		return
+	}
+	simulationObj, getSimulationErr := GetProcInsSimulation(ctx, sourceIns.Id)
+	if getSimulationErr != nil {
+		err = getSimulationErr
+		return
+	}
+	if simulationObj != nil {
+		err = exterror.New().ProcInsCloneError.WithParam("simulation instance can not re-run")
+	}
+	return
+}
+
+// buildProcInsCloneReqActions 复制复用节点最后一次插件调用的出入参,后面节点取上下文参数时能取到
+func buildProcInsCloneReqActions(ctx context.Context, sourceInsNodeIds []string, insNodeIdMap map[string]string) (actions []*db.ExecAction, err error) {
+	if len(sourceInsNodeIds) == 0 {
+		return
+	}
+	var reqRows []*models.ProcInsNodeReq
+	filterSql, filterParams := db.CreateListParams(sourceInsNodeIds, "")
+	err = db.MysqlEngine.Context(ctx).SQL("select id,proc_ins_node_id from proc_ins_node_req where proc_ins_node_id in ("+filterSql+") order by created_time", filterParams...).Find(&reqRows)
+	if err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+		return
+	}
+	lastReqMap := make(map[string]string)
+	for _, row := range reqRows {
+		lastReqMap[row.ProcInsNodeId] = row.Id
+	}
+	for _, sourceInsNodeId := range sourceInsNodeIds {
+		sourceReqId, ok := lastReqMap[sourceInsNodeId]
+		if !ok {
+			continue
+		}
+		newReqId := "proc_req_" + guid.CreateGuid()
+		actions = append(actions, &db.ExecAction{Sql: "insert into proc_ins_node_req(id,proc_ins_node_id,req_url,is_completed,error_code,error_msg,with_context_data,req_data_amount,created_time,updated_time) select ?,?,req_url,is_completed,error_code,error_msg,with_context_data,req_data_amount,created_time,updated_time from proc_ins_node_req where id=?", Param: []interface{}{
+			newReqId, insNodeIdMap[sourceInsNodeId], sourceReqId,
+		}})
+		actions = append(actions, &db.ExecAction{Sql: "insert into proc_ins_node_req_param(req_id,data_index,from_type,name,data_type,data_value,entity_data_id,entity_type_id,is_sensitive,full_data_id,multiple,param_def_id,mapping_type,callback_id,created_time) select ?,data_index,from_type,name,data_type,data_value,entity_data_id,entity_type_id,is_sensitive,full_data_id,multiple,param_def_id,mapping_type,callback_id,created_time from proc_ins_node_req_param where req_id=? order by id", Param: []interface{}{
+			newReqId, sourceReqId,
+		}})
+	}
+	return
+}
+
+// buildProcInsCloneVariableActions 复制编排变量,最后由开始节点及之后节点写入的变量恢复为默认值
+func buildProcInsCloneVariableActions(procDefObj *models.ProcDef, sourceVariables []*models.ProcInsVariable, procInsId string, insNodeIdMap map[string]string, reusedInsNodeMap map[string]bool, operator string, nowTime time.Time) (actions []*db.ExecAction, err error) {
+	sourceVariableMap := make(map[string]*models.ProcInsVariable)
+	for _, row := range sourceVariables {
+		sourceVariableMap[row.Name] = row
+	}
+	for _, variableDef := range models.ParseProcDefVariables(procDefObj.Variables) {
+		if sourceRow, ok := sourceVariableMap[variableDef.Name]; ok {
+			if sourceRow.SourceNode == models.ProcVariableSourceDefault || sourceRow.SourceNode == models.ProcVariableSourceStart {
+				actions = append(actions, &db.ExecAction{Sql: "insert into proc_ins_variable(proc_ins_id,name,data_type,value,source_node,updated_by,updated_time) values (?,?,?,?,?,?,?)", Param: []interface{}{
+					procInsId, variableDef.Name, variableDef.DataType, sourceRow.Value, sourceRow.SourceNode, operator, nowTime,
+				}})
+				continue
+			}
+			if reusedInsNodeMap[sourceRow.SourceNode] {
+				actions = append(actions, &db.ExecAction{Sql: "insert into proc_ins_variable(proc_ins_id,name,data_type,value,source_node,updated_by,updated_time) values (?,?,?,?,?,?,?)", Param: []interface{}{
+					procInsId, variableDef.Name, variableDef.DataType, sourceRow.Value, insNodeIdMap[sourceRow.SourceNode], operator, nowTime,
+				}})
+				continue
+			}
+		}
+		value, convertErr := variableDef.ConvertValue(variableDef.DefaultValue)
+		if convertErr != nil {
+			err = exterror.Catch(exterror.New().RequestParamValidateError, fmt.Errorf("variable %s value illegal,%s", variableDef.Name, convertErr.Error()))
+			return
+		}
+		actions = append(actions, &db.ExecAction{Sql: "insert into proc_ins_variable(proc_ins_id,name,data_type,value,source_node,updated_by,updated_time) values (?,?,?,?,?,?,?)", Param: []interface{}{
+			procInsId, variableDef.Name, variableDef.DataType, buildProcInsVariableValue(value), models.ProcVariableSourceDefault, operator, nowTime,
+		}})
+	}
+	return
+}
+
+// ListProcInsClone 查实例的重新运行纪录,包括由它重新运行出的实例和它自己的来源
+func ListProcInsClone(ctx context.Context, procInsId string) (result []*models.ProcInsClone, err error) {
+	result = []*models.ProcInsClone{}
+	err = db.MysqlEngine.Context(ctx).SQL("select * from proc_ins_clone where source_proc_ins_id=? or proc_ins_id=? order by created_time", procInsId, procInsId).Find(&result)
+	if err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+	}
+	return
+}
@@ -2,6 +2,7 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"github.com/WeBankPartners/go-common-lib/guid"
@@ -10,6 +11,7 @@ import (
 	"github.com/WeBankPartners/wecube-platform/platform-core/common/log"
 	"github.com/WeBankPartners/wecube-platform/platform-core/common/tools"
 	"github.com/WeBankPartners/wecube-platform/platform-core/models"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -106,7 +108,7 @@ func PublicProcDefNodeList(ctx context.Context, procDefId string) (nodes []*mode
 		} else if row.NodeType == "data" {
 			nodeObj.TaskCategory = "SDTN"
 			nodeObj.NodeType = "subProcess"
-		} else if row.NodeType == "subProc" {
+		} else if row.NodeType == "subProc" || row.NodeType == models.JobLoopType {
 			nodeObj.TaskCategory = "SMTN"
 			nodeObj.NodeType = "subProcess"
 		}
@@ -199,7 +201,7 @@ func ProcDefOutline(ctx context.Context, procDefId string) (result *models.ProcD
 				nodeObj.FilterRule = interfaceObj.FilterRule
 			}
 		}
-		if node.NodeType == string(models.ProcDefNodeTypeHuman) || node.NodeType == string(models.ProcDefNodeTypeAutomatic) || node.NodeType == string(models.ProcDefNodeTypeData) || node.NodeType == models.JobSubProcType {
+		if node.NodeType == string(models.ProcDefNodeTypeHuman) || node.NodeType == string(models.ProcDefNodeTypeAutomatic) || node.NodeType == string(models.ProcDefNodeTypeData) || node.NodeType == models.JobSubProcType || node.NodeType == models.JobLoopType {
 			nodeObj.OrderedNo = fmt.Sprintf("%d", orderIndex)
 			orderIndex += 1
 		}
@@ -693,7 +695,56 @@ func CreateProcInstance(ctx context.Context, procStartParam *models.ProcInsStart
 	if procStartParam.ParentInsNodeId != "" {
 		actions = append(actions, &db.ExecAction{Sql: "update proc_ins set parent_ins_node_id=? where id=?", Param: []interface{}{procStartParam.ParentInsNodeId, procInsId}})
 	}
+	simulationAction, buildSimulationErr := buildProcInsSimulationAction(ctx, procStartParam, procInsId, operator, nowTime)
+	if buildSimulationErr != nil {
+		err = buildSimulationErr
+		return
+	}
+	if simulationAction != nil {
+		actions = append(actions, simulationAction)
+	}
+	variableActions, buildVariableErr := buildProcInsVariableActions(procDefObj, procStartParam.Variables, procInsId, operator, nowTime)
+	if buildVariableErr != nil {
+		err = buildVariableErr
+		return
+	}
+	actions = append(actions, variableActions...)
+	breakpointActions, buildBreakpointErr := buildProcInsBreakpointActions(ctx, procDefObj.Id, procInsId, procStartParam.Breakpoints, operator, nowTime)
+	if buildBreakpointErr != nil {
+		err = buildBreakpointErr
+		return
+	}
+	actions = append(actions, breakpointActions...)
 	workflowRow = &models.ProcRunWorkflow{Id: "wf_" + guid.CreateGuid(), ProcInsId: procInsId, Name: procDefObj.Name, Status: models.JobStatusReady, CreatedTime: nowTime}
+	// 并发控制,子编排和模拟运行不参与排队
+	if procStartParam.ParentInsNodeId == "" && simulationAction == nil {
+		if entityDataId == "" {
+			entityDataId = procStartParam.EntityDataId
+		}
+		queued, queueUnlock, checkQueueErr := checkProcInsNeedQueue(ctx, procDefObj, entityDataId)
+		if checkQueueErr != nil {
+			err = checkQueueErr
+			return
+		}
+		defer queueUnlock()
+		if queued {
+			workflowRow.Status = models.JobStatusQueued
+			actions = append(actions, buildProcInsQueueActions(procDefObj, procStartParam, procInsId, workflowRow.Id, entityDataId, operator, nowTime)...)
+		}
+	}
+	// 数据冲突检测,模拟运行不会真正修改数据,不参与检测
+	var lockRows []*models.ProcEntityLock
+	var lockParentProcInsId string
+	if procDefObj.ConflictCheck && simulationAction == nil {
+		var lockActions []*db.ExecAction
+		var buildLockErr error
+		lockRows, lockParentProcInsId, lockActions, buildLockErr = buildProcInsEntityLockActions(ctx, procDefObj, procStartParam, previewRows, procInsId, entityDataId, workflowRow, operator, nowTime)
+		if buildLockErr != nil {
+			err = buildLockErr
+			return
+		}
+		actions = append(actions, lockActions...)
+	}
 	actions = append(actions, &db.ExecAction{Sql: "insert into proc_run_workflow(id,proc_ins_id,name,status,created_time) values (?,?,?,?,?)", Param: []interface{}{
 		workflowRow.Id, workflowRow.ProcInsId, workflowRow.Name, workflowRow.Status, workflowRow.CreatedTime,
 	}})
@@ -722,26 +773,11 @@ func CreateProcInstance(ctx context.Context, procStartParam *models.ProcInsStart
 	}
 	workNodeIdMap := make(map[string]string)
 	for _, node := range procDefNodes {
-		if node.NodeType != "automatic" && node.NodeType != "data" {
-			node.Timeout = 0
-		}
-		tmpProcInsNodeId := "pins_node_" + guid.CreateGuid()
-		actions = append(actions, &db.ExecAction{Sql: "insert into proc_ins_node(id,proc_ins_id,proc_def_node_id,name,node_type,status,ordered_no,created_by,created_time) values (?,?,?,?,?,?,?,?,?)", Param: []interface{}{
-			tmpProcInsNodeId, procInsId, node.Id, node.Name, node.NodeType, models.JobStatusReady, node.OrderedNo, operator, nowTime,
-		}})
-		workNodeObj := models.ProcRunNode{Id: "wn_" + guid.CreateGuid(), WorkflowId: workflowRow.Id, ProcInsNodeId: tmpProcInsNodeId, Name: node.Name, JobType: node.NodeType, Status: models.JobStatusReady, Timeout: node.Timeout, CreatedTime: nowTime}
-		if node.NodeType == models.JobTimeType || node.NodeType == models.JobDateType {
-			workNodeObj.Input = node.TimeConfig
-			actions = append(actions, &db.ExecAction{Sql: "insert into proc_run_node(id,workflow_id,proc_ins_node_id,name,job_type,status,timeout,input,created_time) values (?,?,?,?,?,?,?,?,?)", Param: []interface{}{
-				workNodeObj.Id, workNodeObj.WorkflowId, workNodeObj.ProcInsNodeId, workNodeObj.Name, workNodeObj.JobType, workNodeObj.Status, workNodeObj.Timeout, workNodeObj.Input, workNodeObj.CreatedTime,
-			}})
-		} else {
-			actions = append(actions, &db.ExecAction{Sql: "insert into proc_run_node(id,workflow_id,proc_ins_node_id,name,job_type,status,timeout,created_time) values (?,?,?,?,?,?,?,?)", Param: []interface{}{
-				workNodeObj.Id, workNodeObj.WorkflowId, workNodeObj.ProcInsNodeId, workNodeObj.Name, workNodeObj.JobType, workNodeObj.Status, workNodeObj.Timeout, workNodeObj.CreatedTime,
-			}})
-		}
+		workNodeObj, nodeActions := buildProcInsNodeActions(node, procInsId, workflowRow.Id, operator, nowTime)
+		actions = append(actions, nodeActions...)
+		tmpProcInsNodeId := workNodeObj.ProcInsNodeId
 		workNodeIdMap[node.Id] = workNodeObj.Id
-		workNodes = append(workNodes, &workNodeObj)
+		workNodes = append(workNodes, workNodeObj)
 		// data bind
 		for _, row := range previewRows {
 			if row.ProcDefNodeId == node.Id {
@@ -751,45 +787,6 @@ func CreateProcInstance(ctx context.Context, procStartParam *models.ProcInsStart
 			}
 		}
 	}
-	// 数据冲突检测
-	if procDefObj.ConflictCheck {
-		var existBindingRows []*models.ProcDataBinding
-		err = db.MysqlEngine.Context(ctx).SQL("select t2.proc_ins_id,t2.entity_data_id,t2.entity_type_id from proc_ins t1 left join proc_data_binding t2 on t1.id=t2.proc_ins_id where t1.status='InProgress' and t2.bind_flag=1").Find(&existBindingRows)
-		if err != nil {
-			err = exterror.Catch(exterror.New().DatabaseQueryError, err)
-			return
-		}
-		// 如果是子编排，要不与父编排冲突
-		var parentProcInsId string
-		if procStartParam.ParentInsNodeId != "" {
-			parentInsNodeObj, getParentInsErr := GetSimpleProcInsNode(ctx, procStartParam.ParentInsNodeId, "")
-			if getParentInsErr != nil {
-				err = getParentInsErr
-				return
-			}
-			parentProcInsId = parentInsNodeObj.ProcInsId
-		}
-		for _, previewRow := range previewRows {
-			if !previewRow.IsBound {
-				continue
-			}
-			for _, v := range existBindingRows {
-				if v.ProcInsId == parentProcInsId {
-					continue
-				}
-				if previewRow.EntityTypeId == v.EntityTypeId && previewRow.EntityDataId == v.EntityDataId {
-					err = fmt.Errorf("rowData conflict check fail,data->%s:%s is using by procInsId:%s", v.EntityTypeId, v.EntityDataId, v.ProcInsId)
-					break
-				}
-			}
-			if err != nil {
-				break
-			}
-		}
-		if err != nil {
-			return
-		}
-	}
 	for _, link := range procDefLinks {
 		workLinkObj := models.ProcRunLink{Id: "wl_" + guid.CreateGuid(), WorkflowId: workflowRow.Id, ProcDefLinkId: link.Id, Name: link.Name, Source: workNodeIdMap[link.Source], Target: workNodeIdMap[link.Target]}
 		actions = append(actions, &db.ExecAction{Sql: "insert into proc_run_link(id,workflow_id,proc_def_link_id,name,source,target) values (?,?,?,?,?,?)", Param: []interface{}{
@@ -799,11 +796,41 @@ func CreateProcInstance(ctx context.Context, procStartParam *models.ProcInsStart
 	}
 	if err = db.Transaction(actions, ctx); err != nil {
 		log.Logger.Error("CreateProcInstance fail", log.Error(err))
+		// 并发启动时数据锁被其它实例抢先拿到
+		if isProcEntityLockDuplicateErr(err) {
+			if conflictLock, _, _ := getProcEntityLockConflict(ctx, lockRows, lockParentProcInsId); conflictLock != nil {
+				err = exterror.Catch(exterror.New().ProcEntityLockConflictError.WithParam(conflictLock.Key(), conflictLock.ProcInsId), err)
+				return
+			}
+		}
 		err = exterror.Catch(exterror.New().DatabaseExecuteError, err)
 	}
 	return
 }
 
+// buildProcInsNodeActions 新增编排定义节点对应的实例节点和运行节点
+func buildProcInsNodeActions(node *models.ProcDefNode, procInsId, workflowId, operator string, nowTime time.Time) (workNodeObj *models.ProcRunNode, actions []*db.ExecAction) {
+	if node.NodeType != "automatic" && node.NodeType != "data" {
+		node.Timeout = 0
+	}
+	tmpProcInsNodeId := "pins_node_" + guid.CreateGuid()
+	actions = append(actions, &db.ExecAction{Sql: "insert into proc_ins_node(id,proc_ins_id,proc_def_node_id,name,node_type,status,ordered_no,created_by,created_time) values (?,?,?,?,?,?,?,?,?)", Param: []interface{}{
+		tmpProcInsNodeId, procInsId, node.Id, node.Name, node.NodeType, models.JobStatusReady, node.OrderedNo, operator, nowTime,
+	}})
+	workNodeObj = &models.ProcRunNode{Id: "wn_" + guid.CreateGuid(), WorkflowId: workflowId, ProcInsNodeId: tmpProcInsNodeId, Name: node.Name, JobType: node.NodeType, Status: models.JobStatusReady, Timeout: node.Timeout, CreatedTime: nowTime}
+	if node.NodeType == models.JobTimeType || node.NodeType == models.JobDateType || node.NodeType == models.JobSignalType {
+		workNodeObj.Input = node.TimeConfig
+		actions = append(actions, &db.ExecAction{Sql: "insert into proc_run_node(id,workflow_id,proc_ins_node_id,name,job_type,status,timeout,input,created_time) values (?,?,?,?,?,?,?,?,?)", Param: []interface{}{
+			workNodeObj.Id, workNodeObj.WorkflowId, workNodeObj.ProcInsNodeId, workNodeObj.Name, workNodeObj.JobType, workNodeObj.Status, workNodeObj.Timeout, workNodeObj.Input, workNodeObj.CreatedTime,
+		}})
+	} else {
+		actions = append(actions, &db.ExecAction{Sql: "insert into proc_run_node(id,workflow_id,proc_ins_node_id,name,job_type,status,timeout,created_time) values (?,?,?,?,?,?,?,?)", Param: []interface{}{
+			workNodeObj.Id, workNodeObj.WorkflowId, workNodeObj.ProcInsNodeId, workNodeObj.Name, workNodeObj.JobType, workNodeObj.Status, workNodeObj.Timeout, workNodeObj.CreatedTime,
+		}})
+	}
+	return
+}
+
 func CreatePublicProcInstance(ctx context.Context, startParam *models.RequestProcessData, operator string) (procInsId string, workflowRow *models.ProcRunWorkflow, workNodes []*models.ProcRunNode, workLinks []*models.ProcRunLink, err error) {
 	procInsId = "pins_" + guid.CreateGuid()
 	procDefObj, getProcDefErr := GetSimpleProcDefRow(ctx, startParam.ProcDefId)
@@ -842,6 +869,17 @@ func CreatePublicProcInstance(ctx context.Context, startParam *models.RequestPro
 		procInsId, procDefObj.Id, procDefObj.Key, procDefObj.Name, models.JobStatusReady, entityDataId, entityTypeId, entityDataName, operator, nowTime, operator, nowTime, procSessionId, requestInfo,
 	}})
 	workflowRow = &models.ProcRunWorkflow{Id: "wf_" + guid.CreateGuid(), ProcInsId: procInsId, Name: procDefObj.Name, Status: models.JobStatusReady, CreatedTime: nowTime}
+	// 并发控制
+	queued, queueUnlock, checkQueueErr := checkProcInsNeedQueue(ctx, procDefObj, entityDataId)
+	if checkQueueErr != nil {
+		err = checkQueueErr
+		return
+	}
+	defer queueUnlock()
+	if queued {
+		workflowRow.Status = models.JobStatusQueued
+		actions = append(actions, buildProcInsQueueActions(procDefObj, &models.ProcInsStartParam{}, procInsId, workflowRow.Id, entityDataId, operator, nowTime)...)
+	}
 	actions = append(actions, &db.ExecAction{Sql: "insert into proc_run_workflow(id,proc_ins_id,name,status,created_time) values (?,?,?,?,?)", Param: []interface{}{
 		workflowRow.Id, workflowRow.ProcInsId, workflowRow.Name, workflowRow.Status, workflowRow.CreatedTime,
 	}})
@@ -877,7 +915,7 @@ func CreatePublicProcInstance(ctx context.Context, startParam *models.RequestPro
 	orderIndex := 1
 	for _, node := range procDefNodes {
 		nodeOrderNo := ""
-		if node.NodeType == string(models.ProcDefNodeTypeHuman) || node.NodeType == string(models.ProcDefNodeTypeAutomatic) || node.NodeType == string(models.ProcDefNodeTypeData) || node.NodeType == models.JobSubProcType {
+		if node.NodeType == string(models.ProcDefNodeTypeHuman) || node.NodeType == string(models.ProcDefNodeTypeAutomatic) || node.NodeType == string(models.ProcDefNodeTypeData) || node.NodeType == models.JobSubProcType || node.NodeType == models.JobLoopType {
 			nodeOrderNo = fmt.Sprintf("%d", orderIndex)
 			orderIndex += 1
 		}
@@ -889,7 +927,7 @@ func CreatePublicProcInstance(ctx context.Context, startParam *models.RequestPro
 			tmpProcInsNodeId, procInsId, node.Id, node.Name, node.NodeType, models.JobStatusReady, node.OrderedNo, operator, nowTime,
 		}})
 		workNodeObj := models.ProcRunNode{Id: "wn_" + guid.CreateGuid(), WorkflowId: workflowRow.Id, ProcInsNodeId: tmpProcInsNodeId, Name: node.Name, JobType: node.NodeType, Status: models.JobStatusReady, Timeout: node.Timeout, CreatedTime: nowTime}
-		if node.NodeType == models.JobTimeType || node.NodeType == models.JobDateType {
+		if node.NodeType == models.JobTimeType || node.NodeType == models.JobDateType || node.NodeType == models.JobSignalType {
 			workNodeObj.Input = node.TimeConfig
 			actions = append(actions, &db.ExecAction{Sql: "insert into proc_run_node(id,workflow_id,proc_ins_node_id,name,job_type,status,timeout,input,created_time) values (?,?,?,?,?,?,?,?,?)", Param: []interface{}{
 				workNodeObj.Id, workNodeObj.WorkflowId, workNodeObj.ProcInsNodeId, workNodeObj.Name, workNodeObj.JobType, workNodeObj.Status, workNodeObj.Timeout, workNodeObj.Input, workNodeObj.CreatedTime,
@@ -1055,6 +1093,9 @@ func GetProcInstance(ctx context.Context, procInsId string) (result *models.Proc
 		DisplayStatus:     procInsObj.Status,
 		Request:           requestInfoList,
 	}
+	if result.Variables, err = GetProcInsVariables(ctx, procInsId); err != nil {
+		return
+	}
 	if procInsObj.ParentInsNodeId != "" {
 		procInsParentMap := make(map[string]*models.ParentProcInsObj)
 		procInsParentMap, err = getProcInsParentMap(ctx, []string{procInsObj.Id})
@@ -1150,7 +1191,7 @@ func GetProcInstance(ctx context.Context, procInsId string) (result *models.Proc
 		//if transStatus, ok := models.ProcStatusTransMap[nodeObj.Status]; ok {
 		//	nodeObj.Status = transStatus
 		//}
-		if row.NodeType == string(models.ProcDefNodeTypeHuman) || row.NodeType == string(models.ProcDefNodeTypeAutomatic) || row.NodeType == string(models.ProcDefNodeTypeData) || row.NodeType == models.JobSubProcType {
+		if row.NodeType == string(models.ProcDefNodeTypeHuman) || row.NodeType == string(models.ProcDefNodeTypeAutomatic) || row.NodeType == string(models.ProcDefNodeTypeData) || row.NodeType == models.JobSubProcType || row.NodeType == models.JobLoopType {
 			nodeObj.OrderedNo = fmt.Sprintf("%d", orderIndex)
 			orderIndex += 1
 		}
@@ -1185,6 +1226,15 @@ func GetProcExecNodeData(ctx context.Context, procRunNodeId string) (procInsNode
 	return
 }
 
+// GetProcInsNodeBindData 查实例节点已绑定的数据
+func GetProcInsNodeBindData(ctx context.Context, procInsNodeId string) (dataBinding []*models.ProcDataBinding, err error) {
+	err = db.MysqlEngine.Context(ctx).SQL("select * from proc_data_binding where proc_ins_node_id=? and bind_flag=1", procInsNodeId).Find(&dataBinding)
+	if err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+	}
+	return
+}
+
 func GetSimpleProcInsNode(ctx context.Context, procInsNodeId, procRunNodeId string) (procInsNode *models.ProcInsNode, err error) {
 	var procInsNodeRows []*models.ProcInsNode
 	if procInsNodeId != "" {
@@ -1206,7 +1256,7 @@ func GetSimpleProcInsNode(ctx context.Context, procInsNodeId, procRunNodeId stri
 
 func GetSimpleProcDefNode(ctx context.Context, procDefNodeId string) (procDefNode *models.ProcDefNode, err error) {
 	var procDefNodeRows []*models.ProcDefNode
-	err = db.MysqlEngine.Context(ctx).SQL("select id,node_id,proc_def_id,name,node_type,service_name,dynamic_bind,bind_node_id,risk_check,routine_expression,context_param_nodes,timeout,sub_proc_def_id from proc_def_node where id=?", procDefNodeId).Find(&procDefNodeRows)
+	err = db.MysqlEngine.Context(ctx).SQL("select id,node_id,proc_def_id,name,node_type,service_name,dynamic_bind,bind_node_id,risk_check,routine_expression,context_param_nodes,timeout,sub_proc_def_id,retry_policy,loop_policy,compensate_service,output_mappings,approval_policy from proc_def_node where id=?", procDefNodeId).Find(&procDefNodeRows)
 	if err != nil {
 		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
 		return
@@ -1309,6 +1359,19 @@ func GetSimpleLastPluginInterface(ctx context.Context, serviceName string) (inte
 	return
 }
 
+// GetPluginServiceStatus 查插件服务所属插件配置的状态,服务不存在时返回空列表
+func GetPluginServiceStatus(ctx context.Context, serviceName string) (statusList []string, err error) {
+	queryRows, queryErr := db.MysqlEngine.Context(ctx).QueryString("select distinct t2.status from plugin_config_interfaces t1 join plugin_configs t2 on t1.plugin_config_id=t2.id where t1.service_name=?", serviceName)
+	if queryErr != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, queryErr)
+		return
+	}
+	for _, row := range queryRows {
+		statusList = append(statusList, row["status"])
+	}
+	return
+}
+
 func GetLastEnablePluginInterface(ctx context.Context, serviceName string) (pluginInterface *models.PluginConfigInterfaces, err error) {
 	interfaceObj := &models.PluginInterfaceWithVer{}
 	if interfaceObj, err = GetSimpleLastPluginInterface(ctx, serviceName); err != nil {
@@ -1367,10 +1430,12 @@ func GetLastEnablePluginInterface(ctx context.Context, serviceName string) (plug
 func RecordProcCallReq(ctx context.Context, param *models.ProcInsNodeReq, inputFlag bool) (err error) {
 	nowTime := time.Now()
 	var actions []*db.ExecAction
+	var timelineEvent *models.ProcInsTimeline
 	if inputFlag {
 		actions = append(actions, &db.ExecAction{Sql: "insert into proc_ins_node_req(id,proc_ins_node_id,req_url,req_data_amount,created_time) values (?,?,?,?,?)", Param: []interface{}{
 			param.Id, param.ProcInsNodeId, param.ReqUrl, param.ReqDataAmount, nowTime,
 		}})
+		timelineEvent = &models.ProcInsTimeline{ProcInsNodeId: param.ProcInsNodeId, EventType: models.TimelineEventPluginRequest, Message: param.ReqUrl, RefId: param.Id, CreatedBy: "system", CreatedTime: nowTime}
 		for _, v := range param.Params {
 			if v.FromType == "input" {
 				actions = append(actions, &db.ExecAction{Sql: "insert into proc_ins_node_req_param(req_id,data_index,from_type,name,data_type,data_value,entity_data_id,entity_type_id,is_sensitive,full_data_id,multiple,param_def_id,mapping_type,callback_id,created_time) values (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)", Param: []interface{}{
@@ -1380,6 +1445,11 @@ func RecordProcCallReq(ctx context.Context, param *models.ProcInsNodeReq, inputF
 		}
 	} else {
 		actions = append(actions, &db.ExecAction{Sql: "update proc_ins_node_req set is_completed=1,error_msg=?,updated_time=? where id=?", Param: []interface{}{param.ErrorMsg, nowTime, param.Id}})
+		responseStatus := models.JobStatusSuccess
+		if param.ErrorMsg != "" {
+			responseStatus = models.JobStatusFail
+		}
+		timelineEvent = &models.ProcInsTimeline{ProcInsNodeId: param.ProcInsNodeId, EventType: models.TimelineEventPluginResponse, Status: responseStatus, Message: param.ErrorMsg, RefId: param.Id, CreatedBy: "system", CreatedTime: nowTime}
 		for _, v := range param.Params {
 			if v.FromType == "output" {
 				tmpDataValue := strings.TrimSpace(fmt.Sprintf("%s", v.DataValue))
@@ -1396,7 +1466,9 @@ func RecordProcCallReq(ctx context.Context, param *models.ProcInsNodeReq, inputF
 	if err != nil {
 		log.Logger.Error("RecordProcCallReq fail", log.Error(err))
 		err = exterror.Catch(exterror.New().DatabaseExecuteError, err)
+		return
 	}
+	AddProcInsTimeline(ctx, timelineEvent)
 	return
 }
 
@@ -1438,7 +1510,7 @@ func GetProcInsNodeContext(ctx context.Context, procInsId, procInsNodeId, procDe
 			}
 		}
 	}
-	if queryObj.NodeType == models.JobSubProcType {
+	if queryObj.NodeType == models.JobSubProcType || queryObj.NodeType == models.JobLoopType {
 		// 子编排的节点处理信息
 		var sucProcRows []*models.ProcContextSubProcRow
 		err = db.MysqlEngine.Context(ctx).SQL("select t1.entity_type_id,t1.entity_data_id,t3.proc_ins_id,t3.created_time,t4.proc_def_id,t4.proc_def_name,t4.status,t3.error_message,t5.`version` from proc_run_node_sub_proc t1 left join proc_run_node t2 on t1.proc_run_node_id=t2.id left join proc_run_workflow t3 on t1.workflow_id=t3.id left join proc_ins t4 on t3.proc_ins_id=t4.id left join proc_def t5 on t4.proc_def_id=t5.id where t2.proc_ins_node_id=?", queryObj.Id).Find(&sucProcRows)
@@ -1609,6 +1681,7 @@ func AddWorkflowOperation(ctx context.Context, operation *models.ProcRunOperatio
 		return
 	}
 	lastInsertId, _ = execResult.LastInsertId()
+	AddProcInsTimeline(ctx, &models.ProcInsTimeline{WorkflowId: operation.WorkflowId, ProcRunNodeId: operation.NodeId, EventType: models.TimelineEventOperation, Status: operation.Operation, Message: operation.Message, RefId: strconv.FormatInt(lastInsertId, 10), CreatedBy: operation.CreatedBy})
 	return
 }
 
@@ -2009,8 +2082,8 @@ func GetLatestProcDefByKey(ctx context.Context, procDefKey string) (procDefObj *
 }
 
 func CreateProcInsEvent(ctx context.Context, param *models.ProcStartEventParam, procDefObj *models.ProcDef) (eventId int64, err error) {
-	execResult, execErr := db.MysqlEngine.Context(ctx).Exec("insert into proc_ins_event(event_seq_no,event_type,operation_data,operation_key,operation_user,proc_def_id,source_plugin,status,created_time) values (?,?,?,?,?,?,?,?,?)",
-		param.EventSeqNo, param.EventType, param.OperationData, param.OperationKey, param.OperationUser, procDefObj.Id, param.SourceSubSystem, models.ProcEventStatusCreated, time.Now())
+	execResult, execErr := db.MysqlEngine.Context(ctx).Exec("insert into proc_ins_event(event_seq_no,event_type,operation_data,operation_key,operation_user,proc_def_id,source_plugin,status,created_time,priority) values (?,?,?,?,?,?,?,?,?,?)",
+		param.EventSeqNo, param.EventType, param.OperationData, param.OperationKey, param.OperationUser, procDefObj.Id, param.SourceSubSystem, models.ProcEventStatusCreated, time.Now(), param.Priority)
 	if execErr != nil {
 		err = fmt.Errorf("insert proc ins event data fail,%s ", execErr.Error())
 	} else {
@@ -2019,6 +2092,65 @@ func CreateProcInsEvent(ctx context.Context, param *models.ProcStartEventParam,
 	return
 }
 
+// GetProcInsNodeRetryList 查询实例节点的自动重试执行记录
+func GetProcInsNodeRetryList(ctx context.Context, procInsNodeId string) (result []*models.ProcRunNodeRetry, err error) {
+	result = []*models.ProcRunNodeRetry{}
+	err = db.MysqlEngine.Context(ctx).SQL("select * from proc_run_node_retry where proc_run_node_id in (select id from proc_run_node where proc_ins_node_id=?) order by id", procInsNodeId).Find(&result)
+	if err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+	}
+	return
+}
+
+// GetCompensateRunNodes 查工作流中需要补偿的任务节点,按完成时间倒序
+// 只取配置了补偿服务、执行成功并且还没有补偿成功过的自动节点
+func GetCompensateRunNodes(ctx context.Context, workflowId string) (result []*models.ProcRunNode, err error) {
+	err = db.MysqlEngine.Context(ctx).SQL("select t1.id,t1.workflow_id,t1.proc_ins_node_id,t1.name,t1.job_type,t1.status,t1.end_time from proc_run_node t1 left join proc_ins_node t2 on t1.proc_ins_node_id=t2.id left join proc_def_node t3 on t2.proc_def_node_id=t3.id "+
+		"where t1.workflow_id=? and t1.job_type=? and t1.status=? and t3.compensate_service<>'' and t1.id not in (select c.origin_run_node_id from proc_run_node_compensate c left join proc_run_node r on c.proc_run_node_id=r.id where c.workflow_id=? and r.status=?) order by t1.end_time desc",
+		workflowId, models.JobAutoType, models.JobStatusSuccess, workflowId, models.JobStatusSuccess).Find(&result)
+	if err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+	}
+	return
+}
+
+// CreateCompensateNode 为被补偿的任务节点新增补偿用的实例节点和任务节点
+func CreateCompensateNode(ctx context.Context, originRunNode *models.ProcRunNode, trigger, operator string) (compensateRunNode *models.ProcRunNode, err error) {
+	originInsNode, getErr := GetSimpleProcInsNode(ctx, originRunNode.ProcInsNodeId, "")
+	if getErr != nil {
+		err = getErr
+		return
+	}
+	nowTime := time.Now()
+	procInsNodeId := "pins_node_" + guid.CreateGuid()
+	nodeName := originInsNode.Name + "(compensate)"
+	compensateRunNode = &models.ProcRunNode{Id: "wn_" + guid.CreateGuid(), WorkflowId: originRunNode.WorkflowId, ProcInsNodeId: procInsNodeId, Name: nodeName, JobType: models.JobCompensateType, Status: models.JobStatusReady, CreatedTime: nowTime}
+	var actions []*db.ExecAction
+	actions = append(actions, &db.ExecAction{Sql: "insert into proc_ins_node(id,proc_ins_id,proc_def_node_id,name,node_type,status,created_by,created_time) values (?,?,?,?,?,?,?,?)", Param: []interface{}{
+		procInsNodeId, originInsNode.ProcInsId, originInsNode.ProcDefNodeId, nodeName, models.JobCompensateType, models.JobStatusReady, operator, nowTime,
+	}})
+	actions = append(actions, &db.ExecAction{Sql: "insert into proc_run_node(id,workflow_id,proc_ins_node_id,name,job_type,status,timeout,created_time) values (?,?,?,?,?,?,?,?)", Param: []interface{}{
+		compensateRunNode.Id, compensateRunNode.WorkflowId, procInsNodeId, nodeName, models.JobCompensateType, models.JobStatusReady, 0, nowTime,
+	}})
+	actions = append(actions, &db.ExecAction{Sql: "insert into proc_run_node_compensate(workflow_id,proc_run_node_id,origin_run_node_id,origin_ins_node_id,compensate_trigger,created_by,created_time) values (?,?,?,?,?,?,?)", Param: []interface{}{
+		originRunNode.WorkflowId, compensateRunNode.Id, originRunNode.Id, originInsNode.Id, trigger, operator, nowTime,
+	}})
+	if err = db.Transaction(actions, ctx); err != nil {
+		err = fmt.Errorf("create compensate node fail,%s ", err.Error())
+	}
+	return
+}
+
+// GetFinishProcInsNodeList 查询实例中已完成的任务节点
+func GetFinishProcInsNodeList(ctx context.Context, procInsId string) (result []*models.ProcInsNode, err error) {
+	err = db.MysqlEngine.Context(ctx).SQL("select id,proc_ins_id,proc_def_node_id,name,node_type,status from proc_ins_node where proc_ins_id=? and status=? and node_type in (?,?,?)",
+		procInsId, models.JobStatusSuccess, models.JobAutoType, models.JobDataType, models.JobHumanType).Find(&result)
+	if err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+	}
+	return
+}
+
 func GetProcNodeEndTime(ctx context.Context, procInsNodeId string) (endTime string, err error) {
 	var procRunNodeRows []*models.ProcRunNode
 	err = db.MysqlEngine.Context(ctx).SQL("select `output` from proc_run_node where proc_ins_node_id=?", procInsNodeId).Find(&procRunNodeRows)
@@ -2047,6 +2179,34 @@ func GetProcNodeNextChoose(ctx context.Context, procInsNodeId string) (nextChoos
 	return
 }
 
+// GetProcInsNodeRunStatus 查实例节点运行状态,key为编排节点id,有工作流节点时取工作流节点的状态
+func GetProcInsNodeRunStatus(ctx context.Context, procInsId string) (result map[string]string, err error) {
+	result = make(map[string]string)
+	var procInsNodeRows []*models.ProcInsNode
+	err = db.MysqlEngine.Context(ctx).SQL("select id,proc_def_node_id,status from proc_ins_node where proc_ins_id=?", procInsId).Find(&procInsNodeRows)
+	if err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+		return
+	}
+	procDefNodeMap := make(map[string]string)
+	for _, row := range procInsNodeRows {
+		procDefNodeMap[row.Id] = row.ProcDefNodeId
+		result[row.ProcDefNodeId] = row.Status
+	}
+	var procRunNodeRows []*models.ProcRunNode
+	err = db.MysqlEngine.Context(ctx).SQL("select proc_ins_node_id,status,updated_time from proc_run_node where proc_ins_node_id in (select id from proc_ins_node where proc_ins_id=?) order by updated_time", procInsId).Find(&procRunNodeRows)
+	if err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+		return
+	}
+	for _, row := range procRunNodeRows {
+		if procDefNodeId, ok := procDefNodeMap[row.ProcInsNodeId]; ok && row.Status != "" {
+			result[procDefNodeId] = row.Status
+		}
+	}
+	return
+}
+
 func getProcInsVersionMap(ctx context.Context, procDefList []string) (procDefMap map[string]string, err error) {
 	procDefMap = make(map[string]string)
 	if len(procDefList) == 0 {
@@ -2123,8 +2283,24 @@ func UpdateProcRunNodeSubProc(ctx context.Context, procRunNodeId string, subProc
 	return
 }
 
+// AddProcRunNodeSubProc 循环节点每启动一次子编排追加一条纪录
+func AddProcRunNodeSubProc(ctx context.Context, procRunNodeId string, subProcWorkflow *models.ProcRunNodeSubProc, dataBind *models.ProcDataBinding) (err error) {
+	var actions []*db.ExecAction
+	actions = append(actions, &db.ExecAction{Sql: "insert into proc_run_node_sub_proc(proc_run_node_id,workflow_id,entity_type_id,entity_data_id,created_time) values (?,?,?,?,?)", Param: []interface{}{
+		procRunNodeId, subProcWorkflow.WorkflowId, subProcWorkflow.EntityTypeId, subProcWorkflow.EntityDataId, time.Now(),
+	}})
+	if dataBind != nil && dataBind.SubProcInsId != "" {
+		actions = append(actions, &db.ExecAction{Sql: "update proc_data_binding set sub_proc_ins_id=? where id=?", Param: []interface{}{dataBind.SubProcInsId, dataBind.Id}})
+	}
+	err = db.Transaction(actions, ctx)
+	if err != nil {
+		log.Logger.Error("AddProcRunNodeSubProc fail", log.Error(err))
+	}
+	return
+}
+
 func GetSubProcResult(ctx context.Context, procRunNodeId string) (resultRows []*models.ProcSubProcQueryRow, err error) {
-	err = db.MysqlEngine.Context(ctx).SQL("select t1.proc_run_node_id,t1.workflow_id,t1.entity_type_id,t1.entity_data_id,t2.status,t2.error_message,t2.proc_ins_id from proc_run_node_sub_proc t1 left join proc_run_workflow t2 on t1.workflow_id=t2.id where t1.proc_run_node_id=?", procRunNodeId).Find(&resultRows)
+	err = db.MysqlEngine.Context(ctx).SQL("select t1.proc_run_node_id,t1.workflow_id,t1.entity_type_id,t1.entity_data_id,t2.status,t2.error_message,t2.proc_ins_id from proc_run_node_sub_proc t1 left join proc_run_workflow t2 on t1.workflow_id=t2.id where t1.proc_run_node_id=? order by t1.id", procRunNodeId).Find(&resultRows)
 	return
 }
 
@@ -2316,3 +2492,288 @@ func CheckProcSubRunning(ctx context.Context, procRunNodeId string) (runningRows
 	}
 	return
 }
+
+// buildProcInsSimulationAction 模拟运行时纪录mock返回,子编排继承父编排的模拟配置,不是模拟运行时返回nil
+func buildProcInsSimulationAction(ctx context.Context, procStartParam *models.ProcInsStartParam, procInsId, operator string, nowTime time.Time) (action *db.ExecAction, err error) {
+	if !procStartParam.Simulation {
+		if procStartParam.ParentInsNodeId == "" {
+			return
+		}
+		parentInsNode, getParentErr := GetSimpleProcInsNode(ctx, procStartParam.ParentInsNodeId, "")
+		if getParentErr != nil {
+			err = getParentErr
+			return
+		}
+		parentSimulation, getSimulationErr := GetProcInsSimulation(ctx, parentInsNode.ProcInsId)
+		if getSimulationErr != nil || parentSimulation == nil {
+			err = getSimulationErr
+			return
+		}
+		action = &db.ExecAction{Sql: "insert into proc_ins_simulation(proc_ins_id,mock_data,record_proc_ins_id,created_by,created_time) values (?,?,?,?,?)", Param: []interface{}{
+			procInsId, parentSimulation.MockData, parentSimulation.RecordProcInsId, operator, nowTime,
+		}}
+		return
+	}
+	var mockList []*models.ProcSimulationMock
+	if procStartParam.MockFromProcInsId != "" {
+		if mockList, err = GetProcInsRecordedMock(ctx, procStartParam.MockFromProcInsId); err != nil {
+			return
+		}
+	}
+	// 用户配置的mock优先于录制的返回
+	for _, userMock := range procStartParam.MockResponses {
+		if userMock.ServiceName == "" {
+			err = exterror.Catch(exterror.New().RequestParamValidateError, fmt.Errorf("mock response serviceName can not empty"))
+			return
+		}
+		replaceFlag := false
+		for i, v := range mockList {
+			if v.ServiceName == userMock.ServiceName {
+				mockList[i] = userMock
+				replaceFlag = true
+				break
+			}
+		}
+		if !replaceFlag {
+			mockList = append(mockList, userMock)
+		}
+	}
+	mockBytes, _ := json.Marshal(mockList)
+	action = &db.ExecAction{Sql: "insert into proc_ins_simulation(proc_ins_id,mock_data,record_proc_ins_id,created_by,created_time) values (?,?,?,?,?)", Param: []interface{}{
+		procInsId, string(mockBytes), procStartParam.MockFromProcInsId, operator, nowTime,
+	}}
+	return
+}
+
+// GetProcInsSimulation 查编排实例的模拟运行配置,不是模拟运行的实例返回nil
+func GetProcInsSimulation(ctx context.Context, procInsId string) (result *models.ProcInsSimulation, err error) {
+	var simulationRows []*models.ProcInsSimulation
+	err = db.MysqlEngine.Context(ctx).SQL("select * from proc_ins_simulation where proc_ins_id=?", procInsId).Find(&simulationRows)
+	if err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+		return
+	}
+	if len(simulationRows) == 0 {
+		return
+	}
+	result = simulationRows[0]
+	result.MockResponses = []*models.ProcSimulationMock{}
+	if result.MockData != "" {
+		if err = json.Unmarshal([]byte(result.MockData), &result.MockResponses); err != nil {
+			err = fmt.Errorf("json unmarshal simulation mock data fail,%s ", err.Error())
+		}
+	}
+	return
+}
+
+// GetProcInsRecordedMock 取编排实例中各插件服务最后一次成功调用的输出作为模拟运行的mock返回
+func GetProcInsRecordedMock(ctx context.Context, procInsId string) (result []*models.ProcSimulationMock, err error) {
+	var paramRows []*models.ProcInsNodeReqOutputRow
+	err = db.MysqlEngine.Context(ctx).SQL("select t1.req_id,t1.data_index,t1.name,t1.data_value,t4.service_name from proc_ins_node_req_param t1 join proc_ins_node_req t2 on t1.req_id=t2.id join proc_ins_node t3 on t2.proc_ins_node_id=t3.id join proc_def_node t4 on t3.proc_def_node_id=t4.id "+
+		"where t3.proc_ins_id=? and t1.from_type='output' and t2.is_completed=1 and (t2.error_msg is null or t2.error_msg='') order by t2.created_time,t1.data_index,t1.id", procInsId).Find(&paramRows)
+	if err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+		return
+	}
+	if len(paramRows) == 0 {
+		err = exterror.Catch(exterror.New().RequestParamValidateError, fmt.Errorf("can not find any recorded plugin output in procIns:%s", procInsId))
+		return
+	}
+	// 同一个服务多次调用时以最后一次为准
+	mockMap := make(map[string]*models.ProcSimulationMock)
+	mockReqMap := make(map[string]string)
+	for _, row := range paramRows {
+		mockObj, ok := mockMap[row.ServiceName]
+		if !ok {
+			mockObj = &models.ProcSimulationMock{ServiceName: row.ServiceName, ResultCode: "0"}
+			mockMap[row.ServiceName] = mockObj
+			result = append(result, mockObj)
+		}
+		if mockReqMap[row.ServiceName] != row.ReqId {
+			mockReqMap[row.ServiceName] = row.ReqId
+			mockObj.Outputs = []map[string]interface{}{}
+		}
+		for len(mockObj.Outputs) <= row.DataIndex {
+			mockObj.Outputs = append(mockObj.Outputs, make(map[string]interface{}))
+		}
+		mockObj.Outputs[row.DataIndex][row.Name] = row.DataValue
+	}
+	return
+}
+
+// AddProcInsSimulationTrace 纪录模拟运行中本应发出的请求
+func AddProcInsSimulationTrace(ctx context.Context, trace *models.ProcInsSimulationTrace) (err error) {
+	_, err = db.MysqlEngine.Context(ctx).Exec("insert into proc_ins_simulation_trace(proc_ins_id,proc_ins_node_id,node_name,`action`,service_name,request,response,error_message,created_time) values (?,?,?,?,?,?,?,?,?)",
+		trace.ProcInsId, trace.ProcInsNodeId, trace.NodeName, trace.Action, trace.ServiceName, trace.Request, trace.Response, trace.ErrorMessage, time.Now())
+	if err != nil {
+		err = exterror.Catch(exterror.New().DatabaseExecuteError, err)
+	}
+	return
+}
+
+// GetProcInsSimulationResult 查模拟运行走过的节点路径和本应发出的请求
+func GetProcInsSimulationResult(ctx context.Context, procInsId string) (result *models.ProcInsSimulationResult, err error) {
+	simulation, getErr := GetProcInsSimulation(ctx, procInsId)
+	if getErr != nil {
+		err = getErr
+		return
+	}
+	if simulation == nil {
+		err = exterror.Catch(exterror.New().RequestParamValidateError, fmt.Errorf("procIns:%s is not simulation", procInsId))
+		return
+	}
+	procIns, getInsErr := GetSimpleProcInsRow(ctx, procInsId)
+	if getInsErr != nil {
+		err = getInsErr
+		return
+	}
+	result = &models.ProcInsSimulationResult{ProcInsSimulation: simulation, Status: procIns.Status, Path: []*models.ProcRunNode{}, Requests: []*models.ProcInsSimulationTrace{}}
+	err = db.MysqlEngine.Context(ctx).SQL("select * from proc_run_node where workflow_id in (select id from proc_run_workflow where proc_ins_id=?) and status<>? order by start_time,created_time", procInsId, models.JobStatusReady).Find(&result.Path)
+	if err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+		return
+	}
+	err = db.MysqlEngine.Context(ctx).SQL("select * from proc_ins_simulation_trace where proc_ins_id=? order by id", procInsId).Find(&result.Requests)
+	if err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+	}
+	return
+}
+
+// ListProcRunTimer 查定时器列表,默认只查等待中的
+func ListProcRunTimer(ctx context.Context, procInsId, status string) (result []*models.ProcRunTimer, err error) {
+	result = []*models.ProcRunTimer{}
+	if status == "" {
+		status = models.TimerStatusWait
+	}
+	baseSql := "select * from proc_run_timer where status=?"
+	queryParam := []interface{}{status}
+	if procInsId != "" {
+		baseSql += " and proc_ins_id=?"
+		queryParam = append(queryParam, procInsId)
+	}
+	err = db.MysqlEngine.Context(ctx).SQL(baseSql+" order by fire_time", queryParam...).Find(&result)
+	if err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+	}
+	return
+}
+
+func GetProcRunTimer(ctx context.Context, timerId string) (result *models.ProcRunTimer, err error) {
+	var timerRows []*models.ProcRunTimer
+	err = db.MysqlEngine.Context(ctx).SQL("select * from proc_run_timer where id=?", timerId).Find(&timerRows)
+	if err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+		return
+	}
+	if len(timerRows) == 0 {
+		err = exterror.Catch(exterror.New().DatabaseQueryEmptyError, fmt.Errorf("can not find timer with id:%s", timerId))
+		return
+	}
+	result = timerRows[0]
+	return
+}
+
+// UpdateProcRunTimer 快进或取消等待中的定时器,快进是把触发时间改为当前时间,由定时器调度触发
+func UpdateProcRunTimer(ctx context.Context, timerId, action, operator string) (result *models.ProcRunTimer, err error) {
+	if result, err = GetProcRunTimer(ctx, timerId); err != nil {
+		return
+	}
+	nowTime := time.Now()
+	var execResult sql.Result
+	if action == "cancel" {
+		execResult, err = db.MysqlEngine.Context(ctx).Exec("update proc_run_timer set status=?,updated_by=?,updated_time=? where id=? and status=?", models.TimerStatusCanceled, operator, nowTime, timerId, models.TimerStatusWait)
+	} else {
+		execResult, err = db.MysqlEngine.Context(ctx).Exec("update proc_run_timer set fire_time=?,updated_by=?,updated_time=? where id=? and status=?", nowTime, operator, nowTime, timerId, models.TimerStatusWait)
+	}
+	if err != nil {
+		err = exterror.Catch(exterror.New().DatabaseExecuteError, err)
+		return
+	}
+	if affectNum, _ := execResult.RowsAffected(); affectNum == 0 {
+		err = exterror.New().ProcRunTimerStatusError.WithParam(timerId, result.Status)
+		return
+	}
+	result, err = GetProcRunTimer(ctx, timerId)
+	return
+}
+
+// buildProcInsVariableActions 按编排定义初始化实例变量,启动参数中的值覆盖默认值
+func buildProcInsVariableActions(procDef *models.ProcDef, startVariables map[string]interface{}, procInsId, operator string, nowTime time.Time) (actions []*db.ExecAction, err error) {
+	variableDefs := models.ParseProcDefVariables(procDef.Variables)
+	for name := range startVariables {
+		if variableDefs.Get(name) == nil {
+			err = exterror.Catch(exterror.New().RequestParamValidateError, fmt.Errorf("variable %s is not defined in procDef", name))
+			return
+		}
+	}
+	for _, variableDef := range variableDefs {
+		inputValue, source := variableDef.DefaultValue, models.ProcVariableSourceDefault
+		if v, ok := startVariables[variableDef.Name]; ok {
+			inputValue, source = v, models.ProcVariableSourceStart
+		}
+		value, convertErr := variableDef.ConvertValue(inputValue)
+		if convertErr != nil {
+			err = exterror.Catch(exterror.New().RequestParamValidateError, fmt.Errorf("variable %s value illegal,%s", variableDef.Name, convertErr.Error()))
+			return
+		}
+		actions = append(actions, &db.ExecAction{Sql: "insert into proc_ins_variable(proc_ins_id,name,data_type,value,source_node,updated_by,updated_time) values (?,?,?,?,?,?,?)", Param: []interface{}{
+			procInsId, variableDef.Name, variableDef.DataType, buildProcInsVariableValue(value), source, operator, nowTime,
+		}})
+	}
+	return
+}
+
+func buildProcInsVariableValue(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	b, _ := json.Marshal(value)
+	return string(b)
+}
+
+// GetProcInsVariables 查编排实例的变量当前值
+func GetProcInsVariables(ctx context.Context, procInsId string) (result []*models.ProcInsVariable, err error) {
+	result = []*models.ProcInsVariable{}
+	err = db.MysqlEngine.Context(ctx).SQL("select * from proc_ins_variable where proc_ins_id=? order by id", procInsId).Find(&result)
+	if err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+		return
+	}
+	for _, row := range result {
+		row.ParseValue()
+	}
+	return
+}
+
+// GetProcInsVariableMap 查编排实例的变量当前值,key为变量名
+func GetProcInsVariableMap(ctx context.Context, procInsId string) (result map[string]interface{}, err error) {
+	result = make(map[string]interface{})
+	variableRows, queryErr := GetProcInsVariables(ctx, procInsId)
+	if queryErr != nil {
+		err = queryErr
+		return
+	}
+	for _, row := range variableRows {
+		result[row.Name] = row.Data
+	}
+	return
+}
+
+// UpdateProcInsVariables 节点出参写入编排变量,值需要已按变量类型转换
+func UpdateProcInsVariables(ctx context.Context, procInsId, procInsNodeId string, values map[string]interface{}, operator string) (err error) {
+	if len(values) == 0 {
+		return
+	}
+	var actions []*db.ExecAction
+	nowTime := time.Now()
+	for name, value := range values {
+		actions = append(actions, &db.ExecAction{Sql: "update proc_ins_variable set value=?,source_node=?,updated_by=?,updated_time=? where proc_ins_id=? and name=?", Param: []interface{}{
+			buildProcInsVariableValue(value), procInsNodeId, operator, nowTime, procInsId, name,
+		}})
+	}
+	if err = db.Transaction(actions, ctx); err != nil {
+		err = exterror.Catch(exterror.New().DatabaseExecuteError, err)
+	}
+	return
+}
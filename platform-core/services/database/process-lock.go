@@ -0,0 +1,218 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/db"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/exterror"
+	"github.com/WeBankPartners/wecube-platform/platform-core/models"
+	"strings"
+	"time"
+)
+
+// buildProcEntityLockRows 实例需要加锁的数据,取绑定的数据并按数据类型和id去重
+func buildProcEntityLockRows(procDefObj *models.ProcDef, procInsId string, bindingRows []*models.ProcDataBinding, operator string, nowTime time.Time) (lockRows []*models.ProcEntityLock) {
+	lockMode := models.ParseProcDefConcurrencyPolicy(procDefObj.ConcurrencyPolicy).GetLockMode()
+	existMap := make(map[string]bool)
+	for _, row := range bindingRows {
+		if !row.BindFlag || row.EntityDataId == "" {
+			continue
+		}
+		lockRow := models.ProcEntityLock{EntityTypeId: row.EntityTypeId, EntityDataId: row.EntityDataId, EntityDataName: row.EntityDataName, ProcInsId: procInsId,
+			ProcDefId: procDefObj.Id, ProcDefKey: procDefObj.Key, ProcDefName: procDefObj.Name, LockMode: lockMode, CreatedBy: operator, CreatedTime: nowTime}
+		if existMap[lockRow.Key()] {
+			continue
+		}
+		existMap[lockRow.Key()] = true
+		lockRows = append(lockRows, &lockRow)
+	}
+	return
+}
+
+// buildProcInsEntityLockActions 启动实例时加锁,数据被其它实例占用时按编排配置的加锁方式拒绝启动或进入排队
+func buildProcInsEntityLockActions(ctx context.Context, procDefObj *models.ProcDef, procStartParam *models.ProcInsStartParam, previewRows []*models.ProcDataPreview, procInsId, entityDataId string, workflowRow *models.ProcRunWorkflow, operator string, nowTime time.Time) (lockRows []*models.ProcEntityLock, parentProcInsId string, actions []*db.ExecAction, err error) {
+	var bindingRows []*models.ProcDataBinding
+	for _, row := range previewRows {
+		bindingRows = append(bindingRows, &models.ProcDataBinding{EntityTypeId: row.EntityTypeId, EntityDataId: row.EntityDataId, EntityDataName: row.EntityDataName, BindFlag: row.IsBound})
+	}
+	lockRows = buildProcEntityLockRows(procDefObj, procInsId, bindingRows, operator, nowTime)
+	if len(lockRows) == 0 {
+		return
+	}
+	// 如果是子编排,可重入父编排持有的锁
+	if procStartParam.ParentInsNodeId != "" {
+		parentInsNodeObj, getParentInsErr := GetSimpleProcInsNode(ctx, procStartParam.ParentInsNodeId, "")
+		if getParentInsErr != nil {
+			err = getParentInsErr
+			return
+		}
+		parentProcInsId = parentInsNodeObj.ProcInsId
+	}
+	conflictLock, reentrantMap, checkErr := getProcEntityLockConflict(ctx, lockRows, parentProcInsId)
+	if checkErr != nil {
+		err = checkErr
+		return
+	}
+	if conflictLock != nil {
+		// 子编排不参与排队,数据被占用时直接拒绝
+		if lockRows[0].LockMode == models.ProcLockModeReject || procStartParam.ParentInsNodeId != "" {
+			err = exterror.New().ProcEntityLockConflictError.WithParam(conflictLock.Key(), conflictLock.ProcInsId)
+			return
+		}
+		if workflowRow.Status != models.JobStatusQueued {
+			workflowRow.Status = models.JobStatusQueued
+			actions = append(actions, buildProcInsQueueActions(procDefObj, procStartParam, procInsId, workflowRow.Id, entityDataId, operator, nowTime)...)
+		}
+		return
+	}
+	// 因并发上限排队的实例出队时再加锁
+	if workflowRow.Status == models.JobStatusQueued {
+		return
+	}
+	actions = buildProcEntityLockActions(lockRows, reentrantMap)
+	return
+}
+
+// getProcEntityLockConflict 查找已被其它实例持有的数据锁,ignoreProcInsId持有的锁(父编排)可重入
+func getProcEntityLockConflict(ctx context.Context, lockRows []*models.ProcEntityLock, ignoreProcInsId string) (conflictLock *models.ProcEntityLock, reentrantMap map[string]bool, err error) {
+	reentrantMap = make(map[string]bool)
+	if len(lockRows) == 0 {
+		return
+	}
+	var filterList []string
+	var filterParams []interface{}
+	for _, row := range lockRows {
+		filterList = append(filterList, "(entity_type_id=? and entity_data_id=?)")
+		filterParams = append(filterParams, row.EntityTypeId, row.EntityDataId)
+	}
+	var existLockRows []*models.ProcEntityLock
+	err = db.MysqlEngine.Context(ctx).SQL("select * from proc_entity_lock where "+strings.Join(filterList, " or ")+" order by id", filterParams...).Find(&existLockRows)
+	if err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+		return
+	}
+	for _, row := range existLockRows {
+		if ignoreProcInsId != "" && row.ProcInsId == ignoreProcInsId {
+			reentrantMap[row.Key()] = true
+			continue
+		}
+		conflictLock = row
+		break
+	}
+	return
+}
+
+// buildProcEntityLockActions 加锁,依赖(entity_type_id,entity_data_id)唯一索引保证并发启动时只有一个实例能拿到锁
+func buildProcEntityLockActions(lockRows []*models.ProcEntityLock, reentrantMap map[string]bool) (actions []*db.ExecAction) {
+	for _, row := range lockRows {
+		if reentrantMap[row.Key()] {
+			continue
+		}
+		actions = append(actions, &db.ExecAction{Sql: "insert into proc_entity_lock(entity_type_id,entity_data_id,entity_data_name,proc_ins_id,proc_def_id,proc_def_key,proc_def_name,lock_mode,created_by,created_time) values (?,?,?,?,?,?,?,?,?,?)", Param: []interface{}{
+			row.EntityTypeId, row.EntityDataId, row.EntityDataName, row.ProcInsId, row.ProcDefId, row.ProcDefKey, row.ProcDefName, row.LockMode, row.CreatedBy, row.CreatedTime,
+		}})
+	}
+	return
+}
+
+// isProcEntityLockDuplicateErr 并发加锁时唯一索引冲突
+func isProcEntityLockDuplicateErr(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "Duplicate entry") && strings.Contains(err.Error(), "uk_proc_entity_lock")
+}
+
+// BuildReleaseProcEntityLockAction 释放实例持有的所有数据锁
+func BuildReleaseProcEntityLockAction(procInsId string) *db.ExecAction {
+	return &db.ExecAction{Sql: "delete from proc_entity_lock where proc_ins_id=?", Param: []interface{}{procInsId}}
+}
+
+// TryAcquireQueuedProcInsLock 排队实例出队前加锁,编排未开启冲突检测时直接返回,数据被占用时返回冲突的锁
+func TryAcquireQueuedProcInsLock(ctx context.Context, procInsId, operator string) (lockActions []*db.ExecAction, conflictLock *models.ProcEntityLock, policy *models.ProcDefConcurrencyPolicy, err error) {
+	var procDefRows []*models.ProcDef
+	err = db.MysqlEngine.Context(ctx).SQL("select t2.* from proc_ins t1 join proc_def t2 on t1.proc_def_id=t2.id where t1.id=?", procInsId).Find(&procDefRows)
+	if err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+		return
+	}
+	if len(procDefRows) == 0 || !procDefRows[0].ConflictCheck {
+		return
+	}
+	procDefObj := procDefRows[0]
+	policy = models.ParseProcDefConcurrencyPolicy(procDefObj.ConcurrencyPolicy)
+	var bindingRows []*models.ProcDataBinding
+	err = db.MysqlEngine.Context(ctx).SQL("select entity_type_id,entity_data_id,entity_data_name,bind_flag from proc_data_binding where proc_ins_id=? and bind_flag=1", procInsId).Find(&bindingRows)
+	if err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+		return
+	}
+	lockRows := buildProcEntityLockRows(procDefObj, procInsId, bindingRows, operator, time.Now())
+	var reentrantMap map[string]bool
+	if conflictLock, reentrantMap, err = getProcEntityLockConflict(ctx, lockRows, ""); err != nil || conflictLock != nil {
+		return
+	}
+	lockActions = buildProcEntityLockActions(lockRows, reentrantMap)
+	return
+}
+
+// ListProcEntityLock 查询数据锁
+func ListProcEntityLock(ctx context.Context, entityTypeId, entityDataId, procInsId, procDefKey string) (result []*models.ProcEntityLock, err error) {
+	result = []*models.ProcEntityLock{}
+	baseSql := "select t1.*,t2.status as proc_ins_status from proc_entity_lock t1 left join proc_ins t2 on t1.proc_ins_id=t2.id where 1=1"
+	var queryParam []interface{}
+	if entityTypeId != "" {
+		baseSql += " and t1.entity_type_id=?"
+		queryParam = append(queryParam, entityTypeId)
+	}
+	if entityDataId != "" {
+		baseSql += " and t1.entity_data_id=?"
+		queryParam = append(queryParam, entityDataId)
+	}
+	if procInsId != "" {
+		baseSql += " and t1.proc_ins_id=?"
+		queryParam = append(queryParam, procInsId)
+	}
+	if procDefKey != "" {
+		baseSql += " and t1.proc_def_key=?"
+		queryParam = append(queryParam, procDefKey)
+	}
+	err = db.MysqlEngine.Context(ctx).SQL(baseSql+" order by t1.id", queryParam...).Find(&result)
+	if err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+	}
+	return
+}
+
+// ForceReleaseProcEntityLock 管理员强制释放数据锁,持有锁的实例继续运行,在实例时间线上留下记录
+func ForceReleaseProcEntityLock(ctx context.Context, lockId int64, operator string) (err error) {
+	var lockRows []*models.ProcEntityLock
+	err = db.MysqlEngine.Context(ctx).SQL("select * from proc_entity_lock where id=?", lockId).Find(&lockRows)
+	if err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+		return
+	}
+	if len(lockRows) == 0 {
+		err = exterror.New().ProcEntityLockNotFoundError.WithParam(lockId)
+		return
+	}
+	lockRow := lockRows[0]
+	var actions []*db.ExecAction
+	actions = append(actions, &db.ExecAction{Sql: "delete from proc_entity_lock where id=?", Param: []interface{}{lockId}, CheckAffectRow: true})
+	if err = db.Transaction(actions, ctx); err != nil {
+		err = exterror.Catch(exterror.New().DatabaseExecuteError, err)
+		return
+	}
+	AddProcInsTimeline(ctx, &models.ProcInsTimeline{ProcInsId: lockRow.ProcInsId, EventType: models.TimelineEventLock, Status: "released",
+		Message: fmt.Sprintf("entity lock %s force released by %s", lockRow.Key(), operator), RefId: fmt.Sprintf("%d", lockId), CreatedBy: operator})
+	return
+}
+
+// ReleaseFinishedProcEntityLock 回收已结束或已删除实例仍持有的数据锁
+func ReleaseFinishedProcEntityLock(ctx context.Context) (releaseNum int64, err error) {
+	execResult, execErr := db.MysqlEngine.Context(ctx).Exec("delete t1 from proc_entity_lock t1 left join proc_ins t2 on t1.proc_ins_id=t2.id where t2.id is null or t2.status in (?,?,?,?)",
+		models.JobStatusSuccess, models.JobStatusFail, models.JobStatusKill, models.JobStatusTimeout)
+	if execErr != nil {
+		err = exterror.Catch(exterror.New().DatabaseExecuteError, execErr)
+		return
+	}
+	releaseNum, _ = execResult.RowsAffected()
+	return
+}
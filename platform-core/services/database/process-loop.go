@@ -0,0 +1,143 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"github.com/WeBankPartners/go-common-lib/guid"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/db"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/exterror"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/log"
+	"github.com/WeBankPartners/wecube-platform/platform-core/models"
+	"strings"
+	"time"
+)
+
+// CreateProcLoopBodyInstance 循环子图的一次迭代,以当前编排定义新建子实例,只包含开始、结束节点和子图中的节点
+// 子实例根数据为本次迭代的数据,子图节点复用父实例的数据绑定并只保留数据路径经过迭代数据的部分,变量取父实例当前值
+func CreateProcLoopBodyInstance(ctx context.Context, param *models.ProcInsStartParam, parentProcInsId, loopNodeId, bodyEndNodeId string, bodyNodes map[string]bool, operator string) (procInsId string, workflowRow *models.ProcRunWorkflow, workNodes []*models.ProcRunNode, workLinks []*models.ProcRunLink, err error) {
+	procInsId = "pins_" + guid.CreateGuid()
+	procDefObj, getProcDefErr := GetSimpleProcDefRow(ctx, param.ProcDefId)
+	if getProcDefErr != nil {
+		err = getProcDefErr
+		return
+	}
+	var procDefNodes []*models.ProcDefNode
+	err = db.MysqlEngine.Context(ctx).SQL("select id,node_id,proc_def_id,name,description,status,node_type,service_name,dynamic_bind,bind_node_id,risk_check,routine_expression,context_param_nodes,timeout,ordered_no,time_config from proc_def_node where proc_def_id=? order by ordered_no", param.ProcDefId).Find(&procDefNodes)
+	if err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+		return
+	}
+	var procDefLinks []*models.ProcDefNodeLink
+	err = db.MysqlEngine.Context(ctx).SQL("select id,link_id,proc_def_id,source,target,name from proc_def_node_link where proc_def_id=?", param.ProcDefId).Find(&procDefLinks)
+	if err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+		return
+	}
+	var parentBindings []*models.ProcDataBinding
+	err = db.MysqlEngine.Context(ctx).SQL("select * from proc_data_binding where proc_ins_id=? and proc_def_node_id<>''", parentProcInsId).Find(&parentBindings)
+	if err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+		return
+	}
+	parentVariables, getVariableErr := GetProcInsVariableMap(ctx, parentProcInsId)
+	if getVariableErr != nil {
+		err = getVariableErr
+		return
+	}
+	var actions []*db.ExecAction
+	nowTime := time.Now()
+	actions = append(actions, &db.ExecAction{Sql: "insert into proc_ins(id,proc_def_id,proc_def_key,proc_def_name,status,entity_data_id,entity_type_id,entity_data_name,parent_ins_node_id,created_by,created_time,updated_by,updated_time) values (?,?,?,?,?,?,?,?,?,?,?,?,?)", Param: []interface{}{
+		procInsId, procDefObj.Id, procDefObj.Key, procDefObj.Name, models.JobStatusReady, param.EntityDataId, param.EntityTypeId, param.EntityDisplayName, param.ParentInsNodeId, operator, nowTime, operator, nowTime,
+	}})
+	actions = append(actions, &db.ExecAction{Sql: "insert into proc_data_binding(id,proc_def_id,proc_ins_id,entity_id,entity_data_id,entity_data_name,entity_type_id,bind_flag,bind_type,full_data_id,created_by,created_time) values (?,?,?,?,?,?,?,?,?,?,?,?)", Param: []interface{}{
+		"p_bind_" + guid.CreateGuid(), procDefObj.Id, procInsId, param.EntityDataId, param.EntityDataId, param.EntityDisplayName, param.EntityTypeId, 1, "process", param.EntityDataId, operator, nowTime,
+	}})
+	variableActions, buildVariableErr := buildProcInsVariableActions(procDefObj, parentVariables, procInsId, operator, nowTime)
+	if buildVariableErr != nil {
+		err = buildVariableErr
+		return
+	}
+	actions = append(actions, variableActions...)
+	workflowRow = &models.ProcRunWorkflow{Id: "wf_" + guid.CreateGuid(), ProcInsId: procInsId, Name: procDefObj.Name, Status: models.JobStatusReady, ParentRunNodeId: param.ParentRunNodeId, CreatedTime: nowTime}
+	actions = append(actions, &db.ExecAction{Sql: "insert into proc_run_workflow(id,proc_ins_id,name,status,parent_run_node_id,created_time) values (?,?,?,?,?,?)", Param: []interface{}{
+		workflowRow.Id, workflowRow.ProcInsId, workflowRow.Name, workflowRow.Status, workflowRow.ParentRunNodeId, workflowRow.CreatedTime,
+	}})
+	workNodeIdMap := make(map[string]string)
+	var startNodeId, endNodeId string
+	for _, node := range procDefNodes {
+		switch {
+		case node.NodeType == models.JobStartType:
+			startNodeId = node.Id
+		case node.NodeType == models.JobEndType:
+			endNodeId = node.Id
+		case !bodyNodes[node.Id]:
+			continue
+		}
+		workNodeObj, nodeActions := buildProcInsNodeActions(node, procInsId, workflowRow.Id, operator, nowTime)
+		actions = append(actions, nodeActions...)
+		workNodeIdMap[node.Id] = workNodeObj.Id
+		workNodes = append(workNodes, workNodeObj)
+		for _, row := range parentBindings {
+			if row.ProcDefNodeId != node.Id || !loopBindingMatch(row, param.EntityDataId) {
+				continue
+			}
+			actions = append(actions, &db.ExecAction{Sql: "insert into proc_data_binding(id,proc_def_id,proc_ins_id,proc_def_node_id,proc_ins_node_id,entity_id,entity_data_id,entity_data_name,entity_type_id,bind_flag,bind_type,full_data_id,sub_session_id,created_by,created_time) values (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)", Param: []interface{}{
+				"p_bind_" + guid.CreateGuid(), procDefObj.Id, procInsId, node.Id, workNodeObj.ProcInsNodeId, row.EntityId, row.EntityDataId, row.EntityDataName, row.EntityTypeId, row.BindFlag, row.BindType, row.FullDataId, row.SubSessionId, operator, nowTime,
+			}})
+		}
+	}
+	if startNodeId == "" || endNodeId == "" {
+		err = fmt.Errorf("procDef %s need start and end node to run loop body", param.ProcDefId)
+		return
+	}
+	var runLinks []*models.ProcDefNodeLink
+	for _, link := range procDefLinks {
+		if link.Source == loopNodeId {
+			runLinks = append(runLinks, &models.ProcDefNodeLink{Source: startNodeId, Target: link.Target})
+		} else if bodyNodes[link.Source] && bodyNodes[link.Target] {
+			runLinks = append(runLinks, link)
+		}
+	}
+	runLinks = append(runLinks, &models.ProcDefNodeLink{Source: bodyEndNodeId, Target: endNodeId})
+	for _, link := range runLinks {
+		workLinkObj := models.ProcRunLink{Id: "wl_" + guid.CreateGuid(), WorkflowId: workflowRow.Id, ProcDefLinkId: link.Id, Name: link.Name, Source: workNodeIdMap[link.Source], Target: workNodeIdMap[link.Target]}
+		actions = append(actions, &db.ExecAction{Sql: "insert into proc_run_link(id,workflow_id,proc_def_link_id,name,source,target) values (?,?,?,?,?,?)", Param: []interface{}{
+			workLinkObj.Id, workLinkObj.WorkflowId, workLinkObj.ProcDefLinkId, workLinkObj.Name, workLinkObj.Source, workLinkObj.Target,
+		}})
+		workLinks = append(workLinks, &workLinkObj)
+	}
+	if err = db.Transaction(actions, ctx); err != nil {
+		log.Logger.Error("CreateProcLoopBodyInstance fail", log.Error(err))
+		err = exterror.Catch(exterror.New().DatabaseExecuteError, err)
+	}
+	return
+}
+
+// loopBindingMatch 数据路径上经过本次迭代数据的绑定才属于这次迭代
+func loopBindingMatch(row *models.ProcDataBinding, entityDataId string) bool {
+	if row.EntityDataId == entityDataId {
+		return true
+	}
+	for _, dataId := range strings.Split(row.FullDataId, "::") {
+		if dataId == entityDataId {
+			return true
+		}
+	}
+	return false
+}
+
+// GetProcInsNodeIdByDefNode 查实例中编排定义节点对应的实例节点id
+func GetProcInsNodeIdByDefNode(ctx context.Context, procInsId, procDefNodeId string) (procInsNodeId string, err error) {
+	var procInsNodeRows []*models.ProcInsNode
+	err = db.MysqlEngine.Context(ctx).SQL("select id from proc_ins_node where proc_ins_id=? and proc_def_node_id=?", procInsId, procDefNodeId).Find(&procInsNodeRows)
+	if err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+		return
+	}
+	if len(procInsNodeRows) == 0 {
+		err = fmt.Errorf("can not find procDefNode %s in procIns %s", procDefNodeId, procInsId)
+		return
+	}
+	procInsNodeId = procInsNodeRows[0].Id
+	return
+}
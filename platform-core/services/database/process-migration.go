@@ -0,0 +1,373 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/WeBankPartners/go-common-lib/guid"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/db"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/exterror"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/log"
+	"github.com/WeBankPartners/wecube-platform/platform-core/models"
+	"time"
+)
+
+type procInsMigrationNode struct {
+	insNode    *models.ProcInsNode
+	runNode    *models.ProcRunNode
+	newDefNode *models.ProcDefNode // 为空时删除该节点
+}
+
+type procInsMigrationData struct {
+	procIns      *models.ProcIns
+	workflow     *models.ProcRunWorkflow
+	targetDef    *models.ProcDef
+	nodes        []*procInsMigrationNode
+	addDefNodes  []*models.ProcDefNode
+	newDefLinks  []*models.ProcDefNodeLink
+	newVariables models.ProcDefVariableList
+}
+
+// PreviewProcInsMigration 按节点映射计划试运行迁移,返回每个节点的处理方式和不能迁移的原因
+func PreviewProcInsMigration(ctx context.Context, procInsId string, param *models.ProcInsMigrationParam) (report *models.ProcInsMigrationReport, err error) {
+	_, report, err = buildProcInsMigration(ctx, procInsId, param)
+	return
+}
+
+func buildProcInsMigration(ctx context.Context, procInsId string, param *models.ProcInsMigrationParam) (data *procInsMigrationData, report *models.ProcInsMigrationReport, err error) {
+	data = &procInsMigrationData{}
+	report = &models.ProcInsMigrationReport{ProcInsId: procInsId, ToProcDefId: param.TargetProcDefId, Errors: []string{}, Warnings: []string{}, Nodes: []*models.ProcInsMigrationNode{}}
+	defer func() {
+		report.Legal = err == nil && len(report.Errors) == 0
+	}()
+	if data.procIns, err = GetSimpleProcInsRow(ctx, procInsId); err != nil {
+		return
+	}
+	var workflowRows []*models.ProcRunWorkflow
+	if err = db.MysqlEngine.Context(ctx).SQL("select * from proc_run_workflow where proc_ins_id=?", procInsId).Find(&workflowRows); err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+		return
+	}
+	if len(workflowRows) == 0 {
+		err = exterror.Catch(exterror.New().DatabaseQueryEmptyError, fmt.Errorf("can not find workflow with procIns:%s", procInsId))
+		return
+	}
+	data.workflow = workflowRows[0]
+	fromDef, getFromDefErr := GetSimpleProcDefRow(ctx, data.procIns.ProcDefId)
+	if getFromDefErr != nil {
+		err = getFromDefErr
+		return
+	}
+	if data.targetDef, err = GetSimpleProcDefRow(ctx, param.TargetProcDefId); err != nil {
+		return
+	}
+	report.FromProcDefId, report.FromVersion, report.ToVersion = fromDef.Id, fromDef.Version, data.targetDef.Version
+	if data.workflow.Status != models.JobStatusRunning {
+		report.Errors = append(report.Errors, fmt.Sprintf("workflow status is %s,only InProgress instance can migrate", data.workflow.Status))
+	}
+	if data.targetDef.Key != fromDef.Key {
+		report.Errors = append(report.Errors, "target procDef is not the same process key")
+	}
+	if data.targetDef.Id == fromDef.Id {
+		report.Errors = append(report.Errors, "target procDef is the current version")
+	}
+	if data.targetDef.Status != string(models.Deployed) {
+		report.Errors = append(report.Errors, fmt.Sprintf("target procDef status is %s,not deployed", data.targetDef.Status))
+	}
+	if len(report.Errors) > 0 {
+		return
+	}
+	var oldDefNodes, newDefNodes []*models.ProcDefNode
+	if err = db.MysqlEngine.Context(ctx).SQL("select * from proc_def_node where proc_def_id=?", fromDef.Id).Find(&oldDefNodes); err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+		return
+	}
+	if err = db.MysqlEngine.Context(ctx).SQL("select * from proc_def_node where proc_def_id=? order by ordered_no", data.targetDef.Id).Find(&newDefNodes); err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+		return
+	}
+	if err = db.MysqlEngine.Context(ctx).SQL("select * from proc_def_node_link where proc_def_id=?", data.targetDef.Id).Find(&data.newDefLinks); err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+		return
+	}
+	var insNodes []*models.ProcInsNode
+	if err = db.MysqlEngine.Context(ctx).SQL("select * from proc_ins_node where proc_ins_id=? order by ordered_no", procInsId).Find(&insNodes); err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+		return
+	}
+	var runNodes []*models.ProcRunNode
+	if err = db.MysqlEngine.Context(ctx).SQL("select * from proc_run_node where workflow_id=?", data.workflow.Id).Find(&runNodes); err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+		return
+	}
+	oldDefNodeMap, oldNodeIdMap := make(map[string]*models.ProcDefNode), make(map[string]bool)
+	for _, v := range oldDefNodes {
+		oldDefNodeMap[v.Id] = v
+		oldNodeIdMap[v.NodeId] = true
+	}
+	newDefNodeMap := make(map[string]*models.ProcDefNode)
+	for _, v := range newDefNodes {
+		newDefNodeMap[v.NodeId] = v
+	}
+	runNodeMap := make(map[string]*models.ProcRunNode)
+	for _, v := range runNodes {
+		runNodeMap[v.ProcInsNodeId] = v
+	}
+	for oldNodeId, newNodeId := range param.NodeMapping {
+		if !oldNodeIdMap[oldNodeId] {
+			report.Errors = append(report.Errors, fmt.Sprintf("mapping node %s is not in current version", oldNodeId))
+		}
+		if _, ok := newDefNodeMap[newNodeId]; newNodeId != "" && !ok {
+			report.Errors = append(report.Errors, fmt.Sprintf("mapping target node %s is not in target version", newNodeId))
+		}
+	}
+	usedNewNodeMap := make(map[string]string)
+	executedDefNodeMap := make(map[string]bool)
+	for _, insNode := range insNodes {
+		runNode, ok := runNodeMap[insNode.Id]
+		if !ok {
+			continue
+		}
+		migrateNode := &procInsMigrationNode{insNode: insNode, runNode: runNode}
+		reportNode := &models.ProcInsMigrationNode{OldNodeName: insNode.Name, NodeType: insNode.NodeType, Status: runNode.Status, Action: models.ProcInsMigrationActionKeep}
+		oldNodeId := insNode.ProcDefNodeId
+		if oldDefNode, ok := oldDefNodeMap[insNode.ProcDefNodeId]; ok {
+			oldNodeId = oldDefNode.NodeId
+		}
+		reportNode.OldNodeId = oldNodeId
+		newNodeId, explicit := param.NodeMapping[oldNodeId]
+		if !explicit {
+			newNodeId = oldNodeId
+		} else if newNodeId != oldNodeId {
+			reportNode.Action = models.ProcInsMigrationActionMap
+		}
+		migrateNode.newDefNode = newDefNodeMap[newNodeId]
+		executed := runNode.Status != models.JobStatusReady
+		if migrateNode.newDefNode == nil {
+			reportNode.Action = models.ProcInsMigrationActionDrop
+			if executed {
+				reportNode.Message = "executed node must map to a node in target version"
+			}
+		} else {
+			reportNode.NewNodeId, reportNode.NewNodeName = migrateNode.newDefNode.NodeId, migrateNode.newDefNode.Name
+			if usedOldNodeId, used := usedNewNodeMap[newNodeId]; used {
+				reportNode.Message = fmt.Sprintf("target node is already mapped by node %s", usedOldNodeId)
+			} else if executed && migrateNode.newDefNode.NodeType != insNode.NodeType {
+				reportNode.Message = fmt.Sprintf("executed node can not change type to %s", migrateNode.newDefNode.NodeType)
+			}
+			usedNewNodeMap[newNodeId] = oldNodeId
+			if executed {
+				executedDefNodeMap[migrateNode.newDefNode.Id] = true
+			}
+		}
+		if reportNode.Message == "" && runNode.Status == models.JobStatusRunning && !isProcRunNodeWaiting(runNode.JobType) {
+			reportNode.Message = "node is running,only waiting node(human,time,date,signal) can migrate"
+		}
+		if reportNode.Message != "" {
+			report.Errors = append(report.Errors, fmt.Sprintf("node %s(%s): %s", insNode.Name, oldNodeId, reportNode.Message))
+		}
+		data.nodes = append(data.nodes, migrateNode)
+		report.Nodes = append(report.Nodes, reportNode)
+	}
+	nextNodeMap := make(map[string][]string)
+	for _, link := range data.newDefLinks {
+		nextNodeMap[link.Source] = append(nextNodeMap[link.Source], link.Target)
+	}
+	for _, newDefNode := range newDefNodes {
+		if _, used := usedNewNodeMap[newDefNode.NodeId]; used {
+			continue
+		}
+		data.addDefNodes = append(data.addDefNodes, newDefNode)
+		report.Nodes = append(report.Nodes, &models.ProcInsMigrationNode{NodeType: newDefNode.NodeType, Status: models.JobStatusReady, NewNodeId: newDefNode.NodeId, NewNodeName: newDefNode.Name, Action: models.ProcInsMigrationActionAdd})
+		if (newDefNode.NodeType == models.JobAutoType || newDefNode.NodeType == models.JobDataType || newDefNode.NodeType == models.JobHumanType) && newDefNode.DynamicBind == 0 {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("new node %s has no data binding,set task node bindings before it runs", newDefNode.Name))
+		}
+		if isProcDefNodeBeforeExecuted(newDefNode.Id, nextNodeMap, executedDefNodeMap) {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("new node %s is before executed nodes,it will run when workflow reload if on the executed path", newDefNode.Name))
+		}
+	}
+	existVariables, getVariableErr := GetProcInsVariableMap(ctx, procInsId)
+	if getVariableErr != nil {
+		err = getVariableErr
+		return
+	}
+	for _, variableDef := range models.ParseProcDefVariables(data.targetDef.Variables) {
+		if _, ok := existVariables[variableDef.Name]; !ok {
+			data.newVariables = append(data.newVariables, variableDef)
+		}
+	}
+	return
+}
+
+// isProcRunNodeWaiting 与工作流休眠条件一致,只有等待中的节点可以随工作流退出内存
+func isProcRunNodeWaiting(jobType string) bool {
+	return jobType == models.JobHumanType || jobType == models.JobTimeType || jobType == models.JobDateType || jobType == models.JobSignalType
+}
+
+func isProcDefNodeBeforeExecuted(defNodeId string, nextNodeMap map[string][]string, executedDefNodeMap map[string]bool) bool {
+	visited := map[string]bool{defNodeId: true}
+	queue := []string{defNodeId}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, next := range nextNodeMap[cur] {
+			if executedDefNodeMap[next] {
+				return true
+			}
+			if !visited[next] {
+				visited[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+	return false
+}
+
+// CreateProcInsMigration 新增迁移纪录,由工作流退出内存后执行
+func CreateProcInsMigration(ctx context.Context, procInsId string, param *models.ProcInsMigrationParam, report *models.ProcInsMigrationReport, operator string) (result *models.ProcInsMigration, err error) {
+	var workflowId string
+	if workflowId, _, err = GetProcWorkByInsId(ctx, procInsId, ""); err != nil {
+		return
+	}
+	mappingBytes, _ := json.Marshal(param)
+	reportBytes, _ := json.Marshal(report)
+	nowTime := time.Now()
+	result = &models.ProcInsMigration{Id: "pmig_" + guid.CreateGuid(), ProcInsId: procInsId, WorkflowId: workflowId, FromProcDefId: report.FromProcDefId, ToProcDefId: param.TargetProcDefId,
+		NodeMapping: string(mappingBytes), Report: string(reportBytes), Status: models.ProcInsMigrationStatusWait, CreatedBy: operator, CreatedTime: nowTime, UpdatedTime: nowTime}
+	_, err = db.MysqlEngine.Context(ctx).Exec("insert into proc_ins_migration(id,proc_ins_id,workflow_id,from_proc_def_id,to_proc_def_id,node_mapping,report,status,created_by,created_time,updated_time) values (?,?,?,?,?,?,?,?,?,?,?)",
+		result.Id, result.ProcInsId, result.WorkflowId, result.FromProcDefId, result.ToProcDefId, result.NodeMapping, result.Report, result.Status, result.CreatedBy, result.CreatedTime, result.UpdatedTime)
+	if err != nil {
+		err = exterror.Catch(exterror.New().DatabaseExecuteError, err)
+	}
+	return
+}
+
+func GetProcInsMigration(ctx context.Context, migrationId string) (result *models.ProcInsMigration, err error) {
+	var migrationRows []*models.ProcInsMigration
+	if err = db.MysqlEngine.Context(ctx).SQL("select * from proc_ins_migration where id=?", migrationId).Find(&migrationRows); err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+		return
+	}
+	if len(migrationRows) == 0 {
+		err = exterror.Catch(exterror.New().DatabaseQueryEmptyError, fmt.Errorf("can not find migration:%s", migrationId))
+		return
+	}
+	result = migrationRows[0]
+	return
+}
+
+// ListProcInsMigration 查编排实例的迁移纪录
+func ListProcInsMigration(ctx context.Context, procInsId string) (result []*models.ProcInsMigration, err error) {
+	result = []*models.ProcInsMigration{}
+	if err = db.MysqlEngine.Context(ctx).SQL("select * from proc_ins_migration where proc_ins_id=? order by created_time desc", procInsId).Find(&result); err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+	}
+	return
+}
+
+// ExecProcInsMigration 工作流退出内存后重新检查迁移计划,在一个事务中改写实例节点、工作流节点和连线
+func ExecProcInsMigration(ctx context.Context, migrationId string) (err error) {
+	migrationRow, getErr := GetProcInsMigration(ctx, migrationId)
+	if getErr != nil {
+		return getErr
+	}
+	if migrationRow.Status != models.ProcInsMigrationStatusWait {
+		return fmt.Errorf("migration %s status is %s", migrationId, migrationRow.Status)
+	}
+	defer func() {
+		if err != nil {
+			FailProcInsMigration(ctx, migrationId, err.Error())
+		}
+	}()
+	param := models.ProcInsMigrationParam{}
+	if err = json.Unmarshal([]byte(migrationRow.NodeMapping), &param); err != nil {
+		err = fmt.Errorf("json unmarshal migration node mapping fail,%s ", err.Error())
+		return
+	}
+	data, report, buildErr := buildProcInsMigration(ctx, migrationRow.ProcInsId, &param)
+	if buildErr != nil {
+		err = buildErr
+		return
+	}
+	if !report.Legal {
+		err = exterror.New().ProcInsMigrationError.WithParam(fmt.Sprintf("%v", report.Errors))
+		return
+	}
+	operator := migrationRow.CreatedBy
+	nowTime := time.Now()
+	var actions []*db.ExecAction
+	actions = append(actions, &db.ExecAction{Sql: "update proc_ins set proc_def_id=?,proc_def_name=?,updated_by=?,updated_time=? where id=?", Param: []interface{}{data.targetDef.Id, data.targetDef.Name, operator, nowTime, data.procIns.Id}})
+	actions = append(actions, &db.ExecAction{Sql: "update proc_data_binding set proc_def_id=? where proc_ins_id=?", Param: []interface{}{data.targetDef.Id, data.procIns.Id}})
+	runNodeIdMap := make(map[string]string)
+	for _, node := range data.nodes {
+		if node.newDefNode == nil {
+			actions = append(actions, &db.ExecAction{Sql: "delete from proc_data_binding where proc_ins_node_id=?", Param: []interface{}{node.insNode.Id}})
+			actions = append(actions, &db.ExecAction{Sql: "delete from proc_run_node where id=?", Param: []interface{}{node.runNode.Id}})
+			actions = append(actions, &db.ExecAction{Sql: "delete from proc_ins_node where id=?", Param: []interface{}{node.insNode.Id}})
+			continue
+		}
+		newDefNode := node.newDefNode
+		runNodeIdMap[newDefNode.Id] = node.runNode.Id
+		actions = append(actions, &db.ExecAction{Sql: "update proc_ins_node set proc_def_node_id=?,name=?,node_type=?,ordered_no=?,updated_by=?,updated_time=? where id=?", Param: []interface{}{
+			newDefNode.Id, newDefNode.Name, newDefNode.NodeType, newDefNode.OrderedNo, operator, nowTime, node.insNode.Id,
+		}})
+		actions = append(actions, &db.ExecAction{Sql: "update proc_data_binding set proc_def_node_id=? where proc_ins_node_id=?", Param: []interface{}{newDefNode.Id, node.insNode.Id}})
+		if node.runNode.Status == models.JobStatusReady {
+			// 未开始的节点按新版本配置重置
+			timeout, input := buildProcRunNodeConfig(newDefNode)
+			actions = append(actions, &db.ExecAction{Sql: "update proc_run_node set name=?,job_type=?,timeout=?,input=?,updated_time=? where id=?", Param: []interface{}{
+				newDefNode.Name, newDefNode.NodeType, timeout, input, nowTime, node.runNode.Id,
+			}})
+		} else {
+			actions = append(actions, &db.ExecAction{Sql: "update proc_run_node set name=?,updated_time=? where id=?", Param: []interface{}{newDefNode.Name, nowTime, node.runNode.Id}})
+		}
+	}
+	for _, newDefNode := range data.addDefNodes {
+		tmpProcInsNodeId := "pins_node_" + guid.CreateGuid()
+		actions = append(actions, &db.ExecAction{Sql: "insert into proc_ins_node(id,proc_ins_id,proc_def_node_id,name,node_type,status,ordered_no,created_by,created_time) values (?,?,?,?,?,?,?,?,?)", Param: []interface{}{
+			tmpProcInsNodeId, data.procIns.Id, newDefNode.Id, newDefNode.Name, newDefNode.NodeType, models.JobStatusReady, newDefNode.OrderedNo, operator, nowTime,
+		}})
+		timeout, input := buildProcRunNodeConfig(newDefNode)
+		runNodeId := "wn_" + guid.CreateGuid()
+		actions = append(actions, &db.ExecAction{Sql: "insert into proc_run_node(id,workflow_id,proc_ins_node_id,name,job_type,status,timeout,input,created_time) values (?,?,?,?,?,?,?,?,?)", Param: []interface{}{
+			runNodeId, data.workflow.Id, tmpProcInsNodeId, newDefNode.Name, newDefNode.NodeType, models.JobStatusReady, timeout, input, nowTime,
+		}})
+		runNodeIdMap[newDefNode.Id] = runNodeId
+	}
+	actions = append(actions, &db.ExecAction{Sql: "delete from proc_run_link where workflow_id=?", Param: []interface{}{data.workflow.Id}})
+	for _, link := range data.newDefLinks {
+		actions = append(actions, &db.ExecAction{Sql: "insert into proc_run_link(id,workflow_id,proc_def_link_id,name,source,target) values (?,?,?,?,?,?)", Param: []interface{}{
+			"wl_" + guid.CreateGuid(), data.workflow.Id, link.Id, link.Name, runNodeIdMap[link.Source], runNodeIdMap[link.Target],
+		}})
+	}
+	for _, variableDef := range data.newVariables {
+		value, _ := variableDef.ConvertValue(variableDef.DefaultValue)
+		actions = append(actions, &db.ExecAction{Sql: "insert into proc_ins_variable(proc_ins_id,name,data_type,value,source_node,updated_by,updated_time) values (?,?,?,?,?,?,?)", Param: []interface{}{
+			data.procIns.Id, variableDef.Name, variableDef.DataType, buildProcInsVariableValue(value), models.ProcVariableSourceDefault, operator, nowTime,
+		}})
+	}
+	reportBytes, _ := json.Marshal(report)
+	actions = append(actions, &db.ExecAction{Sql: "update proc_ins_migration set status=?,report=?,updated_time=? where id=?", Param: []interface{}{models.ProcInsMigrationStatusDone, string(reportBytes), nowTime, migrationId}})
+	if err = db.Transaction(actions, ctx); err != nil {
+		err = exterror.Catch(exterror.New().DatabaseExecuteError, err)
+	}
+	return
+}
+
+// FailProcInsMigration 等待处理的迁移置为失败
+func FailProcInsMigration(ctx context.Context, migrationId, message string) {
+	if _, updateErr := db.MysqlEngine.Context(ctx).Exec("update proc_ins_migration set status=?,error_message=?,updated_time=? where id=? and status=?", models.ProcInsMigrationStatusFail, message, time.Now(), migrationId, models.ProcInsMigrationStatusWait); updateErr != nil {
+		log.Logger.Error("update proc ins migration fail status fail", log.String("migrationId", migrationId), log.Error(updateErr))
+	}
+}
+
+// buildProcRunNodeConfig 与创建实例一致,只有自动和数据节点有超时,时间和信号节点的配置放到输入
+func buildProcRunNodeConfig(defNode *models.ProcDefNode) (timeout int, input string) {
+	if defNode.NodeType == models.JobAutoType || defNode.NodeType == models.JobDataType {
+		timeout = defNode.Timeout
+	}
+	if defNode.NodeType == models.JobTimeType || defNode.NodeType == models.JobDateType || defNode.NodeType == models.JobSignalType {
+		input = defNode.TimeConfig
+	}
+	return
+}
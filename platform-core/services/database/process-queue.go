@@ -0,0 +1,132 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/db"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/exterror"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/log"
+	"github.com/WeBankPartners/wecube-platform/platform-core/models"
+	"strconv"
+	"time"
+)
+
+// checkProcInsNeedQueue 编排配置了并发上限时,已达上限或前面已有排队的实例则新实例进入排队
+// 判断前按编排key加锁,调用方要在实例纪录提交后再调用unlock,避免并发创建时都判断为未达上限
+func checkProcInsNeedQueue(ctx context.Context, procDefObj *models.ProcDef, entityDataId string) (queued bool, unlock func(), err error) {
+	unlock = func() {}
+	policy := models.ParseProcDefConcurrencyPolicy(procDefObj.ConcurrencyPolicy)
+	if !policy.Enabled() {
+		return
+	}
+	if unlock, err = LockProcInsQueue(ctx, procDefObj.Key); err != nil {
+		unlock = func() {}
+		return
+	}
+	checkEntity := policy.MaxRunningPerEntity > 0 && entityDataId != ""
+	if policy.MaxRunning > 0 {
+		if queued, err = checkProcInsQueueExist(ctx, "select count(1) as num from proc_ins_queue where proc_def_key=? and status=?", procDefObj.Key, models.ProcInsQueueStatusQueued); err != nil || queued {
+			return
+		}
+		if queued, err = checkProcInsQueueExist(ctx, "select count(1) as num from proc_ins where proc_def_key=? and status in (?,?) and id not in (select proc_ins_id from proc_ins_simulation) having count(1)>=?",
+			procDefObj.Key, models.JobStatusReady, models.JobStatusRunning, policy.MaxRunning); err != nil || queued {
+			return
+		}
+	}
+	if checkEntity {
+		if queued, err = checkProcInsQueueExist(ctx, "select count(1) as num from proc_ins_queue where proc_def_key=? and entity_data_id=? and status=?", procDefObj.Key, entityDataId, models.ProcInsQueueStatusQueued); err != nil || queued {
+			return
+		}
+		queued, err = checkProcInsQueueExist(ctx, "select count(1) as num from proc_ins where proc_def_key=? and entity_data_id=? and status in (?,?) and id not in (select proc_ins_id from proc_ins_simulation) having count(1)>=?",
+			procDefObj.Key, entityDataId, models.JobStatusReady, models.JobStatusRunning, policy.MaxRunningPerEntity)
+	}
+	return
+}
+
+// LockProcInsQueue 锁住编排key对应的锁纪录,同一编排的并发判断和出队在集群内串行执行,直到unlock才释放
+func LockProcInsQueue(ctx context.Context, procDefKey string) (unlock func(), err error) {
+	// 锁纪录单独插入提交,避免多个事务同时持有共享锁后升级排他锁产生死锁
+	if _, execErr := db.MysqlEngine.Context(ctx).Exec("insert ignore into proc_ins_queue_lock(proc_def_key,created_time) values (?,?)", procDefKey, time.Now()); execErr != nil {
+		err = exterror.Catch(exterror.New().DatabaseExecuteError, execErr)
+		return
+	}
+	session := db.MysqlEngine.NewSession().Context(ctx)
+	if beginErr := session.Begin(); beginErr != nil {
+		session.Close()
+		err = exterror.Catch(exterror.New().DatabaseExecuteError, beginErr)
+		return
+	}
+	if _, queryErr := session.QueryString("select proc_def_key from proc_ins_queue_lock where proc_def_key=? for update", procDefKey); queryErr != nil {
+		session.Rollback()
+		session.Close()
+		err = exterror.Catch(exterror.New().DatabaseQueryError, queryErr)
+		return
+	}
+	unlock = func() {
+		if commitErr := session.Commit(); commitErr != nil {
+			log.Logger.Error("release proc ins queue lock fail", log.String("procDefKey", procDefKey), log.Error(commitErr))
+		}
+		session.Close()
+	}
+	return
+}
+
+func checkProcInsQueueExist(ctx context.Context, sql string, params ...interface{}) (exist bool, err error) {
+	queryRows, queryErr := db.MysqlEngine.Context(ctx).QueryString(append([]interface{}{sql}, params...)...)
+	if queryErr != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, queryErr)
+		return
+	}
+	if len(queryRows) == 0 {
+		return
+	}
+	num, _ := strconv.Atoi(queryRows[0]["num"])
+	exist = num > 0
+	return
+}
+
+// buildProcInsQueueActions 实例进入排队,实例和工作流状态置为排队中
+func buildProcInsQueueActions(procDefObj *models.ProcDef, procStartParam *models.ProcInsStartParam, procInsId, workflowId, entityDataId, operator string, nowTime time.Time) (actions []*db.ExecAction) {
+	actions = append(actions, &db.ExecAction{Sql: "update proc_ins set status=? where id=?", Param: []interface{}{models.JobStatusQueued, procInsId}})
+	actions = append(actions, &db.ExecAction{Sql: "insert into proc_ins_queue(proc_ins_id,workflow_id,proc_def_id,proc_def_key,proc_def_name,entity_data_id,priority,status,created_by,created_time,updated_by,updated_time) values (?,?,?,?,?,?,?,?,?,?,?,?)", Param: []interface{}{
+		procInsId, workflowId, procDefObj.Id, procDefObj.Key, procDefObj.Name, entityDataId, procStartParam.Priority, models.ProcInsQueueStatusQueued, operator, nowTime, operator, nowTime,
+	}})
+	return
+}
+
+// ListProcInsQueue 查询排队中的实例,按出队顺序排列
+func ListProcInsQueue(ctx context.Context, procDefKey string) (result []*models.ProcInsQueue, err error) {
+	result = []*models.ProcInsQueue{}
+	baseSql := "select * from proc_ins_queue where status=?"
+	queryParam := []interface{}{models.ProcInsQueueStatusQueued}
+	if procDefKey != "" {
+		baseSql += " and proc_def_key=?"
+		queryParam = append(queryParam, procDefKey)
+	}
+	err = db.MysqlEngine.Context(ctx).SQL(baseSql+" order by proc_def_key,priority desc,id", queryParam...).Find(&result)
+	if err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+	}
+	return
+}
+
+// CancelProcInsQueue 取消排队中的实例,实例直接置为终止
+func CancelProcInsQueue(ctx context.Context, procInsId, operator string) (err error) {
+	nowTime := time.Now()
+	execResult, execErr := db.MysqlEngine.Context(ctx).Exec("update proc_ins_queue set status=?,updated_by=?,updated_time=? where proc_ins_id=? and status=?", models.ProcInsQueueStatusCanceled, operator, nowTime, procInsId, models.ProcInsQueueStatusQueued)
+	if execErr != nil {
+		err = exterror.Catch(exterror.New().DatabaseExecuteError, execErr)
+		return
+	}
+	if affectNum, _ := execResult.RowsAffected(); affectNum == 0 {
+		err = exterror.New().ProcInsQueueStatusError
+		return
+	}
+	var actions []*db.ExecAction
+	actions = append(actions, &db.ExecAction{Sql: "update proc_ins set status=?,updated_by=?,updated_time=? where id=?", Param: []interface{}{models.JobStatusKill, operator, nowTime, procInsId}})
+	actions = append(actions, &db.ExecAction{Sql: "update proc_run_workflow set status=?,error_message=?,updated_time=? where proc_ins_id=?", Param: []interface{}{models.JobStatusKill, fmt.Sprintf("queue canceled by %s", operator), nowTime, procInsId}})
+	if err = db.Transaction(actions, ctx); err != nil {
+		err = exterror.Catch(exterror.New().DatabaseExecuteError, err)
+	}
+	return
+}
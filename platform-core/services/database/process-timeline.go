@@ -0,0 +1,98 @@
+package database
+
+import (
+	"context"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/db"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/exterror"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/log"
+	"github.com/WeBankPartners/wecube-platform/platform-core/models"
+	"time"
+)
+
+// buildProcInsTimelineAction 生成追加实例时间线的sql,没有实例id时按工作流id或编排节点id取
+func buildProcInsTimelineAction(event *models.ProcInsTimeline) *db.ExecAction {
+	if event.Host == "" {
+		event.Host = models.Config.HostIp
+	}
+	if event.CreatedTime.IsZero() {
+		event.CreatedTime = time.Now()
+	}
+	// 按字符截断,避免截断中文等多字节字符后写入失败
+	if messageRunes := []rune(event.Message); len(messageRunes) > models.TimelineMessageMaxLength {
+		event.Message = string(messageRunes[:models.TimelineMessageMaxLength])
+	}
+	columnSql := "insert into proc_ins_timeline(proc_ins_id,workflow_id,proc_ins_node_id,proc_run_node_id,node_name,event_type,status,message,ref_id,host,created_by,created_time) "
+	params := []interface{}{event.ProcInsNodeId, event.ProcRunNodeId, event.NodeName, event.EventType, event.Status, event.Message, event.RefId, event.Host, event.CreatedBy, event.CreatedTime}
+	if event.ProcInsId != "" {
+		return &db.ExecAction{Sql: columnSql + "values (?,?,?,?,?,?,?,?,?,?,?,?)", Param: append([]interface{}{event.ProcInsId, event.WorkflowId}, params...)}
+	}
+	if event.WorkflowId != "" {
+		return &db.ExecAction{Sql: columnSql + "select proc_ins_id,id,?,?,?,?,?,?,?,?,?,? from proc_run_workflow where id=?", Param: append(params, event.WorkflowId)}
+	}
+	return &db.ExecAction{Sql: columnSql + "select proc_ins_id,null,?,?,?,?,?,?,?,?,?,? from proc_ins_node where id=?", Param: append(params, event.ProcInsNodeId)}
+}
+
+// AddProcInsTimeline 追加实例时间线,失败只记日志不影响主流程,和状态变更一起时要在状态变更提交后再调用
+func AddProcInsTimeline(ctx context.Context, event *models.ProcInsTimeline) {
+	action := buildProcInsTimelineAction(event)
+	if _, err := db.MysqlEngine.Context(ctx).Exec(append([]interface{}{action.Sql}, action.Param...)...); err != nil {
+		log.Logger.Error("add proc ins timeline fail", log.String("eventType", event.EventType), log.String("workflowId", event.WorkflowId), log.Error(err))
+	}
+}
+
+// QueryProcInsTimeline 按发生顺序分页查实例时间线,可按事件类型和节点过滤
+func QueryProcInsTimeline(ctx context.Context, procInsId, eventType, procInsNodeId string, pageInfo *models.PageInfo) (result *models.ProcInsTimelinePageData, err error) {
+	result = &models.ProcInsTimelinePageData{PageInfo: &models.PageInfo{}, Contents: []*models.ProcInsTimeline{}}
+	baseSql, queryParam := buildProcInsTimelineSql(procInsId, eventType, procInsNodeId)
+	if pageInfo != nil {
+		result.PageInfo = &models.PageInfo{StartIndex: pageInfo.StartIndex, PageSize: pageInfo.PageSize, TotalRows: queryCount(ctx, baseSql, queryParam...)}
+		pageSql, pageParam := transPageInfoToSQL(*pageInfo)
+		baseSql = db.CombineDBSql(baseSql, pageSql)
+		queryParam = append(queryParam, pageParam...)
+	}
+	if err = db.MysqlEngine.Context(ctx).SQL(baseSql, queryParam...).Find(&result.Contents); err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+		return
+	}
+	if pageInfo == nil {
+		result.PageInfo.TotalRows = len(result.Contents)
+	}
+	return
+}
+
+// ExportProcInsTimeline 按id分页读取实例完整时间线,每页交给handle处理,不在内存中保留全部纪录
+func ExportProcInsTimeline(ctx context.Context, procInsId string, handle func(rows []*models.ProcInsTimeline) error) (err error) {
+	var lastId int64
+	for {
+		var rows []*models.ProcInsTimeline
+		if err = db.MysqlEngine.Context(ctx).SQL("select * from proc_ins_timeline where proc_ins_id=? and id>? order by id limit ?", procInsId, lastId, models.TimelineExportPageSize).Find(&rows); err != nil {
+			err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+			return
+		}
+		if len(rows) == 0 {
+			return
+		}
+		if err = handle(rows); err != nil {
+			return
+		}
+		if len(rows) < models.TimelineExportPageSize {
+			return
+		}
+		lastId = rows[len(rows)-1].Id
+	}
+}
+
+func buildProcInsTimelineSql(procInsId, eventType, procInsNodeId string) (baseSql string, queryParam []interface{}) {
+	baseSql = "select * from proc_ins_timeline where proc_ins_id=?"
+	queryParam = []interface{}{procInsId}
+	if eventType != "" {
+		baseSql += " and event_type=?"
+		queryParam = append(queryParam, eventType)
+	}
+	if procInsNodeId != "" {
+		baseSql += " and proc_ins_node_id=?"
+		queryParam = append(queryParam, procInsNodeId)
+	}
+	baseSql += " order by id"
+	return
+}
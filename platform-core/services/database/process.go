@@ -253,6 +253,8 @@ func AddProcessDefinition(ctx context.Context, user string, param models.Process
 	draftEntity.UpdatedBy = user
 	draftEntity.UpdatedTime = now
 	draftEntity.RootEntity = param.RootEntity
+	draftEntity.Variables = param.Variables.String()
+	draftEntity.ConcurrencyPolicy = param.ConcurrencyPolicy.String()
 	// 计算编排的版本
 	draftEntity.Version = "v1"
 	err = insertProcDef(ctx, draftEntity)
@@ -410,9 +412,9 @@ func execCopyProcessDefinition(ctx context.Context, procDef *models.ProcDef, nod
 	var actions []*db.ExecAction
 	// 插入编排
 	actions = append(actions, &db.ExecAction{Sql: "insert into proc_def (id,`key`,name,root_entity,status,tags,for_plugin,scene," +
-		"conflict_check,created_by,version,sub_proc,created_time,updated_by,updated_time) values (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)", Param: []interface{}{newProcDefId,
+		"conflict_check,created_by,version,sub_proc,created_time,updated_by,updated_time,variables,concurrency_policy) values (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)", Param: []interface{}{newProcDefId,
 		procDef.Key, procDef.Name, procDef.RootEntity, models.Draft, procDef.Tags, procDef.ForPlugin, procDef.Scene,
-		procDef.ConflictCheck, operator, procDef.Version, procDef.SubProc, currTime, operator, currTime}})
+		procDef.ConflictCheck, operator, procDef.Version, procDef.SubProc, currTime, operator, currTime, procDef.Variables, procDef.ConcurrencyPolicy}})
 
 	// 插入权限
 	if len(permissionList) > 0 {
@@ -429,9 +431,9 @@ func execCopyProcessDefinition(ctx context.Context, procDef *models.ProcDef, nod
 			newNodeId := models.GenNodeId(node.NodeType)
 			actions = append(actions, &db.ExecAction{Sql: "insert into  proc_def_node(id,node_id,proc_def_id,name,description,status,node_type,service_name," +
 				"dynamic_bind,bind_node_id,risk_check,routine_expression,context_param_nodes,timeout,time_config,ordered_no,ui_style,created_by,created_time," +
-				"updated_by,updated_time,allow_continue,sub_proc_def_id) values (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)", Param: []interface{}{newNodeId, node.NodeId, newProcDefId, node.Name, node.Description,
+				"updated_by,updated_time,allow_continue,sub_proc_def_id,retry_policy,loop_policy,compensate_service,output_mappings,approval_policy) values (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)", Param: []interface{}{newNodeId, node.NodeId, newProcDefId, node.Name, node.Description,
 				models.Draft, node.NodeType, node.ServiceName, node.DynamicBind, node.BindNodeId, node.RiskCheck, node.RoutineExpression, node.ContextParamNodes,
-				node.Timeout, node.TimeConfig, node.OrderedNo, node.UiStyle, operator, currTime, node.UpdatedBy, currTime, node.AllowContinue, node.SubProcDefId}})
+				node.Timeout, node.TimeConfig, node.OrderedNo, node.UiStyle, operator, currTime, node.UpdatedBy, currTime, node.AllowContinue, node.SubProcDefId, node.RetryPolicy, node.LoopPolicy, node.CompensateService, node.OutputMappings, node.ApprovalPolicy}})
 			for _, nodeParam := range nodeParamList {
 				if nodeParam.ProcDefNodeId == node.NodeId {
 					curNodeParamList = append(curNodeParamList, nodeParam)
@@ -459,8 +461,8 @@ func execCopyProcessDefinition(ctx context.Context, procDef *models.ProcDef, nod
 	// 插入线
 	if len(linkList) > 0 {
 		for _, nodeLink := range linkList {
-			actions = append(actions, &db.ExecAction{Sql: "insert into  proc_def_node_link(id,source,target,name,ui_style,link_id,proc_def_id) values(?,?,?,?,?,?,?)",
-				Param: []interface{}{"pdl_" + guid.CreateGuid(), nodeLink.Source, nodeLink.Target, nodeLink.Name, nodeLink.UiStyle, nodeLink.LinkId, newProcDefId}})
+			actions = append(actions, &db.ExecAction{Sql: "insert into  proc_def_node_link(id,source,target,name,ui_style,link_id,proc_def_id,expression,is_default) values(?,?,?,?,?,?,?,?,?)",
+				Param: []interface{}{"pdl_" + guid.CreateGuid(), nodeLink.Source, nodeLink.Target, nodeLink.Name, nodeLink.UiStyle, nodeLink.LinkId, newProcDefId, nodeLink.Expression, nodeLink.IsDefault}})
 		}
 	}
 
@@ -546,8 +548,8 @@ func GetProcessDefinitionByCondition(ctx context.Context, condition models.ProcD
 func UpdateProcDef(ctx context.Context, procDef *models.ProcDef) (err error) {
 	var actions []*db.ExecAction
 	actions = append(actions, &db.ExecAction{Sql: "update proc_def set name=?,root_entity=?,tags=?,for_plugin=?,scene=?," +
-		"conflict_check=?,updated_by=?,updated_time=?,sub_proc=? where id=?", Param: []interface{}{procDef.Name, procDef.RootEntity,
-		procDef.Tags, procDef.ForPlugin, procDef.Scene, procDef.ConflictCheck, procDef.UpdatedBy, procDef.UpdatedTime, procDef.SubProc, procDef.Id}})
+		"conflict_check=?,updated_by=?,updated_time=?,sub_proc=?,variables=?,concurrency_policy=? where id=?", Param: []interface{}{procDef.Name, procDef.RootEntity,
+		procDef.Tags, procDef.ForPlugin, procDef.Scene, procDef.ConflictCheck, procDef.UpdatedBy, procDef.UpdatedTime, procDef.SubProc, procDef.Variables, procDef.ConcurrencyPolicy, procDef.Id}})
 	err = db.Transaction(actions, ctx)
 	if err != nil {
 		err = exterror.Catch(exterror.New().DatabaseExecuteError, err)
@@ -570,8 +572,8 @@ func UpdateProcDefAndNode(ctx context.Context, procDef *models.ProcDef, nodeList
 	var actions []*db.ExecAction
 	// 更新编排表
 	actions = append(actions, &db.ExecAction{Sql: "update proc_def set name=?,root_entity=?,tags=?,for_plugin=?,scene=?," +
-		"conflict_check=?,updated_by=?,updated_time=?,sub_proc=? where id=?", Param: []interface{}{procDef.Name, procDef.RootEntity,
-		procDef.Tags, procDef.ForPlugin, procDef.Scene, procDef.ConflictCheck, procDef.UpdatedBy, procDef.UpdatedTime, procDef.SubProc, procDef.Id}})
+		"conflict_check=?,updated_by=?,updated_time=?,sub_proc=?,variables=?,concurrency_policy=? where id=?", Param: []interface{}{procDef.Name, procDef.RootEntity,
+		procDef.Tags, procDef.ForPlugin, procDef.Scene, procDef.ConflictCheck, procDef.UpdatedBy, procDef.UpdatedTime, procDef.SubProc, procDef.Variables, procDef.ConcurrencyPolicy, procDef.Id}})
 	// 更新节点表
 	actions = append(actions, &db.ExecAction{Sql: "update proc_def_node  set service_name = null,routine_expression = null where" +
 		" proc_def_id =?", Param: []interface{}{procDef.Id}})
@@ -668,8 +670,9 @@ func GetProcDefNodeLinkByProcDefIdAndTarget(ctx context.Context, procDefId strin
 	return
 }
 
+// GetProcDefNodeLinkByProcDefIdAndSource 查节点的出线,按连线名称和id排序,判断节点按这个顺序计算分支表达式
 func GetProcDefNodeLinkByProcDefIdAndSource(ctx context.Context, procDefId string, source string) (list []*models.ProcDefNodeLink, err error) {
-	err = db.MysqlEngine.Context(ctx).SQL("select * from proc_def_node_link where proc_def_id= ? and source = ?", procDefId, source).Find(&list)
+	err = db.MysqlEngine.Context(ctx).SQL("select * from proc_def_node_link where proc_def_id= ? and source = ? order by name,link_id,id", procDefId, source).Find(&list)
 	if err != nil {
 		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
 		return
@@ -747,8 +750,8 @@ func GetProcDefNodeById(ctx context.Context, procDefId string) (list []*models.P
 // InsertProcDefNodeLink 添加编排节点线
 func InsertProcDefNodeLink(ctx context.Context, nodeLink *models.ProcDefNodeLink) (err error) {
 	var actions []*db.ExecAction
-	actions = append(actions, &db.ExecAction{Sql: "insert into  proc_def_node_link(id,source,target,name,ui_style,link_id,proc_def_id) values(?,?,?,?,?,?,?)",
-		Param: []interface{}{nodeLink.Id, nodeLink.Source, nodeLink.Target, nodeLink.Name, nodeLink.UiStyle, nodeLink.LinkId, nodeLink.ProcDefId}})
+	actions = append(actions, &db.ExecAction{Sql: "insert into  proc_def_node_link(id,source,target,name,ui_style,link_id,proc_def_id,expression,is_default) values(?,?,?,?,?,?,?,?,?)",
+		Param: []interface{}{nodeLink.Id, nodeLink.Source, nodeLink.Target, nodeLink.Name, nodeLink.UiStyle, nodeLink.LinkId, nodeLink.ProcDefId, nodeLink.Expression, nodeLink.IsDefault}})
 	err = db.Transaction(actions, ctx)
 	if err != nil {
 		err = exterror.Catch(exterror.New().DatabaseExecuteError, err)
@@ -773,9 +776,9 @@ func InsertProcDefNode(ctx context.Context, node *models.ProcDefNode) (err error
 	var actions []*db.ExecAction
 	actions = append(actions, &db.ExecAction{Sql: "insert into  proc_def_node(id,node_id,proc_def_id,name,description,status,node_type,service_name," +
 		"dynamic_bind,bind_node_id,risk_check,routine_expression,context_param_nodes,timeout,time_config,ordered_no,ui_style,created_by,created_time," +
-		"updated_by,updated_time,allow_continue,sub_proc_def_id) values (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)", Param: []interface{}{node.Id, node.NodeId, node.ProcDefId, node.Name, node.Description,
+		"updated_by,updated_time,allow_continue,sub_proc_def_id,retry_policy,loop_policy,compensate_service,output_mappings,approval_policy) values (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)", Param: []interface{}{node.Id, node.NodeId, node.ProcDefId, node.Name, node.Description,
 		node.Status, node.NodeType, node.ServiceName, node.DynamicBind, node.BindNodeId, node.RiskCheck, node.RoutineExpression, node.ContextParamNodes,
-		node.Timeout, node.TimeConfig, node.OrderedNo, node.UiStyle, node.CreatedBy, node.CreatedTime.Format(models.DateTimeFormat), node.UpdatedBy, node.UpdatedTime.Format(models.DateTimeFormat), node.AllowContinue, node.SubProcDefId}})
+		node.Timeout, node.TimeConfig, node.OrderedNo, node.UiStyle, node.CreatedBy, node.CreatedTime.Format(models.DateTimeFormat), node.UpdatedBy, node.UpdatedTime.Format(models.DateTimeFormat), node.AllowContinue, node.SubProcDefId, node.RetryPolicy, node.LoopPolicy, node.CompensateService, node.OutputMappings, node.ApprovalPolicy}})
 	err = db.Transaction(actions, ctx)
 	if err != nil {
 		err = exterror.Catch(exterror.New().DatabaseExecuteError, err)
@@ -1033,9 +1036,9 @@ func BatchAddProcDefPermission(ctx context.Context, procDefId string, permission
 func insertProcDef(ctx context.Context, procDef *models.ProcDef) (err error) {
 	var actions []*db.ExecAction
 	actions = append(actions, &db.ExecAction{Sql: "insert into  proc_def (id,`key`,name,root_entity,status,tags,for_plugin,scene," +
-		"conflict_check,version,created_by,created_time,updated_by,updated_time) values (?,?,?,?,?,?,?,?,?,?,?,?,?,?)", Param: []interface{}{procDef.Id,
+		"conflict_check,version,created_by,created_time,updated_by,updated_time,variables,concurrency_policy) values (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)", Param: []interface{}{procDef.Id,
 		procDef.Key, procDef.Name, procDef.RootEntity, procDef.Status, procDef.Tags, procDef.ForPlugin, procDef.Scene,
-		procDef.ConflictCheck, procDef.Version, procDef.CreatedBy, procDef.CreatedTime.Format(models.DateTimeFormat), procDef.UpdatedBy, procDef.UpdatedTime.Format(models.DateTimeFormat)}})
+		procDef.ConflictCheck, procDef.Version, procDef.CreatedBy, procDef.CreatedTime.Format(models.DateTimeFormat), procDef.UpdatedBy, procDef.UpdatedTime.Format(models.DateTimeFormat), procDef.Variables, procDef.ConcurrencyPolicy}})
 	err = db.Transaction(actions, ctx)
 	if err != nil {
 		err = exterror.Catch(exterror.New().DatabaseExecuteError, err)
@@ -1108,6 +1111,8 @@ func transProcDefNodeUpdateConditionToSQL(procDefNode *models.ProcDefNode) (sql
 		sql = sql + ",sub_proc_def_id=?"
 		params = append(params, procDefNode.SubProcDefId)
 	}
+	sql = sql + ",retry_policy=?,loop_policy=?,compensate_service=?,output_mappings=?,approval_policy=?"
+	params = append(params, procDefNode.RetryPolicy, procDefNode.LoopPolicy, procDefNode.CompensateService, procDefNode.OutputMappings, procDefNode.ApprovalPolicy)
 	if procDefNode.UpdatedBy != "" {
 		sql = sql + ",updated_by=?"
 		params = append(params, procDefNode.UpdatedBy)
@@ -1146,6 +1151,9 @@ func transProcDefNodeLinkUpdateConditionToSQL(procDefNodeLink *models.ProcDefNod
 		sql = sql + ",proc_def_id=?"
 		params = append(params, procDefNodeLink.ProcDefId)
 	}
+	// 表达式和默认分支允许被清空,每次都更新
+	sql = sql + ",expression=?,is_default=?"
+	params = append(params, procDefNodeLink.Expression, procDefNodeLink.IsDefault)
 	sql = sql + " where id= ?"
 	params = append(params, procDefNodeLink.Id)
 	return
@@ -38,11 +38,12 @@ func CreateProcSchedule(ctx context.Context, param *models.CreateProcSchedulePar
 		Role:           param.Role,
 		MailMode:       param.MailMode,
 		Name:           param.Name,
+		Calendar:       param.Calendar,
 		UpdatedBy:      param.Operator,
 		UpdatedTime:    time.Now(),
 	}
-	_, err = db.MysqlEngine.Context(ctx).Exec("insert into proc_schedule_config(id,proc_def_id,proc_def_key,proc_def_name,status,entity_data_id,entity_type_id,entity_data_name,schedule_mode,schedule_expr,cron_expr,exec_times,created_by,created_time,updated_by,updated_time,`role`,mail_mode,name) values (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)",
-		result.Id, result.ProcDefId, result.ProcDefKey, result.ProcDefName, result.Status, result.EntityDataId, result.EntityTypeId, result.EntityDataName, result.ScheduleMode, result.ScheduleExpr, result.CronExpr, 0, result.CreatedBy, result.CreatedTime, result.UpdatedBy, result.UpdatedTime, param.Role, param.MailMode, param.Name)
+	_, err = db.MysqlEngine.Context(ctx).Exec("insert into proc_schedule_config(id,proc_def_id,proc_def_key,proc_def_name,status,entity_data_id,entity_type_id,entity_data_name,schedule_mode,schedule_expr,cron_expr,exec_times,created_by,created_time,updated_by,updated_time,`role`,mail_mode,name,calendar) values (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)",
+		result.Id, result.ProcDefId, result.ProcDefKey, result.ProcDefName, result.Status, result.EntityDataId, result.EntityTypeId, result.EntityDataName, result.ScheduleMode, result.ScheduleExpr, result.CronExpr, 0, result.CreatedBy, result.CreatedTime, result.UpdatedBy, result.UpdatedTime, param.Role, param.MailMode, param.Name, param.Calendar)
 	if err != nil {
 		err = exterror.Catch(exterror.New().DatabaseExecuteError, err)
 	}
@@ -343,6 +344,7 @@ func QueryProcScheduleList(ctx context.Context, param *models.ProcScheduleQueryP
 			TotalTimeoutInstances:    timeoutMap[row.Id],
 			TotalTerminateInstances:  terminateMap[row.Id],
 			Role:                     row.Role,
+			Calendar:                 row.Calendar,
 			MailMode:                 row.MailMode,
 			Version:                  procDefVersionMap[row.ProcDefId],
 			Name:                     row.Name,
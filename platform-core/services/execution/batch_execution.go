@@ -1047,6 +1047,24 @@ func handleOutputData(
 			}
 		}
 	}
+	// 模拟运行只纪录本应写入的数据
+	if simCtx := getSimulation(ctx); simCtx != nil {
+		for _, rootData := range tmpResultForEntity.Data {
+			if rootData.FailFlag {
+				continue
+			}
+			writeAction := models.SimulationActionEntityUpdate
+			if rootData.Id == "" {
+				writeAction = models.SimulationActionEntityCreate
+			}
+			recordSimulationEntityWrite(ctx, simCtx, writeAction, tmpResultForEntity.Package, tmpResultForEntity.Entity, []map[string]interface{}{rootData.Data})
+			for _, branchData := range rootData.SubBranchs {
+				recordSimulationEntityWrite(ctx, simCtx, models.SimulationActionEntityUpdate, tmpResultForEntity.Package, tmpResultForEntity.Entity, []map[string]interface{}{branchData.Data})
+			}
+		}
+		result = tmpResult
+		return
+	}
 	// 处理entity写入
 	for _, rootData := range tmpResultForEntity.Data {
 		if rootData.FailFlag {
@@ -0,0 +1,99 @@
+package execution
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/WeBankPartners/go-common-lib/guid"
+	"github.com/WeBankPartners/wecube-platform/platform-core/models"
+	"github.com/WeBankPartners/wecube-platform/platform-core/services/database"
+	"github.com/WeBankPartners/wecube-platform/platform-core/services/remote"
+)
+
+// PreviewWorkflowNodeInput 解析暂停在断点的自动节点将要发给插件的入参,已应用断点上修改的值
+func PreviewWorkflowNodeInput(ctx context.Context, procRunNodeId string) (inputs []map[string]interface{}, err error) {
+	inputs = []map[string]interface{}{}
+	procInsNode, procDefNode, procDefNodeParams, dataBindings, getNodeDataErr := database.GetProcExecNodeData(ctx, procRunNodeId)
+	if getNodeDataErr != nil {
+		err = getNodeDataErr
+		return
+	}
+	if procDefNode.NodeType != models.JobAutoType {
+		return
+	}
+	if procDefNode.DynamicBind == 1 {
+		dataBindings, err = database.GetDynamicBindNodeData(ctx, procInsNode.ProcInsId, procDefNode.ProcDefId, procDefNode.BindNodeId)
+	} else if procDefNode.DynamicBind == 2 {
+		dataBindings, err = DynamicBindNodeInRuntime(ctx, procInsNode, procDefNode)
+	}
+	if err != nil {
+		err = fmt.Errorf("get node dynamic bind data fail,%s ", err.Error())
+		return
+	}
+	if len(dataBindings) == 0 {
+		return
+	}
+	param, buildErr := buildNodePluginCallParam(ctx, procInsNode, procDefNode, procDefNodeParams, dataBindings, procDefNode.ServiceName, "")
+	if buildErr != nil {
+		err = buildErr
+		return
+	}
+	if ctx, _, err = withSimulation(ctx, procInsNode); err != nil {
+		return
+	}
+	rootExprList, analyzeErr := remote.AnalyzeExpression(param.EntityType)
+	if analyzeErr != nil {
+		err = analyzeErr
+		return
+	}
+	if len(rootExprList) == 0 {
+		err = fmt.Errorf("invalid input entity type %s", param.EntityType)
+		return
+	}
+	procInsNodeReq := models.ProcInsNodeReq{Id: "proc_req_" + guid.CreateGuid(), ProcInsNodeId: procInsNode.Id}
+	inputParamDatas, handleErr := handleInputData(ctx, remote.GetToken(), "", param.EntityInstances, param.PluginInterface.InputParameters, rootExprList[len(rootExprList)-1], param.InputConstantMap, param.InputParamContext, &procInsNodeReq)
+	if handleErr != nil {
+		err = handleErr
+		return
+	}
+	if err = applyBreakpointInputOverride(ctx, procInsNode.Id, inputParamDatas, &procInsNodeReq); err != nil {
+		return
+	}
+	for _, v := range inputParamDatas {
+		inputs = append(inputs, v)
+	}
+	return
+}
+
+// applyBreakpointInputOverride 用断点放行时修改的值覆盖插件入参和请求纪录,指定数据行的值优先于*
+func applyBreakpointInputOverride(ctx context.Context, procInsNodeId string, inputParamDatas []models.BatchExecutionPluginExecInputParams, procInsNodeReq *models.ProcInsNodeReq) (err error) {
+	inputOverride, getErr := database.GetProcRunBreakpointInputOverride(ctx, procInsNodeId)
+	if getErr != nil || len(inputOverride) == 0 {
+		err = getErr
+		return
+	}
+	for _, inputParamData := range inputParamDatas {
+		rowId := fmt.Sprintf("%v", inputParamData[models.PluginCallParamPresetCallback])
+		for _, key := range []string{models.BreakpointInputAllEntity, rowId} {
+			for name, value := range inputOverride[key] {
+				if _, ok := inputParamData[name]; !ok || name == models.PluginCallParamPresetCallback {
+					continue
+				}
+				inputParamData[name] = value
+			}
+		}
+	}
+	for _, reqParam := range procInsNodeReq.Params {
+		for _, key := range []string{models.BreakpointInputAllEntity, reqParam.CallbackId} {
+			if value, ok := inputOverride[key][reqParam.Name]; ok {
+				if stringValue, isString := value.(string); isString {
+					reqParam.DataValue = stringValue
+				} else {
+					valueBytes, _ := json.Marshal(value)
+					reqParam.DataValue = string(valueBytes)
+				}
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,125 @@
+package execution
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/log"
+	"github.com/WeBankPartners/wecube-platform/platform-core/models"
+	"github.com/WeBankPartners/wecube-platform/platform-core/services/database"
+)
+
+// simulationRunCtx 模拟运行时放在ctx中,用于替换插件调用和数据写入
+type simulationRunCtx struct {
+	simulation  *models.ProcInsSimulation
+	procInsNode *models.ProcInsNode
+}
+
+// withSimulation 编排实例是模拟运行时在ctx中带上模拟信息
+func withSimulation(ctx context.Context, procInsNode *models.ProcInsNode) (newCtx context.Context, simulation *models.ProcInsSimulation, err error) {
+	newCtx = ctx
+	if simulation, err = database.GetProcInsSimulation(ctx, procInsNode.ProcInsId); err != nil || simulation == nil {
+		return
+	}
+	newCtx = context.WithValue(ctx, models.SimulationCtxKey, &simulationRunCtx{simulation: simulation, procInsNode: procInsNode})
+	return
+}
+
+func getSimulation(ctx context.Context) *simulationRunCtx {
+	if v, ok := ctx.Value(models.SimulationCtxKey).(*simulationRunCtx); ok {
+		return v
+	}
+	return nil
+}
+
+// simulatePluginCall 用mock返回代替插件调用,没有配置mock的服务默认每条数据都返回成功
+func simulatePluginCall(ctx context.Context, simCtx *simulationRunCtx, pluginCallParam *models.BatchExecutionPluginExecParam) (result *models.PluginInterfaceApiResultData, errCode string, err error) {
+	mock := simCtx.simulation.GetMock(pluginCallParam.ServiceName)
+	if mock == nil {
+		mock = &models.ProcSimulationMock{ServiceName: pluginCallParam.ServiceName}
+	}
+	result = &models.PluginInterfaceApiResultData{Outputs: buildSimulationOutputs(mock, pluginCallParam)}
+	errCode = "0"
+	if mock.ResultCode != "" && mock.ResultCode != "0" {
+		errCode = mock.ResultCode
+		err = fmt.Errorf("%s", mock.ErrorMessage)
+	}
+	recordSimulationTrace(ctx, simCtx, models.SimulationActionPlugin, pluginCallParam.ServiceName, pluginCallParam, result, err)
+	return
+}
+
+// simulateHumanCall 用mock返回代替人工任务创建,并直接构造任务回调数据,ResultCode即人工选择的分支
+func simulateHumanCall(ctx context.Context, simCtx *simulationRunCtx, pluginCallParam *models.BatchExecutionPluginExecParam) (callbackData *models.PluginTaskCreateResp, err error) {
+	mock := simCtx.simulation.GetMock(pluginCallParam.ServiceName)
+	if mock == nil {
+		mock = &models.ProcSimulationMock{ServiceName: pluginCallParam.ServiceName}
+	}
+	if mock.ResultCode != "" && mock.ResultCode != "0" {
+		err = fmt.Errorf("%s", mock.ErrorMessage)
+		recordSimulationTrace(ctx, simCtx, models.SimulationActionHuman, pluginCallParam.ServiceName, pluginCallParam, nil, err)
+		return
+	}
+	callbackData = &models.PluginTaskCreateResp{ResultCode: mock.ChoseOption, Results: models.PluginTaskCreateOutput{RequestId: pluginCallParam.RequestId}}
+	for _, output := range buildSimulationOutputs(mock, pluginCallParam) {
+		outputObj := models.PluginTaskCreateOutputObj{ErrorCode: "0", TaskFormOutput: "{}"}
+		outputObj.CallbackParameter = fmt.Sprintf("%v", output["callbackParameter"])
+		if v, ok := output["comment"]; ok {
+			outputObj.Comment = fmt.Sprintf("%v", v)
+		}
+		if v, ok := output["taskFormOutput"]; ok {
+			if taskFormStr, isStr := v.(string); isStr {
+				outputObj.TaskFormOutput = taskFormStr
+			} else {
+				taskFormBytes, _ := json.Marshal(v)
+				outputObj.TaskFormOutput = string(taskFormBytes)
+			}
+		}
+		callbackData.Results.Outputs = append(callbackData.Results.Outputs, &outputObj)
+	}
+	recordSimulationTrace(ctx, simCtx, models.SimulationActionHuman, pluginCallParam.ServiceName, pluginCallParam, callbackData, nil)
+	return
+}
+
+// buildSimulationOutputs 按输入数据逐条生成输出,带上callbackParameter以便和输入对应
+func buildSimulationOutputs(mock *models.ProcSimulationMock, pluginCallParam *models.BatchExecutionPluginExecParam) (outputs []map[string]interface{}) {
+	outputs = []map[string]interface{}{}
+	for i, input := range pluginCallParam.Inputs {
+		output := make(map[string]interface{})
+		if len(mock.Outputs) > 0 {
+			mockIndex := i
+			if mockIndex >= len(mock.Outputs) {
+				mockIndex = len(mock.Outputs) - 1
+			}
+			for k, v := range mock.Outputs[mockIndex] {
+				output[k] = v
+			}
+		}
+		output["callbackParameter"] = input["callbackParameter"]
+		if _, ok := output["errorCode"]; !ok {
+			output["errorCode"] = "0"
+		}
+		outputs = append(outputs, output)
+	}
+	return
+}
+
+// recordSimulationEntityWrite 模拟运行时纪录本应写入的数据
+func recordSimulationEntityWrite(ctx context.Context, simCtx *simulationRunCtx, action, packageName, entityName string, dataList []map[string]interface{}) {
+	recordSimulationTrace(ctx, simCtx, action, fmt.Sprintf("%s:%s", packageName, entityName), dataList, nil, nil)
+}
+
+func recordSimulationTrace(ctx context.Context, simCtx *simulationRunCtx, action, serviceName string, request, response interface{}, callErr error) {
+	trace := models.ProcInsSimulationTrace{ProcInsId: simCtx.simulation.ProcInsId, ProcInsNodeId: simCtx.procInsNode.Id, NodeName: simCtx.procInsNode.Name, Action: action, ServiceName: serviceName}
+	requestBytes, _ := json.Marshal(request)
+	trace.Request = string(requestBytes)
+	if response != nil {
+		responseBytes, _ := json.Marshal(response)
+		trace.Response = string(responseBytes)
+	}
+	if callErr != nil {
+		trace.ErrorMessage = callErr.Error()
+	}
+	if err := database.AddProcInsSimulationTrace(ctx, &trace); err != nil {
+		log.Logger.Error("record simulation trace fail", log.String("procIns", trace.ProcInsId), log.String("action", action), log.Error(err))
+	}
+}
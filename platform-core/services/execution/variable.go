@@ -0,0 +1,85 @@
+package execution
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/log"
+	"github.com/WeBankPartners/wecube-platform/platform-core/models"
+	"github.com/WeBankPartners/wecube-platform/platform-core/services/database"
+)
+
+// buildNodeVariableParams 节点参数绑定编排变量时,变量值同时放到静态值和上下文参数中,对应插件参数的映射方式取值
+func buildNodeVariableParams(ctx context.Context, procInsId string, procDefNodeParams []*models.ProcDefNodeParam, interfaceParamIdMap, inputConstantMap map[string]string, inputContextMap map[string]interface{}) (err error) {
+	var variableMap map[string]interface{}
+	for _, v := range procDefNodeParams {
+		if v.BindType != models.ProcDefNodeParamBindVariable {
+			continue
+		}
+		if variableMap == nil {
+			if variableMap, err = database.GetProcInsVariableMap(ctx, procInsId); err != nil {
+				return
+			}
+		}
+		value, ok := variableMap[v.Value]
+		if !ok {
+			err = fmt.Errorf("param %s bind variable %s which is not defined", v.Name, v.Value)
+			return
+		}
+		inputContextMap[v.Name] = value
+		if value == nil {
+			inputConstantMap[interfaceParamIdMap[v.Name]] = ""
+		} else if strValue, isStr := value.(string); isStr {
+			inputConstantMap[interfaceParamIdMap[v.Name]] = strValue
+		} else {
+			valueBytes, _ := json.Marshal(value)
+			inputConstantMap[interfaceParamIdMap[v.Name]] = string(valueBytes)
+		}
+	}
+	return
+}
+
+// applyNodeOutputMappings 按节点出参映射把插件返回写入编排变量,失败的数据不参与
+func applyNodeOutputMappings(ctx context.Context, procInsNode *models.ProcInsNode, procDefNode *models.ProcDefNode, outputs []map[string]interface{}) (err error) {
+	mappings := models.ParseProcNodeOutputMappings(procDefNode.OutputMappings)
+	if len(mappings) == 0 {
+		return
+	}
+	procDef, getProcDefErr := database.GetSimpleProcDefRow(ctx, procDefNode.ProcDefId)
+	if getProcDefErr != nil {
+		err = getProcDefErr
+		return
+	}
+	variableDefs := models.ParseProcDefVariables(procDef.Variables)
+	values := make(map[string]interface{})
+	for _, mapping := range mappings {
+		variableDef := variableDefs.Get(mapping.Variable)
+		if variableDef == nil {
+			err = fmt.Errorf("output mapping variable %s is not defined", mapping.Variable)
+			return
+		}
+		var paramValues []interface{}
+		for _, output := range outputs {
+			if errorCode, ok := output["errorCode"]; ok && fmt.Sprintf("%v", errorCode) != "0" {
+				continue
+			}
+			if paramValue, ok := output[mapping.Param]; ok {
+				paramValues = append(paramValues, paramValue)
+			}
+		}
+		if len(paramValues) == 0 {
+			log.Logger.Warn("output mapping param not found in outputs", log.String("procInsNode", procInsNode.Id), log.String("param", mapping.Param))
+			continue
+		}
+		var inputValue interface{} = paramValues[0]
+		if variableDef.DataType == models.ProcVariableTypeList {
+			inputValue = paramValues
+		}
+		if values[variableDef.Name], err = variableDef.ConvertValue(inputValue); err != nil {
+			err = fmt.Errorf("output param %s can not write to variable %s,%s", mapping.Param, mapping.Variable, err.Error())
+			return
+		}
+	}
+	err = database.UpdateProcInsVariables(ctx, procInsNode.ProcInsId, procInsNode.Id, values, "SYSTEM")
+	return
+}
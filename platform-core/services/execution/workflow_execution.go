@@ -38,6 +38,9 @@ func WorkflowExecutionCallPluginService(ctx context.Context, param *models.ProcC
 		ProcInsNodeId: param.ProcInsNode.Id,
 		ReqUrl:        fmt.Sprintf("%s%s", models.Config.Gateway.Url, param.PluginInterface.Path),
 	}
+	if ctx, _, err = withSimulation(ctx, param.ProcInsNode); err != nil {
+		return
+	}
 	rootExprList, errAnalyze1 := remote.AnalyzeExpression(param.EntityType)
 	if errAnalyze1 != nil {
 		err = errAnalyze1
@@ -56,6 +59,10 @@ func WorkflowExecutionCallPluginService(ctx context.Context, param *models.ProcC
 		err = errHandle
 		return
 	}
+	// 断点放行时修改过的入参
+	if err = applyBreakpointInputOverride(ctx, param.ProcInsNode.Id, inputParamDatas, &procInsNodeReq); err != nil {
+		return
+	}
 	procInsNodeReq.ReqDataAmount = len(inputParamDatas)
 	// 纪录参数
 	if err = database.RecordProcCallReq(ctx, &procInsNodeReq, true); err != nil {
@@ -93,7 +100,15 @@ func WorkflowExecutionCallPluginService(ctx context.Context, param *models.ProcC
 		DueDate:         param.DueDate,
 		AllowedOptions:  param.AllowedOptions,
 	}
-	pluginCallResult, errCode, errCall := remote.PluginInterfaceApi(ctx, remote.GetToken(), param.PluginInterface, pluginCallParam)
+	var pluginCallResult *models.PluginInterfaceApiResultData
+	var errCode string
+	var errCall error
+	if simCtx := getSimulation(ctx); simCtx != nil {
+		// 模拟运行用mock返回代替插件调用
+		pluginCallResult, errCode, errCall = simulatePluginCall(ctx, simCtx, pluginCallParam)
+	} else {
+		pluginCallResult, errCode, errCall = remote.PluginInterfaceApi(ctx, remote.GetToken(), param.PluginInterface, pluginCallParam)
+	}
 	if errCall != nil {
 		if errCode != "" && errCode != "0" {
 			if pluginCallResult != nil && len(pluginCallResult.Outputs) > 0 {
@@ -103,7 +118,12 @@ func WorkflowExecutionCallPluginService(ctx context.Context, param *models.ProcC
 				}
 			}
 		}
-		err = errCall
+		// 区分插件返回的错误和网络(网关)请求错误,供节点重试策略判断是否可以重试
+		if errCode != "" && errCode != "0" {
+			err = &models.ProcNodeCallError{Code: models.NodeErrorPlugin, Err: errCall}
+		} else {
+			err = &models.ProcNodeCallError{Code: models.NodeErrorNetwork, Err: errCall}
+		}
 		procInsNodeReq.ErrorMsg = err.Error()
 		database.RecordProcCallReq(ctx, &procInsNodeReq, false)
 		return
@@ -221,7 +241,75 @@ func DoWorkflowAutoJob(ctx context.Context, procRunNodeId, continueToken string)
 		// 无数据，空跑
 		return
 	}
-	pluginInterface, getIntErr := database.GetLastEnablePluginInterface(ctx, procDefNode.ServiceName)
+	risky, err = callNodePluginService(ctx, procInsNode, procDefNode, procDefNodeParams, dataBindings, procDefNode.ServiceName, continueToken)
+	return
+}
+
+// DoWorkflowCompensateJob 执行补偿节点,用原任务节点的绑定数据调用节点定义中的补偿插件服务
+func DoWorkflowCompensateJob(ctx context.Context, procRunNodeId, originProcInsNodeId string) (err error) {
+	ctx = context.WithValue(ctx, models.TransactionIdHeader, procRunNodeId)
+	procInsNode, procDefNode, procDefNodeParams, _, getNodeDataErr := database.GetProcExecNodeData(ctx, procRunNodeId)
+	if getNodeDataErr != nil {
+		err = getNodeDataErr
+		return
+	}
+	if procDefNode.CompensateService == "" {
+		err = fmt.Errorf("node %s compensate service is empty ", procDefNode.Name)
+		return
+	}
+	dataBindings, getBindErr := database.GetProcInsNodeBindData(ctx, originProcInsNodeId)
+	if getBindErr != nil {
+		err = getBindErr
+		return
+	}
+	if len(dataBindings) == 0 {
+		log.Logger.Warn("compensate job return with empty binding data", log.String("procIns", procInsNode.ProcInsId), log.String("originProcInsNode", originProcInsNodeId))
+		return
+	}
+	// 补偿不做高危检测
+	procDefNode.RiskCheck = false
+	_, err = callNodePluginService(ctx, procInsNode, procDefNode, procDefNodeParams, dataBindings, procDefNode.CompensateService, "")
+	return
+}
+
+// callNodePluginService 用任务节点的参数配置和绑定数据调用插件服务
+func callNodePluginService(ctx context.Context, procInsNode *models.ProcInsNode, procDefNode *models.ProcDefNode, procDefNodeParams []*models.ProcDefNodeParam, dataBindings []*models.ProcDataBinding, serviceName, continueToken string) (risky bool, err error) {
+	if err = database.AddProcCacheData(ctx, procInsNode.ProcInsId, dataBindings); err != nil {
+		return
+	}
+	callPluginServiceParam, buildErr := buildNodePluginCallParam(ctx, procInsNode, procDefNode, procDefNodeParams, dataBindings, serviceName, continueToken)
+	if buildErr != nil {
+		err = buildErr
+		return
+	}
+	callOutput, dangerousCheckResult, pluginCallParam, callErr := WorkflowExecutionCallPluginService(ctx, callPluginServiceParam)
+	if callErr != nil {
+		err = callErr
+		return
+	}
+	if dangerousCheckResult != nil {
+		dangerousCheckResultBytes, _ := json.Marshal(dangerousCheckResult)
+		risky = true
+		err = fmt.Errorf(string(dangerousCheckResultBytes))
+		//err = database.UpdateProcInsNodeData(ctx, procInsNode.Id, models.JobStatusRisky, "", string(dangerousCheckResultBytes))
+		//if err != nil {
+		//	err = fmt.Errorf("update proc instance node status fail, %s ", err.Error())
+		//}else{
+		//	risky = true
+		//	err = fmt.Errorf(string(dangerousCheckResultBytes))
+		//}
+	}
+	log.Logger.Debug("WorkflowExecutionCallPluginService", log.JsonObj("output", callOutput), log.JsonObj("pluginCallParam", pluginCallParam))
+	// 补偿服务的出参不写入编排变量
+	if err == nil && callOutput != nil && serviceName == procDefNode.ServiceName {
+		err = applyNodeOutputMappings(ctx, procInsNode, procDefNode, callOutput.Outputs)
+	}
+	return
+}
+
+// buildNodePluginCallParam 按节点参数配置解析常量、上下文和编排变量,组装插件调用参数
+func buildNodePluginCallParam(ctx context.Context, procInsNode *models.ProcInsNode, procDefNode *models.ProcDefNode, procDefNodeParams []*models.ProcDefNodeParam, dataBindings []*models.ProcDataBinding, serviceName, continueToken string) (callPluginServiceParam *models.ProcCallPluginServiceFuncParam, err error) {
+	pluginInterface, getIntErr := database.GetLastEnablePluginInterface(ctx, serviceName)
 	if getIntErr != nil {
 		err = getIntErr
 		return
@@ -231,9 +319,6 @@ func DoWorkflowAutoJob(ctx context.Context, procRunNodeId, continueToken string)
 		err = getProcInsErr
 		return
 	}
-	if err = database.AddProcCacheData(ctx, procInsNode.ProcInsId, dataBindings); err != nil {
-		return
-	}
 	var entityInstances []*models.BatchExecutionPluginExecEntityInstances
 	for _, bindingObj := range dataBindings {
 		entityInstances = append(entityInstances, &models.BatchExecutionPluginExecEntityInstances{
@@ -270,8 +355,11 @@ func DoWorkflowAutoJob(ctx context.Context, procRunNodeId, continueToken string)
 			}
 		}
 	}
+	if err = buildNodeVariableParams(ctx, procIns.Id, procDefNodeParams, interfaceParamIdMap, inputConstantMap, inputContextMap); err != nil {
+		return
+	}
 	log.Logger.Debug("DoWorkflowAutoJob data", log.String("procInsNode", procInsNode.Id), log.String("procDefNode", procDefNode.Id), log.String("interfaceId", pluginInterface.Id), log.JsonObj("inputConstantMap", inputConstantMap), log.JsonObj("inputContextMap", inputContextMap))
-	callPluginServiceParam := models.ProcCallPluginServiceFuncParam{
+	callPluginServiceParam = &models.ProcCallPluginServiceFuncParam{
 		PluginInterface:   pluginInterface,
 		EntityType:        procDefNode.RoutineExpression,
 		EntityInstances:   entityInstances,
@@ -283,24 +371,6 @@ func DoWorkflowAutoJob(ctx context.Context, procRunNodeId, continueToken string)
 		ProcInsNode:       procInsNode,
 		ProcIns:           procIns,
 	}
-	callOutput, dangerousCheckResult, pluginCallParam, callErr := WorkflowExecutionCallPluginService(ctx, &callPluginServiceParam)
-	if callErr != nil {
-		err = callErr
-		return
-	}
-	if dangerousCheckResult != nil {
-		dangerousCheckResultBytes, _ := json.Marshal(dangerousCheckResult)
-		risky = true
-		err = fmt.Errorf(string(dangerousCheckResultBytes))
-		//err = database.UpdateProcInsNodeData(ctx, procInsNode.Id, models.JobStatusRisky, "", string(dangerousCheckResultBytes))
-		//if err != nil {
-		//	err = fmt.Errorf("update proc instance node status fail, %s ", err.Error())
-		//}else{
-		//	risky = true
-		//	err = fmt.Errorf(string(dangerousCheckResultBytes))
-		//}
-	}
-	log.Logger.Debug("WorkflowExecutionCallPluginService", log.JsonObj("output", callOutput), log.JsonObj("pluginCallParam", pluginCallParam))
 	return
 }
 
@@ -328,6 +398,10 @@ func DoWorkflowDataJob(ctx context.Context, procRunNodeId string) (err error) {
 		err = getCacheErr
 		return
 	}
+	if ctx, _, err = withSimulation(ctx, procInsNode); err != nil {
+		return
+	}
+	simCtx := getSimulation(ctx)
 	var createEntityIdList, updateEntityIdList []string
 	for _, exprObj := range exprObjList {
 		exprAnalyzeList, analyzeErr := remote.AnalyzeExpression(exprObj.Expression)
@@ -355,9 +429,14 @@ func DoWorkflowDataJob(ctx context.Context, procRunNodeId string) (err error) {
 					break
 				}
 				createEntityIdList = newIdList
+				if simCtx != nil {
+					// 模拟运行只纪录本应新增的数据,不回写新数据id
+					recordSimulationEntityWrite(ctx, simCtx, models.SimulationActionEntityCreate, lastExprEntity.Package, lastExprEntity.Entity, []map[string]interface{}{createDataObj})
+					continue
+				}
 				createDataResult, createDataErr := remote.CreatePluginModelData(ctx, lastExprEntity.Package, lastExprEntity.Entity, remote.GetToken(), exprObj.Operation, []map[string]interface{}{createDataObj})
 				if createDataErr != nil {
-					err = fmt.Errorf("try to create plugin model data %s:%s %s fail,%s", lastExprEntity.Package, lastExprEntity.Entity, tmpDataOid, createDataErr.Error())
+					err = fmt.Errorf("try to create plugin model data %s:%s %s fail,%w", lastExprEntity.Package, lastExprEntity.Entity, tmpDataOid, createDataErr)
 					return
 				}
 				if len(createDataResult) > 0 {
@@ -379,9 +458,13 @@ func DoWorkflowDataJob(ctx context.Context, procRunNodeId string) (err error) {
 			}
 		}
 		if len(updateEntityIdList) > 0 {
+			if simCtx != nil {
+				recordSimulationEntityWrite(ctx, simCtx, models.SimulationActionEntityUpdate, lastExprEntity.Package, lastExprEntity.Entity, buildDataWriteObj(cacheDataList, updateEntityIdList))
+				continue
+			}
 			_, err = remote.UpdatePluginModelData(ctx, lastExprEntity.Package, lastExprEntity.Entity, remote.GetToken(), exprObj.Operation, buildDataWriteObj(cacheDataList, updateEntityIdList))
 			if err != nil {
-				err = fmt.Errorf("try to update plugin model data %s:%s fail,%s", lastExprEntity.Package, lastExprEntity.Entity, err.Error())
+				err = fmt.Errorf("try to update plugin model data %s:%s fail,%w", lastExprEntity.Package, lastExprEntity.Entity, err)
 				return
 			}
 		}
@@ -467,7 +550,8 @@ func findDataWriteObj(cacheDataList []*models.ProcDataCache, ids []string) (oid,
 	return
 }
 
-func DoWorkflowHumanJob(ctx context.Context, procRunNodeId string, recoverFlag bool) (err error) {
+// DoWorkflowHumanJob 创建人工任务,模拟运行时不创建任务,直接返回mock的任务回调数据
+func DoWorkflowHumanJob(ctx context.Context, procRunNodeId string, recoverFlag bool) (simulateCallback *models.PluginTaskCreateResp, err error) {
 	ctx = context.WithValue(ctx, models.TransactionIdHeader, procRunNodeId)
 	if recoverFlag {
 		existReq, getReqErr := database.GetSimpleProcNodeReq(ctx, "", "", procRunNodeId)
@@ -532,6 +616,9 @@ func DoWorkflowHumanJob(ctx context.Context, procRunNodeId string, recoverFlag b
 		err = getProcInsErr
 		return
 	}
+	if ctx, _, err = withSimulation(ctx, procInsNode); err != nil {
+		return
+	}
 	entityInstances := []*models.BatchExecutionPluginExecEntityInstances{{Id: procIns.EntityDataId}}
 	inputConstantMap := make(map[string]string)
 	inputContextMap := make(map[string]interface{})
@@ -561,6 +648,9 @@ func DoWorkflowHumanJob(ctx context.Context, procRunNodeId string, recoverFlag b
 			}
 		}
 	}
+	if err = buildNodeVariableParams(ctx, procIns.Id, procDefNodeParams, interfaceParamIdMap, inputConstantMap, inputContextMap); err != nil {
+		return
+	}
 	callPluginServiceParam := models.ProcCallPluginServiceFuncParam{
 		PluginInterface:   pluginInterface,
 		EntityType:        procDefNode.RoutineExpression,
@@ -579,14 +669,14 @@ func DoWorkflowHumanJob(ctx context.Context, procRunNodeId string, recoverFlag b
 		return
 	}
 	if pluginInterface.Type == "DYNAMICFORM" {
-		err = CallDynamicFormReq(ctx, &callPluginServiceParam)
+		simulateCallback, err = CallDynamicFormReq(ctx, &callPluginServiceParam)
 	} else if pluginInterface.Type == "APPROVAL" {
-		err = CallDynamicFormReq(ctx, &callPluginServiceParam)
+		simulateCallback, err = CallDynamicFormReq(ctx, &callPluginServiceParam)
 	}
 	return
 }
 
-func CallDynamicFormReq(ctx context.Context, param *models.ProcCallPluginServiceFuncParam) (err error) {
+func CallDynamicFormReq(ctx context.Context, param *models.ProcCallPluginServiceFuncParam) (simulateCallback *models.PluginTaskCreateResp, err error) {
 	procInsNodeReq := models.ProcInsNodeReq{
 		Id:            "proc_req_" + guid.CreateGuid(),
 		ProcInsNodeId: param.ProcInsNode.Id,
@@ -631,6 +721,10 @@ func CallDynamicFormReq(ctx context.Context, param *models.ProcCallPluginService
 		err = errHandle
 		return
 	}
+	// 断点放行时修改过的入参
+	if err = applyBreakpointInputOverride(ctx, param.ProcInsNode.Id, inputParamDatas, &procInsNodeReq); err != nil {
+		return
+	}
 	procInsNodeReq.ReqDataAmount = len(inputParamDatas)
 	// 调用插件接口
 	pluginCallParam := &models.BatchExecutionPluginExecParam{
@@ -647,6 +741,16 @@ func CallDynamicFormReq(ctx context.Context, param *models.ProcCallPluginService
 	if err = database.RecordProcCallReq(ctx, &procInsNodeReq, true); err != nil {
 		return
 	}
+	if simCtx := getSimulation(ctx); simCtx != nil {
+		simulateCallback, err = simulateHumanCall(ctx, simCtx, pluginCallParam)
+		if err != nil {
+			procInsNodeReq.ErrorMsg = err.Error()
+			if recordErr := database.RecordProcCallReq(ctx, &procInsNodeReq, false); recordErr != nil {
+				log.Logger.Error("try to record proc call req to database fail", log.Error(recordErr), log.JsonObj("req", procInsNodeReq))
+			}
+		}
+		return
+	}
 	pluginCallResult, _, errCall := remote.PluginInterfaceApi(ctx, remote.GetToken(), param.PluginInterface, pluginCallParam)
 	log.Logger.Info("human job call plugin api response", log.JsonObj("result", pluginCallResult), log.String("error", fmt.Sprintf("%v", errCall)))
 	if errCall != nil {
@@ -771,6 +875,9 @@ func HandleCallbackHumanJob(ctx context.Context, procRunNodeId string, callbackD
 		err = getIntErr
 		return
 	}
+	if ctx, _, err = withSimulation(ctx, procInsNode); err != nil {
+		return
+	}
 	pluginCallOutput := []map[string]interface{}{}
 	outputBytes, _ := json.Marshal(callbackData.Results.Outputs)
 	if err = json.Unmarshal(outputBytes, &pluginCallOutput); err != nil {
@@ -787,6 +894,9 @@ func HandleCallbackHumanJob(ctx context.Context, procRunNodeId string, callbackD
 	if err = database.RecordProcCallReq(ctx, &procInsNodeReq, false); err != nil {
 		return
 	}
+	if err = applyNodeOutputMappings(ctx, procInsNode, procDefNode, pluginCallOutput); err != nil {
+		return
+	}
 	// 更新cache data
 	var taskFormList []*models.PluginTaskFormDto
 	for _, output := range callbackData.Results.Outputs {
@@ -1151,3 +1261,62 @@ func DynamicBindNodeInRuntime(ctx context.Context, procInsNode *models.ProcInsNo
 	}
 	return
 }
+
+// BuildDecisionContextMap 构建判断节点表达式的计算上下文
+// context -> 编排上下文(与开始节点上下文一致), nodes -> 已完成任务节点的输出(按节点名称和节点定义id), root -> 根数据的属性, vars -> 编排变量
+func BuildDecisionContextMap(ctx context.Context, procInsId string) (result map[string]interface{}, err error) {
+	procIns, getProcInsErr := database.GetSimpleProcInsRow(ctx, procInsId)
+	if getProcInsErr != nil {
+		err = getProcInsErr
+		return
+	}
+	contextMap := make(map[string]interface{})
+	buildStartNodeContextMap(contextMap, procIns, &models.ProcDefNodeParam{})
+	nodesMap := make(map[string]interface{})
+	procInsNodes, getNodesErr := database.GetFinishProcInsNodeList(ctx, procInsId)
+	if getNodesErr != nil {
+		err = getNodesErr
+		return
+	}
+	for _, procInsNode := range procInsNodes {
+		nodeContext, getContextErr := database.GetProcInsNodeContext(ctx, procInsId, procInsNode.Id, "")
+		if getContextErr != nil {
+			err = getContextErr
+			return
+		}
+		var outputs []interface{}
+		for _, reqObj := range nodeContext.RequestObjects {
+			for _, output := range reqObj.Outputs {
+				outputs = append(outputs, output)
+			}
+		}
+		var nodeOutput interface{} = outputs
+		if len(outputs) == 1 {
+			nodeOutput = outputs[0]
+		}
+		nodesMap[procInsNode.Name] = nodeOutput
+		nodesMap[procInsNode.ProcDefNodeId] = nodeOutput
+	}
+	rootMap := make(map[string]interface{})
+	cacheDataList, getCacheErr := database.GetProcCacheData(ctx, procInsId)
+	if getCacheErr != nil {
+		err = getCacheErr
+		return
+	}
+	for _, cacheData := range cacheDataList {
+		if cacheData.EntityDataId != procIns.EntityDataId || cacheData.DataValue == "" {
+			continue
+		}
+		if tmpErr := json.Unmarshal([]byte(cacheData.DataValue), &rootMap); tmpErr != nil {
+			log.Logger.Warn("BuildDecisionContextMap json unmarshal root data fail", log.String("dataValue", cacheData.DataValue), log.Error(tmpErr))
+		}
+		break
+	}
+	varsMap, getVarsErr := database.GetProcInsVariableMap(ctx, procInsId)
+	if getVarsErr != nil {
+		err = getVarsErr
+		return
+	}
+	result = map[string]interface{}{"context": contextMap, "nodes": nodesMap, "root": rootMap, "vars": varsMap}
+	return
+}
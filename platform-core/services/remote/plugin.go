@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/WeBankPartners/wecube-platform/platform-core/common/network"
 	"io"
@@ -482,7 +483,7 @@ func CreatePluginModelData(ctx context.Context, packageName, entity, token, oper
 	log.Logger.Info("Start remote modelData create --->>> ", log.String("requestId", reqId), log.String("transactionId", transId), log.String("method", http.MethodPost), log.String("url", urlObj.String()), log.String("operation", operation), log.JsonObj("Authorization", token), log.String("requestBody", string(postBytes)))
 	resp, respErr := http.DefaultClient.Do(req)
 	if respErr != nil {
-		err = fmt.Errorf("do request fail,%s ", respErr.Error())
+		err = &models.ProcNodeCallError{Code: models.NodeErrorNetwork, Err: fmt.Errorf("do request fail,%s ", respErr.Error())}
 		return
 	}
 	var responseBodyBytes []byte
@@ -500,15 +501,15 @@ func CreatePluginModelData(ctx context.Context, packageName, entity, token, oper
 	var response models.EntityResponse
 	responseBodyBytes, err = io.ReadAll(resp.Body)
 	if err != nil {
-		err = fmt.Errorf("read response body fail,%s ", err.Error())
+		err = &models.ProcNodeCallError{Code: models.NodeErrorNetwork, Err: fmt.Errorf("read response body fail,%s ", err.Error())}
 		return
 	}
 	if err = json.Unmarshal(responseBodyBytes, &response); err != nil {
-		err = fmt.Errorf("json unmarshal response body fail,%s ", err.Error())
+		err = &models.ProcNodeCallError{Code: models.NodeErrorNetwork, Err: fmt.Errorf("json unmarshal response body fail,%s ", err.Error())}
 		return
 	}
 	if response.Status != models.DefaultHttpSuccessCode {
-		err = fmt.Errorf(response.Message)
+		err = &models.ProcNodeCallError{Code: models.NodeErrorPlugin, Err: errors.New(response.Message)}
 	} else {
 		result = response.Data
 	}
@@ -542,7 +543,7 @@ func UpdatePluginModelData(ctx context.Context, packageName, entity, token, oper
 	log.Logger.Info("Start remote modelData update --->>> ", log.String("requestId", reqId), log.String("transactionId", transId), log.String("method", http.MethodPost), log.String("url", urlObj.String()), log.JsonObj("Authorization", token), log.String("requestBody", string(postBytes)))
 	resp, respErr := http.DefaultClient.Do(req)
 	if respErr != nil {
-		err = fmt.Errorf("do request fail,%s ", respErr.Error())
+		err = &models.ProcNodeCallError{Code: models.NodeErrorNetwork, Err: fmt.Errorf("do request fail,%s ", respErr.Error())}
 		return
 	}
 	var responseBodyBytes []byte
@@ -560,15 +561,15 @@ func UpdatePluginModelData(ctx context.Context, packageName, entity, token, oper
 	var response models.EntityResponse
 	responseBodyBytes, err = io.ReadAll(resp.Body)
 	if err != nil {
-		err = fmt.Errorf("read response body fail,%s ", err.Error())
+		err = &models.ProcNodeCallError{Code: models.NodeErrorNetwork, Err: fmt.Errorf("read response body fail,%s ", err.Error())}
 		return
 	}
 	if err = json.Unmarshal(responseBodyBytes, &response); err != nil {
-		err = fmt.Errorf("json unmarshal response body fail,%s ", err.Error())
+		err = &models.ProcNodeCallError{Code: models.NodeErrorNetwork, Err: fmt.Errorf("json unmarshal response body fail,%s ", err.Error())}
 		return
 	}
 	if response.Status != models.DefaultHttpSuccessCode {
-		err = fmt.Errorf(response.Message)
+		err = &models.ProcNodeCallError{Code: models.NodeErrorPlugin, Err: errors.New(response.Message)}
 	} else {
 		result = response.Data
 	}
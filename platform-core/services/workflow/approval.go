@@ -0,0 +1,228 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/exterror"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/log"
+	"github.com/WeBankPartners/wecube-platform/platform-core/models"
+	"github.com/WeBankPartners/wecube-platform/platform-core/services/database"
+	"github.com/WeBankPartners/wecube-platform/platform-core/services/execution"
+	"github.com/WeBankPartners/wecube-platform/platform-core/services/remote"
+	"strings"
+	"time"
+)
+
+// getNodeApprovalPolicy 查人工节点的审批策略和表单插件服务名,没有配置审批策略时policy为nil
+// 查询失败时返回错误,不能当作没有审批策略处理,否则会跳过多人审批
+func getNodeApprovalPolicy(ctx context.Context, procRunNodeId string) (policy *models.ProcNodeApprovalPolicy, serviceName string, err error) {
+	procInsNode, getInsNodeErr := database.GetSimpleProcInsNode(ctx, "", procRunNodeId)
+	if getInsNodeErr != nil {
+		err = fmt.Errorf("get node approval policy fail with query proc ins node,%s ", getInsNodeErr.Error())
+		return
+	}
+	procDefNode, getDefNodeErr := database.GetSimpleProcDefNode(ctx, procInsNode.ProcDefNodeId)
+	if getDefNodeErr != nil {
+		err = fmt.Errorf("get node approval policy fail with query proc def node,%s ", getDefNodeErr.Error())
+		return
+	}
+	return models.ParseProcNodeApprovalPolicy(procDefNode.ApprovalPolicy), procDefNode.ServiceName, nil
+}
+
+// waitApproval 按审批策略生成审批票并等待投票结果,编排重新加载时沿用当前轮次的票,重试时开始新一轮
+// 票的状态以数据库为准,timerChan只作为唤醒信号,表单插件的回调只纪录表单数据,不决定审批结果
+func (n *WorkNode) waitApproval(policy *models.ProcNodeApprovalPolicy, recoverFlag bool) (output string, err error) {
+	select {
+	case <-n.timerChan:
+	default:
+	}
+	simulation, getSimulationErr := database.GetProcInsSimulation(n.Ctx, n.workflow.ProcInsId)
+	if getSimulationErr != nil {
+		err = getSimulationErr
+		return
+	}
+	// 模拟运行时审批直接通过
+	if simulation != nil {
+		output = policy.PassOption
+		return
+	}
+	round, getRoundErr := database.GetProcRunApprovalRound(n.Ctx, n.Id)
+	if getRoundErr != nil {
+		err = getRoundErr
+		return
+	}
+	if !recoverFlag || round == 0 {
+		round++
+		nodeRow := models.ProcRunApproval{WorkflowId: n.WorkflowId, ProcInsId: n.workflow.ProcInsId, ProcInsNodeId: n.ProcInsNodeId, ProcRunNodeId: n.Id, NodeName: n.Name}
+		if err = database.CreateProcRunApprovals(n.Ctx, &nodeRow, policy, round); err != nil {
+			return
+		}
+	}
+	log.WorkflowLogger.Info("node wait approval", log.String("nodeId", n.Id), log.Int("round", round))
+	for {
+		approveNum, rejectNum, countErr := database.CountProcRunApproval(n.Ctx, n.Id, round)
+		if countErr != nil {
+			err = countErr
+			return
+		}
+		if result := policy.Decide(approveNum, rejectNum); result != "" {
+			if err = database.CancelProcRunApproval(n.Ctx, n.Id, round); err != nil {
+				return
+			}
+			message := fmt.Sprintf("round:%d approve:%d reject:%d", round, approveNum, rejectNum)
+			database.AddProcInsTimeline(n.Ctx, &models.ProcInsTimeline{ProcInsId: n.workflow.ProcInsId, WorkflowId: n.WorkflowId, ProcInsNodeId: n.ProcInsNodeId, ProcRunNodeId: n.Id, NodeName: n.Name, EventType: models.TimelineEventApproval, Status: result, Message: message, CreatedBy: "system"})
+			log.WorkflowLogger.Info("node approval done", log.String("nodeId", n.Id), log.String("result", result), log.String("message", message))
+			if result == models.ApprovalResultPass {
+				output = policy.PassOption
+			} else if policy.RejectOption != "" {
+				output = policy.RejectOption
+			} else {
+				err = exterror.New().ProcRunApprovalError.WithParam("rejected with " + message)
+			}
+			return
+		}
+		select {
+		case <-n.timerChan:
+		case callbackMessage := <-n.callbackChan:
+			var callbackData models.PluginTaskCreateResp
+			if unmarshalErr := json.Unmarshal([]byte(callbackMessage), &callbackData); unmarshalErr != nil {
+				log.WorkflowLogger.Error("json unmarshal approval node callback data fail", log.String("nodeId", n.Id), log.Error(unmarshalErr))
+			} else if _, handleErr := execution.HandleCallbackHumanJob(n.Ctx, n.Id, &callbackData); handleErr != nil {
+				log.WorkflowLogger.Error("handle approval node callback data fail", log.String("nodeId", n.Id), log.Error(handleErr))
+			}
+		case <-n.Ctx.Done():
+			err = errWorkflowQuit
+			return
+		}
+	}
+}
+
+// NotifyApproval 投票后通知节点重新统计,工作流在sleep时会被唤醒,在其它实例时由其它实例扫描处理
+func NotifyApproval(ctx context.Context, workflowId, procRunNodeId, operator string) {
+	notifyNode(ctx, workflowId, procRunNodeId, "approval", operator)
+}
+
+// validateApprovalPolicy 校验人工节点审批策略
+func validateApprovalPolicy(node *models.ProcDefNode, policy *models.ProcNodeApprovalPolicy) error {
+	illegalErr := func(message string) error {
+		return exterror.New().ProcDefNodeApprovalPolicyError.WithParam(node.Name, message)
+	}
+	if policy.Mode != models.ApprovalModeAny && policy.Mode != models.ApprovalModeAll && policy.Mode != models.ApprovalModeQuorum {
+		return illegalErr(fmt.Sprintf("mode:%s illegal", policy.Mode))
+	}
+	approverMap := make(map[string]bool)
+	for _, approver := range policy.Approvers {
+		if approver == nil || strings.TrimSpace(approver.Name) == "" {
+			return illegalErr("approver name empty")
+		}
+		if approver.Type != models.ApproverTypeRole && approver.Type != models.ApproverTypeUser {
+			return illegalErr(fmt.Sprintf("approver type:%s illegal", approver.Type))
+		}
+		key := approver.Type + ":" + approver.Name
+		if approverMap[key] {
+			return illegalErr(fmt.Sprintf("approver %s duplicate", key))
+		}
+		approverMap[key] = true
+	}
+	if policy.Mode == models.ApprovalModeQuorum && (policy.Quorum < 1 || policy.Quorum > len(policy.Approvers)) {
+		return illegalErr(fmt.Sprintf("quorum:%d should between 1 and %d", policy.Quorum, len(policy.Approvers)))
+	}
+	if policy.ReminderInterval < 0 || policy.EscalationHours < 0 {
+		return illegalErr("reminderInterval and escalationHours can not be negative")
+	}
+	if policy.EscalationHours > 0 && strings.TrimSpace(policy.EscalationRole) == "" {
+		return illegalErr("escalationRole empty")
+	}
+	return nil
+}
+
+// 每分钟扫描等待中的审批票,超过提醒间隔的发邮件提醒,超过升级时间的升级给升级角色
+func startApprovalJob() {
+	t := time.NewTicker(1 * time.Minute).C
+	for {
+		<-t
+		doApprovalJob()
+	}
+}
+
+func doApprovalJob() {
+	if IsDraining() {
+		return
+	}
+	ctx := context.Background()
+	approvalRows, err := database.ListWaitProcRunApproval(ctx)
+	if err != nil {
+		log.WorkflowLogger.Error("query wait proc run approval fail", log.Error(err))
+		return
+	}
+	nowTime := time.Now()
+	policyMap := make(map[string]*models.ProcNodeApprovalPolicy)
+	for _, row := range approvalRows {
+		if !IsClusterOwner(row.WorkflowId) {
+			continue
+		}
+		policy, ok := policyMap[row.ProcInsNodeId]
+		if !ok {
+			if policy, err = database.GetProcInsNodeApprovalPolicy(ctx, row.ProcInsNodeId); err != nil {
+				log.WorkflowLogger.Error("get proc ins node approval policy fail", log.String("procInsNodeId", row.ProcInsNodeId), log.Error(err))
+			}
+			policyMap[row.ProcInsNodeId] = policy
+		}
+		if policy == nil {
+			continue
+		}
+		if policy.EscalationHours > 0 && row.EscalatedFrom == "" && !row.CreatedTime.After(nowTime.Add(-time.Duration(policy.EscalationHours)*time.Hour)) {
+			if database.EscalateProcRunApproval(ctx, row, policy.EscalationRole) {
+				sendApprovalMail(row, models.ApproverTypeRole, policy.EscalationRole, "Escalation")
+			}
+			continue
+		}
+		if policy.ReminderInterval > 0 {
+			lastRemindBefore := nowTime.Add(-time.Duration(policy.ReminderInterval) * time.Hour)
+			if row.CreatedTime.After(lastRemindBefore) || row.RemindedTime.After(lastRemindBefore) {
+				continue
+			}
+			if database.RemindProcRunApproval(ctx, row, lastRemindBefore) {
+				if row.DelegateTo != "" {
+					sendApprovalMail(row, models.ApproverTypeUser, row.DelegateTo, "Reminder")
+				} else {
+					sendApprovalMail(row, row.ApproverType, row.Approver, "Reminder")
+				}
+			}
+		}
+	}
+}
+
+// sendApprovalMail 给审批人发审批提醒邮件,角色发给角色邮箱,用户发给用户邮箱
+func sendApprovalMail(row *models.ProcRunApproval, approverType, approver, title string) {
+	mailObj := models.SendMailTarget{}
+	if approverType == models.ApproverTypeRole {
+		roleObj, err := remote.RetrieveRoleByRoleName(approver, remote.GetToken(), "en")
+		if err != nil {
+			log.WorkflowLogger.Error("send approval mail fail with retrieve role", log.String("role", approver), log.Error(err))
+			return
+		}
+		if roleObj.Email != "" {
+			mailObj.Accept = []string{roleObj.Email}
+		}
+	} else {
+		userObj, err := remote.RetrieveUserByUsername(approver, remote.GetToken(), "en")
+		if err != nil {
+			log.WorkflowLogger.Error("send approval mail fail with retrieve user", log.String("user", approver), log.Error(err))
+			return
+		}
+		if userObj.EmailAddr != "" {
+			mailObj.Accept = []string{userObj.EmailAddr}
+		}
+	}
+	if len(mailObj.Accept) == 0 {
+		log.WorkflowLogger.Warn("send approval mail skip with accept mail empty", log.String("approver", approverType+":"+approver))
+		return
+	}
+	mailObj.Subject = fmt.Sprintf("Wecube Process Approval %s,[%s]", title, row.NodeName)
+	mailObj.Content = mailObj.Subject + fmt.Sprintf("\nProcess Instance Id:%s \nApprover:%s \nTime:%s \n", row.ProcInsId, approverType+":"+approver, row.CreatedTime.Format(models.DateTimeFormat))
+	if err := remote.SendSmtpMail(mailObj); err != nil {
+		log.WorkflowLogger.Error("send approval mail fail", log.String("approvalId", row.Id), log.Error(err))
+	}
+}
@@ -0,0 +1,62 @@
+package workflow
+
+import (
+	"context"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/log"
+	"github.com/WeBankPartners/wecube-platform/platform-core/models"
+	"github.com/WeBankPartners/wecube-platform/platform-core/services/database"
+)
+
+// waitBreakpoint 任务节点开始前检查断点,命中时节点置为暂停,等操作人单步或继续后再执行
+// 暂停的节点不算运行中,工作流可以sleep,重新加载后沿用未处理的断点,已放行的暂停节点直接执行
+func (n *WorkNode) waitBreakpoint() (err error) {
+	if !models.IsBreakpointJobType(n.JobType) {
+		return
+	}
+	select {
+	case <-n.timerChan:
+	default:
+	}
+	hitRow, getErr := database.GetLastProcRunBreakpoint(n.Ctx, n.Id)
+	if getErr != nil {
+		err = getErr
+		return
+	}
+	if n.Status == models.JobStatusPaused && hitRow != nil && hitRow.Status != models.BreakpointHitStatusWait {
+		return
+	}
+	if hitRow == nil || hitRow.Status != models.BreakpointHitStatusWait {
+		match, matchErr := database.MatchProcBreakpoint(n.Ctx, n.ProcInsNodeId)
+		if matchErr != nil || !match {
+			err = matchErr
+			return
+		}
+		hitRow = &models.ProcRunBreakpoint{WorkflowId: n.WorkflowId, ProcInsId: n.workflow.ProcInsId, ProcInsNodeId: n.ProcInsNodeId, ProcRunNodeId: n.Id, NodeName: n.Name, JobType: n.JobType}
+		if err = database.CreateProcRunBreakpoint(n.Ctx, hitRow); err != nil {
+			return
+		}
+	}
+	if n.Status != models.JobStatusPaused {
+		n.Status = models.JobStatusPaused
+		updateNodeDB(&n.ProcRunNode)
+	}
+	log.WorkflowLogger.Info("node paused at breakpoint", log.String("nodeId", n.Id), log.String("breakpointId", hitRow.Id))
+	for hitRow.Status == models.BreakpointHitStatusWait {
+		select {
+		case <-n.timerChan:
+		case <-n.Ctx.Done():
+			err = errWorkflowQuit
+			return
+		}
+		if hitRow, err = database.GetProcRunBreakpoint(n.Ctx, hitRow.Id); err != nil {
+			return
+		}
+	}
+	log.WorkflowLogger.Info("node resume from breakpoint", log.String("nodeId", n.Id), log.String("breakpointId", hitRow.Id), log.String("action", hitRow.Status))
+	return
+}
+
+// NotifyBreakpoint 断点放行后通知节点,工作流在sleep时会被唤醒,在其它实例时由其它实例扫描处理
+func NotifyBreakpoint(ctx context.Context, workflowId, procRunNodeId, operator string) {
+	notifyNode(ctx, workflowId, procRunNodeId, "breakpoint", operator)
+}
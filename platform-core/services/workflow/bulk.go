@@ -0,0 +1,128 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/log"
+	"github.com/WeBankPartners/wecube-platform/platform-core/models"
+	"github.com/WeBankPartners/wecube-platform/platform-core/services/database"
+	"strings"
+	"time"
+)
+
+// RunProcInsBulkJob 逐个执行批量任务中待执行的目标,执行前重新检查实例和节点状态,已变化的跳过
+// 每个目标间隔一段时间,避免插件故障恢复后大量重试同时压到插件上
+func RunProcInsBulkJob(job *models.ProcInsBulkJob) {
+	ctx := context.WithValue(context.Background(), models.TransactionIdHeader, fmt.Sprintf("bulk_%s", job.Id))
+	resultRows, err := database.ListWaitProcInsBulkResult(ctx, job.Id)
+	if err != nil {
+		log.WorkflowLogger.Error("query proc ins bulk result fail", log.String("jobId", job.Id), log.Error(err))
+		return
+	}
+	var roles []string
+	if job.Roles != "" {
+		roles = strings.Split(job.Roles, ",")
+	}
+	for i, row := range resultRows {
+		if IsDraining() {
+			log.WorkflowLogger.Info("stop proc ins bulk job with draining", log.String("jobId", job.Id))
+			return
+		}
+		if i > 0 {
+			time.Sleep(200 * time.Millisecond)
+		}
+		row.Status, row.Message = doProcInsBulkOperation(ctx, job, row, roles)
+		if err = database.UpdateProcInsBulkResult(ctx, row); err != nil {
+			log.WorkflowLogger.Error("update proc ins bulk result fail", log.String("jobId", job.Id), log.Int64("resultId", row.Id), log.Error(err))
+		}
+	}
+	if err = database.FinishProcInsBulkJob(ctx, job.Id); err != nil {
+		log.WorkflowLogger.Error("finish proc ins bulk job fail", log.String("jobId", job.Id), log.Error(err))
+		return
+	}
+	log.WorkflowLogger.Info("proc ins bulk job done", log.String("jobId", job.Id), log.Int("total", len(resultRows)))
+}
+
+// doProcInsBulkOperation 对单个目标下发操作,检查规则和实例操作接口一致
+func doProcInsBulkOperation(ctx context.Context, job *models.ProcInsBulkJob, row *models.ProcInsBulkResult, roles []string) (status, message string) {
+	procInsObj, err := database.GetSimpleProcInsRow(ctx, row.ProcInsId)
+	if err != nil {
+		return models.ProcInsBulkResultFail, err.Error()
+	}
+	expectStatus := models.JobStatusRunning
+	if job.Action == models.ProcInsBulkActionContinue {
+		expectStatus = models.WorkflowStatusStop
+	}
+	if procInsObj.Status != expectStatus {
+		return models.ProcInsBulkResultSkipped, fmt.Sprintf("instance status is %s", procInsObj.Status)
+	}
+	nodeObj := &models.ProcInsNode{}
+	if row.ProcInsNodeId != "" {
+		if nodeObj, err = database.GetSimpleProcInsNode(ctx, row.ProcInsNodeId, ""); err != nil {
+			return models.ProcInsBulkResultFail, err.Error()
+		}
+	}
+	operationObj := models.ProcRunOperation{Status: "wait", CreatedBy: job.CreatedBy}
+	switch job.Action {
+	case models.ProcInsBulkActionRetry:
+		if nodeObj.Status != models.JobStatusFail && nodeObj.Status != models.JobStatusTimeout {
+			return models.ProcInsBulkResultSkipped, fmt.Sprintf("node status is %s", nodeObj.Status)
+		}
+		operationObj.Operation = "retry"
+	case models.ProcInsBulkActionIgnoreRisky:
+		if nodeObj.Status != models.JobStatusRisky {
+			return models.ProcInsBulkResultSkipped, fmt.Sprintf("node status is %s", nodeObj.Status)
+		}
+		operationObj.Operation = "ignore"
+	case models.ProcInsBulkActionApprove:
+		approvalRow, voteErr := database.VoteProcRunApproval(ctx, row.ProcInsId, row.ProcInsNodeId, job.CreatedBy, roles, &models.ProcRunApprovalVoteParam{Decision: models.ApprovalStatusApprove, Comment: job.Message})
+		if voteErr != nil {
+			return models.ProcInsBulkResultFail, voteErr.Error()
+		}
+		NotifyApproval(ctx, approvalRow.WorkflowId, approvalRow.ProcRunNodeId, job.CreatedBy)
+		return models.ProcInsBulkResultSuccess, ""
+	case models.ProcInsBulkActionStop:
+		operationObj.Operation = "stop"
+	case models.ProcInsBulkActionContinue:
+		operationObj.Operation = "continue"
+	}
+	if operationObj.WorkflowId, operationObj.NodeId, err = database.GetProcWorkByInsId(ctx, row.ProcInsId, row.ProcInsNodeId); err != nil {
+		return models.ProcInsBulkResultFail, err.Error()
+	}
+	if operationObj.Id, err = database.AddWorkflowOperation(ctx, &operationObj); err != nil {
+		return models.ProcInsBulkResultFail, err.Error()
+	}
+	go HandleProOperation(&operationObj)
+	if row.ProcInsNodeId != "" && (nodeObj.NodeType == models.JobSubProcType || nodeObj.NodeType == models.JobLoopType) {
+		KillSubProc(ctx, row.ProcInsId, row.ProcInsNodeId, job.CreatedBy)
+	}
+	return models.ProcInsBulkResultSuccess, ""
+}
+
+// startProcInsBulkJob 每分钟检查中断的批量任务(执行的节点重启等),由集群中负责该任务的节点继续执行
+func startProcInsBulkJob() {
+	t := time.NewTicker(1 * time.Minute).C
+	for {
+		<-t
+		doRecoverProcInsBulkJob()
+	}
+}
+
+func doRecoverProcInsBulkJob() {
+	if IsDraining() {
+		return
+	}
+	ctx := context.WithValue(context.Background(), models.TransactionIdHeader, fmt.Sprintf("bulk_%d", time.Now().Unix()))
+	jobRows, err := database.ListStalledProcInsBulkJob(ctx)
+	if err != nil {
+		log.WorkflowLogger.Error("query stalled proc ins bulk job fail", log.Error(err))
+		return
+	}
+	for _, row := range jobRows {
+		if !IsClusterOwner(row.Id) || !database.ClaimStalledProcInsBulkJob(ctx, row) {
+			continue
+		}
+		log.WorkflowLogger.Info("recover stalled proc ins bulk job", log.String("jobId", row.Id))
+		go RunProcInsBulkJob(row)
+	}
+}
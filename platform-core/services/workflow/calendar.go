@@ -0,0 +1,77 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/db"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/exterror"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/log"
+	"github.com/WeBankPartners/wecube-platform/platform-core/models"
+	"github.com/WeBankPartners/wecube-platform/platform-core/services/database"
+	"time"
+)
+
+// doCalendarTimeJob 按业务日历计算时间节点的触发时间,编排重新加载时按节点开始时间重新计算
+func (n *WorkNode) doCalendarTimeJob(timeConfig *models.TimeNodeParam, recoverFlag bool) (err error) {
+	if timeConfig.Calendar == "" {
+		err = fmt.Errorf("time node param:%s calendar empty ", n.Input)
+		return
+	}
+	calendar, getErr := database.GetBusinessCalendarRule(n.Ctx, timeConfig.Calendar)
+	if getErr != nil {
+		err = getErr
+		return
+	}
+	fromTime := time.Now()
+	if recoverFlag {
+		fromTime = n.StartTime
+	}
+	fireTime, calcErr := calendar.CalcTimeNodeFireTime(timeConfig, fromTime)
+	if calcErr != nil {
+		err = fmt.Errorf("time node param:%s calc fire time fail,%s ", n.Input, calcErr.Error())
+		return
+	}
+	if !recoverFlag {
+		endDate := fireTime.In(time.Local).Format(models.DateTimeFormat)
+		n.Output = endDate
+		if _, updateTimeOutputErr := db.WorkflowMysqlEngine.Exec("update proc_run_node set `output`=?,updated_time=? where id=?", endDate, time.Now(), n.Id); updateTimeOutputErr != nil {
+			log.WorkflowLogger.Error("update time job output fail", log.String("nodeId", n.Id), log.String("endDate", endDate), log.Error(updateTimeOutputErr))
+		}
+	}
+	log.WorkflowLogger.Info("time job wait with calendar", log.String("nodeId", n.Id), log.String("calendar", timeConfig.Calendar), log.String("fireTime", fireTime.Format(time.RFC3339)))
+	err = n.waitTimer(fireTime, recoverFlag)
+	return
+}
+
+// parseDateNodeTime 解析日期节点的日期,配置了业务日历时按日历时区解析,否则按服务器时区
+func parseDateNodeTime(ctx context.Context, timeConfig *models.TimeNodeParam) (result time.Time, err error) {
+	if timeConfig.Calendar == "" {
+		return time.ParseInLocation(models.DateTimeFormat, timeConfig.Date, time.Local)
+	}
+	calendar, getErr := database.GetBusinessCalendarRule(ctx, timeConfig.Calendar)
+	if getErr != nil {
+		err = getErr
+		return
+	}
+	return calendar.ParseDate(timeConfig)
+}
+
+// validateNodeCalendar 校验时间节点和日期节点引用的业务日历
+func validateNodeCalendar(ctx context.Context, node *models.ProcDefNode) error {
+	if node.TimeConfig == "" {
+		return nil
+	}
+	timeConfigDto := &models.TimeConfigDto{}
+	json.Unmarshal([]byte(node.TimeConfig), timeConfigDto)
+	if timeConfigDto.Calendar == "" {
+		if timeConfigDto.Type == models.TimeNodeTypeWindow {
+			return exterror.New().ProcDefNodeCalendarError.WithParam(node.Name, "maintenance window need calendar")
+		}
+		return nil
+	}
+	if _, err := database.GetBusinessCalendarRule(ctx, timeConfigDto.Calendar); err != nil {
+		return exterror.New().ProcDefNodeCalendarError.WithParam(node.Name, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package workflow
+
+import (
+	"fmt"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/db"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/log"
+	"github.com/WeBankPartners/wecube-platform/platform-core/models"
+	"hash/crc32"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	clusterRing      atomic.Value
+	clusterStartTime = time.Now()
+	rebalancing      int32 // 上一轮迁移还在执行中
+)
+
+// hashRing 存活实例组成的一致性hash环,工作流、定时任务和事件按id分配到实例
+type hashRing struct {
+	hosts   []string
+	points  []uint32
+	hostMap map[uint32]string
+}
+
+func newHashRing(hosts []string) *hashRing {
+	ring := hashRing{hosts: hosts, hostMap: make(map[uint32]string)}
+	for _, host := range hosts {
+		for i := 0; i < models.ClusterVirtualNodeNum; i++ {
+			point := crc32.ChecksumIEEE([]byte(fmt.Sprintf("%s#%d", host, i)))
+			if _, ok := ring.hostMap[point]; ok {
+				continue
+			}
+			ring.hostMap[point] = host
+			ring.points = append(ring.points, point)
+		}
+	}
+	sort.Slice(ring.points, func(i, j int) bool {
+		return ring.points[i] < ring.points[j]
+	})
+	return &ring
+}
+
+func (r *hashRing) get(key string) string {
+	if len(r.points) == 0 {
+		return ""
+	}
+	hashValue := crc32.ChecksumIEEE([]byte(key))
+	index := sort.Search(len(r.points), func(i int) bool {
+		return r.points[i] >= hashValue
+	})
+	if index == len(r.points) {
+		index = 0
+	}
+	return r.hostMap[r.points[index]]
+}
+
+func getClusterRing() *hashRing {
+	if ring, ok := clusterRing.Load().(*hashRing); ok {
+		return ring
+	}
+	return nil
+}
+
+// GetClusterOwner 按一致性hash取负责该key的实例,还没拿到成员列表时返回空
+func GetClusterOwner(key string) string {
+	ring := getClusterRing()
+	if ring == nil {
+		return ""
+	}
+	return ring.get(key)
+}
+
+// IsClusterOwner 当前实例是否负责该key,没拿到成员列表时退回到各实例抢占
+func IsClusterOwner(key string) bool {
+	owner := GetClusterOwner(key)
+	return owner == "" || owner == instanceHost
+}
+
+// IsClusterOwnerOrOverdue 当前实例负责该key,或者该工作已超时没人处理时也可以接手
+func IsClusterOwnerOrOverdue(key string, lastTime time.Time) bool {
+	if IsClusterOwner(key) {
+		return true
+	}
+	return !lastTime.IsZero() && time.Since(lastTime) > models.ClusterOwnerFallbackTimeout*time.Second
+}
+
+// 每10s上报自身心跳和负载,刷新存活成员的一致性hash环,并把不归自己负责的空闲工作流迁给负责的实例
+func startClusterMemberJob() {
+	doClusterMemberJob()
+	t := time.NewTicker(10 * time.Second).C
+	for {
+		<-t
+		doClusterMemberJob()
+	}
+}
+
+func doClusterMemberJob() {
+	if err := reportClusterMember(); err != nil {
+		log.WorkflowLogger.Error("report cluster member fail", log.Error(err))
+		return
+	}
+	if IsDraining() {
+		return
+	}
+	var memberRows []*models.CoreClusterMember
+	aliveTime := time.Now().Add(-models.ClusterMemberAliveTimeout * time.Second)
+	err := db.WorkflowMysqlEngine.SQL("select host from core_cluster_member where status=? and last_alive_time>=? order by host", models.ClusterMemberStatusActive, aliveTime).Find(&memberRows)
+	if err != nil {
+		log.WorkflowLogger.Error("query cluster member fail", log.Error(err))
+		return
+	}
+	var hosts []string
+	for _, row := range memberRows {
+		hosts = append(hosts, row.Host)
+	}
+	if oldRing := getClusterRing(); oldRing == nil || fmt.Sprintf("%v", oldRing.hosts) != fmt.Sprintf("%v", hosts) {
+		log.WorkflowLogger.Info("cluster member change", log.StringList("hosts", hosts))
+	}
+	clusterRing.Store(newHashRing(hosts))
+	if len(hosts) > 1 {
+		rebalanceWorkflow()
+	}
+}
+
+// reportClusterMember 上报心跳,退出中的实例标记为leaving,其它实例不再给它分配工作
+func reportClusterMember() (err error) {
+	status := models.ClusterMemberStatusActive
+	if IsDraining() {
+		status = models.ClusterMemberStatusLeaving
+	}
+	workflowNum := 0
+	GlobalWorkflowMap.Range(func(key, value any) bool {
+		workflowNum++
+		return true
+	})
+	busyNodeNum := countBusyWorkNode()
+	nowTime := time.Now()
+	_, err = db.WorkflowMysqlEngine.Exec("insert into core_cluster_member(host,status,workflow_num,busy_node_num,start_time,last_alive_time) values (?,?,?,?,?,?) on duplicate key update status=?,workflow_num=?,busy_node_num=?,start_time=?,last_alive_time=?",
+		instanceHost, status, workflowNum, busyNodeNum, clusterStartTime, nowTime, status, workflowNum, busyNodeNum, clusterStartTime, nowTime)
+	return
+}
+
+// rebalanceWorkflow 实例加入后,把内存中按hash归其它实例负责的空闲工作流释放,每轮只迁一批避免抖动
+// 交接要等节点空闲和工作流退出,放到单独的协程里并行执行,不阻塞心跳上报,上一轮没结束时不开始新一轮
+func rebalanceWorkflow() {
+	if !atomic.CompareAndSwapInt32(&rebalancing, 0, 1) {
+		return
+	}
+	var moveList []*Workflow
+	GlobalWorkflowMap.Range(func(key, value any) bool {
+		if len(moveList) >= models.ClusterRebalanceBatchSize {
+			return false
+		}
+		w := value.(*Workflow)
+		if !IsClusterOwner(w.Id) && !w.isReleasing() && w.busyNodeNum() == 0 {
+			moveList = append(moveList, w)
+		}
+		return true
+	})
+	go func() {
+		defer atomic.StoreInt32(&rebalancing, 0)
+		wg := sync.WaitGroup{}
+		for _, w := range moveList {
+			wg.Add(1)
+			go func(w *Workflow) {
+				defer wg.Done()
+				if w.handoff() {
+					log.WorkflowLogger.Info("rebalance workflow to other host", log.String("workflowId", w.Id), log.String("owner", GetClusterOwner(w.Id)))
+				}
+			}(w)
+		}
+		wg.Wait()
+	}()
+}
+
+// handoff 工作流退出内存并释放给负责的实例接管,退出前不再开始新节点,节点一直忙或没能退出时不释放,留在当前实例继续运行
+func (w *Workflow) handoff() bool {
+	atomic.StoreInt32(&w.releaseFlag, 1)
+	for i := 0; i < 60 && w.busyNodeNum() > 0; i++ {
+		time.Sleep(500 * time.Millisecond)
+	}
+	if w.busyNodeNum() > 0 {
+		atomic.StoreInt32(&w.releaseFlag, 0)
+		log.WorkflowLogger.Warn("handoff workflow abort,node still running", log.String("workflowId", w.Id))
+		return false
+	}
+	w.notifyUnload()
+	if !w.waitUnload(5 * time.Second) {
+		select {
+		case <-w.sleepChan:
+			// 退出信号还没被处理,收回后工作流留在当前实例继续运行
+			w.ProcRunWorkflow.Sleep = false
+			atomic.StoreInt32(&w.releaseFlag, 0)
+			log.WorkflowLogger.Warn("handoff workflow abort,workflow not unload", log.String("workflowId", w.Id))
+			return false
+		default:
+		}
+		if !w.waitUnload(30 * time.Second) {
+			log.WorkflowLogger.Error("handoff workflow abort,wait workflow unload timeout", log.String("workflowId", w.Id))
+			return false
+		}
+	}
+	return w.release()
+}
+
+func (w *Workflow) isReleasing() bool {
+	return atomic.LoadInt32(&w.releaseFlag) == 1
+}
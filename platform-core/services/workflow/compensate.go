@@ -0,0 +1,81 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/db"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/log"
+	"github.com/WeBankPartners/wecube-platform/platform-core/models"
+	"github.com/WeBankPartners/wecube-platform/platform-core/services/database"
+	"github.com/WeBankPartners/wecube-platform/platform-core/services/execution"
+	"time"
+)
+
+// 补偿前等待正在执行的节点结束的最长时间
+const compensateWaitTimeout = 30 * time.Minute
+
+// Rollback 终止工作流并按完成时间倒序补偿已完成的任务节点
+// 终止后不会再启动新节点,等已经在执行的节点结束后再补偿,避免补偿和节点执行同时进行
+func (w *Workflow) Rollback(input *models.ProcOperation) {
+	w.killChan <- *input
+	if !w.waitWorkNodeIdle(compensateWaitTimeout) {
+		// 工作流已终止,节点结束后可以再次回滚,已结束的工作流会直接补偿
+		log.WorkflowLogger.Error("workflow rollback give up compensate,node still running", log.String("workflowId", w.Id), log.Int("busyNodeNum", w.busyNodeNum()))
+		return
+	}
+	if err := compensateWorkflow(input.Ctx, w.Id, models.CompensateTriggerRollback, input.CreatedBy); err != nil {
+		log.WorkflowLogger.Error("workflow rollback fail", log.String("workflowId", w.Id), log.Error(err))
+	}
+}
+
+// waitWorkNodeIdle 等待工作流中正在执行的自动、数据和循环节点结束
+func (w *Workflow) waitWorkNodeIdle(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for w.busyNodeNum() > 0 {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	return true
+}
+
+// compensateWorkflow 按完成时间倒序执行任务节点的补偿服务,每个补偿记录为一个单独的任务节点,有补偿失败时停止
+func compensateWorkflow(ctx context.Context, workflowId, trigger, operator string) (err error) {
+	originNodes, err := database.GetCompensateRunNodes(ctx, workflowId)
+	if err != nil {
+		return
+	}
+	if len(originNodes) == 0 {
+		return
+	}
+	log.WorkflowLogger.Info("start compensate workflow", log.String("workflowId", workflowId), log.String("trigger", trigger), log.Int("nodeNum", len(originNodes)))
+	for _, originNode := range originNodes {
+		compensateNode, createErr := database.CreateCompensateNode(ctx, originNode, trigger, operator)
+		if createErr != nil {
+			err = createErr
+			break
+		}
+		compensateNode.Status = models.JobStatusRunning
+		compensateNode.StartTime = time.Now()
+		updateNodeDB(compensateNode)
+		if err = execution.DoWorkflowCompensateJob(ctx, compensateNode.Id, originNode.ProcInsNodeId); err != nil {
+			compensateNode.Status = models.JobStatusFail
+			compensateNode.ErrorMessage = err.Error()
+			updateNodeDB(compensateNode)
+			err = fmt.Errorf("compensate node %s fail,%s ", originNode.Name, err.Error())
+			break
+		}
+		compensateNode.Status = models.JobStatusSuccess
+		updateNodeDB(compensateNode)
+		log.WorkflowLogger.Info("compensate node done", log.String("workflowId", workflowId), log.String("originNode", originNode.Id), log.String("compensateNode", compensateNode.Id))
+	}
+	message := fmt.Sprintf("compensate done with trigger %s", trigger)
+	if err != nil {
+		message = err.Error()
+	}
+	if _, recordErr := db.WorkflowMysqlEngine.Exec("insert into proc_run_work_record(workflow_id,host,`action`,message,created_by,created_time) values (?,?,?,?,?,?)", workflowId, instanceHost, models.JobCompensateType, message, operator, time.Now()); recordErr != nil {
+		log.WorkflowLogger.Error("record workflow compensate fail", log.String("workflowId", workflowId), log.Error(recordErr))
+	}
+	return
+}
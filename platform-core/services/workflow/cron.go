@@ -6,6 +6,8 @@ import (
 	"github.com/WeBankPartners/wecube-platform/platform-core/common/db"
 	"github.com/WeBankPartners/wecube-platform/platform-core/common/log"
 	"github.com/WeBankPartners/wecube-platform/platform-core/models"
+	"github.com/WeBankPartners/wecube-platform/platform-core/services/database"
+	"strconv"
 	"time"
 )
 
@@ -15,6 +17,12 @@ func StartCronJob() {
 	go loadAllWorkflow()
 	go startTakeOverJob()
 	go startSleepWorkflowJob()
+	go startTimerJob()
+	go startApprovalJob()
+	go startProcInsQueueJob()
+	go startProcEntityLockJob()
+	go startProcInsBulkJob()
+	go startClusterMemberJob()
 }
 
 // 当前自身内存中有运行工作流的情况下，没有就跳过
@@ -28,6 +36,9 @@ func startScanOperationJob() {
 }
 
 func doScanOperationJob() {
+	if IsDraining() {
+		return
+	}
 	var curWorkflowIds []string
 	GlobalWorkflowMap.Range(func(key, value any) bool {
 		curWorkflowIds = append(curWorkflowIds, key.(string))
@@ -51,7 +62,36 @@ func doScanOperationJob() {
 	}
 }
 
+// KillSubProc 终止实例(节点)下运行中的子编排
+func KillSubProc(ctx context.Context, mainProcInsId, procNodeId, operator string) {
+	var err error
+	var subWorkflowIdList []string
+	subWorkflowIdList, err = database.GetRunningProcInsSubWorkflow(ctx, mainProcInsId, procNodeId)
+	if err != nil {
+		log.Logger.Error("Try to kill sub proc fail with query sub workflow list", log.String("mainProcIns", mainProcInsId), log.Error(err))
+		return
+	}
+	if len(subWorkflowIdList) == 0 {
+		return
+	}
+	for _, subWorkflowId := range subWorkflowIdList {
+		subOperationObj := models.ProcRunOperation{WorkflowId: subWorkflowId, Operation: "kill", Status: "wait", CreatedBy: operator}
+		subOperationObj.Id, err = database.AddWorkflowOperation(ctx, &subOperationObj)
+		if err != nil {
+			log.Logger.Error("Try to kill sub proc fail", log.String("mainProcIns", mainProcInsId), log.String("subWorkflowId", subWorkflowId), log.Error(err))
+		} else {
+			go HandleProOperation(&subOperationObj)
+		}
+	}
+	return
+}
+
 func HandleProOperation(operation *models.ProcRunOperation) {
+	if IsDraining() {
+		// 实例退出中,操作留在wait状态由接管的实例处理
+		log.WorkflowLogger.Warn("give up handle operation,host is draining", log.Int64("operation", operation.Id))
+		return
+	}
 	// 尝试抢占
 	execResult, err := db.WorkflowMysqlEngine.Exec("update proc_run_operation set status='doing',handle_by=?,start_time=? where id=? and status='wait'", instanceHost, time.Now(), operation.Id)
 	if err != nil {
@@ -85,6 +125,14 @@ func HandleProOperation(operation *models.ProcRunOperation) {
 			log.WorkflowLogger.Error("handle operation fail with get workflow row", log.Error(queryErr))
 			return
 		}
+		if operation.Operation == "rollback" && (workflowRow.Status == models.JobStatusFail || workflowRow.Status == models.JobStatusKill) {
+			// 已经结束的工作流直接补偿
+			if err = compensateWorkflow(context.Background(), operation.WorkflowId, models.CompensateTriggerRollback, operation.CreatedBy); err != nil {
+				log.WorkflowLogger.Error("handle rollback operation fail", log.String("workflowId", operation.WorkflowId), log.Error(err))
+			}
+			doneFlag = true
+			return
+		}
 		if !workflowRow.Sleep {
 			// 如果不是sleep，应该有其它实例在处理它，如果也没有其它实例处理它，那等抢占的worker把它接管后再处理
 			log.WorkflowLogger.Warn("give up handle operation,workflow is not sleeping", log.String("workflowId", operation.WorkflowId))
@@ -95,6 +143,7 @@ func HandleProOperation(operation *models.ProcRunOperation) {
 			log.WorkflowLogger.Error("handle operation fail with set workflow sleep false", log.String("workflowId", operation.WorkflowId), log.Error(err))
 			return
 		}
+		database.AddProcInsTimeline(context.Background(), &models.ProcInsTimeline{WorkflowId: operation.WorkflowId, EventType: models.TimelineEventWakeup, Message: fmt.Sprintf("wakeup by operation:%s", operation.Operation), RefId: strconv.FormatInt(operation.Id, 10), Host: instanceHost, CreatedBy: operation.CreatedBy})
 		if err = recoverWorkflow(operation.WorkflowId); err != nil {
 			setWorkflowSleepDB(operation.WorkflowId, true)
 			log.WorkflowLogger.Error("handle operation fail with recover workflow from sleep", log.String("workflowId", operation.WorkflowId), log.Error(err))
@@ -128,16 +177,23 @@ func doWorkflowOperation(operation *models.ProcRunOperation, workObj *Workflow)
 		workObj.Continue(&opObj)
 	case "confirm":
 		workObj.RetryNode(operation.NodeId, true)
+	case "rollback":
+		workObj.Rollback(&opObj)
+	case "timer", "signal", "breakpoint", "approval":
+		workObj.FireTimer(operation.NodeId)
+	case "migrate":
+		workObj.Migrate(operation.Message)
 	default:
 		log.WorkflowLogger.Error("handle operation error with illegal operation", log.String("operation", operation.Operation))
 	}
 }
 
 // 每10s扫描工作流表找是否有需要尝试接管的工作流
-// 条件是 where sleep=0 and status in (running,problem) and last_alive_time<=now()-30，组合索引(sleep+status)
+// 条件是 where sleep=0 and status in (running,problem) and (last_alive_time<=now()-30 or host='released')，组合索引(sleep+status)
 // 正常情况下不会扫到，扫到的情况下尝试恢复
 // 恢复的话先抢占工作流表(update proc_run_workflow set host='xx',last_alive_time=now where id=wId and last_alive_time<now()-30)
 // 抢占成功后内存加载该工作流
+// 多实例时只接管按一致性hash归自己负责的工作流,超过兜底时间还没人接管的任何实例都可以接管
 func startTakeOverJob() {
 	t := time.NewTicker(10 * time.Second).C
 	for {
@@ -147,19 +203,26 @@ func startTakeOverJob() {
 }
 
 func doTakeOver() {
+	if IsDraining() {
+		return
+	}
 	var workflowRows []*models.ProcRunWorkflow
 	lastTime := time.Unix(time.Now().Unix()-30, 0).Format(models.DateTimeFormat)
-	err := db.WorkflowMysqlEngine.SQL("select id,status,host,updated_time,last_alive_time from proc_run_workflow where `sleep`=0 and status=? and last_alive_time<=?", models.JobStatusRunning, lastTime).Find(&workflowRows)
+	err := db.WorkflowMysqlEngine.SQL("select id,status,host,updated_time,last_alive_time from proc_run_workflow where `sleep`=0 and status=? and (last_alive_time<=? or host=?)", models.JobStatusRunning, lastTime, models.WorkflowHostReleased).Find(&workflowRows)
 	if err != nil {
 		log.WorkflowLogger.Error("do takeover workflow fail with query workflow table error", log.Error(err))
 		return
 	}
 	for _, row := range workflowRows {
+		if !IsClusterOwnerOrOverdue(row.Id, row.LastAliveTime) {
+			continue
+		}
 		if !tryTakeoverWorkflowRow(row.Id) {
 			log.WorkflowLogger.Warn("tryTakeoverWorkflowRow fail", log.String("workflowId", row.Id))
 			continue
 		}
 		log.WorkflowLogger.Info("start takeoverWorkflowRow", log.String("workflowId", row.Id))
+		database.AddProcInsTimeline(context.Background(), &models.ProcInsTimeline{WorkflowId: row.Id, EventType: models.TimelineEventTakeover, Message: fmt.Sprintf("takeover from host:%s", row.Host), Host: instanceHost, CreatedBy: "system"})
 		if tmpErr := recoverWorkflow(row.Id); tmpErr != nil {
 			log.WorkflowLogger.Error("end takeoverWorkflowRow,fail recover workflow", log.String("workflowId", row.Id), log.Error(tmpErr))
 		}
@@ -170,7 +233,7 @@ func tryTakeoverWorkflowRow(workflowId string) bool {
 	ok := false
 	nowTime := time.Now().Format(models.DateTimeFormat)
 	lastTime := time.Unix(time.Now().Unix()-30, 0).Format(models.DateTimeFormat)
-	execResult, execErr := db.WorkflowMysqlEngine.Exec("update proc_run_workflow set host=?,last_alive_time=? where id=? and last_alive_time<?", instanceHost, nowTime, workflowId, lastTime)
+	execResult, execErr := db.WorkflowMysqlEngine.Exec("update proc_run_workflow set host=?,last_alive_time=? where id=? and (last_alive_time<? or host=?)", instanceHost, nowTime, workflowId, lastTime, models.WorkflowHostReleased)
 	if execErr != nil {
 		log.WorkflowLogger.Error("tryTakeoverWorkflowRow fail with exec update workflow sql", log.Error(execErr))
 		return ok
@@ -215,6 +278,7 @@ func recoverWorkflow(workflowId string) (err error) {
 		err = fmt.Errorf("workflow status:%s illegal", workflowRow.Status)
 		return
 	}
+	database.AddProcInsTimeline(ctx, &models.ProcInsTimeline{ProcInsId: workflowRow.ProcInsId, WorkflowId: workflowId, EventType: models.TimelineEventRecover, Host: instanceHost, CreatedBy: "system"})
 	// 初始化workflow并开始
 	workObj := Workflow{ProcRunWorkflow: *workflowRow}
 	workObj.Init(context.Background(), workNodes, workLinks)
@@ -225,7 +289,7 @@ func recoverWorkflow(workflowId string) (err error) {
 
 func getWorkflowData(ctx context.Context, workflowId string) (workflowRow *models.ProcRunWorkflow, nodeList []*models.ProcRunNode, linkList []*models.ProcRunLink, err error) {
 	var workflowRows []*models.ProcRunWorkflow
-	err = db.WorkflowMysqlEngine.Context(ctx).SQL("select id,proc_ins_id,name,status,error_message,host,last_alive_time from proc_run_workflow where id=?", workflowId).Find(&workflowRows)
+	err = db.WorkflowMysqlEngine.Context(ctx).SQL("select id,proc_ins_id,name,status,error_message,host,last_alive_time,created_time from proc_run_workflow where id=?", workflowId).Find(&workflowRows)
 	if err != nil {
 		err = fmt.Errorf("query workflow table fail,%s ", err.Error())
 		return
@@ -308,10 +372,10 @@ func isWorkflowNeedSleep(ctx context.Context, workflowRow *models.ProcRunWorkflo
 		ok = true
 		return
 	}
-	// 正在运行的节点是人工节点
+	// 正在运行的节点是人工节点、等待定时器的时间节点或等待信号节点
 	allHumanTypeFlag := true
 	for _, v := range currentNodes {
-		if v.JobType != models.JobHumanType {
+		if v.JobType != models.JobHumanType && v.JobType != models.JobTimeType && v.JobType != models.JobDateType && v.JobType != models.JobSignalType {
 			allHumanTypeFlag = false
 			break
 		}
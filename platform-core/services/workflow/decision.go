@@ -0,0 +1,101 @@
+package workflow
+
+import (
+	"fmt"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/exterror"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/log"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/tools"
+	"github.com/WeBankPartners/wecube-platform/platform-core/models"
+	"github.com/WeBankPartners/wecube-platform/platform-core/services/database"
+	"github.com/WeBankPartners/wecube-platform/platform-core/services/execution"
+	"strings"
+)
+
+// 判断分支表达式中变量的命名空间
+var decisionVariableNamespaces = []string{"context", "nodes", "root", "vars"}
+
+// evalDecisionBranch 计算判断节点出线上的表达式,返回选中的分支名称
+// 按分支名称顺序计算,有多个表达式成立时第一个成立的分支生效,都不成立时走默认分支
+// 出线都没有配置表达式时返回空(只配了默认分支也一样),仍走原来的上游输出或人工选择的方式
+func evalDecisionBranch(n *WorkNode) (branch string, err error) {
+	procInsNode, err := database.GetSimpleProcInsNode(n.Ctx, "", n.Id)
+	if err != nil {
+		return
+	}
+	procDefNode, err := database.GetSimpleProcDefNode(n.Ctx, procInsNode.ProcDefNodeId)
+	if err != nil {
+		return
+	}
+	nodeLinkList, err := database.GetProcDefNodeLinkByProcDefIdAndSource(n.Ctx, procDefNode.ProcDefId, procDefNode.Id)
+	if err != nil {
+		return
+	}
+	var defaultBranch string
+	var expressionLinks []*models.ProcDefNodeLink
+	for _, link := range nodeLinkList {
+		if link.IsDefault {
+			defaultBranch = link.Name
+		}
+		if strings.TrimSpace(link.Expression) != "" {
+			expressionLinks = append(expressionLinks, link)
+		}
+	}
+	if len(expressionLinks) == 0 {
+		return
+	}
+	contextMap, err := execution.BuildDecisionContextMap(n.Ctx, procInsNode.ProcInsId)
+	if err != nil {
+		err = fmt.Errorf("build decision context fail,%s ", err.Error())
+		return
+	}
+	for _, link := range expressionLinks {
+		expr, parseErr := tools.ParseBoolExpression(link.Expression)
+		if parseErr != nil {
+			err = fmt.Errorf("decision branch %s expression %s illegal,%s ", link.Name, link.Expression, parseErr.Error())
+			return
+		}
+		matched, evalErr := expr.Eval(contextMap)
+		if evalErr != nil {
+			err = fmt.Errorf("decision branch %s expression %s eval fail,%s ", link.Name, link.Expression, evalErr.Error())
+			return
+		}
+		log.WorkflowLogger.Info("decision branch eval", log.String("nodeId", n.Id), log.String("branch", link.Name), log.String("expression", link.Expression), log.Bool("matched", matched))
+		if matched {
+			branch = link.Name
+			return
+		}
+	}
+	if defaultBranch == "" {
+		err = fmt.Errorf("decision node %s no branch expression matched and no default branch ", n.Name)
+		return
+	}
+	branch = defaultBranch
+	return
+}
+
+// validateDecisionExpression 发布编排时检查判断节点出线的表达式语法和默认分支
+func validateDecisionExpression(node *models.ProcDefNode, nodeLinkList []*models.ProcDefNodeLink) error {
+	defaultCount := 0
+	for _, link := range nodeLinkList {
+		if link.IsDefault {
+			defaultCount = defaultCount + 1
+		}
+		if strings.TrimSpace(link.Expression) == "" {
+			continue
+		}
+		expr, err := tools.ParseBoolExpression(link.Expression)
+		if err != nil {
+			return exterror.New().ProcDefNodeDecisionExpressionError.WithParam(node.Name, link.Name, err.Error())
+		}
+		for _, variable := range expr.Variables() {
+			namespace := strings.Split(variable, ".")[0]
+			if !tools.StringListContains(decisionVariableNamespaces, namespace) {
+				return exterror.New().ProcDefNodeDecisionExpressionError.WithParam(node.Name, link.Name, fmt.Sprintf("unknown variable %s", variable))
+			}
+		}
+	}
+	if defaultCount > 1 {
+		return exterror.New().ProcDefNodeDecisionExpressionError.WithParam(node.Name, "", "more than one default branch")
+	}
+	return nil
+}
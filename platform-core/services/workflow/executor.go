@@ -0,0 +1,388 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/exterror"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/log"
+	"github.com/WeBankPartners/wecube-platform/platform-core/models"
+	"github.com/WeBankPartners/wecube-platform/platform-core/services/database"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	nodeExecutorMap  = make(map[string]NodeExecutor)
+	nodeExecutorLock = new(sync.RWMutex)
+)
+
+// NodeExecutor 节点执行器，按任务类型(job type)注册，新增节点类型时实现该接口并注册即可，不需要改动调度主流程
+type NodeExecutor interface {
+	// JobType 执行器对应的任务类型
+	JobType() string
+	// Ready 节点收到启动信号后、开始执行前调用
+	Ready(n *WorkNode)
+	// RecoverExpired 编排重新加载恢复运行态节点时调用，返回true表示节点已超时不再继续执行
+	RecoverExpired(n *WorkNode) bool
+	// Start 执行节点任务，recoverFlag为true表示编排重新加载后恢复执行
+	Start(n *WorkNode, recoverFlag bool) (output string, err error)
+	// Callback 接收外部回调消息，如人工审批结果、判断分支选择
+	Callback(n *WorkNode, message string)
+	// Validate 发布编排时检查节点定义是否合法
+	Validate(ctx context.Context, procDef *models.ProcDef, node *models.ProcDefNode, inCount, outCount int) error
+}
+
+// RegisterNodeExecutor 注册节点执行器，同一任务类型重复注册时后注册的覆盖前面的
+func RegisterNodeExecutor(executor NodeExecutor) {
+	nodeExecutorLock.Lock()
+	nodeExecutorMap[executor.JobType()] = executor
+	nodeExecutorLock.Unlock()
+}
+
+// GetNodeExecutor 根据任务类型获取节点执行器
+func GetNodeExecutor(jobType string) (executor NodeExecutor, ok bool) {
+	nodeExecutorLock.RLock()
+	executor, ok = nodeExecutorMap[jobType]
+	nodeExecutorLock.RUnlock()
+	return
+}
+
+// ValidateProcDefNode 发布编排时由节点对应的执行器检查节点定义，未注册执行器的节点仅支持单进单出
+func ValidateProcDefNode(ctx context.Context, procDef *models.ProcDef, node *models.ProcDefNode, inCount, outCount int) error {
+	if err := validateNodeVariables(ctx, procDef, node); err != nil {
+		return err
+	}
+	executor, ok := GetNodeExecutor(node.NodeType)
+	if !ok {
+		if inCount != 1 || outCount != 1 {
+			return exterror.New().ProcDefNode20000010Error.WithParam(node.Name)
+		}
+		return nil
+	}
+	return executor.Validate(ctx, procDef, node, inCount, outCount)
+}
+
+func init() {
+	RegisterNodeExecutor(&noopExecutor{jobType: models.JobStartType})
+	RegisterNodeExecutor(&noopExecutor{jobType: models.JobEndType})
+	RegisterNodeExecutor(&noopExecutor{jobType: models.JobBreakType})
+	RegisterNodeExecutor(&forkExecutor{noopExecutor{jobType: models.JobForkType}})
+	RegisterNodeExecutor(&mergeExecutor{noopExecutor{jobType: models.JobMergeType}})
+	RegisterNodeExecutor(&mergeExecutor{noopExecutor{jobType: models.JobDecisionMergeType}})
+	RegisterNodeExecutor(&autoExecutor{})
+	RegisterNodeExecutor(&dataExecutor{})
+	RegisterNodeExecutor(&humanExecutor{})
+	RegisterNodeExecutor(&timeExecutor{})
+	RegisterNodeExecutor(&dateExecutor{})
+	RegisterNodeExecutor(&decisionExecutor{})
+	RegisterNodeExecutor(&subProcExecutor{})
+	RegisterNodeExecutor(&loopExecutor{})
+	RegisterNodeExecutor(&signalExecutor{})
+}
+
+// noopExecutor 不做任何事情的执行器，作为其它执行器的默认实现
+type noopExecutor struct {
+	jobType string
+}
+
+func (e *noopExecutor) JobType() string {
+	return e.jobType
+}
+
+func (e *noopExecutor) Ready(n *WorkNode) {
+}
+
+func (e *noopExecutor) RecoverExpired(n *WorkNode) bool {
+	return false
+}
+
+func (e *noopExecutor) Start(n *WorkNode, recoverFlag bool) (output string, err error) {
+	output = n.Output
+	return
+}
+
+func (e *noopExecutor) Callback(n *WorkNode, message string) {
+	n.callbackChan <- message
+}
+
+func (e *noopExecutor) Validate(ctx context.Context, procDef *models.ProcDef, node *models.ProcDefNode, inCount, outCount int) error {
+	return nil
+}
+
+// singleLinkValidate 任务节点、时间节点仅支持单进单出
+func singleLinkValidate(node *models.ProcDefNode, inCount, outCount int) error {
+	if inCount != 1 || outCount != 1 {
+		return exterror.New().ProcDefNode20000010Error.WithParam(node.Name)
+	}
+	return nil
+}
+
+// recoverTimeoutExpired 恢复时节点运行时间超过超时时间的直接置为超时
+func recoverTimeoutExpired(n *WorkNode) bool {
+	if n.Timeout <= 0 || time.Since(n.StartTime).Minutes() <= float64(n.Timeout) {
+		return false
+	}
+	n.ErrorMessage = fmt.Sprintf(timeoutErrorTpl, n.Timeout)
+	n.Err = errors.New(n.ErrorMessage)
+	n.Status = models.JobStatusTimeout
+	updateNodeDB(&n.ProcRunNode)
+	return true
+}
+
+type forkExecutor struct {
+	noopExecutor
+}
+
+func (e *forkExecutor) Validate(ctx context.Context, procDef *models.ProcDef, node *models.ProcDefNode, inCount, outCount int) error {
+	// 分流必须单进多出
+	if !(inCount == 1 && outCount > 1) {
+		return exterror.New().ProcDefNode20000004Error.WithParam(node.Name)
+	}
+	return nil
+}
+
+type mergeExecutor struct {
+	noopExecutor
+}
+
+func (e *mergeExecutor) Start(n *WorkNode, recoverFlag bool) (output string, err error) {
+	output = n.Output
+	if e.jobType != models.JobMergeType {
+		return
+	}
+	needStartCount := 0
+	for _, ref := range n.workflow.Links {
+		if ref.Target == n.Id {
+			needStartCount = needStartCount + 1
+		}
+	}
+	if needStartCount > 1 {
+		log.WorkflowLogger.Info("merge wait other signal", log.Int("wait signal num", needStartCount-1))
+		n.Status = "wait"
+		updateNodeDB(&n.ProcRunNode)
+		for needStartCount > 1 {
+			<-n.StartChan
+			needStartCount = needStartCount - 1
+			log.WorkflowLogger.Info("merge get another signal", log.Int("wait signal num", needStartCount-1))
+		}
+	}
+	return
+}
+
+func (e *mergeExecutor) Validate(ctx context.Context, procDef *models.ProcDef, node *models.ProcDefNode, inCount, outCount int) error {
+	// 汇聚和判断汇聚必须多进单出
+	if !(inCount > 1 && outCount == 1) {
+		return exterror.New().ProcDefNode20000005Error.WithParam(node.Name)
+	}
+	return nil
+}
+
+type autoExecutor struct {
+	noopExecutor
+}
+
+func (e *autoExecutor) JobType() string {
+	return models.JobAutoType
+}
+
+func (e *autoExecutor) RecoverExpired(n *WorkNode) bool {
+	// 如果是恢复态，自动化和数据写入任务时间太久的情况下就置为超时，不然可能时间太长一些数据都不一样了，让用户自行重试
+	return recoverTimeoutExpired(n)
+}
+
+func (e *autoExecutor) Start(n *WorkNode, recoverFlag bool) (output string, err error) {
+	return n.doWithRetry(recoverFlag, n.doAutoJob)
+}
+
+func (e *autoExecutor) Validate(ctx context.Context, procDef *models.ProcDef, node *models.ProcDefNode, inCount, outCount int) error {
+	if strings.TrimSpace(node.ServiceName) == "" {
+		return exterror.New().ProcDefNodeServiceNameEmptyError.WithParam(node.Name)
+	}
+	if err := validateRetryPolicy(node); err != nil {
+		return err
+	}
+	if strings.TrimSpace(node.CompensateService) != "" {
+		// 补偿服务必须是已启用的插件服务
+		if _, err := database.GetSimpleLastPluginInterface(ctx, node.CompensateService); err != nil {
+			return exterror.New().ProcDefNodeCompensateServiceError.WithParam(node.Name, node.CompensateService)
+		}
+	}
+	return singleLinkValidate(node, inCount, outCount)
+}
+
+type dataExecutor struct {
+	noopExecutor
+}
+
+func (e *dataExecutor) JobType() string {
+	return models.JobDataType
+}
+
+func (e *dataExecutor) RecoverExpired(n *WorkNode) bool {
+	return recoverTimeoutExpired(n)
+}
+
+func (e *dataExecutor) Start(n *WorkNode, recoverFlag bool) (output string, err error) {
+	return n.doWithRetry(recoverFlag, n.doDataJob)
+}
+
+func (e *dataExecutor) Validate(ctx context.Context, procDef *models.ProcDef, node *models.ProcDefNode, inCount, outCount int) error {
+	// 判断定位规则有没有带operation
+	if _, err := database.GetProcDataNodeExpression(node.RoutineExpression); err != nil {
+		return exterror.New().ProcDefDataNodeError.WithParam(node.Name)
+	}
+	return validateRetryPolicy(node)
+}
+
+type humanExecutor struct {
+	noopExecutor
+}
+
+func (e *humanExecutor) JobType() string {
+	return models.JobHumanType
+}
+
+func (e *humanExecutor) Start(n *WorkNode, recoverFlag bool) (output string, err error) {
+	return n.doHumanJob(recoverFlag)
+}
+
+func (e *humanExecutor) Validate(ctx context.Context, procDef *models.ProcDef, node *models.ProcDefNode, inCount, outCount int) error {
+	// 配置了多人审批策略时表单插件可选
+	if policy := models.ParseProcNodeApprovalPolicy(node.ApprovalPolicy); policy != nil {
+		if err := validateApprovalPolicy(node, policy); err != nil {
+			return err
+		}
+	} else if strings.TrimSpace(node.ServiceName) == "" {
+		return exterror.New().ProcDefNodeServiceNameEmptyError.WithParam(node.Name)
+	}
+	if procDef.SubProc {
+		return exterror.New().ProcDefSubProcCheckError
+	}
+	return singleLinkValidate(node, inCount, outCount)
+}
+
+type timeExecutor struct {
+	noopExecutor
+}
+
+func (e *timeExecutor) JobType() string {
+	return models.JobTimeType
+}
+
+func (e *timeExecutor) Start(n *WorkNode, recoverFlag bool) (output string, err error) {
+	return n.doTimeJob(recoverFlag)
+}
+
+func (e *timeExecutor) Validate(ctx context.Context, procDef *models.ProcDef, node *models.ProcDefNode, inCount, outCount int) error {
+	if err := validateNodeCalendar(ctx, node); err != nil {
+		return err
+	}
+	return singleLinkValidate(node, inCount, outCount)
+}
+
+type dateExecutor struct {
+	noopExecutor
+}
+
+func (e *dateExecutor) JobType() string {
+	return models.JobDateType
+}
+
+func (e *dateExecutor) Start(n *WorkNode, recoverFlag bool) (output string, err error) {
+	return n.doDateJob(recoverFlag)
+}
+
+func (e *dateExecutor) Validate(ctx context.Context, procDef *models.ProcDef, node *models.ProcDefNode, inCount, outCount int) error {
+	// 时间节点,日期不能为空
+	if node.TimeConfig != "" {
+		timeConfigDto := &models.TimeConfigDto{}
+		json.Unmarshal([]byte(node.TimeConfig), timeConfigDto)
+		if strings.TrimSpace(timeConfigDto.Date) == "" {
+			return exterror.New().ProcDefNodeDateEmptyError.WithParam(node.Name)
+		}
+	}
+	if err := validateNodeCalendar(ctx, node); err != nil {
+		return err
+	}
+	return singleLinkValidate(node, inCount, outCount)
+}
+
+type decisionExecutor struct {
+	noopExecutor
+}
+
+func (e *decisionExecutor) JobType() string {
+	return models.JobDecisionType
+}
+
+func (e *decisionExecutor) Start(n *WorkNode, recoverFlag bool) (output string, err error) {
+	n.Input = getNodeInputData(n.Id)
+	if n.Input == "" {
+		// 分支线上配置了表达式的由引擎直接计算选择分支
+		if n.Input, err = evalDecisionBranch(n); err != nil {
+			return
+		}
+		if n.Input != "" {
+			if tmpErr := updateNodeInputData(n.Id, n.Input); tmpErr != nil {
+				log.WorkflowLogger.Error("updateNodeInputData for decision job fail", log.Error(tmpErr))
+			}
+			output = n.Output
+			return
+		}
+		for _, tmpLink := range n.workflow.Links {
+			if tmpLink.Target == n.Id {
+				n.Input = getNodeOutputData(tmpLink.Source)
+				break
+			}
+		}
+		if n.Input == "" {
+			n.Input = <-n.callbackChan
+		}
+		if tmpErr := updateNodeInputData(n.Id, n.Input); tmpErr != nil {
+			log.WorkflowLogger.Error("updateNodeInputData for decision job fail", log.Error(tmpErr))
+		}
+	}
+	output = n.Output
+	return
+}
+
+func (e *decisionExecutor) Validate(ctx context.Context, procDef *models.ProcDef, node *models.ProcDefNode, inCount, outCount int) error {
+	//  判断节点出的线,必须有名字并且同一个判断节点的所有线的名字不能相同
+	var tempLinkNameMap = make(map[string]bool)
+	nodeLinkList, err := database.GetProcDefNodeLinkByProcDefIdAndSource(ctx, procDef.Id, node.Id)
+	if err != nil {
+		return exterror.Catch(exterror.New().DatabaseQueryError, err)
+	}
+	for _, link := range nodeLinkList {
+		if strings.TrimSpace(link.Name) == "" || tempLinkNameMap[link.Name] {
+			return exterror.New().ProcDefNode20000006Error.WithParam(node.Name)
+		}
+		tempLinkNameMap[link.Name] = true
+	}
+	return validateDecisionExpression(node, nodeLinkList)
+}
+
+type subProcExecutor struct {
+	noopExecutor
+}
+
+func (e *subProcExecutor) JobType() string {
+	return models.JobSubProcType
+}
+
+func (e *subProcExecutor) Start(n *WorkNode, recoverFlag bool) (output string, err error) {
+	return n.doSubProcessJob(recoverFlag)
+}
+
+func (e *subProcExecutor) Validate(ctx context.Context, procDef *models.ProcDef, node *models.ProcDefNode, inCount, outCount int) error {
+	if procDef.SubProc {
+		return exterror.New().ProcDefSubProcCheckError
+	}
+	if node.SubProcDefId == "" {
+		return exterror.New().ProcDefNodeSubProcEmptyError.WithParam(node.Name)
+	}
+	return nil
+}
@@ -0,0 +1,467 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/exterror"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/tools"
+	"github.com/WeBankPartners/wecube-platform/platform-core/models"
+	"github.com/WeBankPartners/wecube-platform/platform-core/services/database"
+	"github.com/WeBankPartners/wecube-platform/platform-core/services/remote"
+	"sort"
+	"strings"
+)
+
+// 数据模型里每个实体都有的内置属性
+var lintBuiltinAttributes = map[string]bool{"id": true, "displayName": true}
+
+// procDefLinter 编排静态检查,同一次检查内缓存插件服务和数据模型实体
+type procDefLinter struct {
+	ctx          context.Context
+	procDef      *models.ProcDef
+	result       *models.ProcDefLintResult
+	nodeList     []*models.ProcDefNode
+	linkList     []*models.ProcDefNodeLink
+	nodeMap      map[string]*models.ProcDefNode            // key->proc_def_node.id
+	nodeIdMap    map[string]*models.ProcDefNode            // key->前端nodeId
+	ancestorMap  map[string]map[string]bool                // key->proc_def_node.id,value->前置节点id
+	interfaceMap map[string]*models.PluginConfigInterfaces // key->服务名,value为nil表示服务不可用
+	entityMap    map[string]*models.DataModelEntity        // key->package:entity,value为nil表示实体不存在
+}
+
+// LintProcDef 静态检查编排定义,不修改编排数据,所有问题都放到结果里而不是遇到第一个就返回
+func LintProcDef(ctx context.Context, procDef *models.ProcDef) (result *models.ProcDefLintResult, err error) {
+	l := &procDefLinter{ctx: ctx, procDef: procDef, result: &models.ProcDefLintResult{ProcDefId: procDef.Id, Items: []*models.ProcDefLintItem{}},
+		nodeMap: make(map[string]*models.ProcDefNode), nodeIdMap: make(map[string]*models.ProcDefNode), ancestorMap: make(map[string]map[string]bool),
+		interfaceMap: make(map[string]*models.PluginConfigInterfaces), entityMap: make(map[string]*models.DataModelEntity)}
+	if l.nodeList, err = database.GetProcDefNodeById(ctx, procDef.Id); err != nil {
+		return
+	}
+	if l.linkList, err = database.GetProcDefNodeLinkListByProcDefId(ctx, procDef.Id); err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+		return
+	}
+	result = l.result
+	if len(l.nodeList) == 0 {
+		l.addError(models.LintRuleGraph, nil, "", exterror.New().ProcDefNode20000009Error)
+		return
+	}
+	for _, node := range l.nodeList {
+		l.nodeMap[node.Id] = node
+		l.nodeIdMap[node.NodeId] = node
+	}
+	l.lintGraph()
+	l.lintUnreachable()
+	for _, node := range l.nodeList {
+		if err = l.lintNode(node); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (l *procDefLinter) addError(rule string, node *models.ProcDefNode, paramName string, err error) {
+	l.add(models.LintLevelError, rule, node, paramName, err.Error(), err)
+}
+
+func (l *procDefLinter) add(level, rule string, node *models.ProcDefNode, paramName, message string, err error) {
+	item := &models.ProcDefLintItem{Level: level, Rule: rule, ParamName: paramName, Message: message, Err: err}
+	if node != nil {
+		item.Id, item.NodeId, item.NodeName = node.Id, node.NodeId, node.Name
+	}
+	l.result.Add(item)
+}
+
+// lintGraph 编排图检查,和发布检查一致但会列出所有问题
+func (l *procDefLinter) lintGraph() {
+	nameCountMap := make(map[string]int)
+	for _, node := range l.nodeList {
+		nameCountMap[node.Name]++
+	}
+	var startNameList, endNameList, sortNodeIds []string
+	for _, node := range l.nodeList {
+		if nameCountMap[node.Name] > 1 {
+			l.addError(models.LintRuleGraph, node, "", exterror.New().ProcDefNodeNameRepeatError.WithParam(node.Name))
+		}
+		if node.NodeType == models.JobStartType {
+			startNameList = append(startNameList, node.Name)
+		} else if node.NodeType == models.JobEndType {
+			endNameList = append(endNameList, node.Name)
+		}
+		sortNodeIds = append(sortNodeIds, node.Id)
+	}
+	if err := ValidateProcDefVariables(l.procDef); err != nil {
+		l.addError(models.LintRuleGraph, nil, "", err)
+	}
+	if len(startNameList) > 1 || len(endNameList) > 1 {
+		l.addError(models.LintRuleGraph, nil, "", exterror.New().ProcDefNode20000007Error.WithParam(strings.Join(startNameList, ","), strings.Join(endNameList, ",")))
+	}
+	var sortLinks [][]string
+	for _, link := range l.linkList {
+		sortLinks = append(sortLinks, []string{link.Source, link.Target})
+		source, target := l.nodeMap[link.Source], l.nodeMap[link.Target]
+		if source == nil || target == nil {
+			continue
+		}
+		if source.NodeType == models.JobForkType && (target == source || target.NodeType == models.JobMergeType) {
+			l.addError(models.LintRuleGraph, source, "", exterror.New().ProcDefNode20000008Error.WithParam(source.Name, target.Name))
+		}
+	}
+	sortNodeIdMap, isLoop := tools.ProcNodeSort(sortNodeIds, sortLinks)
+	if isLoop {
+		l.addError(models.LintRuleGraph, nil, "", exterror.New().ProcDefLoopCheckError)
+		return
+	}
+	// 按拓扑顺序检查判断和分流是否都有成对的汇聚
+	sortNodes := make(models.ProcDefSortNodes, 0, len(l.nodeList))
+	for _, node := range l.nodeList {
+		sortNode := *node
+		sortNode.OrderedNo = sortNodeIdMap[node.Id]
+		sortNodes = append(sortNodes, &sortNode)
+	}
+	sort.Sort(sortNodes)
+	decisionCount, forkCount := 0, 0
+	for _, node := range sortNodes {
+		switch node.NodeType {
+		case models.JobDecisionType:
+			decisionCount++
+		case models.JobDecisionMergeType:
+			if decisionCount--; decisionCount < 0 {
+				l.addError(models.LintRuleGraph, l.nodeMap[node.Id], "", exterror.New().ProcDefDecisionMergeError.WithParam(node.Name))
+				decisionCount = 0
+			}
+		case models.JobForkType:
+			forkCount++
+		case models.JobMergeType:
+			if forkCount--; forkCount < 0 {
+				l.addError(models.LintRuleGraph, l.nodeMap[node.Id], "", exterror.New().ProcDefMergeError.WithParam(node.Name))
+				forkCount = 0
+			}
+		}
+	}
+}
+
+// lintUnreachable 从开始节点沿连线走不到的节点
+func (l *procDefLinter) lintUnreachable() {
+	var queue []string
+	reachMap := make(map[string]bool)
+	for _, node := range l.nodeList {
+		if node.NodeType == models.JobStartType {
+			queue = append(queue, node.Id)
+			reachMap[node.Id] = true
+		}
+	}
+	if len(queue) == 0 {
+		l.add(models.LintLevelError, models.LintRuleGraph, nil, "", "start node not found", nil)
+		return
+	}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, link := range l.linkList {
+			if link.Source == current && !reachMap[link.Target] {
+				reachMap[link.Target] = true
+				queue = append(queue, link.Target)
+			}
+		}
+	}
+	for _, node := range l.nodeList {
+		if !reachMap[node.Id] {
+			l.add(models.LintLevelError, models.LintRuleUnreachableNode, node, "", fmt.Sprintf("node %s can not be reached from start node", node.Name), nil)
+		}
+	}
+}
+
+// getAncestors 逆着连线找节点的所有前置节点
+func (l *procDefLinter) getAncestors(nodeId string) map[string]bool {
+	if ancestors, ok := l.ancestorMap[nodeId]; ok {
+		return ancestors
+	}
+	ancestors := make(map[string]bool)
+	queue := []string{nodeId}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, link := range l.linkList {
+			if link.Target == current && !ancestors[link.Source] {
+				ancestors[link.Source] = true
+				queue = append(queue, link.Source)
+			}
+		}
+	}
+	l.ancestorMap[nodeId] = ancestors
+	return ancestors
+}
+
+func (l *procDefLinter) lintNode(node *models.ProcDefNode) (err error) {
+	var inCount, outCount int
+	for _, link := range l.linkList {
+		if link.Source == node.Id {
+			outCount++
+		} else if link.Target == node.Id {
+			inCount++
+		}
+	}
+	if validateErr := ValidateProcDefNode(l.ctx, l.procDef, node, inCount, outCount); validateErr != nil {
+		l.addError(models.LintRuleNodeDefine, node, "", validateErr)
+	}
+	var pluginInterface *models.PluginConfigInterfaces
+	if (node.NodeType == models.JobAutoType || node.NodeType == models.JobHumanType) && strings.TrimSpace(node.ServiceName) != "" {
+		if pluginInterface, err = l.lintService(node, node.ServiceName); err != nil {
+			return
+		}
+	}
+	nodeParams, getParamErr := database.GetProcDefNodeParamByNodeId(l.ctx, node.Id)
+	if getParamErr != nil {
+		return getParamErr
+	}
+	if err = l.lintContextParams(node, nodeParams, pluginInterface); err != nil {
+		return
+	}
+	if pluginInterface != nil {
+		l.lintRequiredParams(node, nodeParams, pluginInterface)
+	}
+	return l.lintRoutineExpression(node)
+}
+
+// lintService 检查插件服务是否存在并启用,可用时返回服务的出入参定义
+func (l *procDefLinter) lintService(node *models.ProcDefNode, serviceName string) (pluginInterface *models.PluginConfigInterfaces, err error) {
+	if pluginInterface, err = l.getServiceInterface(serviceName); err != nil || pluginInterface != nil {
+		return
+	}
+	statusList, queryErr := database.GetPluginServiceStatus(l.ctx, serviceName)
+	if queryErr != nil {
+		err = queryErr
+		return
+	}
+	if len(statusList) == 0 {
+		l.add(models.LintLevelError, models.LintRuleServiceUnavailable, node, "", fmt.Sprintf("plugin service %s not found", serviceName), nil)
+	} else {
+		l.add(models.LintLevelError, models.LintRuleServiceUnavailable, node, "", fmt.Sprintf("plugin service %s is disabled", serviceName), nil)
+	}
+	return
+}
+
+// getServiceInterface 查启用的插件服务出入参定义,服务不可用时缓存nil
+func (l *procDefLinter) getServiceInterface(serviceName string) (pluginInterface *models.PluginConfigInterfaces, err error) {
+	if cacheInterface, ok := l.interfaceMap[serviceName]; ok {
+		return cacheInterface, nil
+	}
+	statusList, queryErr := database.GetPluginServiceStatus(l.ctx, serviceName)
+	if queryErr != nil {
+		err = queryErr
+		return
+	}
+	enabled := false
+	for _, status := range statusList {
+		if status == "ENABLED" {
+			enabled = true
+		}
+	}
+	if enabled {
+		if pluginInterface, err = database.GetLastEnablePluginInterface(l.ctx, serviceName); err != nil {
+			return
+		}
+	}
+	l.interfaceMap[serviceName] = pluginInterface
+	return
+}
+
+// lintContextParams 上下文参数必须绑定当前节点的前置节点,绑定的参数类型要和入参一致
+func (l *procDefLinter) lintContextParams(node *models.ProcDefNode, nodeParams []*models.ProcDefNodeParam, pluginInterface *models.PluginConfigInterfaces) (err error) {
+	ancestors := l.getAncestors(node.Id)
+	for _, param := range nodeParams {
+		if param.BindType != models.PluginParamMapTypeContext || param.CtxBindNode == "" {
+			continue
+		}
+		bindNode, ok := l.nodeIdMap[param.CtxBindNode]
+		if !ok {
+			l.add(models.LintLevelError, models.LintRuleContextNotAncestor, node, param.Name, fmt.Sprintf("param %s bind node %s not found", param.Name, param.CtxBindNode), nil)
+			continue
+		}
+		if !ancestors[bindNode.Id] {
+			l.add(models.LintLevelError, models.LintRuleContextNotAncestor, node, param.Name, fmt.Sprintf("param %s bind node %s is not ancestor of node %s", param.Name, bindNode.Name, node.Name), nil)
+			continue
+		}
+		if pluginInterface == nil || strings.TrimSpace(bindNode.ServiceName) == "" || (bindNode.NodeType != models.JobAutoType && bindNode.NodeType != models.JobHumanType) {
+			continue
+		}
+		inputParam := findInterfaceParam(pluginInterface.InputParameters, param.Name)
+		if inputParam == nil {
+			continue
+		}
+		bindInterface, getErr := l.getServiceInterface(bindNode.ServiceName)
+		if getErr != nil {
+			return getErr
+		}
+		if bindInterface == nil {
+			continue
+		}
+		bindParams := bindInterface.OutputParameters
+		if param.CtxBindType == "input" {
+			bindParams = bindInterface.InputParameters
+		}
+		bindParam := findInterfaceParam(bindParams, param.CtxBindName)
+		if bindParam == nil {
+			l.add(models.LintLevelError, models.LintRuleContextNotAncestor, node, param.Name, fmt.Sprintf("param %s bind %s param %s not found in node %s", param.Name, param.CtxBindType, param.CtxBindName, bindNode.Name), nil)
+			continue
+		}
+		if bindParam.DataType != inputParam.DataType || (bindParam.Multiple == "Y") != (inputParam.Multiple == "Y") {
+			l.add(models.LintLevelWarning, models.LintRuleParamTypeMismatch, node, param.Name, fmt.Sprintf("param %s(%s,multiple:%s) bind node %s %s param %s(%s,multiple:%s)", param.Name, inputParam.DataType, inputParam.Multiple, bindNode.Name, param.CtxBindType, param.CtxBindName, bindParam.DataType, bindParam.Multiple), nil)
+		}
+	}
+	return
+}
+
+// lintRequiredParams 插件必填的常量和上下文入参需要在节点上绑定值
+func (l *procDefLinter) lintRequiredParams(node *models.ProcDefNode, nodeParams []*models.ProcDefNodeParam, pluginInterface *models.PluginConfigInterfaces) {
+	nodeParamMap := make(map[string]*models.ProcDefNodeParam)
+	for _, param := range nodeParams {
+		nodeParamMap[param.Name] = param
+	}
+	for _, inputParam := range pluginInterface.InputParameters {
+		if inputParam.Required != "Y" {
+			continue
+		}
+		bound := true
+		switch inputParam.MappingType {
+		case models.PluginParamMapTypeConstant:
+			bound = inputParam.MappingVal != "" || nodeParamBound(nodeParamMap[inputParam.Name])
+		case models.PluginParamMapTypeContext:
+			bound = nodeParamBound(nodeParamMap[inputParam.Name])
+		case models.PluginParamMapTypeSystemVar:
+			bound = inputParam.MappingSystemVariableName != ""
+		case models.PluginParamMapTypeEntity:
+			bound = inputParam.MappingEntityExpression != ""
+		}
+		if !bound {
+			l.add(models.LintLevelError, models.LintRuleRequiredParamUnbound, node, inputParam.Name, fmt.Sprintf("required param %s(%s) of service %s is not bound", inputParam.Name, inputParam.MappingType, pluginInterface.ServiceName), nil)
+		}
+	}
+}
+
+func nodeParamBound(param *models.ProcDefNodeParam) bool {
+	if param == nil {
+		return false
+	}
+	switch param.BindType {
+	case models.PluginParamMapTypeContext:
+		return param.CtxBindNode != "" && param.CtxBindName != ""
+	case models.PluginParamMapTypeConstant, models.ProcDefNodeParamBindVariable:
+		return param.Value != ""
+	}
+	return false
+}
+
+func findInterfaceParam(params []*models.PluginConfigInterfaceParameters, name string) *models.PluginConfigInterfaceParameters {
+	for _, param := range params {
+		if param.Name == name {
+			return param
+		}
+	}
+	return nil
+}
+
+// lintRoutineExpression 定位规则里的实体和属性都要在数据模型里存在
+func (l *procDefLinter) lintRoutineExpression(node *models.ProcDefNode) (err error) {
+	var expressions []string
+	switch node.NodeType {
+	case models.JobAutoType, models.JobHumanType, models.JobSubProcType:
+		if strings.TrimSpace(node.RoutineExpression) != "" {
+			expressions = append(expressions, node.RoutineExpression)
+		}
+	case models.JobDataType:
+		// 表达式格式错误已经在发布检查里报了
+		exprObjList, _ := database.GetProcDataNodeExpression(node.RoutineExpression)
+		for _, exprObj := range exprObjList {
+			expressions = append(expressions, exprObj.Expression)
+		}
+	}
+	for _, expression := range expressions {
+		message, checkErr := l.checkExpression(expression)
+		if checkErr != nil {
+			return checkErr
+		}
+		if message != "" {
+			l.add(models.LintLevelError, models.LintRuleRoutineExpression, node, "", fmt.Sprintf("expression %s illegal,%s", expression, message), nil)
+		}
+	}
+	return
+}
+
+// checkExpression 返回表达式不合法的原因,合法时返回空
+func (l *procDefLinter) checkExpression(expression string) (message string, err error) {
+	exprList, analyzeErr := analyzeLintExpression(expression)
+	if analyzeErr != nil {
+		message = analyzeErr.Error()
+		return
+	}
+	var lastEntity *models.DataModelEntity
+	for i, exprObj := range exprList {
+		entity, getErr := l.getEntity(exprObj.Package, exprObj.Entity)
+		if getErr != nil {
+			err = getErr
+			return
+		}
+		if entity == nil {
+			message = fmt.Sprintf("entity %s:%s not found", exprObj.Package, exprObj.Entity)
+			return
+		}
+		if exprObj.LeftJoinColumn != "" && i > 0 && !entityHasAttribute(lastEntity, exprObj.LeftJoinColumn) {
+			message = fmt.Sprintf("attribute %s not found in entity %s:%s", exprObj.LeftJoinColumn, lastEntity.PackageName, lastEntity.Name)
+			return
+		}
+		for _, attrName := range []string{exprObj.RightJoinColumn, exprObj.ResultColumn} {
+			if attrName != "" && !entityHasAttribute(entity, attrName) {
+				message = fmt.Sprintf("attribute %s not found in entity %s:%s", attrName, exprObj.Package, exprObj.Entity)
+				return
+			}
+		}
+		for _, filter := range exprObj.Filters {
+			if !entityHasAttribute(entity, filter.Name) {
+				message = fmt.Sprintf("filter attribute %s not found in entity %s:%s", filter.Name, exprObj.Package, exprObj.Entity)
+				return
+			}
+		}
+		lastEntity = entity
+	}
+	return
+}
+
+// analyzeLintExpression 解析表达式,格式错误时解析可能会panic,转成错误返回
+func analyzeLintExpression(expression string) (result []*models.ExpressionObj, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("expression format illegal")
+		}
+	}()
+	return remote.AnalyzeExpression(expression)
+}
+
+func (l *procDefLinter) getEntity(packageName, entityName string) (entity *models.DataModelEntity, err error) {
+	key := packageName + ":" + entityName
+	if cacheEntity, ok := l.entityMap[key]; ok {
+		return cacheEntity, nil
+	}
+	if entity, err = database.GetEntityModel(l.ctx, packageName, entityName, true); err != nil {
+		if customErr, ok := err.(exterror.CustomError); ok && customErr.Code == exterror.New().DatabaseQueryEmptyError.Code {
+			entity, err = nil, nil
+		} else {
+			return
+		}
+	}
+	l.entityMap[key] = entity
+	return
+}
+
+func entityHasAttribute(entity *models.DataModelEntity, attrName string) bool {
+	if lintBuiltinAttributes[attrName] {
+		return true
+	}
+	for _, attr := range entity.Attributes {
+		if attr.Name == attrName {
+			return true
+		}
+	}
+	return false
+}
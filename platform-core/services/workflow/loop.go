@@ -0,0 +1,428 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/exterror"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/log"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/tools"
+	"github.com/WeBankPartners/wecube-platform/platform-core/models"
+	"github.com/WeBankPartners/wecube-platform/platform-core/services/database"
+	"github.com/WeBankPartners/wecube-platform/platform-core/services/execution"
+	"strings"
+	"sync"
+)
+
+// 循环结束条件表达式中变量的命名空间,loop -> 当前迭代信息(iteration,status,procInsId)
+var loopVariableNamespaces = []string{"context", "nodes", "root", "vars", "loop"}
+
+type loopExecutor struct {
+	noopExecutor
+}
+
+// loopBody 循环当前编排中的一段子图
+type loopBody struct {
+	loopNodeId string          // 循环节点的编排定义节点id
+	endNodeId  string          // 子图最后一个节点的编排定义节点id
+	nodes      map[string]bool // 子图中的编排定义节点id
+}
+
+func (e *loopExecutor) JobType() string {
+	return models.JobLoopType
+}
+
+func (e *loopExecutor) Start(n *WorkNode, recoverFlag bool) (output string, err error) {
+	return n.doLoopJob(recoverFlag)
+}
+
+func (e *loopExecutor) Validate(ctx context.Context, procDef *models.ProcDef, node *models.ProcDefNode, inCount, outCount int) error {
+	if err := singleLinkValidate(node, inCount, outCount); err != nil {
+		return err
+	}
+	if procDef.SubProc {
+		return exterror.New().ProcDefSubProcCheckError
+	}
+	if err := validateLoopPolicy(node); err != nil {
+		return err
+	}
+	// 没有配置子编排时循环当前编排中的子图
+	if node.SubProcDefId == "" {
+		if _, err := getProcDefLoopBody(ctx, node); err != nil {
+			return exterror.New().ProcDefNodeLoopPolicyError.WithParam(node.Name, err.Error())
+		}
+	}
+	return nil
+}
+
+// getProcDefLoopBody 按循环策略中的bodyEndNode取循环节点之后的子图
+func getProcDefLoopBody(ctx context.Context, procDefNode *models.ProcDefNode) (body *loopBody, err error) {
+	policy := models.ParseProcNodeLoopPolicy(procDefNode.LoopPolicy)
+	if policy == nil || policy.BodyEndNode == "" {
+		err = fmt.Errorf("loop body need sub process or bodyEndNode")
+		return
+	}
+	procDefNodes, queryErr := database.GetProcDefNodeById(ctx, procDefNode.ProcDefId)
+	if queryErr != nil {
+		err = queryErr
+		return
+	}
+	body = &loopBody{loopNodeId: procDefNode.Id}
+	for _, node := range procDefNodes {
+		if node.NodeId == policy.BodyEndNode {
+			body.endNodeId = node.Id
+			break
+		}
+	}
+	if body.endNodeId == "" {
+		err = fmt.Errorf("bodyEndNode %s not found", policy.BodyEndNode)
+		return
+	}
+	links, queryErr := database.GetProcDefNodeLinkListByProcDefId(ctx, procDefNode.ProcDefId)
+	if queryErr != nil {
+		err = queryErr
+		return
+	}
+	body.nodes, err = models.GetProcDefLoopBody(links, body.loopNodeId, body.endNodeId)
+	return
+}
+
+// getNodeLoopPolicy 取节点的循环策略并补上默认值
+func getNodeLoopPolicy(procDefNode *models.ProcDefNode) *models.ProcNodeLoopPolicy {
+	policy := models.ParseProcNodeLoopPolicy(procDefNode.LoopPolicy)
+	if policy == nil {
+		policy = &models.ProcNodeLoopPolicy{}
+	}
+	if policy.Mode == "" {
+		policy.Mode = models.LoopModeForEach
+	}
+	if policy.MaxParallel <= 0 {
+		policy.MaxParallel = 1
+	}
+	if policy.FailurePolicy == "" {
+		policy.FailurePolicy = models.LoopFailFast
+	}
+	return policy
+}
+
+// doLoopJob 循环节点,每次迭代以子编排执行,没有配置子编排时每次迭代以当前编排中的子图新建子实例执行
+// 循环子图时父实例跳过子图中的节点,循环结束后从子图最后一个节点的出线继续
+// 已启动的迭代都记录在proc_run_node_sub_proc,恢复时等待运行中的子编排结束后从没跑过的迭代继续
+func (n *WorkNode) doLoopJob(recoverFlag bool) (output string, err error) {
+	log.WorkflowLogger.Info("do loop job", log.String("nodeId", n.Id), log.Bool("recover", recoverFlag))
+	ctx := context.WithValue(n.Ctx, models.TransactionIdHeader, n.Id)
+	procInsNode, procDefNode, dataBindings, getNodeDataErr := getSubProcBindData(ctx, n.Id, !recoverFlag)
+	if getNodeDataErr != nil {
+		err = getNodeDataErr
+		return
+	}
+	policy := getNodeLoopPolicy(procDefNode)
+	var body *loopBody
+	if procDefNode.SubProcDefId == "" {
+		if body, err = n.initLoopBody(ctx, procInsNode, procDefNode); err != nil {
+			return
+		}
+	}
+	var doneRows []*models.ProcSubProcQueryRow
+	if recoverFlag {
+		waitSubProcRunning(ctx, n.Id)
+		if doneRows, err = database.GetSubProcResult(ctx, n.Id); err != nil {
+			err = fmt.Errorf("query loop sub process result fail,%s ", err.Error())
+			return
+		}
+	} else {
+		// 重新执行时清掉上一次的迭代纪录
+		if err = database.UpdateProcRunNodeSubProc(ctx, n.Id, nil, nil); err != nil {
+			err = fmt.Errorf("clean loop sub process record fail,%s ", err.Error())
+			return
+		}
+	}
+	operator := procInsNode.CreatedBy
+	if procInsNode.UpdatedBy != "" {
+		operator = procInsNode.UpdatedBy
+	}
+	if policy.Mode == models.LoopModeUntil {
+		err = n.doLoopUntil(ctx, procInsNode, procDefNode, body, policy, dataBindings, doneRows, operator)
+	} else {
+		err = n.doLoopForEach(ctx, procInsNode, procDefNode, body, policy, dataBindings, doneRows, operator)
+	}
+	return
+}
+
+// initLoopBody 取循环的子图,并记下父实例中子图最后一个节点,循环结束后从它的出线继续
+func (n *WorkNode) initLoopBody(ctx context.Context, procInsNode *models.ProcInsNode, procDefNode *models.ProcDefNode) (body *loopBody, err error) {
+	if body, err = getProcDefLoopBody(ctx, procDefNode); err != nil {
+		err = fmt.Errorf("get loop body fail,%s ", err.Error())
+		return
+	}
+	endInsNodeId, queryErr := database.GetProcInsNodeIdByDefNode(ctx, procInsNode.ProcInsId, body.endNodeId)
+	if queryErr != nil {
+		err = queryErr
+		return
+	}
+	for _, node := range n.workflow.Nodes {
+		if node.ProcInsNodeId == endInsNodeId {
+			n.loopBodyEnd = node.Id
+			break
+		}
+	}
+	if n.loopBodyEnd == "" {
+		err = fmt.Errorf("can not find loop body end node %s in workflow ", endInsNodeId)
+	}
+	return
+}
+
+// doLoopForEach 按绑定数据逐条执行子编排,最多同时运行maxParallel个
+func (n *WorkNode) doLoopForEach(ctx context.Context, procInsNode *models.ProcInsNode, procDefNode *models.ProcDefNode, body *loopBody, policy *models.ProcNodeLoopPolicy, dataBindings []*models.ProcDataBinding, doneRows []*models.ProcSubProcQueryRow, operator string) (err error) {
+	total := len(dataBindings)
+	if total == 0 {
+		log.WorkflowLogger.Warn("loop job return with empty binding data", log.String("procIns", procInsNode.ProcInsId), log.String("procInsNode", procInsNode.Id))
+		return
+	}
+	if policy.MaxIterations > 0 && total > policy.MaxIterations {
+		err = fmt.Errorf("loop data num %d is more than max iterations %d ", total, policy.MaxIterations)
+		return
+	}
+	failCount := 0
+	startedDataMap := make(map[string]int)
+	for _, row := range doneRows {
+		startedDataMap[row.EntityDataId] = startedDataMap[row.EntityDataId] + 1
+		if row.Status != models.JobStatusSuccess {
+			failCount = failCount + 1
+		}
+	}
+	stopFlag := !policy.AllowFailure(failCount, total)
+	lock := new(sync.Mutex)
+	limitChan := make(chan int, policy.MaxParallel)
+	wg := sync.WaitGroup{}
+	for i, dataRow := range dataBindings {
+		if startedDataMap[dataRow.EntityDataId] > 0 {
+			// 恢复时已经启动过的迭代
+			startedDataMap[dataRow.EntityDataId] = startedDataMap[dataRow.EntityDataId] - 1
+			continue
+		}
+		select {
+		case limitChan <- 1:
+		case <-n.Ctx.Done():
+			lock.Lock()
+			stopFlag = true
+			lock.Unlock()
+		}
+		lock.Lock()
+		tmpStopFlag := stopFlag
+		lock.Unlock()
+		if tmpStopFlag {
+			break
+		}
+		workObj, subWorkNodes, createErr := n.createLoopIteration(ctx, procInsNode, procDefNode, body, dataRow, operator, i)
+		if createErr != nil {
+			err = createErr
+			<-limitChan
+			break
+		}
+		wg.Add(1)
+		go func(wo *Workflow, nl []*models.ProcRunNode) {
+			wo.Init(context.Background(), nl, wo.Links)
+			wo.Start(&models.ProcOperation{CreatedBy: operator})
+			lock.Lock()
+			if wo.Status != models.JobStatusSuccess {
+				failCount = failCount + 1
+				if !policy.AllowFailure(failCount, total) {
+					stopFlag = true
+				}
+			}
+			lock.Unlock()
+			log.WorkflowLogger.Debug("loop sub proc done", log.String("subWorkflowId", wo.Id), log.String("status", wo.Status))
+			<-limitChan
+			wg.Done()
+		}(workObj, subWorkNodes)
+	}
+	wg.Wait()
+	log.WorkflowLogger.Info("loop sub proc wait done", log.String("nodeId", n.Id))
+	if err != nil {
+		return
+	}
+	return n.checkLoopResult(ctx, policy, total)
+}
+
+// doLoopUntil 用第一条绑定数据重复执行子编排,每次执行完计算结束条件,满足时结束
+func (n *WorkNode) doLoopUntil(ctx context.Context, procInsNode *models.ProcInsNode, procDefNode *models.ProcDefNode, body *loopBody, policy *models.ProcNodeLoopPolicy, dataBindings []*models.ProcDataBinding, doneRows []*models.ProcSubProcQueryRow, operator string) (err error) {
+	if len(dataBindings) == 0 {
+		err = fmt.Errorf("until loop need at least one bind data ")
+		return
+	}
+	untilExpr, parseErr := tools.ParseBoolExpression(policy.Until)
+	if parseErr != nil {
+		err = fmt.Errorf("loop until expression %s illegal,%s ", policy.Until, parseErr.Error())
+		return
+	}
+	dataRow := dataBindings[0]
+	iteration, failCount := 0, 0
+	var lastStatus, lastProcInsId string
+	for _, row := range doneRows {
+		iteration = iteration + 1
+		lastStatus, lastProcInsId = row.Status, row.ProcInsId
+		if row.Status != models.JobStatusSuccess {
+			failCount = failCount + 1
+		}
+	}
+	for {
+		if iteration > 0 {
+			if !policy.AllowFailure(failCount, iteration) {
+				err = fmt.Errorf("loop iteration %d sub process %s status %s ", iteration, lastProcInsId, lastStatus)
+				return
+			}
+			contextMap, buildErr := execution.BuildDecisionContextMap(ctx, procInsNode.ProcInsId)
+			if buildErr != nil {
+				err = fmt.Errorf("build loop context fail,%s ", buildErr.Error())
+				return
+			}
+			contextMap["loop"] = map[string]interface{}{"iteration": iteration, "status": lastStatus, "procInsId": lastProcInsId}
+			matched, evalErr := untilExpr.Eval(contextMap)
+			if evalErr != nil {
+				err = fmt.Errorf("loop until expression %s eval fail,%s ", policy.Until, evalErr.Error())
+				return
+			}
+			log.WorkflowLogger.Info("loop until eval", log.String("nodeId", n.Id), log.Int("iteration", iteration), log.Bool("matched", matched))
+			if matched {
+				return
+			}
+		}
+		if policy.MaxIterations > 0 && iteration >= policy.MaxIterations {
+			err = fmt.Errorf("loop reach max iterations %d and until condition still not match ", policy.MaxIterations)
+			return
+		}
+		if n.Ctx.Err() != nil {
+			err = fmt.Errorf("loop cancel,%s ", n.Ctx.Err().Error())
+			return
+		}
+		dataRow.SubSessionId = ""
+		workObj, subWorkNodes, createErr := n.createLoopIteration(ctx, procInsNode, procDefNode, body, dataRow, operator, iteration)
+		if createErr != nil {
+			err = createErr
+			return
+		}
+		workObj.Init(context.Background(), subWorkNodes, workObj.Links)
+		workObj.Start(&models.ProcOperation{CreatedBy: operator})
+		iteration = iteration + 1
+		lastStatus, lastProcInsId = workObj.Status, workObj.ProcInsId
+		if workObj.Status != models.JobStatusSuccess {
+			failCount = failCount + 1
+		}
+	}
+}
+
+// createLoopIteration 试算并创建一次迭代的子编排,同时追加迭代纪录
+func (n *WorkNode) createLoopIteration(ctx context.Context, procInsNode *models.ProcInsNode, procDefNode *models.ProcDefNode, body *loopBody, dataRow *models.ProcDataBinding, operator string, index int) (workObj *Workflow, subWorkNodes []*models.ProcRunNode, err error) {
+	createInsParam := models.ProcInsStartParam{
+		EntityDataId:      dataRow.EntityDataId,
+		EntityDisplayName: dataRow.EntityDataName,
+		EntityTypeId:      dataRow.EntityTypeId,
+		ProcDefId:         procDefNode.SubProcDefId,
+		ParentInsNodeId:   procInsNode.Id,
+		ParentRunNodeId:   n.Id,
+	}
+	if body != nil {
+		createInsParam.ProcDefId = procDefNode.ProcDefId
+		workObj, subWorkNodes, err = n.createLoopBodyWorkflow(&createInsParam, procInsNode.ProcInsId, body, operator, index)
+	} else {
+		if dataRow.SubSessionId == "" {
+			subPreviewResult, subPreviewErr := execution.BuildProcPreviewData(ctx, procDefNode.SubProcDefId, dataRow.EntityDataId, operator)
+			if subPreviewErr != nil {
+				err = fmt.Errorf("try to build sub proc preview data fail,%s ", subPreviewErr.Error())
+				return
+			}
+			dataRow.SubSessionId = subPreviewResult.ProcessSessionId
+		}
+		createInsParam.ProcessSessionId = dataRow.SubSessionId
+		workObj, subWorkNodes, err = n.createSubWorkflow(&createInsParam, operator, index)
+	}
+	if err != nil {
+		return
+	}
+	dataRow.SubProcInsId = workObj.ProcInsId
+	subProcRow := models.ProcRunNodeSubProc{WorkflowId: workObj.Id, EntityTypeId: dataRow.EntityTypeId, EntityDataId: dataRow.EntityDataId}
+	if err = database.AddProcRunNodeSubProc(ctx, n.Id, &subProcRow, dataRow); err != nil {
+		err = fmt.Errorf("AddProcRunNodeSubProc fail,%s ", err.Error())
+	}
+	return
+}
+
+// createLoopBodyWorkflow 新增循环子图一次迭代的子实例并初始化workflow
+func (n *WorkNode) createLoopBodyWorkflow(createInsParam *models.ProcInsStartParam, parentProcInsId string, body *loopBody, operator string, index int) (workObj *Workflow, subWorkNodes []*models.ProcRunNode, err error) {
+	subProcInsId, subWorkflowRow, subWorkNodes, subWorkLinks, createInsErr := database.CreateProcLoopBodyInstance(context.WithValue(n.Ctx, models.TransactionIdHeader, fmt.Sprintf("%s_%d", n.Id, index)), createInsParam, parentProcInsId, body.loopNodeId, body.endNodeId, body.nodes, operator)
+	if createInsErr != nil {
+		err = createInsErr
+		return
+	}
+	workObj = &Workflow{ProcRunWorkflow: *subWorkflowRow}
+	workObj.ProcInsId = subProcInsId
+	workObj.Links = subWorkLinks
+	return
+}
+
+// checkLoopResult 按失败策略汇总所有迭代的结果
+func (n *WorkNode) checkLoopResult(ctx context.Context, policy *models.ProcNodeLoopPolicy, total int) (err error) {
+	subProcResultList, queryErr := database.GetSubProcResult(ctx, n.Id)
+	if queryErr != nil {
+		err = fmt.Errorf("Query loop sub process running result fail,%s ", queryErr.Error())
+		return
+	}
+	failCount := 0
+	var errorMessage string
+	for _, subResult := range subProcResultList {
+		if subResult.Status != models.JobStatusSuccess {
+			failCount = failCount + 1
+			errorMessage += fmt.Sprintf("dataId:%s:%s procInsId:%s error:%s ;", subResult.EntityTypeId, subResult.EntityDataId, subResult.ProcInsId, subResult.ErrorMessage)
+		}
+	}
+	log.WorkflowLogger.Info("loop job result", log.String("nodeId", n.Id), log.Int("total", total), log.Int("started", len(subProcResultList)), log.Int("fail", failCount))
+	if skipCount := total - len(subProcResultList); skipCount > 0 {
+		errorMessage += fmt.Sprintf("skip %d data with failure policy %s ;", skipCount, policy.FailurePolicy)
+	}
+	if !policy.AllowFailure(failCount, total) || len(subProcResultList) < total {
+		err = errors.New(errorMessage)
+	}
+	return
+}
+
+// validateLoopPolicy 发布编排时检查循环节点策略
+func validateLoopPolicy(node *models.ProcDefNode) error {
+	if node.LoopPolicy == "" {
+		return nil
+	}
+	policy := models.ParseProcNodeLoopPolicy(node.LoopPolicy)
+	if policy == nil {
+		return exterror.New().ProcDefNodeLoopPolicyError.WithParam(node.Name, "json format illegal")
+	}
+	if policy.Mode != "" && policy.Mode != models.LoopModeForEach && policy.Mode != models.LoopModeUntil {
+		return exterror.New().ProcDefNodeLoopPolicyError.WithParam(node.Name, "mode "+policy.Mode+" not support")
+	}
+	if policy.MaxParallel < 0 || policy.MaxIterations < 0 {
+		return exterror.New().ProcDefNodeLoopPolicyError.WithParam(node.Name, "maxParallel and maxIterations can not be negative")
+	}
+	switch policy.FailurePolicy {
+	case "", models.LoopFailFast, models.LoopFailContinue:
+	case models.LoopFailThreshold:
+		if policy.FailureThreshold < 0 || policy.FailureThreshold > 100 {
+			return exterror.New().ProcDefNodeLoopPolicyError.WithParam(node.Name, "failureThreshold should between 0 and 100")
+		}
+	default:
+		return exterror.New().ProcDefNodeLoopPolicyError.WithParam(node.Name, "failurePolicy "+policy.FailurePolicy+" not support")
+	}
+	if policy.Mode == models.LoopModeUntil {
+		if policy.MaxIterations == 0 {
+			return exterror.New().ProcDefNodeLoopPolicyError.WithParam(node.Name, "until loop need maxIterations")
+		}
+		expr, err := tools.ParseBoolExpression(policy.Until)
+		if err != nil {
+			return exterror.New().ProcDefNodeLoopPolicyError.WithParam(node.Name, err.Error())
+		}
+		for _, variable := range expr.Variables() {
+			if !tools.StringListContains(loopVariableNamespaces, strings.Split(variable, ".")[0]) {
+				return exterror.New().ProcDefNodeLoopPolicyError.WithParam(node.Name, "unknown variable "+variable)
+			}
+		}
+	}
+	return nil
+}
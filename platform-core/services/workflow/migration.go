@@ -0,0 +1,47 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/log"
+	"github.com/WeBankPartners/wecube-platform/platform-core/models"
+	"github.com/WeBankPartners/wecube-platform/platform-core/services/database"
+	"time"
+)
+
+// Migrate 工作流退出内存后按迁移纪录改写节点和连线,再从数据库重新加载
+// 退出期间不置sleep,其它操作留在操作表里,等重新加载后由扫描任务处理,工作流没能退出时不改写节点,迁移置为失败
+func (w *Workflow) Migrate(migrationId string) {
+	ctx := context.WithValue(context.Background(), models.TransactionIdHeader, fmt.Sprintf("migrate_%s", migrationId))
+	w.ProcRunWorkflow.Sleep = true
+	w.sleepChan <- 1
+	if !w.waitUnload(5 * time.Second) {
+		// 工作流还在内存中运行,不能改写它的节点,迁移置为失败
+		database.FailProcInsMigration(ctx, migrationId, "workflow is still running in memory,can not migrate")
+		select {
+		case <-w.sleepChan:
+			// 退出信号还没被处理,收回后工作流继续运行
+			w.ProcRunWorkflow.Sleep = false
+			log.WorkflowLogger.Error("migrate workflow abort,workflow not unload", log.String("workflowId", w.Id), log.String("migrationId", migrationId))
+			return
+		default:
+		}
+		// 退出信号已被处理,等退出后按原节点重新加载
+		if !w.waitUnload(30 * time.Second) {
+			log.WorkflowLogger.Error("migrate workflow abort,wait workflow unload timeout", log.String("workflowId", w.Id), log.String("migrationId", migrationId))
+			return
+		}
+		if err := recoverWorkflow(w.Id); err != nil {
+			log.WorkflowLogger.Error("recover workflow after migrate abort fail", log.String("workflowId", w.Id), log.Error(err))
+		}
+		return
+	}
+	if err := database.ExecProcInsMigration(ctx, migrationId); err != nil {
+		log.WorkflowLogger.Error("migrate workflow fail", log.String("workflowId", w.Id), log.String("migrationId", migrationId), log.Error(err))
+	} else {
+		log.WorkflowLogger.Info("migrate workflow done", log.String("workflowId", w.Id), log.String("migrationId", migrationId))
+	}
+	if err := recoverWorkflow(w.Id); err != nil {
+		log.WorkflowLogger.Error("recover workflow after migrate fail", log.String("workflowId", w.Id), log.Error(err))
+	}
+}
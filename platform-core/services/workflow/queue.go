@@ -0,0 +1,222 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/db"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/log"
+	"github.com/WeBankPartners/wecube-platform/platform-core/models"
+	"github.com/WeBankPartners/wecube-platform/platform-core/services/database"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// 每5s按编排并发上限把排队中的实例出队启动,多个实例同时扫描时通过抢占排队纪录保证只启动一次
+func startProcInsQueueJob() {
+	t := time.NewTicker(5 * time.Second).C
+	for {
+		<-t
+		doProcInsQueueJob()
+	}
+}
+
+func doProcInsQueueJob() {
+	if IsDraining() {
+		return
+	}
+	ctx := context.WithValue(context.Background(), models.TransactionIdHeader, fmt.Sprintf("proc_queue_%d", time.Now().Unix()))
+	var queueRows []*models.ProcInsQueue
+	err := db.WorkflowMysqlEngine.Context(ctx).SQL("select * from proc_ins_queue where status=? order by id", models.ProcInsQueueStatusQueued).Find(&queueRows)
+	if err != nil {
+		log.WorkflowLogger.Error("query proc ins queue table fail", log.Error(err))
+		return
+	}
+	if len(queueRows) == 0 {
+		return
+	}
+	var keyList []string
+	keyQueueMap := make(map[string][]*models.ProcInsQueue)
+	for _, row := range queueRows {
+		if _, ok := keyQueueMap[row.ProcDefKey]; !ok {
+			keyList = append(keyList, row.ProcDefKey)
+		}
+		keyQueueMap[row.ProcDefKey] = append(keyQueueMap[row.ProcDefKey], row)
+	}
+	for _, procDefKey := range keyList {
+		if !IsClusterOwner(procDefKey) {
+			continue
+		}
+		if err = dequeueProcDefKey(ctx, procDefKey, keyQueueMap[procDefKey]); err != nil {
+			log.WorkflowLogger.Error("dequeue proc ins fail", log.String("procDefKey", procDefKey), log.Error(err))
+		}
+	}
+}
+
+// dequeueProcDefKey 按最新发布版本的并发配置出队,超过编排上限时后面的都继续排队,超过根数据上限时只跳过该数据
+func dequeueProcDefKey(ctx context.Context, procDefKey string, queueRows []*models.ProcInsQueue) (err error) {
+	policy, getPolicyErr := getProcDefKeyConcurrencyPolicy(ctx, procDefKey)
+	if getPolicyErr != nil {
+		return getPolicyErr
+	}
+	if policy != nil && policy.QueueMode == models.ProcQueueModePriority {
+		sort.SliceStable(queueRows, func(i, j int) bool {
+			return queueRows[i].Priority > queueRows[j].Priority
+		})
+	}
+	// 和新建实例的并发判断共用编排key锁,出队期间新建的实例不会同时判断为未达上限
+	unlock, lockErr := database.LockProcInsQueue(ctx, procDefKey)
+	if lockErr != nil {
+		return lockErr
+	}
+	defer unlock()
+	keyRunning, entityRunningMap, countErr := countProcDefKeyRunning(ctx, procDefKey)
+	if countErr != nil {
+		return countErr
+	}
+	for _, row := range queueRows {
+		if policy.Enabled() {
+			if policy.MaxRunning > 0 && keyRunning >= policy.MaxRunning {
+				break
+			}
+			if policy.MaxRunningPerEntity > 0 && row.EntityDataId != "" && entityRunningMap[row.EntityDataId] >= policy.MaxRunningPerEntity {
+				continue
+			}
+		}
+		startFlag, startErr := startQueuedProcIns(ctx, row)
+		if startErr != nil {
+			log.WorkflowLogger.Error("start queued proc ins fail", log.String("procInsId", row.ProcInsId), log.Error(startErr))
+			continue
+		}
+		if startFlag {
+			keyRunning++
+			entityRunningMap[row.EntityDataId]++
+		}
+	}
+	return
+}
+
+// getProcDefKeyConcurrencyPolicy 取编排最新发布版本的并发配置,配置去掉后排队的实例全部出队
+func getProcDefKeyConcurrencyPolicy(ctx context.Context, procDefKey string) (policy *models.ProcDefConcurrencyPolicy, err error) {
+	var procDefRows []*models.ProcDef
+	err = db.WorkflowMysqlEngine.Context(ctx).SQL("select id,concurrency_policy from proc_def where `key`=? and status=? order by created_time desc limit 1", procDefKey, models.Deployed).Find(&procDefRows)
+	if err != nil {
+		err = fmt.Errorf("query proc def concurrency policy fail,%s ", err.Error())
+		return
+	}
+	if len(procDefRows) > 0 {
+		policy = models.ParseProcDefConcurrencyPolicy(procDefRows[0].ConcurrencyPolicy)
+	}
+	return
+}
+
+func countProcDefKeyRunning(ctx context.Context, procDefKey string) (keyRunning int, entityRunningMap map[string]int, err error) {
+	entityRunningMap = make(map[string]int)
+	queryRows, queryErr := db.WorkflowMysqlEngine.Context(ctx).QueryString("select entity_data_id,count(1) as num from proc_ins where proc_def_key=? and status in (?,?) and id not in (select proc_ins_id from proc_ins_simulation) group by entity_data_id",
+		procDefKey, models.JobStatusReady, models.JobStatusRunning)
+	if queryErr != nil {
+		err = fmt.Errorf("count running proc ins fail,%s ", queryErr.Error())
+		return
+	}
+	for _, row := range queryRows {
+		num, _ := strconv.Atoi(row["num"])
+		keyRunning += num
+		entityRunningMap[row["entity_data_id"]] += num
+	}
+	return
+}
+
+// startQueuedProcIns 抢占排队纪录后把实例和工作流状态恢复为未开始,再加载工作流启动
+func startQueuedProcIns(ctx context.Context, queueRow *models.ProcInsQueue) (startFlag bool, err error) {
+	// 编排开启冲突检测时出队前要先拿到数据锁
+	lockActions, conflictLock, policy, lockErr := database.TryAcquireQueuedProcInsLock(ctx, queueRow.ProcInsId, queueRow.CreatedBy)
+	if lockErr != nil {
+		err = lockErr
+		return
+	}
+	if conflictLock != nil {
+		err = handleQueuedProcInsLockConflict(ctx, queueRow, policy, conflictLock)
+		return
+	}
+	nowTime := time.Now()
+	execResult, execErr := db.WorkflowMysqlEngine.Context(ctx).Exec("update proc_ins_queue set status=?,updated_by=?,updated_time=? where id=? and status=?", models.ProcInsQueueStatusStarted, "SYSTEM", nowTime, queueRow.Id, models.ProcInsQueueStatusQueued)
+	if execErr != nil {
+		err = fmt.Errorf("takeover proc ins queue fail,%s ", execErr.Error())
+		return
+	}
+	if affectNum, _ := execResult.RowsAffected(); affectNum == 0 {
+		return
+	}
+	var actions []*db.ExecAction
+	actions = append(actions, &db.ExecAction{Sql: "update proc_ins set status=?,updated_time=? where id=? and status=?", Param: []interface{}{models.JobStatusReady, nowTime, queueRow.ProcInsId, models.JobStatusQueued}})
+	actions = append(actions, &db.ExecAction{Sql: "update proc_run_workflow set status=?,updated_time=? where id=? and status=?", Param: []interface{}{models.JobStatusReady, nowTime, queueRow.WorkflowId, models.JobStatusQueued}})
+	actions = append(actions, lockActions...)
+	if err = db.Transaction(actions, ctx); err != nil {
+		err = fmt.Errorf("update queued proc ins status fail,%s ", err.Error())
+		db.WorkflowMysqlEngine.Context(ctx).Exec("update proc_ins_queue set status=? where id=?", models.ProcInsQueueStatusQueued, queueRow.Id)
+		return
+	}
+	workflowRow, nodes, links, getDataErr := getWorkflowData(ctx, queueRow.WorkflowId)
+	if getDataErr != nil {
+		err = getDataErr
+		return
+	}
+	startFlag = true
+	log.WorkflowLogger.Info("start queued proc ins", log.String("procInsId", queueRow.ProcInsId), log.String("workflowId", queueRow.WorkflowId))
+	workObj := Workflow{ProcRunWorkflow: *workflowRow}
+	workObj.Init(context.Background(), nodes, links)
+	go workObj.Start(&models.ProcOperation{CreatedBy: queueRow.CreatedBy})
+	return
+}
+
+// handleQueuedProcInsLockConflict 数据锁被占用时,queue模式继续排队,wait模式超过等待时间后超时结束,reject模式直接失败
+func handleQueuedProcInsLockConflict(ctx context.Context, queueRow *models.ProcInsQueue, policy *models.ProcDefConcurrencyPolicy, conflictLock *models.ProcEntityLock) (err error) {
+	lockMode := policy.GetLockMode()
+	if lockMode == models.ProcLockModeQueue {
+		return
+	}
+	endStatus, message := models.JobStatusFail, fmt.Sprintf("data %s is locked by process instance %s", conflictLock.Key(), conflictLock.ProcInsId)
+	if lockMode == models.ProcLockModeWait {
+		if time.Since(queueRow.CreatedTime) < time.Duration(policy.LockWaitTimeout)*time.Second {
+			return
+		}
+		endStatus, message = models.JobStatusTimeout, fmt.Sprintf("wait %ds timeout,%s", policy.LockWaitTimeout, message)
+	}
+	nowTime := time.Now()
+	execResult, execErr := db.WorkflowMysqlEngine.Context(ctx).Exec("update proc_ins_queue set status=?,updated_by=?,updated_time=? where id=? and status=?", models.ProcInsQueueStatusCanceled, "SYSTEM", nowTime, queueRow.Id, models.ProcInsQueueStatusQueued)
+	if execErr != nil {
+		err = fmt.Errorf("takeover proc ins queue fail,%s ", execErr.Error())
+		return
+	}
+	if affectNum, _ := execResult.RowsAffected(); affectNum == 0 {
+		return
+	}
+	var actions []*db.ExecAction
+	actions = append(actions, &db.ExecAction{Sql: "update proc_ins set status=?,updated_by=?,updated_time=? where id=?", Param: []interface{}{endStatus, "SYSTEM", nowTime, queueRow.ProcInsId}})
+	actions = append(actions, &db.ExecAction{Sql: "update proc_run_workflow set status=?,error_message=?,updated_time=? where id=?", Param: []interface{}{endStatus, message, nowTime, queueRow.WorkflowId}})
+	if err = db.Transaction(actions, ctx); err != nil {
+		err = fmt.Errorf("update lock conflict proc ins status fail,%s ", err.Error())
+		return
+	}
+	database.AddProcInsTimeline(ctx, &models.ProcInsTimeline{ProcInsId: queueRow.ProcInsId, WorkflowId: queueRow.WorkflowId, EventType: models.TimelineEventLock, Status: endStatus, Message: message, RefId: fmt.Sprintf("%d", conflictLock.Id), CreatedBy: "SYSTEM", CreatedTime: nowTime})
+	log.WorkflowLogger.Info("queued proc ins end with entity lock conflict", log.String("procInsId", queueRow.ProcInsId), log.String("status", endStatus), log.String("message", message))
+	return
+}
+
+// 每分钟回收已结束实例仍持有的数据锁,实例状态更新时已释放,这里兜底异常退出等情况
+func startProcEntityLockJob() {
+	t := time.NewTicker(1 * time.Minute).C
+	for {
+		<-t
+		if IsDraining() {
+			continue
+		}
+		ctx := context.WithValue(context.Background(), models.TransactionIdHeader, fmt.Sprintf("proc_lock_%d", time.Now().Unix()))
+		releaseNum, err := database.ReleaseFinishedProcEntityLock(ctx)
+		if err != nil {
+			log.WorkflowLogger.Error("release finished proc entity lock fail", log.Error(err))
+		} else if releaseNum > 0 {
+			log.WorkflowLogger.Info("release finished proc entity lock", log.Int64("num", releaseNum))
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/db"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/exterror"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/log"
+	"github.com/WeBankPartners/wecube-platform/platform-core/models"
+	"github.com/WeBankPartners/wecube-platform/platform-core/services/database"
+	"strconv"
+	"time"
+)
+
+// doWithRetry 按节点定义的重试策略执行任务
+// 每次执行都会记录到proc_run_node_retry,失败后的下一次重试时间也会持久化,工作流被其它主机接管后按剩余时间继续等待和计数
+func (n *WorkNode) doWithRetry(recoverFlag bool, job func() (string, error)) (output string, err error) {
+	policy := getNodeRetryPolicy(n.Ctx, n.Id)
+	if policy == nil {
+		return job()
+	}
+	attempt := 1
+	var retryRowId int64
+	var waitDuration time.Duration
+	if recoverFlag {
+		if lastRow := getLastNodeRetryRow(n.Id); lastRow != nil {
+			if lastRow.EndTime.IsZero() {
+				// 上一次执行还没结束主机就挂了,重新执行这一次
+				attempt = lastRow.Attempt
+				retryRowId = lastRow.Id
+			} else if !lastRow.NextRetryTime.IsZero() {
+				attempt = lastRow.Attempt + 1
+				waitDuration = time.Until(lastRow.NextRetryTime)
+			}
+		}
+	}
+	for {
+		if waitDuration > 0 {
+			log.WorkflowLogger.Info("node wait for retry", log.String("nodeId", n.Id), log.Int("attempt", attempt), log.String("wait", waitDuration.String()))
+			select {
+			case <-time.After(waitDuration):
+			case <-n.Ctx.Done():
+				err = fmt.Errorf("node retry wait cancel,%s ", n.Ctx.Err().Error())
+				return
+			}
+		}
+		if n.Status == models.JobStatusTimeout {
+			err = errors.New(n.ErrorMessage)
+			return
+		}
+		if retryRowId == 0 {
+			retryRowId = insertNodeRetryRow(n, attempt)
+		}
+		output, err = job()
+		if err == nil || n.Status == models.JobStatusRisky {
+			finishNodeRetryRow(retryRowId, "", "", time.Time{})
+			return
+		}
+		errorCode := getNodeErrorCode(err)
+		if attempt >= policy.MaxAttempts || !policy.Retryable(errorCode) {
+			finishNodeRetryRow(retryRowId, errorCode, err.Error(), time.Time{})
+			log.WorkflowLogger.Warn("node retry give up", log.String("nodeId", n.Id), log.Int("attempt", attempt), log.String("errorCode", errorCode))
+			return
+		}
+		waitDuration = policy.Delay(attempt)
+		finishNodeRetryRow(retryRowId, errorCode, err.Error(), time.Now().Add(waitDuration))
+		log.WorkflowLogger.Warn("node job fail,prepare to retry", log.String("nodeId", n.Id), log.Int("attempt", attempt), log.String("errorCode", errorCode), log.Error(err))
+		attempt = attempt + 1
+		retryRowId = 0
+	}
+}
+
+// getNodeErrorCode 区分节点执行错误的类型,插件调用的错误会带上网络错误或插件错误的标识
+func getNodeErrorCode(err error) string {
+	var callErr *models.ProcNodeCallError
+	if errors.As(err, &callErr) {
+		return callErr.Code
+	}
+	return models.NodeErrorOther
+}
+
+func getNodeRetryPolicy(ctx context.Context, procRunNodeId string) *models.ProcNodeRetryPolicy {
+	procInsNode, err := database.GetSimpleProcInsNode(ctx, "", procRunNodeId)
+	if err != nil {
+		log.WorkflowLogger.Error("get node retry policy fail with query proc ins node", log.String("nodeId", procRunNodeId), log.Error(err))
+		return nil
+	}
+	procDefNode, err := database.GetSimpleProcDefNode(ctx, procInsNode.ProcDefNodeId)
+	if err != nil {
+		log.WorkflowLogger.Error("get node retry policy fail with query proc def node", log.String("nodeId", procRunNodeId), log.Error(err))
+		return nil
+	}
+	policy := models.ParseProcNodeRetryPolicy(procDefNode.RetryPolicy)
+	if policy == nil || policy.MaxAttempts <= 1 {
+		return nil
+	}
+	return policy
+}
+
+func getLastNodeRetryRow(procRunNodeId string) (result *models.ProcRunNodeRetry) {
+	var retryRows []*models.ProcRunNodeRetry
+	err := db.WorkflowMysqlEngine.SQL("select * from proc_run_node_retry where proc_run_node_id=? order by id desc limit 1", procRunNodeId).Find(&retryRows)
+	if err != nil {
+		log.WorkflowLogger.Error("query proc run node retry table fail", log.String("nodeId", procRunNodeId), log.Error(err))
+		return
+	}
+	if len(retryRows) > 0 {
+		result = retryRows[0]
+	}
+	return
+}
+
+func insertNodeRetryRow(n *WorkNode, attempt int) (id int64) {
+	execResult, err := db.WorkflowMysqlEngine.Exec("insert into proc_run_node_retry(workflow_id,proc_run_node_id,attempt,host,start_time) values (?,?,?,?,?)", n.WorkflowId, n.Id, attempt, instanceHost, time.Now())
+	if err != nil {
+		log.WorkflowLogger.Error("insert proc run node retry fail", log.String("nodeId", n.Id), log.Int("attempt", attempt), log.Error(err))
+		return
+	}
+	id, _ = execResult.LastInsertId()
+	database.AddProcInsTimeline(context.Background(), &models.ProcInsTimeline{WorkflowId: n.WorkflowId, ProcInsNodeId: n.ProcInsNodeId, ProcRunNodeId: n.Id, NodeName: n.Name, EventType: models.TimelineEventRetry, Message: fmt.Sprintf("attempt:%d", attempt), RefId: strconv.FormatInt(id, 10), Host: instanceHost, CreatedBy: "system"})
+	return
+}
+
+func finishNodeRetryRow(id int64, errorCode, errorMessage string, nextRetryTime time.Time) {
+	if id <= 0 {
+		return
+	}
+	var nextRetryTimeParam interface{}
+	if !nextRetryTime.IsZero() {
+		nextRetryTimeParam = nextRetryTime
+	}
+	_, err := db.WorkflowMysqlEngine.Exec("update proc_run_node_retry set error_code=?,error_message=?,end_time=?,next_retry_time=? where id=?", errorCode, errorMessage, time.Now(), nextRetryTimeParam, id)
+	if err != nil {
+		log.WorkflowLogger.Error("update proc run node retry fail", log.Int64("id", id), log.Error(err))
+	}
+}
+
+// validateRetryPolicy 发布编排时检查节点的重试策略配置
+func validateRetryPolicy(node *models.ProcDefNode) error {
+	if node.RetryPolicy == "" {
+		return nil
+	}
+	policy := models.ProcNodeRetryPolicy{}
+	if err := json.Unmarshal([]byte(node.RetryPolicy), &policy); err != nil {
+		return exterror.New().ProcDefNodeRetryPolicyError.WithParam(node.Name)
+	}
+	if policy.MaxAttempts < 1 || policy.Interval < 0 || policy.MaxInterval < 0 {
+		return exterror.New().ProcDefNodeRetryPolicyError.WithParam(node.Name)
+	}
+	if policy.Backoff != "" && policy.Backoff != models.RetryBackoffFixed && policy.Backoff != models.RetryBackoffExponential {
+		return exterror.New().ProcDefNodeRetryPolicyError.WithParam(node.Name)
+	}
+	for _, v := range policy.RetryOn {
+		if v != models.NodeErrorNetwork && v != models.NodeErrorPlugin && v != models.NodeErrorOther {
+			return exterror.New().ProcDefNodeRetryPolicyError.WithParam(node.Name)
+		}
+	}
+	return nil
+}
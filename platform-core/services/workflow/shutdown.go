@@ -0,0 +1,105 @@
+package workflow
+
+import (
+	"context"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/db"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/log"
+	"github.com/WeBankPartners/wecube-platform/platform-core/models"
+	"github.com/WeBankPartners/wecube-platform/platform-core/services/database"
+	"sync/atomic"
+	"time"
+)
+
+var draining int32
+
+// IsDraining 实例正在退出,不再受理新的启动、操作和接管
+func IsDraining() bool {
+	return atomic.LoadInt32(&draining) == 1
+}
+
+// Drain 优雅退出:停止受理新工作后等待正在调插件的节点在期限内完成,再让工作流退出内存并释放给其它实例立即接管
+func Drain(timeout time.Duration) {
+	atomic.StoreInt32(&draining, 1)
+	if err := reportClusterMember(); err != nil {
+		log.WorkflowLogger.Error("report cluster member leaving fail", log.Error(err))
+	}
+	log.WorkflowLogger.Info("<<--Start drain workflow-->>", log.String("host", instanceHost), log.String("timeout", timeout.String()))
+	deadline := time.Now().Add(timeout)
+	for {
+		busyNum := countBusyWorkNode()
+		if busyNum == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			log.WorkflowLogger.Warn("drain workflow timeout,running node will be recovered by other host", log.Int("busyNodeNum", busyNum))
+			break
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	// 先让工作流退出内存,退出时取消工作流上下文,还在执行的节点保持运行中由接管的实例恢复,避免两个实例同时执行
+	var workflowList []*Workflow
+	GlobalWorkflowMap.Range(func(key, value any) bool {
+		w := value.(*Workflow)
+		w.notifyUnload()
+		workflowList = append(workflowList, w)
+		return true
+	})
+	unloadDeadline := time.Now().Add(5 * time.Second)
+	releaseNum := 0
+	for _, w := range workflowList {
+		if !w.waitUnload(time.Until(unloadDeadline)) {
+			log.WorkflowLogger.Warn("drain workflow unload timeout,cancel it", log.String("workflowId", w.Id))
+			w.cancel()
+		}
+		if w.release() {
+			releaseNum++
+		}
+	}
+	log.WorkflowLogger.Info("<<--Done drain workflow-->>", log.String("host", instanceHost), log.Int("releaseNum", releaseNum))
+}
+
+// countBusyWorkNode 统计内存中正在运行的自动、数据、循环和补偿节点,人工、定时和等待信号节点可以直接交给其它实例
+func countBusyWorkNode() (num int) {
+	GlobalWorkflowMap.Range(func(key, value any) bool {
+		num += value.(*Workflow).busyNodeNum()
+		return true
+	})
+	return
+}
+
+func (w *Workflow) busyNodeNum() (num int) {
+	for _, n := range w.Nodes {
+		if n.Status != models.JobStatusRunning {
+			continue
+		}
+		if n.JobType == models.JobAutoType || n.JobType == models.JobDataType || n.JobType == models.JobLoopType || n.JobType == models.JobCompensateType {
+			num++
+		}
+	}
+	return
+}
+
+// notifyUnload 不再开始新节点,通知工作流退出内存,退出时会取消工作流上下文
+func (w *Workflow) notifyUnload() {
+	atomic.StoreInt32(&w.releaseFlag, 1)
+	w.ProcRunWorkflow.Sleep = true
+	select {
+	case w.sleepChan <- 1:
+	default:
+	}
+}
+
+// release 停止心跳并把工作流host置为released,其它实例下一次扫描时不用等存活超时就能接管
+func (w *Workflow) release() bool {
+	w.ProcRunWorkflow.Sleep = true
+	execResult, err := db.WorkflowMysqlEngine.Exec("update proc_run_workflow set host=? where id=? and host=? and status=?", models.WorkflowHostReleased, w.Id, instanceHost, models.JobStatusRunning)
+	if err != nil {
+		log.WorkflowLogger.Error("release workflow fail", log.String("workflowId", w.Id), log.Error(err))
+		return false
+	}
+	affectNum, _ := execResult.RowsAffected()
+	if affectNum > 0 {
+		database.AddProcInsTimeline(context.Background(), &models.ProcInsTimeline{ProcInsId: w.ProcInsId, WorkflowId: w.Id, EventType: models.TimelineEventRelease, Host: instanceHost, CreatedBy: "system"})
+	}
+	return affectNum > 0
+}
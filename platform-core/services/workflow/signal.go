@@ -0,0 +1,332 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/WeBankPartners/go-common-lib/guid"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/db"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/exterror"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/log"
+	"github.com/WeBankPartners/wecube-platform/platform-core/models"
+	"github.com/WeBankPartners/wecube-platform/platform-core/services/database"
+	"strings"
+	"time"
+)
+
+type signalExecutor struct {
+	noopExecutor
+}
+
+func (e *signalExecutor) JobType() string {
+	return models.JobSignalType
+}
+
+func (e *signalExecutor) Start(n *WorkNode, recoverFlag bool) (output string, err error) {
+	return n.doSignalJob(recoverFlag)
+}
+
+// Validate 等待信号节点单进,出线最多两条,两条时其中一条必须是超时分支并且配置了超时时长
+func (e *signalExecutor) Validate(ctx context.Context, procDef *models.ProcDef, node *models.ProcDefNode, inCount, outCount int) error {
+	config := models.ParseProcNodeSignalConfig(node.TimeConfig)
+	if config == nil || strings.TrimSpace(config.EventType) == "" {
+		return exterror.New().ProcDefNodeSignalError.WithParam(node.Name, "eventType can not empty")
+	}
+	switch config.CorrelationFrom {
+	case models.SignalCorrelationRoot:
+	case models.SignalCorrelationVariable:
+		if models.ParseProcDefVariables(procDef.Variables).Get(config.CorrelationVariable) == nil {
+			return exterror.New().ProcDefNodeSignalError.WithParam(node.Name, "unknown variable "+config.CorrelationVariable)
+		}
+	default:
+		return exterror.New().ProcDefNodeSignalError.WithParam(node.Name, "correlationFrom "+config.CorrelationFrom+" not support")
+	}
+	timeout, err := config.TimeoutDuration()
+	if err != nil {
+		return exterror.New().ProcDefNodeSignalError.WithParam(node.Name, err.Error())
+	}
+	if inCount != 1 || outCount < 1 || outCount > 2 {
+		return exterror.New().ProcDefNodeSignalError.WithParam(node.Name, "signal node need one in link and one or two out links")
+	}
+	nodeLinkList, err := database.GetProcDefNodeLinkByProcDefIdAndSource(ctx, procDef.Id, node.Id)
+	if err != nil {
+		return exterror.Catch(exterror.New().DatabaseQueryError, err)
+	}
+	timeoutLinkCount := 0
+	for _, link := range nodeLinkList {
+		if link.Name == models.SignalTimeoutBranch {
+			timeoutLinkCount++
+		}
+	}
+	if outCount == 2 && timeoutLinkCount != 1 {
+		return exterror.New().ProcDefNodeSignalError.WithParam(node.Name, "one of the two out links must be named "+models.SignalTimeoutBranch)
+	}
+	if outCount == 1 && timeoutLinkCount > 0 {
+		return exterror.New().ProcDefNodeSignalError.WithParam(node.Name, "need a out link besides the timeout branch")
+	}
+	if timeoutLinkCount > 0 && timeout <= 0 {
+		return exterror.New().ProcDefNodeSignalError.WithParam(node.Name, "timeout branch need duration")
+	}
+	return nil
+}
+
+// doSignalJob 等待关联的外部事件,超时由持久化定时器触发,有超时分支时走超时分支,否则节点失败
+func (n *WorkNode) doSignalJob(recoverFlag bool) (output string, err error) {
+	log.WorkflowLogger.Info("do signal job", log.String("nodeId", n.Id), log.String("input", n.Input), log.Bool("recover", recoverFlag))
+	config := models.ParseProcNodeSignalConfig(n.Input)
+	if config == nil || config.EventType == "" {
+		err = fmt.Errorf("signal node param:%s config illegal ", n.Input)
+		return
+	}
+	timeout, err := config.TimeoutDuration()
+	if err != nil {
+		err = fmt.Errorf("signal node param:%s config illegal,%s ", n.Input, err.Error())
+		return
+	}
+	select {
+	case <-n.timerChan:
+	default:
+	}
+	var signalRow *models.ProcRunSignal
+	if recoverFlag {
+		if signalRow, err = getNodeLastSignal(n.Id); err != nil {
+			return
+		}
+	}
+	if signalRow == nil {
+		if signalRow, err = createNodeSignal(n, config, timeout); err != nil {
+			return
+		}
+	}
+	for {
+		switch signalRow.Status {
+		case models.SignalStatusReceived:
+			log.WorkflowLogger.Info("signal job receive event", log.String("nodeId", n.Id), log.String("signalId", signalRow.Id), log.Int64("eventId", signalRow.EventId))
+			outputBytes, _ := json.Marshal(map[string]interface{}{"eventId": signalRow.EventId, "payload": signalRow.Payload})
+			output = string(outputBytes)
+			return
+		case models.SignalStatusTimeout:
+			if n.hasTimeoutBranch() {
+				output = models.SignalTimeoutBranch
+			} else {
+				err = fmt.Errorf("wait signal %s with correlation key %s timeout", signalRow.EventType, signalRow.CorrelationKey)
+			}
+			return
+		}
+		timeoutFlag := false
+		if signalRow.TimerId != "" {
+			timerRow, getTimerErr := getTimerRow(signalRow.TimerId)
+			if getTimerErr != nil {
+				err = getTimerErr
+				return
+			}
+			// 定时器被取消时一直等待信号
+			timeoutFlag = timerRow != nil && timerRow.Status == models.TimerStatusFired
+		}
+		if timeoutFlag {
+			updateSignalStatus(signalRow.Id, models.SignalStatusWait, models.SignalStatusTimeout, "sys")
+		} else {
+			select {
+			case <-n.timerChan:
+			case <-n.ContinueChan:
+				log.WorkflowLogger.Info("signal job continue before event arrive", log.String("nodeId", n.Id), log.String("signalId", signalRow.Id))
+				updateSignalStatus(signalRow.Id, models.SignalStatusWait, models.SignalStatusReceived, "continue")
+			case <-n.Ctx.Done():
+				err = errWorkflowQuit
+				return
+			}
+		}
+		if signalRow, err = getNodeLastSignal(n.Id); err != nil {
+			return
+		}
+		if signalRow == nil {
+			err = fmt.Errorf("can not find signal with node:%s ", n.Id)
+			return
+		}
+	}
+}
+
+// hasTimeoutBranch 节点是否有超时分支的出线
+func (n *WorkNode) hasTimeoutBranch() bool {
+	for _, link := range n.workflow.Links {
+		if link.Source == n.Id && link.Name == models.SignalTimeoutBranch {
+			return true
+		}
+	}
+	return false
+}
+
+// buildSignalCorrelationKey 从根数据id或编排变量取关联键
+func buildSignalCorrelationKey(n *WorkNode, config *models.ProcNodeSignalConfig) (correlationKey string, err error) {
+	if config.CorrelationFrom == models.SignalCorrelationVariable {
+		variableMap, getVarErr := database.GetProcInsVariableMap(n.Ctx, n.workflow.ProcInsId)
+		if getVarErr != nil {
+			err = getVarErr
+			return
+		}
+		value, ok := variableMap[config.CorrelationVariable]
+		if !ok || value == nil {
+			err = fmt.Errorf("correlation variable %s is empty", config.CorrelationVariable)
+			return
+		}
+		if strValue, isStr := value.(string); isStr {
+			correlationKey = strValue
+		} else {
+			valueBytes, _ := json.Marshal(value)
+			correlationKey = string(valueBytes)
+		}
+		return
+	}
+	procIns, getProcInsErr := database.GetSimpleProcInsRow(n.Ctx, n.workflow.ProcInsId)
+	if getProcInsErr != nil {
+		err = getProcInsErr
+		return
+	}
+	correlationKey = procIns.EntityDataId
+	return
+}
+
+// createNodeSignal 新增节点的信号等待纪录,有超时时同时新增定时器,并尝试匹配节点开始等待前已到达的事件
+func createNodeSignal(n *WorkNode, config *models.ProcNodeSignalConfig, timeout time.Duration) (signalRow *models.ProcRunSignal, err error) {
+	correlationKey, err := buildSignalCorrelationKey(n, config)
+	if err != nil {
+		return
+	}
+	nowTime := time.Now()
+	signalRow = &models.ProcRunSignal{Id: "signal_" + guid.CreateGuid(), WorkflowId: n.WorkflowId, ProcRunNodeId: n.Id, ProcInsId: n.workflow.ProcInsId, NodeName: n.Name,
+		EventType: config.EventType, CorrelationKey: correlationKey, Status: models.SignalStatusWait, CreatedTime: nowTime}
+	if timeout > 0 {
+		timerRow, createTimerErr := createNodeTimer(n, nowTime.Add(timeout))
+		if createTimerErr != nil {
+			err = createTimerErr
+			return
+		}
+		signalRow.TimerId = timerRow.Id
+	}
+	_, err = db.WorkflowMysqlEngine.Exec("insert into proc_run_signal(id,workflow_id,proc_run_node_id,proc_ins_id,node_name,event_type,correlation_key,timer_id,status,created_time) values (?,?,?,?,?,?,?,?,?,?)",
+		signalRow.Id, signalRow.WorkflowId, signalRow.ProcRunNodeId, signalRow.ProcInsId, signalRow.NodeName, signalRow.EventType, signalRow.CorrelationKey, signalRow.TimerId, signalRow.Status, signalRow.CreatedTime)
+	if err != nil {
+		err = fmt.Errorf("create proc run signal fail,%s ", err.Error())
+		return
+	}
+	// 编排启动后、节点开始等待前到达的事件只会被消费一次
+	var eventRows []*models.ProcInsEvent
+	err = db.WorkflowMysqlEngine.SQL("select id,operation_data from proc_ins_event where status=? and event_type=? and correlation_key=? and created_time>=? order by id",
+		models.ProcEventStatusUnmatched, signalRow.EventType, signalRow.CorrelationKey, n.workflow.CreatedTime).Find(&eventRows)
+	if err != nil {
+		err = fmt.Errorf("query unmatched proc ins event fail,%s ", err.Error())
+		return
+	}
+	for _, eventRow := range eventRows {
+		execResult, execErr := db.WorkflowMysqlEngine.Exec("update proc_ins_event set status=?,proc_ins_id=? where id=? and status=?", models.ProcEventStatusMatched, signalRow.ProcInsId, eventRow.Id, models.ProcEventStatusUnmatched)
+		if execErr != nil {
+			err = fmt.Errorf("take over unmatched proc ins event fail,%s ", execErr.Error())
+			return
+		}
+		if affectNum, _ := execResult.RowsAffected(); affectNum > 0 {
+			receiveSignal(signalRow.Id, int64(eventRow.Id), eventRow.OperationData, "sys")
+			signalRow.Status = models.SignalStatusReceived
+			signalRow.EventId = int64(eventRow.Id)
+			signalRow.Payload = eventRow.OperationData
+			break
+		}
+	}
+	return
+}
+
+func getNodeLastSignal(procRunNodeId string) (result *models.ProcRunSignal, err error) {
+	var signalRows []*models.ProcRunSignal
+	err = db.WorkflowMysqlEngine.SQL("select * from proc_run_signal where proc_run_node_id=? order by created_time desc limit 1", procRunNodeId).Find(&signalRows)
+	if err != nil {
+		err = fmt.Errorf("query proc run signal fail,%s ", err.Error())
+		return
+	}
+	if len(signalRows) > 0 {
+		result = signalRows[0]
+	}
+	return
+}
+
+func getTimerRow(timerId string) (result *models.ProcRunTimer, err error) {
+	var timerRows []*models.ProcRunTimer
+	err = db.WorkflowMysqlEngine.SQL("select * from proc_run_timer where id=?", timerId).Find(&timerRows)
+	if err != nil {
+		err = fmt.Errorf("query proc run timer fail,%s ", err.Error())
+		return
+	}
+	if len(timerRows) > 0 {
+		result = timerRows[0]
+	}
+	return
+}
+
+// updateSignalStatus 按原状态抢占更新信号状态,返回是否更新成功
+func updateSignalStatus(signalId, oldStatus, newStatus, operator string) bool {
+	execResult, err := db.WorkflowMysqlEngine.Exec("update proc_run_signal set status=?,updated_by=?,updated_time=? where id=? and status=?", newStatus, operator, time.Now(), signalId, oldStatus)
+	if err != nil {
+		log.WorkflowLogger.Error("update proc run signal status fail", log.String("signalId", signalId), log.String("status", newStatus), log.Error(err))
+		return false
+	}
+	if affectNum, _ := execResult.RowsAffected(); affectNum > 0 {
+		return true
+	}
+	return false
+}
+
+// receiveSignal 等待中的信号收到事件,返回是否抢占成功
+func receiveSignal(signalId string, eventId int64, payload, operator string) bool {
+	execResult, err := db.WorkflowMysqlEngine.Exec("update proc_run_signal set status=?,event_id=?,payload=?,updated_by=?,updated_time=? where id=? and status=?",
+		models.SignalStatusReceived, eventId, payload, operator, time.Now(), signalId, models.SignalStatusWait)
+	if err != nil {
+		log.WorkflowLogger.Error("receive proc run signal fail", log.String("signalId", signalId), log.Int64("eventId", eventId), log.Error(err))
+		return false
+	}
+	if affectNum, _ := execResult.RowsAffected(); affectNum > 0 {
+		return true
+	}
+	return false
+}
+
+// DeliverSignalEvent 外部事件恢复所有匹配事件类型和关联键的等待信号节点,没有匹配时保留给之后开始等待的节点
+func DeliverSignalEvent(ctx context.Context, param *models.ProcStartEventParam) (result *models.ProcStartEventResultData, err error) {
+	operator := param.OperationUser
+	if operator == "" {
+		operator = "platform"
+	}
+	execResult, execErr := db.MysqlEngine.Context(ctx).Exec("insert into proc_ins_event(event_seq_no,event_type,operation_data,operation_key,operation_user,source_plugin,status,correlation_key,created_time) values (?,?,?,?,?,?,?,?,?)",
+		param.EventSeqNo, param.EventType, param.OperationData, param.OperationKey, param.OperationUser, param.SourceSubSystem, models.ProcEventStatusUnmatched, param.CorrelationKey, time.Now())
+	if execErr != nil {
+		err = exterror.Catch(exterror.New().DatabaseExecuteError, execErr)
+		return
+	}
+	eventId, _ := execResult.LastInsertId()
+	result = &models.ProcStartEventResultData{EventId: fmt.Sprintf("%d", eventId), Status: models.ProcEventStatusUnmatched}
+	var signalRows []*models.ProcRunSignal
+	err = db.WorkflowMysqlEngine.Context(ctx).SQL("select id,workflow_id,proc_run_node_id,proc_ins_id from proc_run_signal where status=? and event_type=? and correlation_key=?",
+		models.SignalStatusWait, param.EventType, param.CorrelationKey).Find(&signalRows)
+	if err != nil {
+		err = exterror.Catch(exterror.New().DatabaseQueryError, err)
+		return
+	}
+	var matchProcInsIds []string
+	for _, row := range signalRows {
+		if !receiveSignal(row.Id, eventId, param.OperationData, operator) {
+			continue
+		}
+		matchProcInsIds = append(matchProcInsIds, row.ProcInsId)
+		notifyNode(ctx, row.WorkflowId, row.ProcRunNodeId, "signal", operator)
+	}
+	if len(matchProcInsIds) == 0 {
+		return
+	}
+	// proc_ins_id保留第一个实例兼容原来的事件列表,所有匹配的实例记录在match_proc_ins_ids
+	if _, err = db.MysqlEngine.Context(ctx).Exec("update proc_ins_event set status=?,proc_ins_id=?,match_proc_ins_ids=? where id=?", models.ProcEventStatusMatched, matchProcInsIds[0], strings.Join(matchProcInsIds, ","), eventId); err != nil {
+		err = exterror.Catch(exterror.New().DatabaseExecuteError, err)
+		return
+	}
+	result.Status = models.ProcEventStatusMatched
+	for _, procInsId := range matchProcInsIds {
+		result.TaskNodeInstances = append(result.TaskNodeInstances, &models.ProcStartEventResultData{ProcInstId: procInsId, Status: models.ProcEventStatusMatched})
+	}
+	return
+}
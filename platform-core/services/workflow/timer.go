@@ -0,0 +1,168 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/WeBankPartners/go-common-lib/guid"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/db"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/log"
+	"github.com/WeBankPartners/wecube-platform/platform-core/models"
+	"github.com/WeBankPartners/wecube-platform/platform-core/services/database"
+	"strconv"
+	"time"
+)
+
+// errWorkflowQuit 工作流退出内存(如sleep)时等待中的节点直接退出,不更新节点状态
+var errWorkflowQuit = errors.New("workflow quit from memory")
+
+// waitTimer 纪录持久化的定时器并等待定时器调度唤醒,编排重新加载时沿用已有的定时器
+// 定时器的状态以数据库为准,timerChan只作为唤醒信号
+func (n *WorkNode) waitTimer(fireTime time.Time, recoverFlag bool) (err error) {
+	select {
+	case <-n.timerChan:
+	default:
+	}
+	var timerRow *models.ProcRunTimer
+	if recoverFlag {
+		if timerRow, err = getNodeLastTimer(n.Id); err != nil {
+			return
+		}
+	}
+	if timerRow == nil {
+		if timerRow, err = createNodeTimer(n, fireTime); err != nil {
+			return
+		}
+	}
+	for {
+		switch timerRow.Status {
+		case models.TimerStatusFired:
+			log.WorkflowLogger.Info("timer job success done", log.String("nodeId", n.Id), log.String("timerId", timerRow.Id))
+			return
+		case models.TimerStatusCanceled:
+			err = fmt.Errorf("timer canceled by %s", timerRow.UpdatedBy)
+			return
+		}
+		select {
+		case <-n.timerChan:
+		case <-n.ContinueChan:
+			log.WorkflowLogger.Info("timer job continue before done", log.String("nodeId", n.Id), log.String("timerId", timerRow.Id))
+			updateTimerStatus(timerRow.Id, models.TimerStatusWait, models.TimerStatusFired, "continue")
+			return
+		case <-n.Ctx.Done():
+			err = errWorkflowQuit
+			return
+		}
+		if timerRow, err = getNodeLastTimer(n.Id); err != nil {
+			return
+		}
+		if timerRow == nil {
+			err = fmt.Errorf("can not find timer with node:%s ", n.Id)
+			return
+		}
+	}
+}
+
+func getNodeLastTimer(procRunNodeId string) (result *models.ProcRunTimer, err error) {
+	var timerRows []*models.ProcRunTimer
+	err = db.WorkflowMysqlEngine.SQL("select * from proc_run_timer where proc_run_node_id=? order by created_time desc limit 1", procRunNodeId).Find(&timerRows)
+	if err != nil {
+		err = fmt.Errorf("query proc run timer fail,%s ", err.Error())
+		return
+	}
+	if len(timerRows) > 0 {
+		result = timerRows[0]
+	}
+	return
+}
+
+// createNodeTimer 新增节点定时器,节点之前未触发的定时器置为取消
+func createNodeTimer(n *WorkNode, fireTime time.Time) (timerRow *models.ProcRunTimer, err error) {
+	nowTime := time.Now()
+	timerRow = &models.ProcRunTimer{Id: "timer_" + guid.CreateGuid(), WorkflowId: n.WorkflowId, ProcRunNodeId: n.Id, ProcInsId: n.workflow.ProcInsId, NodeName: n.Name, JobType: n.JobType, FireTime: fireTime, Status: models.TimerStatusWait, CreatedTime: nowTime}
+	var actions []*db.ExecAction
+	actions = append(actions, &db.ExecAction{Sql: "update proc_run_timer set status=?,updated_by=?,updated_time=? where proc_run_node_id=? and status=?", Param: []interface{}{models.TimerStatusCanceled, "sys", nowTime, n.Id, models.TimerStatusWait}})
+	actions = append(actions, &db.ExecAction{Sql: "insert into proc_run_timer(id,workflow_id,proc_run_node_id,proc_ins_id,node_name,job_type,fire_time,status,created_time) values (?,?,?,?,?,?,?,?,?)", Param: []interface{}{
+		timerRow.Id, timerRow.WorkflowId, timerRow.ProcRunNodeId, timerRow.ProcInsId, timerRow.NodeName, timerRow.JobType, timerRow.FireTime, timerRow.Status, timerRow.CreatedTime,
+	}})
+	if err = db.Transaction(actions, n.Ctx); err != nil {
+		err = fmt.Errorf("create proc run timer fail,%s ", err.Error())
+	}
+	return
+}
+
+// updateTimerStatus 按原状态抢占更新定时器状态,返回是否更新成功
+func updateTimerStatus(timerId, oldStatus, newStatus, operator string) bool {
+	execResult, err := db.WorkflowMysqlEngine.Exec("update proc_run_timer set status=?,handle_by=?,updated_by=?,updated_time=? where id=? and status=?", newStatus, instanceHost, operator, time.Now(), timerId, oldStatus)
+	if err != nil {
+		log.WorkflowLogger.Error("update proc run timer status fail", log.String("timerId", timerId), log.String("status", newStatus), log.Error(err))
+		return false
+	}
+	if affectNum, _ := execResult.RowsAffected(); affectNum > 0 {
+		return true
+	}
+	return false
+}
+
+// FireTimer 唤醒等待定时器的时间节点、等待信号节点或暂停在断点的节点
+func (w *Workflow) FireTimer(nodeId string) {
+	for _, node := range w.Nodes {
+		if node.Id == nodeId {
+			select {
+			case node.timerChan <- 1:
+			default:
+			}
+			return
+		}
+	}
+	log.WorkflowLogger.Error("can not find node in workflow", log.String("node", nodeId), log.String("workflowId", w.Id))
+}
+
+// 每1s扫描到期的定时器,抢占成功后通过工作流操作唤醒节点,多个实例同时扫描时只有一个能抢占成功
+func startTimerJob() {
+	t := time.NewTicker(1 * time.Second).C
+	for {
+		<-t
+		doTimerJob()
+	}
+}
+
+func doTimerJob() {
+	if IsDraining() {
+		return
+	}
+	var timerRows []*models.ProcRunTimer
+	err := db.WorkflowMysqlEngine.SQL("select id,workflow_id,proc_run_node_id,fire_time from proc_run_timer where status=? and fire_time<=? order by fire_time limit 100", models.TimerStatusWait, time.Now()).Find(&timerRows)
+	if err != nil {
+		log.WorkflowLogger.Error("query due proc run timer fail", log.Error(err))
+		return
+	}
+	for _, row := range timerRows {
+		if !IsClusterOwnerOrOverdue(row.WorkflowId, row.FireTime) {
+			continue
+		}
+		if !updateTimerStatus(row.Id, models.TimerStatusWait, models.TimerStatusFired, "sys") {
+			continue
+		}
+		NotifyTimer(context.Background(), row.WorkflowId, row.ProcRunNodeId, "sys")
+	}
+}
+
+// NotifyTimer 定时器触发或取消后通知节点,工作流在sleep时会被唤醒,在其它实例时由其它实例扫描处理
+func NotifyTimer(ctx context.Context, workflowId, procRunNodeId, operator string) {
+	notifyNode(ctx, workflowId, procRunNodeId, "timer", operator)
+}
+
+// notifyNode 通过工作流操作唤醒等待中的节点
+func notifyNode(ctx context.Context, workflowId, procRunNodeId, operationName, operator string) {
+	operation := models.ProcRunOperation{WorkflowId: workflowId, NodeId: procRunNodeId, Operation: operationName, Status: "wait", CreatedBy: operator}
+	execResult, err := db.WorkflowMysqlEngine.Context(ctx).Exec("insert into proc_run_operation(workflow_id,node_id,operation,status,message,created_by,created_time) values (?,?,?,?,?,?,?)",
+		operation.WorkflowId, operation.NodeId, operation.Operation, operation.Status, operation.Message, operation.CreatedBy, time.Now())
+	if err != nil {
+		log.WorkflowLogger.Error("add notify node operation fail", log.String("workflowId", workflowId), log.String("nodeId", procRunNodeId), log.String("operation", operationName), log.Error(err))
+		return
+	}
+	operation.Id, _ = execResult.LastInsertId()
+	database.AddProcInsTimeline(ctx, &models.ProcInsTimeline{WorkflowId: workflowId, ProcRunNodeId: procRunNodeId, EventType: models.TimelineEventOperation, Status: operationName, RefId: strconv.FormatInt(operation.Id, 10), CreatedBy: operator})
+	go HandleProOperation(&operation)
+}
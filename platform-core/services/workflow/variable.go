@@ -0,0 +1,46 @@
+package workflow
+
+import (
+	"context"
+	"github.com/WeBankPartners/wecube-platform/platform-core/common/exterror"
+	"github.com/WeBankPartners/wecube-platform/platform-core/models"
+	"github.com/WeBankPartners/wecube-platform/platform-core/services/database"
+	"strings"
+)
+
+// ValidateProcDefVariables 发布编排时检查编排变量定义
+func ValidateProcDefVariables(procDef *models.ProcDef) error {
+	if err := models.ParseProcDefVariables(procDef.Variables).Validate(); err != nil {
+		return exterror.New().ProcDefVariableError.WithParam(err.Error())
+	}
+	return nil
+}
+
+// validateNodeVariables 发布编排时检查节点出参映射和绑定变量的参数引用的都是已定义的编排变量
+func validateNodeVariables(ctx context.Context, procDef *models.ProcDef, node *models.ProcDefNode) error {
+	variableDefs := models.ParseProcDefVariables(procDef.Variables)
+	if node.OutputMappings != "" {
+		mappings := models.ParseProcNodeOutputMappings(node.OutputMappings)
+		if mappings == nil {
+			return exterror.New().ProcDefNodeOutputMappingError.WithParam(node.Name, "json format illegal")
+		}
+		for _, mapping := range mappings {
+			if strings.TrimSpace(mapping.Param) == "" {
+				return exterror.New().ProcDefNodeOutputMappingError.WithParam(node.Name, "param can not empty")
+			}
+			if variableDefs.Get(mapping.Variable) == nil {
+				return exterror.New().ProcDefNodeOutputMappingError.WithParam(node.Name, "unknown variable "+mapping.Variable)
+			}
+		}
+	}
+	nodeParams, err := database.GetProcDefNodeParamByNodeId(ctx, node.Id)
+	if err != nil {
+		return err
+	}
+	for _, param := range nodeParams {
+		if param.BindType == models.ProcDefNodeParamBindVariable && variableDefs.Get(param.Value) == nil {
+			return exterror.New().ProcDefVariableError.WithParam(node.Name + " param " + param.Name + " bind unknown variable " + param.Value)
+		}
+	}
+	return nil
+}
@@ -35,11 +35,13 @@ type Workflow struct {
 	statusLock       *sync.RWMutex
 	errorLock        *sync.RWMutex
 	stopNodeChanList []chan int
+	cancel           context.CancelFunc
+	releaseFlag      int32
 }
 
 func (w *Workflow) Init(ctx context.Context, nodes []*models.ProcRunNode, links []*models.ProcRunLink) {
 	w.Links = links
-	w.Ctx, _ = context.WithCancel(ctx)
+	w.Ctx, w.cancel = context.WithCancel(ctx)
 	for _, node := range nodes {
 		workNodeObj := WorkNode{ProcRunNode: *node, Ctx: w.Ctx}
 		workNodeObj.Init(w)
@@ -87,8 +89,18 @@ func (w *Workflow) Start(input *models.ProcOperation) {
 	} else {
 		log.WorkflowLogger.Info("<--workflow done-->", log.String("wid", w.Id))
 		w.setStatus(w.Status, nil)
+		if w.Status == models.JobStatusFail {
+			// 走到异常结束节点时自动补偿已完成的任务节点,其它分支可能还有节点在执行,等它们结束再补偿
+			// 普通节点失败时工作流仍是运行中,等待人工重试、跳过或回滚,不自动补偿
+			if !w.waitWorkNodeIdle(compensateWaitTimeout) {
+				log.WorkflowLogger.Error("workflow compensate give up,node still running", log.String("wid", w.Id), log.Int("busyNodeNum", w.busyNodeNum()))
+			} else if err := compensateWorkflow(w.Ctx, w.Id, models.CompensateTriggerFail, "sys"); err != nil {
+				log.WorkflowLogger.Error("workflow compensate fail", log.String("wid", w.Id), log.Error(err))
+			}
+		}
 	}
 	GlobalWorkflowMap.Delete(w.Id)
+	w.cancel()
 }
 
 func (w *Workflow) nodeDoneCallback(node *WorkNode) {
@@ -126,13 +138,21 @@ func (w *Workflow) nodeDoneCallback(node *WorkNode) {
 		<-waitStopChan
 	}
 	// 找到节点下一跳发出start信号
+	sourceId := node.Id
+	if node.loopBodyEnd != "" {
+		sourceId = node.loopBodyEnd
+	}
 	for _, ref := range w.Links {
 		if decisionChose != "" {
 			if ref.Name != decisionChose {
 				continue
 			}
 		}
-		if ref.Source == node.Id {
+		// 等待信号节点超时走超时分支,否则走另外的分支
+		if node.JobType == models.JobSignalType && (ref.Name == models.SignalTimeoutBranch) != (node.Output == models.SignalTimeoutBranch) {
+			continue
+		}
+		if ref.Source == sourceId {
 			for _, targetNode := range w.Nodes {
 				if targetNode.Id == ref.Target {
 					if targetNode.JobType == models.JobDecisionType {
@@ -171,6 +191,20 @@ func (w *Workflow) Sleep() (err error) {
 	return
 }
 
+// waitUnload 等待工作流退出内存,超时还没退出返回false
+func (w *Workflow) waitUnload(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		if value, ok := GlobalWorkflowMap.Load(w.Id); !ok || value.(*Workflow) != w {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
 func (w *Workflow) setStatus(status string, op *models.ProcOperation) {
 	w.statusLock.Lock()
 	w.Status = status
@@ -301,7 +335,7 @@ func (w *Workflow) heartbeat() {
 			log.WorkflowLogger.Info("workflow heartbeat get quit status", log.String("workflowId", w.Id), log.String("status", wStatus))
 			break
 		}
-		if _, err := db.WorkflowMysqlEngine.Exec("update proc_run_workflow set host=?,last_alive_time=? where id=?", instanceHost, time.Now(), w.Id); err != nil {
+		if _, err := db.WorkflowMysqlEngine.Exec("update proc_run_workflow set host=?,last_alive_time=? where id=? and (host is null or host<>?)", instanceHost, time.Now(), w.Id, models.WorkflowHostReleased); err != nil {
 			log.WorkflowLogger.Error("workflow heartbeat update alive time fail", log.String("workflowId", w.Id), log.Error(err))
 		}
 		<-t
@@ -318,8 +352,10 @@ type WorkNode struct {
 	Err          error
 	callbackChan chan string
 	ContinueChan chan int
+	timerChan    chan int
 	RetryFlag    bool
 	ConfirmFlag  bool
+	loopBodyEnd  string // 循环子图时子图最后一个节点的运行节点id,循环结束后从它的出线继续
 }
 
 func (n *WorkNode) Init(w *Workflow) {
@@ -328,6 +364,7 @@ func (n *WorkNode) Init(w *Workflow) {
 	n.DoneChan = make(chan int, 1)
 	n.callbackChan = make(chan string, 1)
 	n.ContinueChan = make(chan int, 1)
+	n.timerChan = make(chan int, 1)
 }
 
 func (n *WorkNode) Ready() {
@@ -339,9 +376,42 @@ func (n *WorkNode) Ready() {
 	case <-n.StartChan:
 		log.WorkflowLogger.Info("ready job ", log.String("nodeId", n.Id))
 	}
+	if IsDraining() {
+		// 实例退出中不再开始新节点,由接管的实例重新加载后继续
+		log.WorkflowLogger.Info("job not start with host draining", log.String("nodeId", n.Id))
+		return
+	}
+	// 断点在超时计时前等待,暂停期间不算节点超时,放行后才开始执行和计时
+	if n.Status != models.JobStatusRunning && n.Status != models.JobStatusSuccess && n.Status != models.JobStatusFail {
+		if breakpointErr := n.waitBreakpoint(); breakpointErr != nil {
+			if errors.Is(breakpointErr, errWorkflowQuit) {
+				// 工作流已退出内存,节点保持暂停,等工作流重新加载后继续等待
+				return
+			}
+			n.Err = breakpointErr
+			n.Status = models.JobStatusFail
+			n.ErrorMessage = fmt.Sprintf("check breakpoint fail,%s", breakpointErr.Error())
+			updateNodeDB(&n.ProcRunNode)
+			log.WorkflowLogger.Error("node error", log.String("id", n.Id), log.Error(n.Err))
+			n.workflow.nodeDoneCallback(n)
+			return
+		}
+	}
+	// 工作流迁往其它实例期间先不开始,迁移放弃时继续,工作流退出内存时直接退出
+	for n.workflow.isReleasing() {
+		select {
+		case <-n.Ctx.Done():
+			log.WorkflowLogger.Info("job not start with workflow handoff", log.String("nodeId", n.Id))
+			return
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
 	if n.StartTime.IsZero() {
 		n.StartTime = time.Now()
 	}
+	if executor, ok := GetNodeExecutor(n.JobType); ok {
+		executor.Ready(n)
+	}
 	go n.start()
 	if n.Timeout > 0 {
 		select {
@@ -352,10 +422,19 @@ func (n *WorkNode) Ready() {
 			updateNodeDB(&n.ProcRunNode)
 		case <-n.DoneChan:
 			log.WorkflowLogger.Info("<--- done node", log.String("id", n.Id), log.String("type", n.JobType))
+		case <-n.Ctx.Done():
+			// 工作流退出内存(sleep或被其它实例接管)后不再计时,由重新加载的实例处理
+			log.WorkflowLogger.Info("job quit with workflow", log.String("nodeId", n.Id))
+			return
 		}
 	} else {
-		<-n.DoneChan
-		log.WorkflowLogger.Info("<--- done node", log.String("id", n.Id), log.String("type", n.JobType))
+		select {
+		case <-n.DoneChan:
+			log.WorkflowLogger.Info("<--- done node", log.String("id", n.Id), log.String("type", n.JobType))
+		case <-n.Ctx.Done():
+			log.WorkflowLogger.Info("job quit with workflow", log.String("nodeId", n.Id))
+			return
+		}
 	}
 	if n.Err != nil {
 		log.WorkflowLogger.Error("node error", log.String("id", n.Id), log.Error(n.Err))
@@ -373,21 +452,21 @@ func (n *WorkNode) start() {
 		n.DoneChan <- 1
 		return
 	}
+	executor, ok := GetNodeExecutor(n.JobType)
+	if !ok {
+		n.Err = fmt.Errorf("can not find executor with node job type:%s ", n.JobType)
+		n.Status = models.JobStatusFail
+		n.ErrorMessage = n.Err.Error()
+		updateNodeDB(&n.ProcRunNode)
+		n.DoneChan <- 1
+		return
+	}
 	retryFlag := false
 	if n.Status == models.JobStatusRunning {
 		retryFlag = true
-		if n.Timeout > 0 {
-			// 如果是恢复态，自动化和数据写入任务时间太久的情况下就置为超时，不然可能时间太长一些数据都不一样了，让用户自行重试
-			if n.JobType == models.JobAutoType || n.JobType == models.JobDataType {
-				if time.Since(n.StartTime).Minutes() > float64(n.Timeout) {
-					n.ErrorMessage = fmt.Sprintf(timeoutErrorTpl, n.Timeout)
-					n.Err = errors.New(n.ErrorMessage)
-					n.Status = models.JobStatusTimeout
-					updateNodeDB(&n.ProcRunNode)
-					n.DoneChan <- 1
-					return
-				}
-			}
+		if executor.RecoverExpired(n) {
+			n.DoneChan <- 1
+			return
 		}
 	}
 	log.WorkflowLogger.Info("---> start node", log.String("id", n.Id), log.String("type", n.JobType), log.String("input", n.Input))
@@ -401,63 +480,10 @@ func (n *WorkNode) start() {
 		recoverFlag = true
 	}
 	n.RetryFlag = false
-	switch n.JobType {
-	case models.JobStartType:
-		break
-	case models.JobEndType:
-		break
-	case models.JobBreakType:
-		break
-	case models.JobAutoType:
-		n.Output, n.Err = n.doAutoJob()
-	case models.JobDataType:
-		n.Output, n.Err = n.doDataJob()
-	case models.JobHumanType:
-		n.Output, n.Err = n.doHumanJob(recoverFlag)
-	case models.JobForkType:
-		break
-	case models.JobMergeType:
-		needStartCount := 0
-		for _, ref := range n.workflow.Links {
-			if ref.Target == n.Id {
-				needStartCount = needStartCount + 1
-			}
-		}
-		if needStartCount > 1 {
-			log.WorkflowLogger.Info("merge wait other signal", log.Int("wait signal num", needStartCount-1))
-			n.Status = "wait"
-			updateNodeDB(&n.ProcRunNode)
-			for needStartCount > 1 {
-				<-n.StartChan
-				needStartCount = needStartCount - 1
-				log.WorkflowLogger.Info("merge get another signal", log.Int("wait signal num", needStartCount-1))
-			}
-		}
-	case models.JobTimeType:
-		n.Output, n.Err = n.doTimeJob(recoverFlag)
-	case models.JobDateType:
-		n.Output, n.Err = n.doDateJob(recoverFlag)
-	case models.JobDecisionType:
-		n.Input = getNodeInputData(n.Id)
-		if n.Input == "" {
-			for _, tmpLink := range n.workflow.Links {
-				if tmpLink.Target == n.Id {
-					n.Input = getNodeOutputData(tmpLink.Source)
-					break
-				}
-			}
-			if n.Input == "" {
-				n.Input = <-n.callbackChan
-				//n.Err = fmt.Errorf("dicision type receive empty choose")
-			}
-			if tmpErr := updateNodeInputData(n.Id, n.Input); tmpErr != nil {
-				log.WorkflowLogger.Error("updateNodeInputData for decision job fail", log.Error(tmpErr))
-			}
-		}
-	case models.JobSubProcType:
-		n.Output, n.Err = n.doSubProcessJob(recoverFlag)
-	case models.JobDecisionMergeType:
-		break
+	n.Output, n.Err = executor.Start(n, recoverFlag)
+	if errors.Is(n.Err, errWorkflowQuit) || n.Ctx.Err() != nil {
+		// 工作流已退出内存(调用中被取消也一样),节点保持运行中,等工作流重新加载后恢复
+		return
 	}
 	if n.Err == nil {
 		n.Status = models.JobStatusSuccess
@@ -516,11 +542,30 @@ func (n *WorkNode) doHumanJob(recoverFlag bool) (output string, err error) {
 	//		recoverFlag = false
 	//	}
 	//}
-	err = execution.DoWorkflowHumanJob(n.Ctx, n.Id, recoverFlag)
+	policy, serviceName, err := getNodeApprovalPolicy(n.Ctx, n.Id)
 	if err != nil {
 		log.WorkflowLogger.Error("do human job error", log.Error(err))
 		return
 	}
+	var simulateCallback *models.PluginTaskCreateResp
+	// 配置了多人审批且没有表单插件时不用发人工任务
+	if policy == nil || serviceName != "" {
+		if simulateCallback, err = execution.DoWorkflowHumanJob(n.Ctx, n.Id, recoverFlag); err != nil {
+			log.WorkflowLogger.Error("do human job error", log.Error(err))
+			return
+		}
+	}
+	// 模拟运行时不用等待任务回调
+	if simulateCallback != nil {
+		if output, err = execution.HandleCallbackHumanJob(n.Ctx, n.Id, simulateCallback); err != nil || policy == nil {
+			return
+		}
+	}
+	// 多人审批时节点结果由审批票决定
+	if policy != nil {
+		output, err = n.waitApproval(policy, recoverFlag)
+		return
+	}
 	// wait callback
 	callbackMessage := <-n.callbackChan
 	var callbackData models.PluginTaskCreateResp
@@ -539,6 +584,11 @@ func (n *WorkNode) doTimeJob(recoverFlag bool) (output string, err error) {
 		err = fmt.Errorf("time node param:%s json unmarshal fail,%s ", n.Input, err.Error())
 		return
 	}
+	// 配置了业务日历或等待维护窗口时按日历计算
+	if timeConfig.Calendar != "" || timeConfig.Type == models.TimeNodeTypeWindow {
+		err = n.doCalendarTimeJob(&timeConfig, recoverFlag)
+		return
+	}
 	if timeConfig.Unit == "" || timeConfig.Duration < 0 {
 		err = fmt.Errorf("time node param:%s config illegal ", n.Input)
 		return
@@ -564,32 +614,17 @@ func (n *WorkNode) doTimeJob(recoverFlag bool) (output string, err error) {
 	if err != nil {
 		return
 	}
+	fireTime := time.Now().Add(timeDuration)
 	if recoverFlag {
-		nowSubSec := time.Since(n.StartTime).Seconds()
-		if nowSubSec > timeDuration.Seconds() {
-			log.WorkflowLogger.Info("time job already start,now time match done", log.String("startTime", n.StartTime.Format(models.DateTimeFormat)), log.Float64("waitSec", timeDuration.Seconds()))
-		} else {
-			newTimeDuration := time.Duration(timeDuration.Seconds()-nowSubSec) * time.Second
-			select {
-			case <-time.After(newTimeDuration):
-				log.WorkflowLogger.Info("time job success done", log.String("nodeId", n.Id))
-			case <-n.ContinueChan:
-				log.WorkflowLogger.Info("time job continue before done", log.String("nodeId", n.Id))
-			}
-		}
+		fireTime = n.StartTime.Add(timeDuration)
 	} else {
 		endDate := time.Unix(time.Now().Unix()+int64(waitSec), 0).Format(models.DateTimeFormat)
 		n.Output = endDate
 		if _, updateTimeOutputErr := db.WorkflowMysqlEngine.Exec("update proc_run_node set `output`=?,updated_time=? where id=?", endDate, time.Now(), n.Id); updateTimeOutputErr != nil {
 			log.WorkflowLogger.Error("update time job output fail", log.String("nodeId", n.Id), log.String("endDate", endDate), log.Error(updateTimeOutputErr))
 		}
-		select {
-		case <-time.After(timeDuration):
-			log.WorkflowLogger.Info("time job success done", log.String("nodeId", n.Id))
-		case <-n.ContinueChan:
-			log.WorkflowLogger.Info("time job continue before done", log.String("nodeId", n.Id))
-		}
 	}
+	err = n.waitTimer(fireTime, recoverFlag)
 	return
 }
 
@@ -600,26 +635,20 @@ func (n *WorkNode) doDateJob(recoverFlag bool) (output string, err error) {
 		err = fmt.Errorf("time node param:%s json unmarshal fail,%s ", n.Input, err.Error())
 		return
 	}
-	t, parseErr := time.ParseInLocation("2006-01-02 15:04:05", timeConfig.Date, time.Local)
+	t, parseErr := parseDateNodeTime(n.Ctx, &timeConfig)
 	if parseErr != nil {
-		err = fmt.Errorf("date node parse time:%s fail", timeConfig.Date)
+		err = fmt.Errorf("date node parse time:%s fail,%s ", timeConfig.Date, parseErr.Error())
 		return
 	}
-	n.Output = timeConfig.Date
-	if _, updateTimeOutputErr := db.WorkflowMysqlEngine.Exec("update proc_run_node set `output`=?,updated_time=? where id=?", timeConfig.Date, time.Now(), n.Id); updateTimeOutputErr != nil {
-		log.WorkflowLogger.Error("update date job output fail", log.String("nodeId", n.Id), log.String("endDate", timeConfig.Date), log.Error(updateTimeOutputErr))
+	endDate := t.In(time.Local).Format(models.DateTimeFormat)
+	n.Output = endDate
+	if _, updateTimeOutputErr := db.WorkflowMysqlEngine.Exec("update proc_run_node set `output`=?,updated_time=? where id=?", endDate, time.Now(), n.Id); updateTimeOutputErr != nil {
+		log.WorkflowLogger.Error("update date job output fail", log.String("nodeId", n.Id), log.String("endDate", endDate), log.Error(updateTimeOutputErr))
 	}
-	timeSub := t.Unix() - time.Now().Unix()
-	if timeSub < 0 {
+	if !recoverFlag && t.Before(time.Now()) {
 		return
-	} else {
-		select {
-		case <-time.After(time.Duration(timeSub) * time.Second):
-			log.WorkflowLogger.Info("date job success done", log.String("nodeId", n.Id))
-		case <-n.ContinueChan:
-			log.WorkflowLogger.Info("date job continue before done", log.String("nodeId", n.Id))
-		}
 	}
+	err = n.waitTimer(t, recoverFlag)
 	return
 }
 
@@ -627,55 +656,15 @@ func (n *WorkNode) doSubProcessJob(recoverFlag bool) (output string, err error)
 	log.WorkflowLogger.Info("do sub process job", log.String("nodeId", n.Id), log.String("input", n.Input))
 	ctx := context.WithValue(n.Ctx, models.TransactionIdHeader, n.Id)
 	if recoverFlag {
-		t := time.NewTicker(5 * time.Second).C
-		for {
-			<-t
-			runningRows, tmpErr := database.CheckProcSubRunning(ctx, n.Id)
-			if tmpErr != nil {
-				log.WorkflowLogger.Error("doSubProcessJob recover check fail", log.String("procRunNodeId", n.Id), log.Error(tmpErr))
-				continue
-			}
-			if len(runningRows) > 0 {
-				log.WorkflowLogger.Debug("doSubProcessJob recover check continue", log.String("procRunNodeId", n.Id), log.Int("runningSubProcessNum", len(runningRows)))
-				continue
-			}
-			break
-		}
+		waitSubProcRunning(ctx, n.Id)
 		log.WorkflowLogger.Info("doSubProcessJob recover done", log.String("procRunNodeId", n.Id))
 	} else {
 		// 查proc def node定义和proc ins绑定数据
-		procInsNode, procDefNode, _, dataBindings, getNodeDataErr := database.GetProcExecNodeData(ctx, n.Id)
+		procInsNode, procDefNode, dataBindings, getNodeDataErr := getSubProcBindData(ctx, n.Id, true)
 		if getNodeDataErr != nil {
 			err = getNodeDataErr
 			return
 		}
-		if procDefNode.DynamicBind == 1 {
-			dataBindings, err = database.GetDynamicBindNodeData(ctx, procInsNode.ProcInsId, procDefNode.ProcDefId, procDefNode.BindNodeId)
-			if err != nil {
-				err = fmt.Errorf("get node dynamic bind data fail,%s ", err.Error())
-				return
-			}
-			if len(dataBindings) > 0 {
-				err = database.UpdateDynamicNodeBindData(ctx, procInsNode.ProcInsId, procInsNode.Id, procDefNode.ProcDefId, procDefNode.Id, dataBindings)
-				if err != nil {
-					err = fmt.Errorf("try to update dynamic node binding data fail,%s ", err.Error())
-					return
-				}
-			}
-		} else if procDefNode.DynamicBind == 2 {
-			dataBindings, err = execution.DynamicBindNodeInRuntime(ctx, procInsNode, procDefNode)
-			if err != nil {
-				err = fmt.Errorf("get runtime dynamic bind data fail,%s ", err.Error())
-				return
-			}
-			if len(dataBindings) > 0 {
-				err = database.UpdateDynamicNodeBindData(ctx, procInsNode.ProcInsId, procInsNode.Id, procDefNode.ProcDefId, procDefNode.Id, dataBindings)
-				if err != nil {
-					err = fmt.Errorf("try to update runtime dynamic node binding data fail,%s ", err.Error())
-					return
-				}
-			}
-		}
 		if len(dataBindings) == 0 {
 			log.WorkflowLogger.Warn("sub process job return with empty binding data", log.String("procIns", procInsNode.ProcInsId), log.String("procInsNode", procInsNode.Id))
 			// 无数据，空跑
@@ -712,20 +701,15 @@ func (n *WorkNode) doSubProcessJob(recoverFlag bool) (output string, err error)
 				ParentRunNodeId:   n.Id,
 			}
 			log.WorkflowLogger.Debug("doSubProcessJob", log.Int("i", i), log.JsonObj("tmpCreateInsParam", tmpCreateInsParam))
-			// 新增 proc_ins,proc_ins_node,proc_data_binding 纪录
-			subProcInsId, subWorkflowRow, subWorkNodes, subWorkLinks, tmpCreateInsErr := database.CreateProcInstance(context.WithValue(n.Ctx, models.TransactionIdHeader, fmt.Sprintf("%s_%d", n.Id, i)), &tmpCreateInsParam, operator)
+			workObj, subWorkNodes, tmpCreateInsErr := n.createSubWorkflow(&tmpCreateInsParam, operator, i)
 			if tmpCreateInsErr != nil {
 				err = tmpCreateInsErr
 				return
 			}
-			// 初始化workflow并开始
-			workObj := Workflow{ProcRunWorkflow: *subWorkflowRow}
-			workObj.ProcInsId = subProcInsId
-			dataRow.SubProcInsId = subProcInsId
-			workObj.Links = subWorkLinks
-			subWorkflowList = append(subWorkflowList, &workObj)
+			dataRow.SubProcInsId = workObj.ProcInsId
+			subWorkflowList = append(subWorkflowList, workObj)
 			subWorkNodeList = append(subWorkNodeList, subWorkNodes)
-			subProcWorkflowList = append(subProcWorkflowList, &models.ProcRunNodeSubProc{WorkflowId: subWorkflowRow.Id, EntityTypeId: dataRow.EntityTypeId, EntityDataId: dataRow.EntityDataId})
+			subProcWorkflowList = append(subProcWorkflowList, &models.ProcRunNodeSubProc{WorkflowId: workObj.Id, EntityTypeId: dataRow.EntityTypeId, EntityDataId: dataRow.EntityDataId})
 		}
 		if err = database.UpdateProcRunNodeSubProc(ctx, n.Id, subProcWorkflowList, dataBindings); err != nil {
 			err = fmt.Errorf("UpdateProcRunNodeSubProc fail,%s ", err.Error())
@@ -763,7 +747,78 @@ func (n *WorkNode) doSubProcessJob(recoverFlag bool) (output string, err error)
 	return
 }
 
+// getSubProcBindData 查子编排节点定义和绑定数据,dynamicFlag为true时按节点配置重新做动态绑定
+func getSubProcBindData(ctx context.Context, procRunNodeId string, dynamicFlag bool) (procInsNode *models.ProcInsNode, procDefNode *models.ProcDefNode, dataBindings []*models.ProcDataBinding, err error) {
+	procInsNode, procDefNode, _, dataBindings, err = database.GetProcExecNodeData(ctx, procRunNodeId)
+	if err != nil || !dynamicFlag {
+		return
+	}
+	if procDefNode.DynamicBind == 1 {
+		dataBindings, err = database.GetDynamicBindNodeData(ctx, procInsNode.ProcInsId, procDefNode.ProcDefId, procDefNode.BindNodeId)
+		if err != nil {
+			err = fmt.Errorf("get node dynamic bind data fail,%s ", err.Error())
+			return
+		}
+		if len(dataBindings) > 0 {
+			err = database.UpdateDynamicNodeBindData(ctx, procInsNode.ProcInsId, procInsNode.Id, procDefNode.ProcDefId, procDefNode.Id, dataBindings)
+			if err != nil {
+				err = fmt.Errorf("try to update dynamic node binding data fail,%s ", err.Error())
+				return
+			}
+		}
+	} else if procDefNode.DynamicBind == 2 {
+		dataBindings, err = execution.DynamicBindNodeInRuntime(ctx, procInsNode, procDefNode)
+		if err != nil {
+			err = fmt.Errorf("get runtime dynamic bind data fail,%s ", err.Error())
+			return
+		}
+		if len(dataBindings) > 0 {
+			err = database.UpdateDynamicNodeBindData(ctx, procInsNode.ProcInsId, procInsNode.Id, procDefNode.ProcDefId, procDefNode.Id, dataBindings)
+			if err != nil {
+				err = fmt.Errorf("try to update runtime dynamic node binding data fail,%s ", err.Error())
+				return
+			}
+		}
+	}
+	return
+}
+
+// createSubWorkflow 新增子编排的 proc_ins,proc_ins_node,proc_data_binding 纪录并初始化workflow
+func (n *WorkNode) createSubWorkflow(createInsParam *models.ProcInsStartParam, operator string, index int) (workObj *Workflow, subWorkNodes []*models.ProcRunNode, err error) {
+	subProcInsId, subWorkflowRow, subWorkNodes, subWorkLinks, createInsErr := database.CreateProcInstance(context.WithValue(n.Ctx, models.TransactionIdHeader, fmt.Sprintf("%s_%d", n.Id, index)), createInsParam, operator)
+	if createInsErr != nil {
+		err = createInsErr
+		return
+	}
+	workObj = &Workflow{ProcRunWorkflow: *subWorkflowRow}
+	workObj.ProcInsId = subProcInsId
+	workObj.Links = subWorkLinks
+	return
+}
+
+// waitSubProcRunning 恢复时等待还在运行中的子编排结束
+func waitSubProcRunning(ctx context.Context, procRunNodeId string) {
+	t := time.NewTicker(5 * time.Second).C
+	for {
+		<-t
+		runningRows, tmpErr := database.CheckProcSubRunning(ctx, procRunNodeId)
+		if tmpErr != nil {
+			log.WorkflowLogger.Error("doSubProcessJob recover check fail", log.String("procRunNodeId", procRunNodeId), log.Error(tmpErr))
+			continue
+		}
+		if len(runningRows) > 0 {
+			log.WorkflowLogger.Debug("doSubProcessJob recover check continue", log.String("procRunNodeId", procRunNodeId), log.Int("runningSubProcessNum", len(runningRows)))
+			continue
+		}
+		break
+	}
+}
+
 func (n *WorkNode) Callback(message string) {
+	if executor, ok := GetNodeExecutor(n.JobType); ok {
+		executor.Callback(n, message)
+		return
+	}
 	n.callbackChan <- message
 }
 
@@ -790,10 +845,15 @@ func updateWorkflowDB(w *models.ProcRunWorkflow, op *models.ProcOperation) {
 		actions = append(actions, &db.ExecAction{Sql: "update proc_run_workflow set status=?,updated_time=? where id=?", Param: []interface{}{w.Status, nowTime, w.Id}})
 	}
 	actions = append(actions, &db.ExecAction{Sql: "update proc_ins set status=?,updated_by=?,updated_time=? where id=?", Param: []interface{}{w.Status, op.CreatedBy, nowTime, w.ProcInsId}})
+	if models.IsProcInsFinishStatus(w.Status) {
+		actions = append(actions, database.BuildReleaseProcEntityLockAction(w.ProcInsId))
+	}
 	actions = append(actions, &db.ExecAction{Sql: "insert into proc_run_work_record(workflow_id,host,`action`,message,created_by,created_time) values (?,?,?,?,?,?)", Param: []interface{}{w.Id, instanceHost, w.Status, op.Message, op.CreatedBy, nowTime}})
 	if err := db.Transaction(actions, op.Ctx); err != nil {
 		log.WorkflowLogger.Error("record workflow state fail", log.String("workflowId", w.Id), log.Error(err))
+		return
 	}
+	database.AddProcInsTimeline(op.Ctx, &models.ProcInsTimeline{ProcInsId: w.ProcInsId, WorkflowId: w.Id, EventType: models.TimelineEventWorkflow, Status: w.Status, Message: op.Message, Host: instanceHost, CreatedBy: op.CreatedBy, CreatedTime: nowTime})
 }
 
 func updateNodeDB(n *models.ProcRunNode) {
@@ -834,7 +894,13 @@ func updateNodeDB(n *models.ProcRunNode) {
 	err = db.Transaction(actions, context.Background())
 	if err != nil {
 		log.WorkflowLogger.Error("record node state fail", log.String("nodeId", n.Id), log.Error(err))
+		return
+	}
+	timelineEvent := models.ProcInsTimeline{WorkflowId: n.WorkflowId, ProcInsNodeId: n.ProcInsNodeId, ProcRunNodeId: n.Id, NodeName: n.Name, EventType: models.TimelineEventNode, Status: n.Status, Host: instanceHost, CreatedBy: "system", CreatedTime: nowTime}
+	if n.Status != models.JobStatusRunning && n.Status != models.JobStatusSuccess {
+		timelineEvent.Message = n.ErrorMessage
 	}
+	database.AddProcInsTimeline(context.Background(), &timelineEvent)
 }
 
 func getWorkflowRow(workflowId string) (result *models.ProcRunWorkflow, err error) {
@@ -0,0 +1,342 @@
+alter table proc_def_node add column retry_policy text default null comment '自动重试策略';
+
+CREATE TABLE `proc_run_node_retry` (
+      `id` int(11) NOT NULL AUTO_INCREMENT COMMENT '自增id',
+      `workflow_id` varchar(64) NOT NULL COMMENT '工作流id',
+      `proc_run_node_id` varchar(64) NOT NULL COMMENT '任务节点id',
+      `attempt` int(11) NOT NULL COMMENT '第几次执行',
+      `host` varchar(64) DEFAULT NULL COMMENT '执行主机',
+      `error_code` varchar(32) DEFAULT NULL COMMENT '错误类型->network(网络或网关请求失败) | pluginError(插件返回错误) | other(其它)',
+      `error_message` text DEFAULT NULL COMMENT '错误信息',
+      `start_time` datetime DEFAULT NULL COMMENT '执行开始时间',
+      `end_time` datetime DEFAULT NULL COMMENT '执行结束时间',
+      `next_retry_time` datetime DEFAULT NULL COMMENT '下一次重试时间',
+      PRIMARY KEY (`id`),
+      KEY `idx_run_node_retry_node` (`proc_run_node_id`)
+) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+alter table proc_def_node_link add column expression text default null comment '判断分支表达式';
+alter table proc_def_node_link add column is_default bit(1) default b'0' comment '是否判断默认分支';
+
+alter table proc_def_node add column loop_policy text default null comment '循环节点策略';
+
+alter table proc_def_node add column compensate_service varchar(255) default null comment '补偿插件服务';
+
+CREATE TABLE `proc_run_node_compensate` (
+      `id` int(11) NOT NULL AUTO_INCREMENT COMMENT '自增id',
+      `workflow_id` varchar(64) NOT NULL COMMENT '工作流id',
+      `proc_run_node_id` varchar(64) NOT NULL COMMENT '补偿任务节点id',
+      `origin_run_node_id` varchar(64) NOT NULL COMMENT '被补偿的任务节点id',
+      `origin_ins_node_id` varchar(64) NOT NULL COMMENT '被补偿的实例节点id',
+      `compensate_trigger` varchar(32) DEFAULT NULL COMMENT '触发方式->fail(编排失败) | rollback(人工回滚)',
+      `created_by` varchar(64) DEFAULT NULL COMMENT '创建人',
+      `created_time` datetime DEFAULT NULL COMMENT '创建时间',
+      PRIMARY KEY (`id`),
+      KEY `idx_run_node_compensate_wf` (`workflow_id`)
+) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE `proc_ins_simulation` (
+      `proc_ins_id` varchar(64) NOT NULL COMMENT '编排实例id',
+      `mock_data` mediumtext DEFAULT NULL COMMENT '插件服务mock返回',
+      `record_proc_ins_id` varchar(64) DEFAULT NULL COMMENT '录制mock返回的编排实例id',
+      `created_by` varchar(64) DEFAULT NULL COMMENT '创建人',
+      `created_time` datetime DEFAULT NULL COMMENT '创建时间',
+      PRIMARY KEY (`proc_ins_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE `proc_ins_simulation_trace` (
+      `id` int(11) NOT NULL AUTO_INCREMENT COMMENT '自增id',
+      `proc_ins_id` varchar(64) NOT NULL COMMENT '编排实例id',
+      `proc_ins_node_id` varchar(64) DEFAULT NULL COMMENT '编排实例节点id',
+      `node_name` varchar(255) DEFAULT NULL COMMENT '节点名称',
+      `action` varchar(32) DEFAULT NULL COMMENT '动作->plugin(调用插件) | human(创建人工任务) | entityCreate(新增数据) | entityUpdate(修改数据)',
+      `service_name` varchar(255) DEFAULT NULL COMMENT '插件服务名或数据entity',
+      `request` mediumtext DEFAULT NULL COMMENT '本应发出的请求',
+      `response` mediumtext DEFAULT NULL COMMENT 'mock返回',
+      `error_message` text DEFAULT NULL COMMENT '错误信息',
+      `created_time` datetime DEFAULT NULL COMMENT '创建时间',
+      PRIMARY KEY (`id`),
+      KEY `idx_simulation_trace_ins` (`proc_ins_id`)
+) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE `proc_run_timer` (
+      `id` varchar(64) NOT NULL COMMENT '唯一标识',
+      `workflow_id` varchar(64) NOT NULL COMMENT '工作流id',
+      `proc_run_node_id` varchar(64) NOT NULL COMMENT '任务节点id',
+      `proc_ins_id` varchar(64) DEFAULT NULL COMMENT '编排实例id',
+      `node_name` varchar(255) DEFAULT NULL COMMENT '节点名称',
+      `job_type` varchar(32) DEFAULT NULL COMMENT '任务类型->timeInterval(定时) | date(定期) | signal(等待信号超时)',
+      `fire_time` datetime NOT NULL COMMENT '触发时间',
+      `status` varchar(32) NOT NULL COMMENT '状态->wait(等待) | fired(已触发) | canceled(已取消)',
+      `handle_by` varchar(64) DEFAULT NULL COMMENT '触发的主机',
+      `created_time` datetime DEFAULT NULL COMMENT '创建时间',
+      `updated_by` varchar(64) DEFAULT NULL COMMENT '更新人',
+      `updated_time` datetime DEFAULT NULL COMMENT '更新时间',
+      PRIMARY KEY (`id`),
+      KEY `idx_run_timer_status` (`status`,`fire_time`),
+      KEY `idx_run_timer_node` (`proc_run_node_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+alter table proc_def add column variables text default null comment '编排变量定义';
+alter table proc_def_node add column output_mappings text default null comment '出参写入编排变量的映射';
+
+CREATE TABLE `proc_ins_variable` (
+      `id` int(11) NOT NULL AUTO_INCREMENT COMMENT '自增id',
+      `proc_ins_id` varchar(64) NOT NULL COMMENT '编排实例id',
+      `name` varchar(64) NOT NULL COMMENT '变量名',
+      `data_type` varchar(32) NOT NULL COMMENT '数据类型->string | int | bool | object | list',
+      `value` mediumtext DEFAULT NULL COMMENT '变量值json',
+      `source_node` varchar(64) DEFAULT NULL COMMENT '最后写入来源->default | start | 编排实例节点id',
+      `updated_by` varchar(64) DEFAULT NULL COMMENT '更新人',
+      `updated_time` datetime DEFAULT NULL COMMENT '更新时间',
+      PRIMARY KEY (`id`),
+      UNIQUE KEY `uk_proc_ins_variable` (`proc_ins_id`,`name`)
+) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+alter table proc_ins_event add column correlation_key varchar(255) default null comment '关联键';
+alter table proc_ins_event add index idx_ins_event_correlation (event_type,correlation_key);
+
+CREATE TABLE `proc_run_signal` (
+      `id` varchar(64) NOT NULL COMMENT '唯一标识',
+      `workflow_id` varchar(64) NOT NULL COMMENT '工作流id',
+      `proc_run_node_id` varchar(64) NOT NULL COMMENT '任务节点id',
+      `proc_ins_id` varchar(64) DEFAULT NULL COMMENT '编排实例id',
+      `node_name` varchar(255) DEFAULT NULL COMMENT '节点名称',
+      `event_type` varchar(255) NOT NULL COMMENT '事件类型',
+      `correlation_key` varchar(255) DEFAULT NULL COMMENT '关联键',
+      `timer_id` varchar(64) DEFAULT NULL COMMENT '超时定时器id',
+      `status` varchar(32) NOT NULL COMMENT '状态->wait(等待) | received(已收到) | timeout(超时)',
+      `event_id` int(11) DEFAULT NULL COMMENT '匹配的事件id',
+      `payload` mediumtext DEFAULT NULL COMMENT '事件数据',
+      `created_time` datetime DEFAULT NULL COMMENT '创建时间',
+      `updated_by` varchar(64) DEFAULT NULL COMMENT '更新人',
+      `updated_time` datetime DEFAULT NULL COMMENT '更新时间',
+      PRIMARY KEY (`id`),
+      KEY `idx_run_signal_match` (`status`,`event_type`,`correlation_key`),
+      KEY `idx_run_signal_node` (`proc_run_node_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+alter table proc_def add column concurrency_policy varchar(255) default null comment '并发控制->maxRunning,maxRunningPerEntity,queueMode';
+alter table proc_ins_event add column priority int(11) default 0 comment '优先级';
+
+CREATE TABLE `proc_ins_queue` (
+      `id` int(11) NOT NULL AUTO_INCREMENT COMMENT '自增id',
+      `proc_ins_id` varchar(64) NOT NULL COMMENT '编排实例id',
+      `workflow_id` varchar(64) NOT NULL COMMENT '工作流id',
+      `proc_def_id` varchar(64) NOT NULL COMMENT '编排定义id',
+      `proc_def_key` varchar(64) NOT NULL COMMENT '编排定义key',
+      `proc_def_name` varchar(255) DEFAULT NULL COMMENT '编排名称',
+      `entity_data_id` varchar(255) DEFAULT NULL COMMENT '根数据id',
+      `priority` int(11) DEFAULT 0 COMMENT '优先级,数值越大越优先',
+      `status` varchar(32) NOT NULL COMMENT '状态->queued(排队中) | started(已出队启动) | canceled(已取消)',
+      `created_by` varchar(64) DEFAULT NULL COMMENT '创建人',
+      `created_time` datetime DEFAULT NULL COMMENT '创建时间',
+      `updated_by` varchar(64) DEFAULT NULL COMMENT '更新人',
+      `updated_time` datetime DEFAULT NULL COMMENT '更新时间',
+      PRIMARY KEY (`id`),
+      UNIQUE KEY `uk_proc_ins_queue` (`proc_ins_id`),
+      KEY `idx_ins_queue_status` (`status`,`proc_def_key`)
+) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE `proc_ins_migration` (
+      `id` varchar(64) NOT NULL COMMENT '唯一标识',
+      `proc_ins_id` varchar(64) NOT NULL COMMENT '编排实例id',
+      `workflow_id` varchar(64) NOT NULL COMMENT '工作流id',
+      `from_proc_def_id` varchar(64) NOT NULL COMMENT '迁移前编排定义id',
+      `to_proc_def_id` varchar(64) NOT NULL COMMENT '迁移后编排定义id',
+      `node_mapping` text DEFAULT NULL COMMENT '节点映射计划json',
+      `report` mediumtext DEFAULT NULL COMMENT '迁移报告json',
+      `status` varchar(32) NOT NULL COMMENT '状态->wait(等待工作流处理) | done(完成) | fail(失败)',
+      `error_message` text DEFAULT NULL COMMENT '错误信息',
+      `created_by` varchar(64) DEFAULT NULL COMMENT '创建人',
+      `created_time` datetime DEFAULT NULL COMMENT '创建时间',
+      `updated_time` datetime DEFAULT NULL COMMENT '更新时间',
+      PRIMARY KEY (`id`),
+      KEY `idx_ins_migration_ins` (`proc_ins_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE `core_cluster_member` (
+      `host` varchar(64) NOT NULL COMMENT '实例地址',
+      `status` varchar(32) NOT NULL COMMENT '状态->active(正常) | leaving(退出中)',
+      `workflow_num` int(11) DEFAULT 0 COMMENT '内存中运行的工作流数',
+      `busy_node_num` int(11) DEFAULT 0 COMMENT '正在调插件的节点数',
+      `start_time` datetime DEFAULT NULL COMMENT '启动时间',
+      `last_alive_time` datetime DEFAULT NULL COMMENT '最近心跳时间',
+      PRIMARY KEY (`host`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE `proc_ins_timeline` (
+      `id` bigint(20) NOT NULL AUTO_INCREMENT COMMENT '自增id',
+      `proc_ins_id` varchar(64) NOT NULL COMMENT '编排实例id',
+      `workflow_id` varchar(64) DEFAULT NULL COMMENT '工作流id',
+      `proc_ins_node_id` varchar(64) DEFAULT NULL COMMENT '编排实例节点id',
+      `proc_run_node_id` varchar(64) DEFAULT NULL COMMENT '工作流节点id',
+      `node_name` varchar(255) DEFAULT NULL COMMENT '节点名称',
+      `event_type` varchar(32) NOT NULL COMMENT '事件类型->workflow | node | operation | takeover | release | recover | wakeup | retry | plugin_request | plugin_response | breakpoint | approval',
+      `status` varchar(64) DEFAULT NULL COMMENT '事件后的状态或操作名称',
+      `message` text DEFAULT NULL COMMENT '说明,操作原因或错误信息',
+      `ref_id` varchar(64) DEFAULT NULL COMMENT '关联纪录id',
+      `host` varchar(64) DEFAULT NULL COMMENT '处理主机',
+      `created_by` varchar(64) DEFAULT NULL COMMENT '操作人',
+      `created_time` datetime(3) DEFAULT NULL COMMENT '发生时间',
+      PRIMARY KEY (`id`),
+      KEY `idx_ins_timeline_ins` (`proc_ins_id`,`event_type`)
+) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE `proc_breakpoint` (
+      `id` varchar(64) NOT NULL COMMENT '唯一标识',
+      `scope` varchar(32) NOT NULL COMMENT '范围->definition(编排定义) | instance(编排实例)',
+      `proc_def_id` varchar(64) DEFAULT NULL COMMENT '编排定义id',
+      `proc_ins_id` varchar(64) DEFAULT NULL COMMENT '编排实例id',
+      `node_id` varchar(64) NOT NULL COMMENT '编排定义节点nodeId,*表示单步',
+      `created_by` varchar(64) DEFAULT NULL COMMENT '创建人',
+      `created_time` datetime DEFAULT NULL COMMENT '创建时间',
+      PRIMARY KEY (`id`),
+      KEY `idx_breakpoint_def` (`proc_def_id`),
+      KEY `idx_breakpoint_ins` (`proc_ins_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE `proc_run_breakpoint` (
+      `id` varchar(64) NOT NULL COMMENT '唯一标识',
+      `workflow_id` varchar(64) NOT NULL COMMENT '工作流id',
+      `proc_ins_id` varchar(64) NOT NULL COMMENT '编排实例id',
+      `proc_ins_node_id` varchar(64) NOT NULL COMMENT '编排实例节点id',
+      `proc_run_node_id` varchar(64) NOT NULL COMMENT '工作流节点id',
+      `node_name` varchar(255) DEFAULT NULL COMMENT '节点名称',
+      `job_type` varchar(32) DEFAULT NULL COMMENT '节点类型',
+      `status` varchar(32) NOT NULL COMMENT '状态->wait(暂停中) | step(单步) | continue(继续)',
+      `input_override` text DEFAULT NULL COMMENT '修改后的入参json',
+      `created_time` datetime(3) DEFAULT NULL COMMENT '命中时间',
+      `updated_by` varchar(64) DEFAULT NULL COMMENT '处理人',
+      `updated_time` datetime DEFAULT NULL COMMENT '处理时间',
+      PRIMARY KEY (`id`),
+      KEY `idx_run_breakpoint_ins` (`proc_ins_id`,`status`),
+      KEY `idx_run_breakpoint_run_node` (`proc_run_node_id`),
+      KEY `idx_run_breakpoint_ins_node` (`proc_ins_node_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+alter table proc_def_node add column approval_policy text default null comment '人工节点多人审批策略';
+
+CREATE TABLE `proc_run_approval` (
+      `id` varchar(64) NOT NULL COMMENT '唯一标识',
+      `workflow_id` varchar(64) NOT NULL COMMENT '工作流id',
+      `proc_ins_id` varchar(64) NOT NULL COMMENT '编排实例id',
+      `proc_ins_node_id` varchar(64) NOT NULL COMMENT '编排实例节点id',
+      `proc_run_node_id` varchar(64) NOT NULL COMMENT '工作流节点id',
+      `node_name` varchar(255) DEFAULT NULL COMMENT '节点名称',
+      `round` int(11) NOT NULL DEFAULT 1 COMMENT '审批轮次,节点重试时开始新一轮',
+      `approver_type` varchar(32) NOT NULL COMMENT '审批人类型->role | user',
+      `approver` varchar(64) NOT NULL COMMENT '角色名或用户名',
+      `delegate_to` varchar(64) DEFAULT NULL COMMENT '转交给的用户',
+      `escalated_from` varchar(128) DEFAULT NULL COMMENT '升级前的审批人',
+      `status` varchar(32) NOT NULL COMMENT '状态->wait | approve | reject | canceled',
+      `comment` varchar(1024) DEFAULT NULL COMMENT '审批意见',
+      `voted_by` varchar(64) DEFAULT NULL COMMENT '投票人',
+      `reminded_time` datetime DEFAULT NULL COMMENT '最近提醒时间',
+      `created_time` datetime DEFAULT NULL COMMENT '创建时间',
+      `updated_time` datetime DEFAULT NULL COMMENT '更新时间',
+      PRIMARY KEY (`id`),
+      UNIQUE KEY `uk_approval_vote` (`proc_run_node_id`,`round`,`voted_by`),
+      KEY `idx_approval_ins_node` (`proc_ins_node_id`),
+      KEY `idx_approval_ins` (`proc_ins_id`),
+      KEY `idx_approval_status` (`status`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE `business_calendar` (
+      `id` varchar(64) NOT NULL COMMENT '唯一标识',
+      `name` varchar(64) NOT NULL COMMENT '日历名称',
+      `description` varchar(255) DEFAULT NULL COMMENT '描述',
+      `time_zone` varchar(64) DEFAULT NULL COMMENT '时区,为空时用服务器时区',
+      `work_days` varchar(32) DEFAULT NULL COMMENT '工作日,逗号分隔的星期几,0表示周日',
+      `work_hours` varchar(255) DEFAULT NULL COMMENT '工作时间段,为空表示全天',
+      `holidays` text DEFAULT NULL COMMENT '节假日,逗号分隔的日期',
+      `extra_work_dates` text DEFAULT NULL COMMENT '调休上班日,逗号分隔的日期',
+      `maintenance_windows` varchar(1024) DEFAULT NULL COMMENT '维护窗口,分号分隔',
+      `created_by` varchar(64) DEFAULT NULL COMMENT '创建人',
+      `created_time` datetime DEFAULT NULL COMMENT '创建时间',
+      `updated_by` varchar(64) DEFAULT NULL COMMENT '更新人',
+      `updated_time` datetime DEFAULT NULL COMMENT '更新时间',
+      PRIMARY KEY (`id`),
+      UNIQUE KEY `uk_business_calendar_name` (`name`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+alter table proc_schedule_config add column calendar varchar(64) default null comment '业务日历名称';
+
+CREATE TABLE `proc_entity_lock` (
+      `id` int(11) NOT NULL AUTO_INCREMENT COMMENT '自增id',
+      `entity_type_id` varchar(128) NOT NULL COMMENT '数据类型->包名:模型名',
+      `entity_data_id` varchar(255) NOT NULL COMMENT '数据id',
+      `entity_data_name` varchar(255) DEFAULT NULL COMMENT '数据名称',
+      `proc_ins_id` varchar(64) NOT NULL COMMENT '持有锁的编排实例id',
+      `proc_def_id` varchar(64) DEFAULT NULL COMMENT '编排定义id',
+      `proc_def_key` varchar(64) DEFAULT NULL COMMENT '编排定义key',
+      `proc_def_name` varchar(255) DEFAULT NULL COMMENT '编排名称',
+      `lock_mode` varchar(32) DEFAULT NULL COMMENT '加锁方式->reject(直接拒绝) | queue(排队等待) | wait(排队等待,超时结束)',
+      `created_by` varchar(64) DEFAULT NULL COMMENT '创建人',
+      `created_time` datetime DEFAULT NULL COMMENT '加锁时间',
+      PRIMARY KEY (`id`),
+      UNIQUE KEY `uk_proc_entity_lock` (`entity_type_id`,`entity_data_id`),
+      KEY `idx_entity_lock_ins` (`proc_ins_id`)
+) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+insert ignore into proc_entity_lock(entity_type_id,entity_data_id,entity_data_name,proc_ins_id,proc_def_id,proc_def_key,proc_def_name,lock_mode,created_by,created_time)
+select t2.entity_type_id,t2.entity_data_id,max(t2.entity_data_name),t1.id,t1.proc_def_id,t1.proc_def_key,t1.proc_def_name,'reject',t1.created_by,now() from proc_ins t1 join proc_data_binding t2 on t1.id=t2.proc_ins_id join proc_def t3 on t1.proc_def_id=t3.id
+where t1.status='InProgress' and t3.conflict_check=1 and t2.bind_flag=1 and t2.entity_data_id<>'' and t1.id not in (select proc_ins_id from proc_ins_simulation)
+group by t2.entity_type_id,t2.entity_data_id,t1.id,t1.proc_def_id,t1.proc_def_key,t1.proc_def_name,t1.created_by;
+
+CREATE TABLE `proc_ins_clone` (
+      `id` varchar(64) NOT NULL COMMENT '唯一标识',
+      `proc_ins_id` varchar(64) NOT NULL COMMENT '新实例id',
+      `source_proc_ins_id` varchar(64) NOT NULL COMMENT '源实例id',
+      `start_proc_def_node_id` varchar(64) NOT NULL COMMENT '开始运行的节点定义id',
+      `start_node_name` varchar(255) DEFAULT NULL COMMENT '开始运行的节点名称',
+      `reused_nodes` text DEFAULT NULL COMMENT '复用源实例执行结果的节点名称,逗号分隔',
+      `skipped_nodes` text DEFAULT NULL COMMENT '跳过的节点名称,逗号分隔',
+      `created_by` varchar(64) DEFAULT NULL COMMENT '创建人',
+      `created_time` datetime DEFAULT NULL COMMENT '创建时间',
+      PRIMARY KEY (`id`),
+      UNIQUE KEY `uk_proc_ins_clone` (`proc_ins_id`),
+      KEY `idx_ins_clone_source` (`source_proc_ins_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE `proc_ins_bulk_job` (
+      `id` varchar(64) NOT NULL COMMENT '唯一标识',
+      `action` varchar(32) NOT NULL COMMENT '操作->retry | ignoreRisky | approve | stop | continue',
+      `filter` text DEFAULT NULL COMMENT '筛选条件json',
+      `message` varchar(1024) DEFAULT NULL COMMENT '审批意见',
+      `status` varchar(32) NOT NULL COMMENT '状态->running | done',
+      `total_num` int(11) DEFAULT 0 COMMENT '目标总数',
+      `success_num` int(11) DEFAULT 0 COMMENT '成功数',
+      `fail_num` int(11) DEFAULT 0 COMMENT '失败数',
+      `skip_num` int(11) DEFAULT 0 COMMENT '跳过数',
+      `roles` text DEFAULT NULL COMMENT '创建人角色,逗号分隔',
+      `created_by` varchar(64) DEFAULT NULL COMMENT '创建人',
+      `created_time` datetime DEFAULT NULL COMMENT '创建时间',
+      `updated_time` datetime DEFAULT NULL COMMENT '更新时间',
+      PRIMARY KEY (`id`),
+      KEY `idx_bulk_job_status` (`status`,`updated_time`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE `proc_ins_bulk_result` (
+      `id` int(11) NOT NULL AUTO_INCREMENT COMMENT '自增id',
+      `job_id` varchar(64) NOT NULL COMMENT '批量任务id',
+      `proc_ins_id` varchar(64) NOT NULL COMMENT '编排实例id',
+      `proc_def_name` varchar(255) DEFAULT NULL COMMENT '编排名称',
+      `entity_data_name` varchar(255) DEFAULT NULL COMMENT '根数据名称',
+      `proc_ins_node_id` varchar(64) DEFAULT NULL COMMENT '编排实例节点id',
+      `node_name` varchar(255) DEFAULT NULL COMMENT '节点名称',
+      `node_type` varchar(64) DEFAULT NULL COMMENT '节点类型',
+      `status` varchar(32) NOT NULL COMMENT '状态->wait | success | fail | skipped',
+      `message` text DEFAULT NULL COMMENT '失败或跳过的原因',
+      `updated_time` datetime DEFAULT NULL COMMENT '更新时间',
+      PRIMARY KEY (`id`),
+      KEY `idx_bulk_result_job` (`job_id`,`status`)
+) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+alter table proc_ins_event add column match_proc_ins_ids text default null comment '信号事件匹配到的所有编排实例id,逗号分隔';
+
+CREATE TABLE `proc_ins_queue_lock` (
+      `proc_def_key` varchar(64) NOT NULL COMMENT '编排定义key',
+      `created_time` datetime DEFAULT NULL COMMENT '创建时间',
+      PRIMARY KEY (`proc_def_key`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;